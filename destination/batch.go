@@ -0,0 +1,393 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/conduitio/conduit-connector-postgres/destination/internal/writer"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// writeBatch writes the records in a single transaction. Only the last
+// operation for each key is written (see dedupeBatch), upserts into the same
+// table with the same columns are combined into a single multi-row INSERT ...
+// ON CONFLICT statement. Like Write, it blocks while the rate limit is reached
+// and retries the whole batch if it fails with a transient error.
+func (d *Destination) writeBatch(ctx context.Context, records []sdk.Record) error {
+	for range records {
+		if err := d.rateLimiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	records, err := d.generateKeys(records)
+	if err != nil {
+		return err
+	}
+	// the position of the last record is stored even if the record itself is
+	// skipped or superseded
+	lastPosition := records[len(records)-1].Position
+	if d.config.trackPositions || d.window != nil {
+		var written []sdk.Record
+		for _, r := range records {
+			if !d.skipWritten(ctx, r.Position) {
+				written = append(written, r)
+			}
+		}
+		records = written
+		if len(records) == 0 {
+			return nil
+		}
+	}
+	// records superseded in the batch count as written
+	positions := make([]sdk.Position, len(records))
+	for i, r := range records {
+		positions[i] = r.Position
+	}
+	if d.keyOrders != nil {
+		var ordered []sdk.Record
+		for _, r := range records {
+			ok, err := d.checkOrder(ctx, r)
+			if err != nil {
+				return err
+			}
+			if ok {
+				ordered = append(ordered, r)
+			}
+		}
+		records = ordered
+	}
+
+	records, err = d.dedupeBatch(records)
+	if err != nil {
+		return err
+	}
+	if err := d.truncateForLoad(ctx, records); err != nil {
+		return err
+	}
+	if err := d.createHistoryTables(ctx, records); err != nil {
+		return err
+	}
+	if err := d.createHeavyFieldsTables(ctx, records); err != nil {
+		return err
+	}
+
+	// staged snapshots completed in the batch are swapped into their table
+	// before the records following them are written
+	batches, err := d.splitAtSwaps(records)
+	if err != nil {
+		return err
+	}
+	for _, batch := range batches {
+		if err := d.stageForLoad(ctx, batch); err != nil {
+			return err
+		}
+		err = d.retryWrite(ctx, "write batch", func(ctx context.Context) error {
+			return d.writeRecords(ctx, batch, lastPosition, positions)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if d.config.validateWrites {
+		for _, r := range records {
+			if isRowChange(r) {
+				d.validateWrite(ctx, r)
+			}
+		}
+	}
+	return nil
+}
+
+// dedupeBatch removes records that are superseded by a later upsert or delete
+// of the same key in the same table, the remaining records keep their order.
+// If the last record of a key is an upsert, the last delete before it is kept,
+// so the upsert inserts a new row instead of updating the deleted one. With
+// conditionalUpdates, records of a key are never removed if one of them
+// contains the row before the update, since a conditional update only matches
+// the row if the preceding updates were written.
+func (d *Destination) dedupeBatch(records []sdk.Record) ([]sdk.Record, error) {
+	keys := make([]string, len(records))
+	last := make(map[string]int)
+	lastDelete := make(map[string]int)
+	withBefore := make(map[string]bool)
+	for i, r := range records {
+		if !d.isKeyedWrite(r) {
+			continue
+		}
+		key, err := d.batchKey(r)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+		last[key] = i
+		if r.Metadata["action"] == actionDelete {
+			lastDelete[key] = i
+		}
+		if _, ok := r.Metadata[metadataPayloadBefore]; ok && d.config.conditionalUpdates {
+			withBefore[key] = true
+		}
+	}
+
+	deduped := make([]sdk.Record, 0, len(records))
+	for i, r := range records {
+		key := keys[i]
+		if key != "" && !withBefore[key] && last[key] != i {
+			if j, ok := lastDelete[key]; !ok || j != i {
+				continue
+			}
+		}
+		deduped = append(deduped, r)
+	}
+	return deduped, nil
+}
+
+// writeRecords writes the records in a transaction, consecutive upserts are
+// grouped into multi-row statements and consecutive snapshot rows in
+// truncate-and-load mode into COPY statements. If positions are tracked, the
+// last position is stored in the same transaction, as are the positions of all
+// records if dedupWindow is set. If deferConstraints is enabled, deferrable
+// constraints are checked when the transaction is committed.
+func (d *Destination) writeRecords(ctx context.Context, records []sdk.Record, pos sdk.Position, positions []sdk.Position) error {
+	tx, err := d.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // no-op if the transaction is committed
+
+	if d.config.deferConstraints {
+		// foreign keys are checked at commit, so a row can reference a row
+		// written later in the batch
+		if _, err := tx.Exec(ctx, "SET CONSTRAINTS ALL DEFERRED"); err != nil {
+			return fmt.Errorf("failed to defer constraints: %w", err)
+		}
+	}
+
+	// the transaction is open on the connection, so all writes executed on
+	// the connection are part of the transaction
+	var groups []*upsertGroup
+	var loads []*loadGroup
+	flush := func() error {
+		for _, g := range loads {
+			if err := d.execLoad(ctx, g.rows); err != nil {
+				return err
+			}
+		}
+		loads = nil
+		for _, g := range groups {
+			if err := d.execUpsertGroup(ctx, g); err != nil {
+				return err
+			}
+		}
+		groups = nil
+		return nil
+	}
+	for _, r := range records {
+		r, ok, err := d.checkRecordSize(ctx, r)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if d.isLoad(r) || (!d.useMerge && d.isUpsert(r)) {
+			// other writes are executed with write, which writes the heavy
+			// fields and the history
+			if err := d.writeHeavyFields(ctx, r); err != nil {
+				return err
+			}
+			if d.config.writeHistory {
+				if err := d.writeHistory(ctx, r); err != nil {
+					return err
+				}
+			}
+		}
+		if d.isLoad(r) {
+			// snapshot rows are copied after the upserts received before them
+			if len(groups) > 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			row, err := d.prepareLoad(ctx, r)
+			if err != nil {
+				return err
+			}
+			loads = addToLoadGroup(loads, row)
+			continue
+		}
+		if len(loads) > 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if d.useMerge || !d.isUpsert(r) {
+			// other writes could depend on the rows upserted so far
+			if err := flush(); err != nil {
+				return err
+			}
+			if err := d.write(ctx, r); err != nil {
+				return err
+			}
+			continue
+		}
+
+		row, err := d.prepareUpsert(ctx, r)
+		if err != nil {
+			return err
+		}
+		if row.before != nil {
+			// conditional updates are executed one by one, so skipped
+			// updates can be reported
+			if err := flush(); err != nil {
+				return err
+			}
+			if err := d.execUpsert(ctx, r, row); err != nil {
+				return err
+			}
+			continue
+		}
+		groups = addToUpsertGroup(groups, row)
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if d.config.trackPositions {
+		if err := storePosition(ctx, tx, d.config.positionID, pos); err != nil {
+			return err
+		}
+	}
+	if d.window != nil {
+		if err := storeWindow(ctx, tx, d.config.positionID, d.window, positions); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if d.window != nil {
+		for _, p := range positions {
+			d.window.add(p)
+		}
+	}
+	return nil
+}
+
+// isUpsert returns true if the record is written with an upsert, see write.
+func (d *Destination) isUpsert(r sdk.Record) bool {
+	switch r.Metadata["action"] {
+	case actionDelete, actionSchemaChange, actionSequence:
+		return false
+	case actionUpdate:
+		return hasKey(r)
+	default:
+		return hasKey(r) && d.config.keyColumnName != "" && !hasGeneratedKey(r)
+	}
+}
+
+// isKeyedWrite returns true if the record upserts or deletes the row with its
+// key, so it supersedes earlier records with the same key.
+func (d *Destination) isKeyedWrite(r sdk.Record) bool {
+	if r.Metadata["action"] == actionDelete {
+		return hasKey(r)
+	}
+	return d.isUpsert(r)
+}
+
+// batchKey identifies the row written by the record, it consists of the table
+// name and the key encoded as JSON.
+func (d *Destination) batchKey(r sdk.Record) (string, error) {
+	tableName, err := d.getRowTableName(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to get table name for write: %w", err)
+	}
+	key, err := d.getKey(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to get key: %w", err)
+	}
+	// map keys are sorted when encoding to JSON
+	b, err := json.Marshal(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode key: %w", err)
+	}
+	return tableName + "\x00" + string(b), nil
+}
+
+// upsertGroup contains rows that are upserted into the same table with the
+// same columns.
+type upsertGroup struct {
+	id   string
+	rows []upsertRow
+	// keys contains the keys of the rows, see upsertRowKey.
+	keys map[string]bool
+}
+
+// addToUpsertGroup adds the row to the group of rows with the same table and
+// columns, a new group is appended if none exists. The identity and null
+// columns of a row are derived from its table and columns, so all rows of a
+// group share them. Groups are executed in order and a statement can't upsert
+// a row twice, so a row is only added to a group if no group from there on
+// contains its key.
+func addToUpsertGroup(groups []*upsertGroup, row upsertRow) []*upsertGroup {
+	id := strings.Join([]string{
+		row.tableName,
+		row.keyColumnName,
+		strings.Join(sortedFields(row.key), ","),
+		strings.Join(sortedFields(row.payload), ","),
+	}, "\x00")
+	key := upsertRowKey(row)
+	for i := len(groups) - 1; i >= 0; i-- {
+		g := groups[i]
+		if g.keys[key] {
+			break
+		}
+		if g.id == id {
+			g.rows = append(g.rows, row)
+			g.keys[key] = true
+			return groups
+		}
+	}
+	return append(groups, &upsertGroup{
+		id:   id,
+		rows: []upsertRow{row},
+		keys: map[string]bool{key: true},
+	})
+}
+
+// upsertRowKey identifies the row written by the upsert. Maps are formatted
+// with sorted keys, so equal keys result in the same string.
+func upsertRowKey(row upsertRow) string {
+	return row.tableName + "\x00" + fmt.Sprint(row.key)
+}
+
+func (d *Destination) execUpsertGroup(ctx context.Context, g *upsertGroup) error {
+	rows := make([]writer.Row, len(g.rows))
+	for i, row := range g.rows {
+		rows[i] = row.writerRow()
+	}
+	var w writer.BulkWriter = writer.Postgres{}
+	stmt, err := w.BulkUpsert(rows, d.upsertOptions(g.rows[0]))
+	if err != nil {
+		return fmt.Errorf("error formatting query: %w", err)
+	}
+	if _, err := d.execUpsertQuery(ctx, stmt.SQL, stmt.Args, len(g.rows)); err != nil {
+		return fmt.Errorf("insert exec failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestDestination_DedupeBatch(t *testing.T) {
+	is := is.New(t)
+
+	d := &Destination{config: config{tableName: "users", keyColumnName: "id"}}
+	record := func(action string, id int, table string) sdk.Record {
+		r := sdk.Record{
+			Position: sdk.Position(action),
+			Metadata: map[string]string{"action": action},
+			Key:      sdk.StructuredData{"id": id},
+			Payload:  sdk.StructuredData{"id": id},
+		}
+		if table != "" {
+			r.Metadata["table"] = table
+		}
+		return r
+	}
+	keyless := sdk.Record{
+		Metadata: map[string]string{"action": actionInsert},
+		Payload:  sdk.StructuredData{"name": "foo"},
+	}
+
+	got, err := d.dedupeBatch([]sdk.Record{
+		record(actionInsert, 1, ""),
+		keyless,
+		record(actionUpdate, 2, ""),
+		record(actionUpdate, 1, ""),
+		record(actionInsert, 1, "admins"),
+		record(actionDelete, 2, ""),
+		keyless,
+	})
+	is.NoErr(err)
+	is.Equal(got, []sdk.Record{
+		keyless,
+		record(actionUpdate, 1, ""),
+		record(actionInsert, 1, "admins"),
+		record(actionDelete, 2, ""),
+		keyless,
+	})
+}
+
+func TestDestination_DedupeBatch_DeleteAndBefore(t *testing.T) {
+	is := is.New(t)
+
+	d := &Destination{config: config{tableName: "users", keyColumnName: "id", conditionalUpdates: true}}
+	record := func(action string, id int, name string) sdk.Record {
+		return sdk.Record{
+			Position: sdk.Position(action + name),
+			Metadata: map[string]string{"action": action},
+			Key:      sdk.StructuredData{"id": id},
+			Payload:  sdk.StructuredData{"id": id, "name": name},
+		}
+	}
+	withBefore := func(r sdk.Record, name string) sdk.Record {
+		r.Metadata[metadataPayloadBefore] = `{"id":2,"name":"` + name + `"}`
+		return r
+	}
+
+	got, err := d.dedupeBatch([]sdk.Record{
+		record(actionUpdate, 1, "a"),
+		record(actionDelete, 1, ""),
+		record(actionInsert, 1, "b"),
+		record(actionUpdate, 1, "c"),
+		withBefore(record(actionUpdate, 2, "y"), "x"),
+		withBefore(record(actionUpdate, 2, "z"), "y"),
+	})
+	is.NoErr(err)
+	is.Equal(got, []sdk.Record{
+		// the row is deleted and inserted again
+		record(actionDelete, 1, ""),
+		record(actionUpdate, 1, "c"),
+		// conditional updates are all written
+		withBefore(record(actionUpdate, 2, "y"), "x"),
+		withBefore(record(actionUpdate, 2, "z"), "y"),
+	})
+}
+
+func TestDestination_DedupeBatch_BeforeWithoutConditionalUpdates(t *testing.T) {
+	is := is.New(t)
+
+	d := &Destination{config: config{tableName: "users", keyColumnName: "id"}}
+	update := func(before, after string) sdk.Record {
+		return sdk.Record{
+			Position: sdk.Position(after),
+			Metadata: map[string]string{
+				"action":              actionUpdate,
+				metadataPayloadBefore: `{"id":1,"name":"` + before + `"}`,
+			},
+			Key:     sdk.StructuredData{"id": 1},
+			Payload: sdk.StructuredData{"id": 1, "name": after},
+		}
+	}
+
+	// the rows before the updates are ignored, so only the last update is
+	// written, two updates of the row can't be part of one statement
+	got, err := d.dedupeBatch([]sdk.Record{
+		update("x", "y"),
+		update("y", "z"),
+	})
+	is.NoErr(err)
+	is.Equal(got, []sdk.Record{update("y", "z")})
+}
+
+func TestAddToUpsertGroup(t *testing.T) {
+	is := is.New(t)
+
+	row := func(table string, id int, payload sdk.StructuredData) upsertRow {
+		return upsertRow{
+			key:           sdk.StructuredData{"id": id},
+			payload:       payload,
+			keyColumnName: "id",
+			tableName:     table,
+		}
+	}
+
+	var groups []*upsertGroup
+	groups = addToUpsertGroup(groups, row("users", 1, sdk.StructuredData{"name": "foo"}))
+	groups = addToUpsertGroup(groups, row("users", 2, sdk.StructuredData{"name": "foo", "email": "foo@example.com"}))
+	groups = addToUpsertGroup(groups, row("admins", 1, sdk.StructuredData{"name": "foo"}))
+	groups = addToUpsertGroup(groups, row("users", 3, sdk.StructuredData{"name": "bar"}))
+	is.Equal(len(groups), 3)
+	is.Equal(len(groups[0].rows), 2)
+	is.Equal(len(groups[1].rows), 1)
+	is.Equal(len(groups[2].rows), 1)
+}
+
+func TestAddToUpsertGroup_SameKey(t *testing.T) {
+	is := is.New(t)
+
+	row := func(id int, payload sdk.StructuredData) upsertRow {
+		return upsertRow{
+			key:           sdk.StructuredData{"id": id},
+			payload:       payload,
+			keyColumnName: "id",
+			tableName:     "users",
+		}
+	}
+
+	var groups []*upsertGroup
+	groups = addToUpsertGroup(groups, row(1, sdk.StructuredData{"name": "foo"}))
+	groups = addToUpsertGroup(groups, row(1, sdk.StructuredData{"email": "foo@example.com"}))
+	// the group of the first row is followed by a group with the same key
+	groups = addToUpsertGroup(groups, row(1, sdk.StructuredData{"name": "bar"}))
+	groups = addToUpsertGroup(groups, row(2, sdk.StructuredData{"name": "baz"}))
+	is.Equal(len(groups), 3)
+	is.Equal(groups[0].rows, []upsertRow{row(1, sdk.StructuredData{"name": "foo"})})
+	is.Equal(groups[1].rows, []upsertRow{row(1, sdk.StructuredData{"email": "foo@example.com"})})
+	is.Equal(groups[2].rows, []upsertRow{
+		row(1, sdk.StructuredData{"name": "bar"}),
+		row(2, sdk.StructuredData{"name": "baz"}),
+	})
+}
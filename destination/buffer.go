@@ -0,0 +1,559 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// diskBuffer is a bounded queue of records that is persisted in a file, so
+// records that were accepted but not yet written into the database survive a
+// restart. Each record is stored as a frame containing the length of the
+// record encoded as a big endian uint32 followed by the record encoded as
+// JSON. The file is synced after each appended record.
+//
+// Removed records are not deleted from the file right away, the file is
+// truncated once the buffer is empty and rewritten with the remaining records
+// after as many records were removed as the buffer can hold.
+type diskBuffer struct {
+	m    sync.Mutex
+	path string
+	file *os.File
+	max  int
+
+	// entries are the records in the buffer, the oldest record first.
+	entries []bufferEntry
+	// removed is the number of records removed since the file was last
+	// truncated or rewritten.
+	removed int
+	// changed is closed and replaced each time records are added or removed.
+	changed chan struct{}
+}
+
+// bufferEntry is a record in the buffer.
+type bufferEntry struct {
+	record sdk.Record
+	// ack acknowledges the record, it is nil for records that were loaded
+	// from the file, since they were received by a previous run.
+	ack sdk.AckFunc
+	// frame is the record as stored in the file.
+	frame []byte
+}
+
+// bufferedRecord is the representation of a record in the buffer file.
+type bufferedRecord struct {
+	Position  []byte            `json:"position"`
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Key       []byte            `json:"key"`
+	Payload   []byte            `json:"payload"`
+}
+
+// openDiskBuffer opens the buffer stored in the file at path, the file is
+// created if it doesn't exist. Records left in the file by a previous run are
+// loaded, an incomplete record at the end of the file (e.g. because of a crash
+// while it was written) is dropped.
+func openDiskBuffer(ctx context.Context, path string, max int) (*diskBuffer, error) {
+	b := &diskBuffer{
+		path:    path,
+		max:     max,
+		changed: make(chan struct{}),
+	}
+
+	complete, err := b.load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load buffer file %s: %w", path, err)
+	}
+	if !complete {
+		sdk.Logger(ctx).Warn().
+			Str("path", path).
+			Int("records", len(b.entries)).
+			Msg("buffer file ends with an incomplete record, dropping it")
+		// rewrite the file so new records are not appended after the
+		// incomplete one
+		if err := b.rewrite(); err != nil {
+			return nil, err
+		}
+	} else {
+		b.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open buffer file %s: %w", path, err)
+		}
+	}
+	if len(b.entries) > 0 {
+		sdk.Logger(ctx).Info().
+			Str("path", path).
+			Int("records", len(b.entries)).
+			Msg("loaded records left in buffer by previous run, they are written first")
+	}
+	return b, nil
+}
+
+// load reads the records from the buffer file. It returns false if the file
+// ends with an incomplete record.
+func (b *diskBuffer) load() (bool, error) {
+	f, err := os.Open(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return true, nil
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return false, nil
+			}
+			return false, err
+		}
+		frame := make([]byte, 4+binary.BigEndian.Uint32(header[:]))
+		copy(frame, header[:])
+		if _, err := io.ReadFull(r, frame[4:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return false, nil
+			}
+			return false, err
+		}
+		rec, err := decodeBufferedRecord(frame[4:])
+		if err != nil {
+			return false, err
+		}
+		b.entries = append(b.entries, bufferEntry{record: rec, frame: frame})
+	}
+}
+
+// Append stores the record in the buffer. It blocks until the buffer has room
+// for the record or the context is canceled. The ack function is returned
+// with the record by Peek.
+func (b *diskBuffer) Append(ctx context.Context, r sdk.Record, ack sdk.AckFunc) error {
+	frame, err := encodeBufferedRecord(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+
+	if err := b.waitLocked(ctx, func() bool { return len(b.entries) < b.max }); err != nil {
+		return err
+	}
+	defer b.m.Unlock()
+
+	if _, err := b.file.Write(frame); err != nil {
+		return fmt.Errorf("failed to write record into buffer file %s: %w", b.path, err)
+	}
+	if err := b.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync buffer file %s: %w", b.path, err)
+	}
+	b.entries = append(b.entries, bufferEntry{record: r, ack: ack, frame: frame})
+	b.broadcastLocked()
+	return nil
+}
+
+// Peek returns up to n of the oldest records in the buffer without removing
+// them. It blocks until the buffer contains a record or the context is
+// canceled, it doesn't wait for n records.
+func (b *diskBuffer) Peek(ctx context.Context, n int) ([]bufferEntry, error) {
+	if err := b.waitLocked(ctx, func() bool { return len(b.entries) > 0 }); err != nil {
+		return nil, err
+	}
+	defer b.m.Unlock()
+	if n > len(b.entries) {
+		n = len(b.entries)
+	}
+	entries := make([]bufferEntry, n)
+	copy(entries, b.entries)
+	return entries, nil
+}
+
+// Pop removes the n oldest records from the buffer.
+func (b *diskBuffer) Pop(n int) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if n > len(b.entries) {
+		n = len(b.entries)
+	}
+	if n == 0 {
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		b.entries[i] = bufferEntry{} // release the record
+	}
+	b.entries = b.entries[n:]
+	b.removed += n
+	b.broadcastLocked()
+
+	switch {
+	case len(b.entries) == 0:
+		// writes go to the end of the file because of O_APPEND, so the file
+		// can be truncated in place
+		if err := b.file.Truncate(0); err != nil {
+			return fmt.Errorf("failed to truncate buffer file %s: %w", b.path, err)
+		}
+		b.removed = 0
+	case b.removed >= b.max:
+		return b.rewrite()
+	}
+	return nil
+}
+
+// Drain removes all records from the buffer and returns them.
+func (b *diskBuffer) Drain() ([]bufferEntry, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	entries := b.entries
+	b.entries = nil
+	b.broadcastLocked()
+	if err := b.file.Truncate(0); err != nil {
+		return entries, fmt.Errorf("failed to truncate buffer file %s: %w", b.path, err)
+	}
+	b.removed = 0
+	return entries, nil
+}
+
+// WaitEmpty blocks until all records were removed from the buffer or the
+// context is canceled.
+func (b *diskBuffer) WaitEmpty(ctx context.Context) error {
+	if err := b.waitLocked(ctx, func() bool { return len(b.entries) == 0 }); err != nil {
+		return err
+	}
+	b.m.Unlock()
+	return nil
+}
+
+// Pending returns the records in the buffer that still need to be
+// acknowledged. The records are kept in the file, so they are written after a
+// restart.
+func (b *diskBuffer) Pending() []bufferEntry {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	var pending []bufferEntry
+	for i, e := range b.entries {
+		if e.ack != nil {
+			pending = append(pending, e)
+			// the record is acknowledged by the caller
+			b.entries[i].ack = nil
+		}
+	}
+	return pending
+}
+
+// Close closes the buffer file.
+func (b *diskBuffer) Close() error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.file.Close()
+}
+
+// rewrite replaces the buffer file with a file that only contains the records
+// in the buffer. It should be called while holding the lock.
+func (b *diskBuffer) rewrite() error {
+	tmpPath := b.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create buffer file %s: %w", tmpPath, err)
+	}
+	w := bufio.NewWriter(tmp)
+	for _, e := range b.entries {
+		if _, err := w.Write(e.frame); err != nil {
+			_ = tmp.Close()
+			return fmt.Errorf("failed to write buffer file %s: %w", tmpPath, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write buffer file %s: %w", tmpPath, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to sync buffer file %s: %w", tmpPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close buffer file %s: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, b.path); err != nil {
+		return fmt.Errorf("failed to replace buffer file %s: %w", b.path, err)
+	}
+
+	if b.file != nil {
+		_ = b.file.Close()
+	}
+	b.file, err = os.OpenFile(b.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open buffer file %s: %w", b.path, err)
+	}
+	b.removed = 0
+	return nil
+}
+
+// waitLocked blocks until cond returns true or the context is canceled. cond
+// is called while holding the lock, if no error is returned the lock is still
+// held and needs to be released by the caller.
+func (b *diskBuffer) waitLocked(ctx context.Context, cond func() bool) error {
+	for {
+		b.m.Lock()
+		if cond() {
+			return nil
+		}
+		changed := b.changed
+		b.m.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// broadcastLocked wakes up all goroutines waiting for a change of the buffer.
+// It should be called while holding the lock.
+func (b *diskBuffer) broadcastLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// encodeBufferedRecord encodes the record into a frame of the buffer file.
+func encodeBufferedRecord(r sdk.Record) ([]byte, error) {
+	br := bufferedRecord{
+		Position:  r.Position,
+		Metadata:  r.Metadata,
+		CreatedAt: r.CreatedAt,
+	}
+	if r.Key != nil {
+		br.Key = r.Key.Bytes()
+	}
+	if r.Payload != nil {
+		br.Payload = r.Payload.Bytes()
+	}
+	raw, err := json.Marshal(br)
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]byte, 4+len(raw))
+	binary.BigEndian.PutUint32(frame, uint32(len(raw)))
+	copy(frame[4:], raw)
+	return frame, nil
+}
+
+// decodeBufferedRecord decodes a record stored in the buffer file. Key and
+// payload are restored as raw data, the destination parses both the same way.
+func decodeBufferedRecord(raw []byte) (sdk.Record, error) {
+	var br bufferedRecord
+	if err := json.Unmarshal(raw, &br); err != nil {
+		return sdk.Record{}, fmt.Errorf("failed to decode buffered record: %w", err)
+	}
+	r := sdk.Record{
+		Position:  br.Position,
+		Metadata:  br.Metadata,
+		CreatedAt: br.CreatedAt,
+	}
+	if len(br.Key) > 0 {
+		r.Key = sdk.RawData(br.Key)
+	}
+	if len(br.Payload) > 0 {
+		r.Payload = sdk.RawData(br.Payload)
+	}
+	return r, nil
+}
+
+const (
+	drainInitialBackoff = time.Second
+	drainMaxBackoff     = 30 * time.Second
+)
+
+// WriteAsync appends the record to the disk buffer, it is written into the
+// database by a background goroutine and acknowledged once it is committed.
+// If no buffer is configured, sdk.ErrUnimplemented is returned and the SDK
+// falls back to Write.
+func (d *Destination) WriteAsync(ctx context.Context, r sdk.Record, ack sdk.AckFunc) error {
+	if d.buffer == nil {
+		return sdk.ErrUnimplemented
+	}
+	if err := d.drainError(); err != nil {
+		return err
+	}
+	return d.buffer.Append(ctx, r, ack)
+}
+
+// Flush blocks until all buffered records are written into the database.
+func (d *Destination) Flush(ctx context.Context) error {
+	if d.buffer == nil {
+		return nil
+	}
+	if err := d.buffer.WaitEmpty(ctx); err != nil {
+		return err
+	}
+	return d.drainError()
+}
+
+// startDrain starts the goroutine writing buffered records into the database.
+// The goroutine is detached from the context, so it keeps running until
+// stopDrain is called.
+func (d *Destination) startDrain(ctx context.Context) {
+	ctx, cancel := context.WithCancel(sdk.Logger(ctx).WithContext(context.Background()))
+	d.drainCancel = cancel
+	d.drainDone = make(chan struct{})
+	go func() {
+		defer close(d.drainDone)
+		d.drain(ctx)
+	}()
+}
+
+// stopDrain stops the drain goroutine and waits for it to return. Records
+// that were not written yet are acknowledged with an error, they stay in the
+// buffer file and are written after a restart.
+func (d *Destination) stopDrain(ctx context.Context) {
+	if d.drainCancel == nil {
+		return
+	}
+	d.drainCancel()
+	<-d.drainDone
+
+	pending := d.buffer.Pending()
+	if len(pending) > 0 {
+		sdk.Logger(ctx).Warn().
+			Int("records", len(pending)).
+			Msg("destination stopped before all buffered records were written, they are written after a restart")
+	}
+	for _, e := range pending {
+		_ = e.ack(errors.New("destination stopped before the record was written"))
+	}
+}
+
+// drain writes the buffered records into the database in the order they were
+// received and acknowledges each record once it is written. If batchSize is
+// greater than 1, up to batchSize buffered records are written together with
+// writeBatch. If writeConcurrency is greater than 1, up to batchSize records
+// per worker are written concurrently, see writeConcurrently, and
+// acknowledged once all of them are written. Records failing with a retryable
+// error (e.g. because the database is unreachable) are retried until they are
+// written, with a growing backoff. If a record fails with any other error, the
+// record and all remaining buffered records are acknowledged with the error
+// and the destination stops accepting records.
+func (d *Destination) drain(ctx context.Context) {
+	backoff := drainInitialBackoff
+	// written marks the peeked records already written by a worker, the
+	// buffer only grows at the end, so retries peek the same records first
+	var written []bool
+	for {
+		entries, err := d.buffer.Peek(ctx, d.config.batchSize*d.config.writeConcurrency)
+		if err != nil {
+			return // context canceled
+		}
+
+		records := make([]sdk.Record, len(entries))
+		for i, e := range entries {
+			records[i] = e.record
+		}
+		switch {
+		case len(d.workers) > 0:
+			for len(written) < len(records) {
+				written = append(written, false)
+			}
+			err = d.writeConcurrently(ctx, records, written)
+		case len(records) == 1:
+			err = d.Write(ctx, records[0])
+		default:
+			err = d.writeBatch(ctx, records)
+		}
+		switch {
+		case err == nil:
+			backoff = drainInitialBackoff
+			written = nil
+			if err := d.buffer.Pop(len(entries)); err != nil {
+				d.failDrain(ctx, err)
+				return
+			}
+			for _, e := range entries {
+				if e.ack != nil {
+					_ = e.ack(nil)
+				}
+			}
+		case ctx.Err() != nil:
+			return
+		case d.retry.Retryable(err):
+			sdk.Logger(ctx).Warn().Err(err).
+				Bytes("position", entries[0].record.Position).
+				Int("records", len(entries)).
+				Dur("backoff", backoff).
+				Msg("failed to write buffered records, keeping them in the buffer and retrying")
+			if err := sleep(ctx, backoff); err != nil {
+				return
+			}
+			backoff *= 2
+			if backoff > drainMaxBackoff {
+				backoff = drainMaxBackoff
+			}
+		default:
+			d.failDrain(ctx, fmt.Errorf("failed to write buffered record: %w", err))
+			return
+		}
+	}
+}
+
+// failDrain stores the error and acknowledges all buffered records with it.
+func (d *Destination) failDrain(ctx context.Context, err error) {
+	d.drainM.Lock()
+	d.drainErr = err
+	d.drainM.Unlock()
+
+	sdk.Logger(ctx).Error().Err(err).Msg("stopped writing buffered records")
+	entries, drainErr := d.buffer.Drain()
+	if drainErr != nil {
+		sdk.Logger(ctx).Error().Err(drainErr).Msg("failed to clear buffer")
+	}
+	for _, e := range entries {
+		if e.ack != nil {
+			_ = e.ack(err)
+		}
+	}
+}
+
+// drainError returns the error that stopped the drain goroutine.
+func (d *Destination) drainError() error {
+	d.drainM.Lock()
+	defer d.drainM.Unlock()
+	return d.drainErr
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
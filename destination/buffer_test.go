@@ -0,0 +1,152 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func testRecord(i int) sdk.Record {
+	return sdk.Record{
+		Position:  sdk.Position(fmt.Sprintf("%d", i)),
+		Metadata:  map[string]string{"action": "insert"},
+		CreatedAt: time.Date(2022, 3, 1, 0, 0, i, 0, time.UTC),
+		Key:       sdk.RawData(fmt.Sprintf(`{"id":%d}`, i)),
+		Payload:   sdk.RawData(fmt.Sprintf(`{"id":%d,"name":"foo"}`, i)),
+	}
+}
+
+func TestDiskBuffer_Reopen(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "buffer")
+
+	b, err := openDiskBuffer(ctx, path, 10)
+	is.NoErr(err)
+	for i := 1; i <= 3; i++ {
+		is.NoErr(b.Append(ctx, testRecord(i), func(error) error { return nil }))
+	}
+	is.NoErr(b.Pop(1))
+	is.NoErr(b.Close())
+
+	// the removed record is still in the file, it's only dropped once the
+	// buffer is empty, so the remaining records are loaded after it
+	b, err = openDiskBuffer(ctx, path, 10)
+	is.NoErr(err)
+	defer b.Close()
+	is.Equal(len(b.entries), 3)
+	for i, e := range b.entries {
+		is.Equal(e.record, testRecord(i+1))
+		is.Equal(e.ack, nil)
+	}
+}
+
+func TestDiskBuffer_TruncateWhenEmpty(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "buffer")
+
+	b, err := openDiskBuffer(ctx, path, 10)
+	is.NoErr(err)
+	defer b.Close()
+	is.NoErr(b.Append(ctx, testRecord(1), nil))
+	is.NoErr(b.Pop(1))
+
+	info, err := os.Stat(path)
+	is.NoErr(err)
+	is.Equal(info.Size(), int64(0))
+}
+
+func TestDiskBuffer_Rewrite(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "buffer")
+
+	b, err := openDiskBuffer(ctx, path, 2)
+	is.NoErr(err)
+	is.NoErr(b.Append(ctx, testRecord(1), nil))
+	is.NoErr(b.Append(ctx, testRecord(2), nil))
+	is.NoErr(b.Pop(1))
+	is.NoErr(b.Append(ctx, testRecord(3), nil))
+	is.NoErr(b.Pop(1)) // second removed record, the file is rewritten
+	is.NoErr(b.Close())
+
+	b, err = openDiskBuffer(ctx, path, 2)
+	is.NoErr(err)
+	defer b.Close()
+	is.Equal(len(b.entries), 1)
+	is.Equal(b.entries[0].record, testRecord(3))
+}
+
+func TestDiskBuffer_IncompleteRecord(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "buffer")
+
+	frame, err := encodeBufferedRecord(testRecord(1))
+	is.NoErr(err)
+	incomplete, err := encodeBufferedRecord(testRecord(2))
+	is.NoErr(err)
+	is.NoErr(os.WriteFile(path, append(frame, incomplete[:10]...), 0o600))
+
+	b, err := openDiskBuffer(ctx, path, 10)
+	is.NoErr(err)
+	is.Equal(len(b.entries), 1)
+	is.NoErr(b.Append(ctx, testRecord(3), nil))
+	is.NoErr(b.Close())
+
+	b, err = openDiskBuffer(ctx, path, 10)
+	is.NoErr(err)
+	defer b.Close()
+	is.Equal(len(b.entries), 2)
+	is.Equal(b.entries[0].record, testRecord(1))
+	is.Equal(b.entries[1].record, testRecord(3))
+}
+
+func TestDiskBuffer_Full(t *testing.T) {
+	is := is.New(t)
+	path := filepath.Join(t.TempDir(), "buffer")
+
+	b, err := openDiskBuffer(context.Background(), path, 1)
+	is.NoErr(err)
+	defer b.Close()
+	is.NoErr(b.Append(context.Background(), testRecord(1), nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = b.Append(ctx, testRecord(2), nil)
+	is.Equal(err, context.DeadlineExceeded)
+
+	// removing a record makes room for the next one
+	done := make(chan error)
+	go func() {
+		done <- b.Append(context.Background(), testRecord(2), nil)
+	}()
+	is.NoErr(b.Pop(1))
+	is.NoErr(<-done)
+
+	entries, err := b.Peek(context.Background(), 2)
+	is.NoErr(err)
+	is.Equal(len(entries), 1)
+	is.Equal(entries[0].record, testRecord(2))
+}
@@ -0,0 +1,817 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/conduitio/conduit-connector-postgres/destination/internal/writer"
+	"github.com/conduitio/conduit-connector-postgres/retry"
+	"github.com/conduitio/conduit-connector-postgres/session"
+	"github.com/conduitio/conduit-connector-postgres/stats"
+)
+
+const (
+	ConfigKeyURL                    = "url"
+	ConfigKeyTable                  = "table"
+	ConfigKeySchema                 = "schema"
+	ConfigKeyKeyColumnName          = "keyColumnName"
+	ConfigKeyGenerateKey            = "generateKey"
+	ConfigKeyDedupColumn            = "dedupColumn"
+	ConfigKeyRouteToPartitions      = "routeToPartitions"
+	ConfigKeyShardCount             = "shardCount"
+	ConfigKeyOverridingSystemValue  = "overridingSystemValue"
+	ConfigKeyJSONMergeColumns       = "jsonMergeColumns"
+	ConfigKeyDialect                = "dialect"
+	ConfigKeyCreateKeyIndex         = "createKeyIndex"
+	ConfigKeyTrackPositions         = "trackPositions"
+	ConfigKeyPositionID             = "positionId"
+	ConfigKeyDedupWindow            = "dedupWindow"
+	ConfigKeyWriteHistory           = "writeHistory"
+	ConfigKeyMaxRecordsPerSecond    = "maxRecordsPerSecond"
+	ConfigKeyMaxConcurrentWrites    = "maxConcurrentWrites"
+	ConfigKeyFlattenObjects         = "flattenObjects"
+	ConfigKeyFlattenSeparator       = "flattenSeparator"
+	ConfigKeyUpsertMethod           = "upsertMethod"
+	ConfigKeyIncludeFields          = "includeFields"
+	ConfigKeyExcludeFields          = "excludeFields"
+	ConfigKeyValidateWrites         = "validateWrites"
+	ConfigKeyConditionalUpdates     = "conditionalUpdates"
+	ConfigKeyFieldNameConversion    = "fieldNameConversion"
+	ConfigKeyTreatMissingAsNull     = "treatMissingAsNull"
+	ConfigKeyConflictTarget         = "conflictTarget"
+	ConfigKeyBufferPath             = "bufferPath"
+	ConfigKeyBufferMaxRecords       = "bufferMaxRecords"
+	ConfigKeyBatchSize              = "batchSize"
+	ConfigKeyWriteConcurrency       = "writeConcurrency"
+	ConfigKeyLoadMode               = "loadMode"
+	ConfigKeyDeferConstraints       = "deferConstraints"
+	ConfigKeyTxIsolationLevel       = "txIsolationLevel"
+	ConfigKeyInitSQL                = "initSQL"
+	ConfigKeyTeardownSQL            = "teardownSQL"
+	ConfigKeySessionReplicationRole = "sessionReplicationRole"
+	ConfigKeyHeavyFields            = "heavyFields"
+	ConfigKeyHeavyFieldsMode        = "heavyFieldsMode"
+	ConfigKeyCountRows              = "countRows"
+	ConfigKeyHealthCheck            = "healthCheck"
+	ConfigKeyTimestampLayouts       = "timestampLayouts"
+	ConfigKeyAssumeTimezone         = "assumeTimezone"
+	ConfigKeyStrictTimestamps       = "strictTimestamps"
+	ConfigKeyMaxIdleTime            = "maxIdleTime"
+	ConfigKeyWriteTimeout           = "writeTimeout"
+	ConfigKeyUpdateColumns          = "updateColumns"
+	ConfigKeyExcludeFromUpdate      = "excludeFromUpdate"
+	ConfigKeyDryRun                 = "dryRun"
+	ConfigKeyDryRunPath             = "dryRunPath"
+	ConfigKeyMaxRecordSize          = "maxRecordSize"
+	ConfigKeyOversizedRecords       = "oversizedRecords"
+	ConfigKeyOverflowColumn         = "overflowColumn"
+	ConfigKeyDeadLetterTable        = "deadLetterTable"
+	ConfigKeyOutOfOrderRecords      = "outOfOrderRecords"
+	ConfigKeySetCreatedAtColumn     = "setCreatedAtColumn"
+	ConfigKeySetUpdatedAtColumn     = "setUpdatedAtColumn"
+
+	// ConfigKeyColumnMappingPrefix is the prefix of column mapping keys, the
+	// full key has the format "columnMapping.<path>" and its value is the
+	// column the value at the path is written into.
+	ConfigKeyColumnMappingPrefix = "columnMapping."
+	// ConfigKeyColumnExpressionPrefix is the prefix of column expression
+	// keys, the full key has the format "columnExpression.<column>" and its
+	// value is the SQL expression the value of the column is written with.
+	ConfigKeyColumnExpressionPrefix = "columnExpression."
+
+	DefaultFlattenSeparator = "_"
+	DefaultBufferMaxRecords = 10000
+	DefaultBatchSize        = 1
+	DefaultWriteConcurrency = 1
+)
+
+type config struct {
+	url           string
+	tableName     string
+	keyColumnName string
+	// generateKey determines how the key of inserted records without a key
+	// is generated, no key is generated if empty.
+	generateKey KeyGeneration
+	// schema qualifies table names that don't contain a schema, if empty the
+	// table is looked up using the search_path of the session.
+	schema string
+
+	// dedupColumn is the name of the column that stores a hash of the whole
+	// record. If set, inserts into keyless tables skip records whose hash is
+	// already stored, which requires a unique index on that column.
+	dedupColumn string
+	// routeToPartitions makes the destination write directly into the child
+	// partition of a partitioned table instead of the parent table.
+	routeToPartitions bool
+	// shardCount is the number of shards rows are spread across by the hash
+	// of their key, each shard is a table with the shard number appended to
+	// its name. 0 disables sharding.
+	shardCount int
+	// overridingSystemValue makes the destination write values into identity
+	// columns declared as GENERATED ALWAYS instead of skipping them.
+	overridingSystemValue bool
+	// jsonMergeColumns are jsonb columns that get merged with the existing
+	// document on upsert instead of being replaced.
+	jsonMergeColumns []string
+	// dialect adjusts the generated SQL to the target database.
+	dialect Dialect
+	// createKeyIndex makes the destination create a unique index on the key
+	// column of the configured table when it's opened, if none exists.
+	createKeyIndex bool
+	// trackPositions makes the destination store the position of the last
+	// written record in the same transaction as the record and skip already
+	// written records after a restart.
+	trackPositions bool
+	// positionID identifies the destination in the position table and the
+	// window table.
+	positionID string
+	// dedupWindow is the number of recently written record positions stored
+	// in the same transaction as the records, records whose position is
+	// among them are skipped. 0 disables the window.
+	dedupWindow int
+	// writeHistory makes the destination mirror each applied change into
+	// the table <table>_history in the same transaction as the change.
+	writeHistory bool
+	// maxRecordsPerSecond limits the number of records written per second,
+	// 0 means no limit.
+	maxRecordsPerSecond int
+	// maxConcurrentWrites limits the number of workers writing at the same
+	// time, 0 means no limit. It requires writeConcurrency, the SDK calls
+	// Write sequentially, so there is nothing to limit without workers.
+	maxConcurrentWrites int
+	// retry controls how writes failing with a transient error are retried.
+	retry retry.Config
+	// session contains settings applied to the Postgres session.
+	session session.Config
+	// statsInterval is the interval in which the stats of the destination
+	// are logged, 0 only logs them on teardown.
+	statsInterval time.Duration
+	// maxIdleTime is the time a connection can be idle before it's checked
+	// with a ping before the next write, 0 disables the check.
+	maxIdleTime time.Duration
+	// writeTimeout is the maximum time of a single write attempt, including
+	// all statements of a batch, 0 means no limit.
+	writeTimeout time.Duration
+	// flattenObjects makes the destination write nested objects into columns
+	// prefixed with the field name instead of a single json column.
+	flattenObjects bool
+	// flattenSeparator separates the field name and the key of a flattened
+	// object.
+	flattenSeparator string
+	// upsertMethod determines the statement used to upsert records.
+	upsertMethod UpsertMethod
+	// includeFields is the list of payload fields that are written, all
+	// other fields are dropped. An empty list means all fields are written.
+	includeFields []string
+	// excludeFields is the list of payload fields that are dropped.
+	excludeFields []string
+	// columnMappings map values nested in the payload to columns.
+	columnMappings []columnMapping
+	// columnExpressions are SQL expressions wrapping the parameters of the
+	// values of columns, e.g. lower($value).
+	columnExpressions writer.ColumnExpressions
+	// heavyFields are payload fields with large values that are compressed
+	// or written into a side table, depending on heavyFieldsMode.
+	heavyFields     []string
+	heavyFieldsMode HeavyFieldsMode
+	// validateWrites makes the destination read each written row back and
+	// log fields whose stored value doesn't match the record.
+	validateWrites bool
+	// healthCheck makes the destination check that the table exists and can
+	// be written when it's opened.
+	healthCheck bool
+	// countRows makes the destination count inserted, updated, deleted and
+	// skipped rows, see WriteStats.
+	countRows bool
+	// timestampLayouts are the layouts strings written into timestamp and
+	// timestamptz columns are parsed with, see convertTimestamp.
+	timestampLayouts []string
+	// assumeTimezone is the timezone of parsed timestamps without an offset.
+	assumeTimezone *time.Location
+	// strictTimestamps makes writes fail if a timestamp matches no layout,
+	// instead of leaving it to Postgres to cast it.
+	strictTimestamps bool
+	// conditionalUpdates makes the destination update a row only if it still
+	// matches the row before the update, as sent in the record metadata.
+	conditionalUpdates bool
+	// fieldNameConversion determines how field names of the key and payload
+	// are converted into column names.
+	fieldNameConversion FieldNameConversion
+	// treatMissingAsNull makes upserts set columns that are missing in the
+	// payload to NULL instead of keeping their value.
+	treatMissingAsNull bool
+	// updateColumns are the only columns overwritten when an upsert updates
+	// an existing row, all columns of the payload are overwritten if empty.
+	updateColumns []string
+	// excludeFromUpdate are columns that are only written when an upsert
+	// inserts a row, e.g. columns maintained by other systems.
+	excludeFromUpdate []string
+	// conflictTarget is the raw conflict target used in upserts instead of the
+	// key column, e.g. "(lower(email)) WHERE deleted_at IS NULL".
+	conflictTarget string
+	// bufferPath is the file that buffers records until they are written into
+	// the database. If set, records are written asynchronously.
+	bufferPath string
+	// bufferMaxRecords is the maximum number of records in the buffer.
+	bufferMaxRecords int
+	// batchSize is the maximum number of buffered records written in a single
+	// transaction, upserts of the same key are deduplicated and upserts with
+	// the same columns are combined into one statement.
+	batchSize int
+	// writeConcurrency is the number of workers writing buffered records in
+	// parallel, records with the same key are always written by the same
+	// worker.
+	writeConcurrency int
+	// loadMode determines how snapshot records are written.
+	loadMode LoadMode
+	// deferConstraints makes the destination defer deferrable constraints,
+	// e.g. foreign keys, until a batch is committed.
+	deferConstraints bool
+	// txIsolationLevel is the isolation level of batch transactions, the
+	// default isolation level of the session is used if empty.
+	txIsolationLevel TxIsolationLevel
+	// dryRun makes the destination preview the statements that change the
+	// database instead of executing them.
+	dryRun bool
+	// dryRunPath is the file the previewed statements are appended to, they
+	// are logged if empty.
+	dryRunPath string
+	// initSQL contains statements executed when the destination is opened.
+	initSQL string
+	// teardownSQL contains statements executed when the destination is torn
+	// down.
+	teardownSQL string
+	// maxRecordSize is the maximum size of the payload of a record in bytes,
+	// 0 means no limit.
+	maxRecordSize int
+	// oversizedRecords determines how records exceeding maxRecordSize are
+	// handled.
+	oversizedRecords OversizedRecords
+	// overflowColumn is the jsonb column that lists the fields removed from
+	// oversized records.
+	overflowColumn string
+	// deadLetterTable is the table oversized records are written into.
+	deadLetterTable string
+	// outOfOrderRecords determines how records older than the last record
+	// written for the same key are handled.
+	outOfOrderRecords OutOfOrderRecords
+	// setCreatedAtColumn is the column set to now() when a row is inserted.
+	setCreatedAtColumn string
+	// setUpdatedAtColumn is the column set to now() when a row is inserted or
+	// updated.
+	setUpdatedAtColumn string
+}
+
+func parseConfig(cfgRaw map[string]string) (config, error) {
+	cfg := config{
+		tableName:     cfgRaw[ConfigKeyTable],
+		keyColumnName: cfgRaw[ConfigKeyKeyColumnName],
+		dedupColumn:   cfgRaw[ConfigKeyDedupColumn],
+		positionID:    cfgRaw[ConfigKeyPositionID],
+		bufferPath:    cfgRaw[ConfigKeyBufferPath],
+		dryRunPath:    cfgRaw[ConfigKeyDryRunPath],
+
+		overflowColumn:  cfgRaw[ConfigKeyOverflowColumn],
+		deadLetterTable: cfgRaw[ConfigKeyDeadLetterTable],
+
+		setCreatedAtColumn: cfgRaw[ConfigKeySetCreatedAtColumn],
+		setUpdatedAtColumn: cfgRaw[ConfigKeySetUpdatedAtColumn],
+
+		conflictTarget: strings.TrimSpace(cfgRaw[ConfigKeyConflictTarget]),
+		initSQL:        strings.TrimSpace(cfgRaw[ConfigKeyInitSQL]),
+		teardownSQL:    strings.TrimSpace(cfgRaw[ConfigKeyTeardownSQL]),
+
+		flattenSeparator: DefaultFlattenSeparator,
+		bufferMaxRecords: DefaultBufferMaxRecords,
+		batchSize:        DefaultBatchSize,
+		writeConcurrency: DefaultWriteConcurrency,
+	}
+
+	if raw := cfgRaw[ConfigKeySchema]; raw != "" {
+		ident, err := parseIdentifier(raw)
+		if err != nil || len(ident) != 1 {
+			return config{}, fmt.Errorf("%q contains unsupported value %q, expected a schema name", ConfigKeySchema, raw)
+		}
+		cfg.schema = ident[0]
+	}
+	if cfg.tableName != "" {
+		if _, err := parseTableName(cfg.tableName, cfg.schema); err != nil {
+			return config{}, fmt.Errorf("%q contains unsupported value %q: %w", ConfigKeyTable, cfg.tableName, err)
+		}
+	}
+
+	var err error
+	if cfg.url, err = session.ResolveURL(cfgRaw); err != nil {
+		return config{}, err
+	}
+	if cfg.routeToPartitions, err = parseBool(cfgRaw, ConfigKeyRouteToPartitions); err != nil {
+		return config{}, err
+	}
+	if cfg.overridingSystemValue, err = parseBool(cfgRaw, ConfigKeyOverridingSystemValue); err != nil {
+		return config{}, err
+	}
+	cfg.jsonMergeColumns = parseList(cfgRaw, ConfigKeyJSONMergeColumns)
+	cfg.updateColumns = parseList(cfgRaw, ConfigKeyUpdateColumns)
+	cfg.excludeFromUpdate = parseList(cfgRaw, ConfigKeyExcludeFromUpdate)
+	if len(cfg.updateColumns) > 0 && len(cfg.excludeFromUpdate) > 0 {
+		return config{}, fmt.Errorf("%q can't be combined with %q", ConfigKeyUpdateColumns, ConfigKeyExcludeFromUpdate)
+	}
+	cfg.includeFields = parseList(cfgRaw, ConfigKeyIncludeFields)
+	cfg.excludeFields = parseList(cfgRaw, ConfigKeyExcludeFields)
+	if cfg.columnMappings, err = parseColumnMappings(cfgRaw); err != nil {
+		return config{}, err
+	}
+	if cfg.columnExpressions, err = parseColumnExpressions(cfgRaw); err != nil {
+		return config{}, err
+	}
+	if cfg.createKeyIndex, err = parseBool(cfgRaw, ConfigKeyCreateKeyIndex); err != nil {
+		return config{}, err
+	}
+	if cfg.createKeyIndex && (cfg.tableName == "" || cfg.keyColumnName == "") {
+		return config{}, fmt.Errorf("%q requires %q and %q to be set", ConfigKeyCreateKeyIndex, ConfigKeyTable, ConfigKeyKeyColumnName)
+	}
+	if generate := cfgRaw[ConfigKeyGenerateKey]; generate != "" {
+		if !isKeyGenerationSupported(generate) {
+			return config{}, fmt.Errorf("%q contains unsupported value %q, expected one of %v", ConfigKeyGenerateKey, generate, keyGenerationAll)
+		}
+		if cfg.keyColumnName == "" {
+			return config{}, fmt.Errorf("%q requires %q to be set", ConfigKeyGenerateKey, ConfigKeyKeyColumnName)
+		}
+		cfg.generateKey = KeyGeneration(generate)
+	}
+	if cfg.trackPositions, err = parseBool(cfgRaw, ConfigKeyTrackPositions); err != nil {
+		return config{}, err
+	}
+	if cfg.trackPositions && cfg.positionID == "" {
+		return config{}, fmt.Errorf("%q requires %q to be set", ConfigKeyTrackPositions, ConfigKeyPositionID)
+	}
+	if cfg.dedupWindow, err = parseInt(cfgRaw, ConfigKeyDedupWindow); err != nil {
+		return config{}, err
+	}
+	if cfg.dedupWindow > 0 && cfg.positionID == "" {
+		return config{}, fmt.Errorf("%q requires %q to be set", ConfigKeyDedupWindow, ConfigKeyPositionID)
+	}
+	if cfg.writeHistory, err = parseBool(cfgRaw, ConfigKeyWriteHistory); err != nil {
+		return config{}, err
+	}
+	if cfg.maxRecordsPerSecond, err = parseInt(cfgRaw, ConfigKeyMaxRecordsPerSecond); err != nil {
+		return config{}, err
+	}
+	if cfg.maxConcurrentWrites, err = parseInt(cfgRaw, ConfigKeyMaxConcurrentWrites); err != nil {
+		return config{}, err
+	}
+	if cfgRaw[ConfigKeyBufferMaxRecords] != "" {
+		if cfg.bufferMaxRecords, err = parseInt(cfgRaw, ConfigKeyBufferMaxRecords); err != nil {
+			return config{}, err
+		}
+		if cfg.bufferMaxRecords == 0 {
+			return config{}, fmt.Errorf("%q contains unsupported value %q, expected a positive integer", ConfigKeyBufferMaxRecords, cfgRaw[ConfigKeyBufferMaxRecords])
+		}
+	}
+	if cfgRaw[ConfigKeyBatchSize] != "" {
+		if cfg.batchSize, err = parseInt(cfgRaw, ConfigKeyBatchSize); err != nil {
+			return config{}, err
+		}
+		if cfg.batchSize == 0 {
+			return config{}, fmt.Errorf("%q contains unsupported value %q, expected a positive integer", ConfigKeyBatchSize, cfgRaw[ConfigKeyBatchSize])
+		}
+		if cfg.batchSize > 1 && cfg.bufferPath == "" {
+			// records are only batched when they are drained from the buffer
+			return config{}, fmt.Errorf("%q requires %q to be set", ConfigKeyBatchSize, ConfigKeyBufferPath)
+		}
+	}
+	if cfgRaw[ConfigKeyWriteConcurrency] != "" {
+		if cfg.writeConcurrency, err = parseInt(cfgRaw, ConfigKeyWriteConcurrency); err != nil {
+			return config{}, err
+		}
+		if cfg.writeConcurrency == 0 {
+			return config{}, fmt.Errorf("%q contains unsupported value %q, expected a positive integer", ConfigKeyWriteConcurrency, cfgRaw[ConfigKeyWriteConcurrency])
+		}
+		if cfg.writeConcurrency > 1 && cfg.bufferPath == "" {
+			// only buffered records are written concurrently
+			return config{}, fmt.Errorf("%q requires %q to be set", ConfigKeyWriteConcurrency, ConfigKeyBufferPath)
+		}
+		if cfg.writeConcurrency > 1 && cfg.trackPositions {
+			// records are not written in order, so there is no single last
+			// written position
+			return config{}, fmt.Errorf("%q can't be combined with %q", ConfigKeyWriteConcurrency, ConfigKeyTrackPositions)
+		}
+		if cfg.writeConcurrency > 1 && cfg.dedupWindow > 0 {
+			// the window is shared by all workers
+			return config{}, fmt.Errorf("%q can't be combined with %q", ConfigKeyWriteConcurrency, ConfigKeyDedupWindow)
+		}
+	}
+	if cfg.maxConcurrentWrites > 0 && cfg.writeConcurrency <= 1 {
+		return config{}, fmt.Errorf("%q requires %q to be greater than 1", ConfigKeyMaxConcurrentWrites, ConfigKeyWriteConcurrency)
+	}
+	cfg.loadMode = LoadModeUpsert
+	if mode := cfgRaw[ConfigKeyLoadMode]; mode != "" {
+		if !isLoadModeSupported(mode) {
+			return config{}, fmt.Errorf("%q contains unsupported value %q, expected one of %v", ConfigKeyLoadMode, mode, loadModeAll)
+		}
+		cfg.loadMode = LoadMode(mode)
+	}
+	if cfg.loadMode != LoadModeUpsert {
+		switch {
+		case cfg.writeConcurrency > 1:
+			// each worker would truncate the table
+			return config{}, fmt.Errorf("%q %q can't be combined with %q", ConfigKeyLoadMode, cfg.loadMode, ConfigKeyWriteConcurrency)
+		case cfg.trackPositions:
+			// a restarted destination would truncate the rows loaded before
+			// the last written position
+			return config{}, fmt.Errorf("%q %q can't be combined with %q", ConfigKeyLoadMode, cfg.loadMode, ConfigKeyTrackPositions)
+		case cfg.dedupWindow > 0:
+			return config{}, fmt.Errorf("%q %q can't be combined with %q", ConfigKeyLoadMode, cfg.loadMode, ConfigKeyDedupWindow)
+		case cfg.dedupColumn != "":
+			return config{}, fmt.Errorf("%q %q can't be combined with %q", ConfigKeyLoadMode, cfg.loadMode, ConfigKeyDedupColumn)
+		case len(cfg.columnExpressions) > 0:
+			// COPY sends values without a statement to apply expressions in
+			return config{}, fmt.Errorf("%q %q can't be combined with column expressions", ConfigKeyLoadMode, cfg.loadMode)
+		}
+	}
+	if cfg.shardCount, err = parseInt(cfgRaw, ConfigKeyShardCount); err != nil {
+		return config{}, err
+	}
+	if cfg.shardCount > 0 {
+		switch {
+		case cfg.createKeyIndex:
+			// the index would be created on the table instead of its shards
+			return config{}, fmt.Errorf("%q can't be combined with %q", ConfigKeyShardCount, ConfigKeyCreateKeyIndex)
+		case cfg.loadMode != LoadModeUpsert:
+			// shards that receive no snapshot rows wouldn't be truncated
+			return config{}, fmt.Errorf("%q can't be combined with %q %q", ConfigKeyShardCount, ConfigKeyLoadMode, cfg.loadMode)
+		}
+	}
+	if cfg.deferConstraints, err = parseBool(cfgRaw, ConfigKeyDeferConstraints); err != nil {
+		return config{}, err
+	}
+	if cfg.deferConstraints && cfg.batchSize == 1 {
+		// constraints are only deferred in the transaction of a batch
+		return config{}, fmt.Errorf("%q requires %q to be greater than 1", ConfigKeyDeferConstraints, ConfigKeyBatchSize)
+	}
+	if level := cfgRaw[ConfigKeyTxIsolationLevel]; level != "" {
+		if !isTxIsolationLevelSupported(level) {
+			return config{}, fmt.Errorf("%q contains unsupported value %q, expected one of %v", ConfigKeyTxIsolationLevel, level, txIsolationLevelAll)
+		}
+		if cfg.batchSize == 1 {
+			// single records are written without a transaction
+			return config{}, fmt.Errorf("%q requires %q to be greater than 1", ConfigKeyTxIsolationLevel, ConfigKeyBatchSize)
+		}
+		cfg.txIsolationLevel = TxIsolationLevel(level)
+	}
+	if cfg.maxRecordSize, err = parseInt(cfgRaw, ConfigKeyMaxRecordSize); err != nil {
+		return config{}, err
+	}
+	cfg.oversizedRecords = OversizedRecordsReject
+	if mode := cfgRaw[ConfigKeyOversizedRecords]; mode != "" {
+		if !isOversizedRecordsSupported(mode) {
+			return config{}, fmt.Errorf("%q contains unsupported value %q, expected one of %v", ConfigKeyOversizedRecords, mode, oversizedRecordsAll)
+		}
+		cfg.oversizedRecords = OversizedRecords(mode)
+	}
+	switch {
+	case cfg.oversizedRecords == OversizedRecordsOverflow && cfg.overflowColumn == "":
+		return config{}, fmt.Errorf("%q %q requires %q to be set", ConfigKeyOversizedRecords, OversizedRecordsOverflow, ConfigKeyOverflowColumn)
+	case cfg.oversizedRecords == OversizedRecordsDeadLetter && cfg.deadLetterTable == "":
+		return config{}, fmt.Errorf("%q %q requires %q to be set", ConfigKeyOversizedRecords, OversizedRecordsDeadLetter, ConfigKeyDeadLetterTable)
+	case cfg.deadLetterTable != "":
+		if _, err := parseTableName(cfg.deadLetterTable, cfg.schema); err != nil {
+			return config{}, fmt.Errorf("%q contains unsupported value %q: %w", ConfigKeyDeadLetterTable, cfg.deadLetterTable, err)
+		}
+	}
+	cfg.outOfOrderRecords = OutOfOrderRecordsIgnore
+	if mode := cfgRaw[ConfigKeyOutOfOrderRecords]; mode != "" {
+		if !isOutOfOrderRecordsSupported(mode) {
+			return config{}, fmt.Errorf("%q contains unsupported value %q, expected one of %v", ConfigKeyOutOfOrderRecords, mode, outOfOrderRecordsAll)
+		}
+		cfg.outOfOrderRecords = OutOfOrderRecords(mode)
+	}
+	if cfg.retry, err = retry.ParseConfig(cfgRaw); err != nil {
+		return config{}, err
+	}
+	if cfg.session, err = session.ParseConfig(cfgRaw); err != nil {
+		return config{}, err
+	}
+	if cfg.statsInterval, err = stats.ParseInterval(cfgRaw); err != nil {
+		return config{}, err
+	}
+	if role := cfgRaw[ConfigKeySessionReplicationRole]; role != "" {
+		if !isSessionReplicationRoleSupported(role) {
+			return config{}, fmt.Errorf("%q contains unsupported value %q, expected one of %v", ConfigKeySessionReplicationRole, role, sessionReplicationRoleAll)
+		}
+		if cfg.session.PoolerCompatibility {
+			// no settings are sent when connecting through a pooler
+			return config{}, fmt.Errorf("%q can't be combined with %q, set it for the database role instead", ConfigKeySessionReplicationRole, session.ConfigKeyPoolerCompatibility)
+		}
+		cfg.session.ReplicationRole = role
+	}
+	if cfg.maxIdleTime, err = parseDuration(cfgRaw, ConfigKeyMaxIdleTime); err != nil {
+		return config{}, err
+	}
+	if cfg.writeTimeout, err = parseDuration(cfgRaw, ConfigKeyWriteTimeout); err != nil {
+		return config{}, err
+	}
+	if cfg.validateWrites, err = parseBool(cfgRaw, ConfigKeyValidateWrites); err != nil {
+		return config{}, err
+	}
+	if cfg.conditionalUpdates, err = parseBool(cfgRaw, ConfigKeyConditionalUpdates); err != nil {
+		return config{}, err
+	}
+	if cfg.treatMissingAsNull, err = parseBool(cfgRaw, ConfigKeyTreatMissingAsNull); err != nil {
+		return config{}, err
+	}
+	if cfg.heavyFields = parseList(cfgRaw, ConfigKeyHeavyFields); len(cfg.heavyFields) > 0 {
+		cfg.heavyFieldsMode = HeavyFieldsModeCompress
+	}
+	if mode := cfgRaw[ConfigKeyHeavyFieldsMode]; mode != "" {
+		if !isHeavyFieldsModeSupported(mode) {
+			return config{}, fmt.Errorf("%q contains unsupported value %q, expected one of %v", ConfigKeyHeavyFieldsMode, mode, heavyFieldsModeAll)
+		}
+		if len(cfg.heavyFields) == 0 {
+			return config{}, fmt.Errorf("%q requires %q to be set", ConfigKeyHeavyFieldsMode, ConfigKeyHeavyFields)
+		}
+		cfg.heavyFieldsMode = HeavyFieldsMode(mode)
+	}
+	if len(cfg.heavyFields) > 0 && cfg.validateWrites {
+		// stored values are compressed or in the side table
+		return config{}, fmt.Errorf("%q can't be combined with %q", ConfigKeyHeavyFields, ConfigKeyValidateWrites)
+	}
+	if len(cfg.columnExpressions) > 0 && cfg.validateWrites {
+		// stored values are transformed by the expressions
+		return config{}, fmt.Errorf("column expressions can't be combined with %q", ConfigKeyValidateWrites)
+	}
+	if cfg.heavyFieldsMode == HeavyFieldsModeSideTable {
+		if cfg.keyColumnName == "" {
+			// rows in the side table are identified by the key
+			return config{}, fmt.Errorf("%q %q requires %q to be set", ConfigKeyHeavyFieldsMode, cfg.heavyFieldsMode, ConfigKeyKeyColumnName)
+		}
+		if cfg.loadMode != LoadModeUpsert {
+			// the side table is not truncated or swapped with the table
+			return config{}, fmt.Errorf("%q %q can't be combined with %q %q", ConfigKeyHeavyFieldsMode, cfg.heavyFieldsMode, ConfigKeyLoadMode, cfg.loadMode)
+		}
+	}
+	if cfg.dryRun, err = parseBool(cfgRaw, ConfigKeyDryRun); err != nil {
+		return config{}, err
+	}
+	if cfg.dryRunPath != "" && !cfg.dryRun {
+		return config{}, fmt.Errorf("%q requires %q to be enabled", ConfigKeyDryRunPath, ConfigKeyDryRun)
+	}
+	if cfg.dryRun && cfg.trackPositions {
+		// nothing is written, so no position can be stored
+		return config{}, fmt.Errorf("%q can't be combined with %q", ConfigKeyDryRun, ConfigKeyTrackPositions)
+	}
+	if cfg.dryRun && cfg.dedupWindow > 0 {
+		return config{}, fmt.Errorf("%q can't be combined with %q", ConfigKeyDryRun, ConfigKeyDedupWindow)
+	}
+	if cfg.dryRun && cfg.validateWrites {
+		return config{}, fmt.Errorf("%q can't be combined with %q", ConfigKeyDryRun, ConfigKeyValidateWrites)
+	}
+	if cfg.healthCheck, err = parseBool(cfgRaw, ConfigKeyHealthCheck); err != nil {
+		return config{}, err
+	}
+	if cfg.countRows, err = parseBool(cfgRaw, ConfigKeyCountRows); err != nil {
+		return config{}, err
+	}
+	if cfg.dryRun && cfg.countRows {
+		return config{}, fmt.Errorf("%q can't be combined with %q", ConfigKeyDryRun, ConfigKeyCountRows)
+	}
+	cfg.timestampLayouts = parseTimestampLayouts(parseList(cfgRaw, ConfigKeyTimestampLayouts))
+	if tz := cfgRaw[ConfigKeyAssumeTimezone]; tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return config{}, fmt.Errorf("%q contains unsupported value %q, expected a timezone (e.g. Europe/Berlin)", ConfigKeyAssumeTimezone, tz)
+		}
+		cfg.assumeTimezone = loc
+	}
+	if cfg.strictTimestamps, err = parseBool(cfgRaw, ConfigKeyStrictTimestamps); err != nil {
+		return config{}, err
+	}
+	if cfg.flattenObjects, err = parseBool(cfgRaw, ConfigKeyFlattenObjects); err != nil {
+		return config{}, err
+	}
+	if sep, ok := cfgRaw[ConfigKeyFlattenSeparator]; ok {
+		cfg.flattenSeparator = sep
+	}
+
+	cfg.dialect = DialectPostgres
+	if dialect := cfgRaw[ConfigKeyDialect]; dialect != "" {
+		if !isDialectSupported(dialect) {
+			return config{}, fmt.Errorf("%q contains unsupported value %q, expected one of %v", ConfigKeyDialect, dialect, dialectAll)
+		}
+		cfg.dialect = Dialect(dialect)
+	}
+	cfg.upsertMethod = UpsertMethodOnConflict
+	if method := cfgRaw[ConfigKeyUpsertMethod]; method != "" {
+		if !isUpsertMethodSupported(method) {
+			return config{}, fmt.Errorf("%q contains unsupported value %q, expected one of %v", ConfigKeyUpsertMethod, method, upsertMethodAll)
+		}
+		cfg.upsertMethod = UpsertMethod(method)
+	}
+	cfg.fieldNameConversion = FieldNameConversionNone
+	if conversion := cfgRaw[ConfigKeyFieldNameConversion]; conversion != "" {
+		if !isFieldNameConversionSupported(conversion) {
+			return config{}, fmt.Errorf("%q contains unsupported value %q, expected one of %v", ConfigKeyFieldNameConversion, conversion, fieldNameConversionAll)
+		}
+		cfg.fieldNameConversion = FieldNameConversion(conversion)
+	}
+	if cfg.conflictTarget != "" {
+		if !isConflictTarget(cfg.conflictTarget) {
+			return config{}, fmt.Errorf("%q contains unsupported value %q, expected a column list in parentheses optionally followed by a WHERE clause, or ON CONSTRAINT <name>", ConfigKeyConflictTarget, cfg.conflictTarget)
+		}
+		if cfg.upsertMethod == UpsertMethodMerge {
+			return config{}, fmt.Errorf("%q can't be combined with %q %q, MERGE matches rows by the key column", ConfigKeyConflictTarget, ConfigKeyUpsertMethod, UpsertMethodMerge)
+		}
+	}
+	if cfg.countRows && cfg.upsertMethod == UpsertMethodMerge {
+		// MERGE doesn't support RETURNING before Postgres 17
+		return config{}, fmt.Errorf("%q can't be combined with %q %q", ConfigKeyCountRows, ConfigKeyUpsertMethod, UpsertMethodMerge)
+	}
+	if cfg.setCreatedAtColumn != "" && cfg.setCreatedAtColumn == cfg.setUpdatedAtColumn {
+		return config{}, fmt.Errorf("%q and %q can't be the same column", ConfigKeySetCreatedAtColumn, ConfigKeySetUpdatedAtColumn)
+	}
+	if err := cfg.validateDialect(); err != nil {
+		return config{}, err
+	}
+
+	return cfg, nil
+}
+
+// validateDialect returns an error if an option is configured that the dialect
+// doesn't support.
+func (c config) validateDialect() error {
+	unsupported := func(key string) error {
+		return fmt.Errorf("%q is not supported with %s %q", key, ConfigKeyDialect, c.dialect)
+	}
+	if c.routeToPartitions && !c.dialect.readsCatalog() {
+		return unsupported(ConfigKeyRouteToPartitions)
+	}
+	if c.createKeyIndex && !c.dialect.readsCatalog() {
+		return unsupported(ConfigKeyCreateKeyIndex)
+	}
+	if c.dedupColumn != "" && !c.dialect.supportsOnConflict() {
+		return unsupported(ConfigKeyDedupColumn)
+	}
+	if c.trackPositions && !c.dialect.supportsOnConflict() {
+		return unsupported(ConfigKeyTrackPositions)
+	}
+	if c.dedupWindow > 0 && !c.dialect.supportsOnConflict() {
+		return unsupported(ConfigKeyDedupWindow)
+	}
+	if c.writeHistory && !c.dialect.supportsJSON() {
+		return unsupported(ConfigKeyWriteHistory)
+	}
+	if len(c.jsonMergeColumns) > 0 && !c.dialect.supportsOnConflict() {
+		return unsupported(ConfigKeyJSONMergeColumns)
+	}
+	if c.conflictTarget != "" && !c.dialect.supportsOnConflict() {
+		return unsupported(ConfigKeyConflictTarget)
+	}
+	if len(c.updateColumns) > 0 && !c.dialect.supportsOnConflict() {
+		// rows are replaced, so all columns are overwritten
+		return unsupported(ConfigKeyUpdateColumns)
+	}
+	if len(c.excludeFromUpdate) > 0 && !c.dialect.supportsOnConflict() {
+		return unsupported(ConfigKeyExcludeFromUpdate)
+	}
+	if c.batchSize > 1 && !c.dialect.supportsOnConflict() {
+		return unsupported(ConfigKeyBatchSize)
+	}
+	if c.setCreatedAtColumn != "" && !c.dialect.supportsOnConflict() {
+		// rows are replaced, so the created at column can't be kept
+		return unsupported(ConfigKeySetCreatedAtColumn)
+	}
+	if c.setUpdatedAtColumn != "" && !c.dialect.supportsOnConflict() {
+		return unsupported(ConfigKeySetUpdatedAtColumn)
+	}
+	if c.conditionalUpdates && !c.dialect.supportsOnConflict() {
+		return unsupported(ConfigKeyConditionalUpdates)
+	}
+	if c.validateWrites && !c.dialect.supportsJSON() {
+		return unsupported(ConfigKeyValidateWrites)
+	}
+	if c.oversizedRecords != OversizedRecordsReject && !c.dialect.supportsJSON() {
+		// the overflow column and the metadata in the dead letter table are
+		// jsonb
+		return unsupported(ConfigKeyOversizedRecords)
+	}
+	if c.treatMissingAsNull && !c.dialect.readsCatalog() {
+		// the missing columns are read from the catalog
+		return unsupported(ConfigKeyTreatMissingAsNull)
+	}
+	if c.upsertMethod == UpsertMethodMerge && !c.dialect.readsCatalog() {
+		// parameters are cast to the column types read from the catalog
+		return unsupported(ConfigKeyUpsertMethod)
+	}
+	if c.loadMode == LoadModeTruncateAndLoad && !c.dialect.supportsCopy() {
+		return unsupported(ConfigKeyLoadMode)
+	}
+	if c.loadMode == LoadModeStaged && !c.dialect.readsCatalog() {
+		// the staging table is created as a copy of the table
+		return unsupported(ConfigKeyLoadMode)
+	}
+	if c.deferConstraints && !c.dialect.supportsDeferredConstraints() {
+		return unsupported(ConfigKeyDeferConstraints)
+	}
+	if c.session.ReplicationRole != "" && !c.dialect.supportsSessionReplicationRole() {
+		return unsupported(ConfigKeySessionReplicationRole)
+	}
+	if c.heavyFieldsMode == HeavyFieldsModeSideTable && !c.dialect.supportsJSON() {
+		// the side table stores keys and values as jsonb
+		return unsupported(ConfigKeyHeavyFieldsMode)
+	}
+	if c.countRows && !c.dialect.supportsXmax() {
+		// inserted and updated rows are told apart by their xmax
+		return unsupported(ConfigKeyCountRows)
+	}
+	if c.healthCheck && !c.dialect.readsCatalog() {
+		return unsupported(ConfigKeyHealthCheck)
+	}
+	// timestamps are parsed based on the column types in the catalog
+	if len(c.timestampLayouts) > 0 && !c.dialect.readsCatalog() {
+		return unsupported(ConfigKeyTimestampLayouts)
+	}
+	if c.assumeTimezone != nil && !c.dialect.readsCatalog() {
+		return unsupported(ConfigKeyAssumeTimezone)
+	}
+	if c.strictTimestamps && !c.dialect.readsCatalog() {
+		return unsupported(ConfigKeyStrictTimestamps)
+	}
+	return nil
+}
+
+// isConflictTarget returns true if raw looks like the conflict target of an ON
+// CONFLICT clause. The target itself is validated by Postgres.
+func isConflictTarget(raw string) bool {
+	return strings.HasPrefix(raw, "(") ||
+		strings.HasPrefix(strings.ToUpper(raw), "ON CONSTRAINT ")
+}
+
+// parseList parses an optional comma separated list of values.
+func parseList(cfgRaw map[string]string, key string) []string {
+	raw := cfgRaw[key]
+	if raw == "" {
+		return nil
+	}
+	list := strings.Split(raw, ",")
+	for i, v := range list {
+		list[i] = strings.TrimSpace(v)
+	}
+	return list
+}
+
+// parseBool parses an optional boolean config value, it defaults to false.
+func parseBool(cfgRaw map[string]string, key string) (bool, error) {
+	raw := cfgRaw[key]
+	if raw == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("%q contains unsupported value %q, expected a boolean", key, raw)
+	}
+	return b, nil
+}
+
+// parseInt parses an optional non-negative integer config value, it defaults
+// to 0.
+func parseInt(cfgRaw map[string]string, key string) (int, error) {
+	raw := cfgRaw[key]
+	if raw == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(raw)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("%q contains unsupported value %q, expected a non-negative integer", key, raw)
+	}
+	return i, nil
+}
+
+// parseDuration parses an optional non-negative duration config value, it
+// defaults to 0.
+func parseDuration(cfgRaw map[string]string, key string) (time.Duration, error) {
+	raw := cfgRaw[key]
+	if raw == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%q contains unsupported value %q, expected a duration", key, raw)
+	}
+	return d, nil
+}
@@ -0,0 +1,151 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/pprof"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgconn"
+)
+
+// SessionReplicationRole is the session_replication_role of the connections of
+// the destination, it determines which triggers and rules fire on writes.
+type SessionReplicationRole string
+
+const (
+	// SessionReplicationRoleOrigin fires triggers as usual.
+	SessionReplicationRoleOrigin SessionReplicationRole = "origin"
+	// SessionReplicationRoleReplica only fires triggers enabled with ENABLE
+	// REPLICA or ENABLE ALWAYS. Foreign keys are implemented as triggers, so
+	// they aren't checked either.
+	SessionReplicationRoleReplica SessionReplicationRole = "replica"
+	// SessionReplicationRoleLocal only fires triggers enabled with ENABLE
+	// ALWAYS, same as replica for most purposes.
+	SessionReplicationRoleLocal SessionReplicationRole = "local"
+)
+
+var sessionReplicationRoleAll = []SessionReplicationRole{
+	SessionReplicationRoleOrigin,
+	SessionReplicationRoleReplica,
+	SessionReplicationRoleLocal,
+}
+
+func isSessionReplicationRoleSupported(raw string) bool {
+	for _, r := range sessionReplicationRoleAll {
+		if string(r) == raw {
+			return true
+		}
+	}
+	return false
+}
+
+// cancelRequestTimeout limits the time spent asking the server to cancel a
+// timed out statement.
+const cancelRequestTimeout = 5 * time.Second
+
+// retryWrite executes the write with retries. Before each attempt the
+// connection is reopened if it was closed, see ensureConn. Each attempt is
+// limited by writeTimeout, see writeWithTimeout. If an attempt fails
+// on a dead connection before anything was sent to the server, it's repeated
+// once on a new connection, even if retries are disabled, so a connection that
+// was dropped while idle doesn't fail the write. Serialization failures of
+// repeatable read and serializable transactions are repeated in the same
+// attempt, see writeSerialized. If countRows is enabled, only the rows
+// changed by the successful attempt are counted.
+func (d *Destination) retryWrite(ctx context.Context, name string, write func(context.Context) error) (err error) {
+	// samples of CPU profiles are labeled with the operation, so the time
+	// spent in each kind of write can be told apart
+	pprof.Do(ctx, pprof.Labels("postgres.write", name), func(ctx context.Context) {
+		err = d.retryWriteLabeled(ctx, name, d.countedWrite(write))
+	})
+	if err == nil {
+		d.commitRowCounts()
+	}
+	return err
+}
+
+func (d *Destination) retryWriteLabeled(ctx context.Context, name string, write func(context.Context) error) error {
+	return d.retry.Do(ctx, name, func(ctx context.Context) error {
+		if err := d.ensureConn(ctx); err != nil {
+			return err
+		}
+		err := d.writeSerialized(ctx, name, write)
+		if err != nil && d.conn.IsClosed() && pgconn.SafeToRetry(err) {
+			sdk.Logger(ctx).Info().Err(err).
+				Str("operation", name).
+				Msg("connection was closed, reconnecting")
+			if err := d.connect(ctx, d.config.url); err != nil {
+				return err
+			}
+			err = d.writeWithTimeout(ctx, write)
+		}
+		if isReadOnlyError(err) {
+			// the server was demoted to a standby, reconnect in the next
+			// attempt to find the new primary
+			_ = d.conn.Close(ctx)
+		}
+		d.lastUsed = time.Now()
+		return err
+	})
+}
+
+// ensureConn reopens the connection if it's closed, e.g. because it broke in a
+// previous attempt. If maxIdleTime is set and the connection was idle for
+// longer, it's checked with a ping first and reopened if the ping fails.
+func (d *Destination) ensureConn(ctx context.Context) error {
+	if d.config.maxIdleTime > 0 && !d.conn.IsClosed() && time.Since(d.lastUsed) > d.config.maxIdleTime {
+		if err := d.conn.Ping(ctx); err != nil {
+			sdk.Logger(ctx).Info().Err(err).
+				Dur("idle", time.Since(d.lastUsed)).
+				Msg("idle connection is dead, reconnecting")
+			_ = d.conn.Close(ctx)
+		}
+	}
+	if d.conn.IsClosed() {
+		return d.connect(ctx, d.config.url)
+	}
+	return nil
+}
+
+// writeWithTimeout executes the write, if writeTimeout is set it's canceled
+// once the timeout expires. pgx closes the connection when a statement is
+// canceled, so the server is also asked to cancel the running statement,
+// otherwise it could keep holding locks until the server notices that the
+// connection is gone. The error of a timed out write is treated as a
+// connection failure and retried on a new connection.
+func (d *Destination) writeWithTimeout(ctx context.Context, write func(context.Context) error) error {
+	if d.config.writeTimeout == 0 {
+		return write(ctx)
+	}
+	pgConn := d.conn.PgConn()
+	writeCtx, cancel := context.WithTimeout(ctx, d.config.writeTimeout)
+	defer cancel()
+
+	err := write(writeCtx)
+	if err == nil || ctx.Err() != nil || !errors.Is(writeCtx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+	cancelCtx, cancelCancel := context.WithTimeout(ctx, cancelRequestTimeout)
+	defer cancelCancel()
+	if cancelErr := pgConn.CancelRequest(cancelCtx); cancelErr != nil {
+		sdk.Logger(ctx).Warn().Err(cancelErr).Msg("failed to cancel timed out statement")
+	}
+	return fmt.Errorf("write timed out after %v: %w", d.config.writeTimeout, err)
+}
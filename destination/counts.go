@@ -0,0 +1,196 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgconn"
+)
+
+// WriteStats contains the number of rows changed by the destination since it
+// was opened. Rows are only counted if countRows is enabled.
+type WriteStats struct {
+	// Inserted is the number of rows inserted, including rows loaded with COPY.
+	Inserted uint64
+	// Updated is the number of existing rows updated by upserts.
+	Updated uint64
+	// Deleted is the number of rows deleted.
+	Deleted uint64
+	// Skipped is the number of rows a write didn't change, e.g. upserts whose
+	// condition didn't match, conflicting inserts that did nothing and
+	// deletes of rows that didn't exist.
+	Skipped uint64
+}
+
+// Fields returns the counts as fields of the stats log line, see
+// stats.Logger.
+func (s WriteStats) Fields() map[string]interface{} {
+	return map[string]interface{}{
+		"rowsInserted": s.Inserted,
+		"rowsUpdated":  s.Updated,
+		"rowsDeleted":  s.Deleted,
+		"rowsSkipped":  s.Skipped,
+	}
+}
+
+// rowCounts counts the rows changed by a single write attempt.
+type rowCounts struct {
+	inserted, updated, deleted, skipped uint64
+}
+
+func (c *rowCounts) add(counts rowCounts) {
+	c.inserted += counts.inserted
+	c.updated += counts.updated
+	c.deleted += counts.deleted
+	c.skipped += counts.skipped
+}
+
+// rowCounters contains the rows changed by committed writes, it is shared by
+// the destination and its workers.
+type rowCounters struct {
+	m      sync.Mutex
+	counts rowCounts
+}
+
+func (c *rowCounters) add(counts rowCounts) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.counts.add(counts)
+}
+
+func (c *rowCounters) stats() WriteStats {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return WriteStats{
+		Inserted: c.counts.inserted,
+		Updated:  c.counts.updated,
+		Deleted:  c.counts.deleted,
+		Skipped:  c.counts.skipped,
+	}
+}
+
+// WriteStats returns the number of rows changed by the destination and its
+// workers. It returns zero counts if countRows is disabled.
+func (d *Destination) WriteStats() WriteStats {
+	if d.rowCounters == nil {
+		return WriteStats{}
+	}
+	return d.rowCounters.stats()
+}
+
+// statsFields returns the counters logged periodically, see stats.Logger: the
+// retries and, if countRows is enabled, the rows changed.
+func (d *Destination) statsFields() map[string]interface{} {
+	fields := d.retry.Stats().Fields()
+	if d.rowCounters != nil {
+		for k, v := range d.rowCounters.stats().Fields() {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// countedWrite returns the write with the rows it changes counted. The counts
+// of a failed attempt are discarded, they are only added to the totals once
+// the write succeeded, see commitRowCounts.
+func (d *Destination) countedWrite(write func(context.Context) error) func(context.Context) error {
+	if !d.config.countRows {
+		return write
+	}
+	return func(ctx context.Context) error {
+		d.pendingCounts = rowCounts{}
+		return write(ctx)
+	}
+}
+
+// commitRowCounts adds the rows changed by the last attempt of a successful
+// write to the totals.
+func (d *Destination) commitRowCounts() {
+	if !d.config.countRows {
+		return
+	}
+	d.rowCounters.add(d.pendingCounts)
+	d.pendingCounts = rowCounts{}
+}
+
+// execUpsertQuery executes an upsert of n rows and returns the number of rows
+// inserted or updated. If countRows is enabled, the query returns whether each
+// written row was inserted, which is the case if the row has no xmax, i.e. it
+// wasn't locked by an update. Rows that aren't returned were skipped.
+func (d *Destination) execUpsertQuery(ctx context.Context, query string, args []interface{}, n int) (int64, error) {
+	if !d.config.countRows {
+		tag, err := d.exec(ctx, query, args...)
+		return tag.RowsAffected(), err
+	}
+	query = strings.TrimSuffix(query, ";") + " RETURNING (xmax = 0)"
+	rows, err := d.conn.Query(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var counts rowCounts
+	for rows.Next() {
+		var inserted bool
+		if err := rows.Scan(&inserted); err != nil {
+			return 0, fmt.Errorf("failed to scan upsert result: %w", err)
+		}
+		if inserted {
+			counts.inserted++
+		} else {
+			counts.updated++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	written := counts.inserted + counts.updated
+	counts.skipped = remaining(n, written)
+	d.countRows(counts)
+	return int64(written), nil
+}
+
+// countInserts counts the rows inserted by a statement writing n rows, the
+// other rows were skipped.
+func (d *Destination) countInserts(tag pgconn.CommandTag, n int) {
+	inserted := uint64(tag.RowsAffected())
+	d.countRows(rowCounts{inserted: inserted, skipped: remaining(n, inserted)})
+}
+
+// countDeletes counts the rows deleted by a statement deleting n rows, the
+// other rows didn't exist.
+func (d *Destination) countDeletes(tag pgconn.CommandTag, n int) {
+	deleted := uint64(tag.RowsAffected())
+	d.countRows(rowCounts{deleted: deleted, skipped: remaining(n, deleted)})
+}
+
+func (d *Destination) countRows(counts rowCounts) {
+	if d.config.countRows {
+		d.pendingCounts.add(counts)
+	}
+}
+
+// remaining returns the number of the n rows that weren't changed. A key
+// column without a unique index can match more than n rows.
+func remaining(n int, changed uint64) uint64 {
+	if changed >= uint64(n) {
+		return 0
+	}
+	return uint64(n) - changed
+}
@@ -0,0 +1,123 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/conduitio/conduit-connector-postgres/retry"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgconn"
+	"github.com/matryer/is"
+)
+
+func TestDestination_CountedWrite(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	d := &Destination{
+		config:      config{countRows: true},
+		rowCounters: &rowCounters{},
+	}
+
+	attempts := 0
+	write := d.countedWrite(func(ctx context.Context) error {
+		attempts++
+		d.countInserts(pgconn.CommandTag("INSERT 0 2"), 3)
+		d.countDeletes(pgconn.CommandTag("DELETE 1"), 1)
+		if attempts == 1 {
+			return errors.New("connection reset")
+		}
+		return nil
+	})
+	// the counts of the failed attempt are discarded
+	is.True(write(ctx) != nil)
+	is.NoErr(write(ctx))
+	d.commitRowCounts()
+	is.Equal(d.WriteStats(), WriteStats{Inserted: 2, Deleted: 1, Skipped: 1})
+
+	// a delete matching more rows than expected doesn't skip any
+	d.countDeletes(pgconn.CommandTag("DELETE 3"), 1)
+	d.commitRowCounts()
+	is.Equal(d.WriteStats(), WriteStats{Inserted: 2, Deleted: 4, Skipped: 1})
+}
+
+func TestDestination_StatsFields(t *testing.T) {
+	is := is.New(t)
+	d := &Destination{
+		config:      config{countRows: true},
+		retry:       retry.New(retry.Config{MaxAttempts: 1}),
+		rowCounters: &rowCounters{},
+	}
+	d.rowCounters.add(rowCounts{inserted: 2, updated: 1})
+
+	// the row counts are logged with the retries
+	is.Equal(d.statsFields(), map[string]interface{}{
+		"retries":          uint64(0),
+		"retriesExhausted": uint64(0),
+		"rowsInserted":     uint64(2),
+		"rowsUpdated":      uint64(1),
+		"rowsDeleted":      uint64(0),
+		"rowsSkipped":      uint64(0),
+	})
+
+	// without countRows only the retries are logged
+	d.rowCounters = nil
+	is.Equal(len(d.statsFields()), 2)
+}
+
+func TestDestination_CountedWrite_Disabled(t *testing.T) {
+	is := is.New(t)
+	d := &Destination{}
+
+	is.NoErr(d.countedWrite(func(ctx context.Context) error {
+		d.countInserts(pgconn.CommandTag("INSERT 0 1"), 1)
+		return nil
+	})(context.Background()))
+	d.commitRowCounts()
+	is.Equal(d.pendingCounts, rowCounts{})
+	is.Equal(d.WriteStats(), WriteStats{})
+}
+
+func TestAdapter_Write_CountRows(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	d := &Destination{
+		conn:        getTestPostgres(t),
+		config:      config{countRows: true},
+		rowCounters: &rowCounters{},
+	}
+
+	records := []sdk.Record{{
+		Metadata: map[string]string{"action": "update", "table": "keyed"},
+		Key:      sdk.StructuredData{"key": "1"},
+		Payload:  sdk.StructuredData{"column1": "updated"},
+	}, {
+		Metadata: map[string]string{"action": "insert", "table": "keyed"},
+		Key:      sdk.StructuredData{"key": "5"},
+		Payload:  sdk.StructuredData{"column1": "inserted"},
+	}, {
+		Metadata: map[string]string{"action": "delete", "table": "keyed"},
+		Key:      sdk.StructuredData{"key": "3"},
+	}, {
+		Metadata: map[string]string{"action": "delete", "table": "keyed"},
+		Key:      sdk.StructuredData{"key": "missing"},
+	}}
+	for _, r := range records {
+		is.NoErr(d.Write(ctx, r))
+	}
+	is.Equal(d.WriteStats(), WriteStats{Inserted: 1, Updated: 1, Deleted: 1, Skipped: 1})
+}
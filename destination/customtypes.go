@@ -0,0 +1,293 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// values of pg_type.typtype
+	typeTypeEnum   = "e"
+	typeTypeDomain = "d"
+
+	// defaultGeoJSONSRID is the spatial reference system of GeoJSON
+	// coordinates, WGS 84 longitude and latitude.
+	defaultGeoJSONSRID = 4326
+)
+
+// customType is an enum or domain type defined in the target database.
+type customType struct {
+	oid  uint32
+	name string
+	// typeType is the value of pg_type.typtype, "e" for enums and "d" for
+	// domains.
+	typeType string
+	// baseOID is the OID of the underlying type of a domain.
+	baseOID uint32
+	// arrayOID is the OID of the array type, 0 if there is none.
+	arrayOID uint32
+	// members are the labels of an enum.
+	members []string
+}
+
+// registerCustomTypes loads the enum and domain types of the database and
+// registers them with the connection, so pgx can encode values of any type
+// into columns of these types and their arrays.
+func registerCustomTypes(ctx context.Context, conn *pgx.Conn) error {
+	types, err := loadCustomTypes(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("failed to load custom types: %w", err)
+	}
+	registerTypes(conn.ConnInfo(), types)
+	return nil
+}
+
+func loadCustomTypes(ctx context.Context, conn *pgx.Conn) ([]customType, error) {
+	// the labels are aggregated in a subquery, grouping by the oid alone only
+	// works on Postgres 14+, where it's the primary key of pg_type
+	query := `SELECT t.oid, format_type(t.oid, NULL), t.typtype::text, t.typbasetype, t.typarray,
+			ARRAY(SELECT e.enumlabel::text FROM pg_enum e WHERE e.enumtypid = t.oid ORDER BY e.enumsortorder)
+		FROM pg_type t
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		WHERE t.typtype IN ('e', 'd') AND n.nspname NOT IN ('pg_catalog', 'information_schema')`
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var types []customType
+	for rows.Next() {
+		var t customType
+		if err := rows.Scan(&t.oid, &t.name, &t.typeType, &t.baseOID, &t.arrayOID, &t.members); err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	return types, rows.Err()
+}
+
+// registerTypes registers the types and their arrays. Enums are registered
+// first, domains are registered once their base type is known, so domains can
+// be based on enums and other domains. Domains of unknown base types are
+// skipped, their values are sent as text.
+func registerTypes(ci *pgtype.ConnInfo, types []customType) {
+	pending := types
+	for len(pending) > 0 {
+		var next []customType
+		for _, t := range pending {
+			var newValue func() pgtype.ValueTranscoder
+			switch t.typeType {
+			case typeTypeEnum:
+				members := t.members
+				name := t.name
+				newValue = func() pgtype.ValueTranscoder {
+					return pgtype.NewEnumType(name, members)
+				}
+			case typeTypeDomain:
+				base, ok := ci.DataTypeForOID(t.baseOID)
+				if !ok {
+					next = append(next, t)
+					continue
+				}
+				if _, ok := base.Value.(pgtype.ValueTranscoder); !ok {
+					continue
+				}
+				newValue = func() pgtype.ValueTranscoder {
+					return pgtype.NewValue(base.Value).(pgtype.ValueTranscoder)
+				}
+			default:
+				continue
+			}
+
+			ci.RegisterDataType(pgtype.DataType{Value: newValue(), Name: t.name, OID: t.oid})
+			if t.arrayOID != 0 {
+				ci.RegisterDataType(pgtype.DataType{
+					Value: pgtype.NewArrayType(t.name+"[]", t.oid, newValue),
+					Name:  t.name + "[]",
+					OID:   t.arrayOID,
+				})
+			}
+		}
+		if len(next) == len(pending) {
+			// the remaining domains are based on types pgx doesn't know
+			return
+		}
+		pending = next
+	}
+}
+
+// isGeometryType returns true if the formatted type is a PostGIS geometry or
+// geography type.
+func isGeometryType(dataType string) bool {
+	return strings.HasPrefix(dataType, "geometry") || strings.HasPrefix(dataType, "geography")
+}
+
+// geometryText converts a value written into a geometry or geography column
+// into text PostGIS can parse. GeoJSON geometries, either as an object or a
+// string, are converted into EWKT with the SRID of the column or 4326 if the
+// column has none. Other strings, e.g. WKT, EWKT or hex encoded WKB, are kept.
+func geometryText(value interface{}, dataType string) (interface{}, error) {
+	var geoJSON map[string]interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		geoJSON = v
+	case string:
+		if !strings.HasPrefix(strings.TrimSpace(v), "{") {
+			return v, nil
+		}
+		dec := json.NewDecoder(strings.NewReader(v))
+		dec.UseNumber()
+		if err := dec.Decode(&geoJSON); err != nil {
+			return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+		}
+	default:
+		return value, nil
+	}
+
+	wkt, err := geoJSONToWKT(geoJSON)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GeoJSON: %w", err)
+	}
+	return fmt.Sprintf("SRID=%d;%s", columnSRID(dataType), wkt), nil
+}
+
+// columnSRID returns the SRID of a column formatted like geometry(Point,3857),
+// or the SRID of GeoJSON if the column doesn't declare one.
+func columnSRID(dataType string) int {
+	open := strings.Index(dataType, "(")
+	comma := strings.LastIndex(dataType, ",")
+	if open == -1 || comma < open || !strings.HasSuffix(dataType, ")") {
+		return defaultGeoJSONSRID
+	}
+	srid, err := strconv.Atoi(strings.TrimSpace(dataType[comma+1 : len(dataType)-1]))
+	if err != nil || srid <= 0 {
+		return defaultGeoJSONSRID
+	}
+	return srid
+}
+
+// geoJSONToWKT converts a GeoJSON geometry into WKT. Features are converted
+// into the WKT of their geometry.
+func geoJSONToWKT(g map[string]interface{}) (string, error) {
+	typ, _ := g["type"].(string)
+	var depth int
+	switch typ {
+	case "Feature":
+		geometry, ok := g["geometry"].(map[string]interface{})
+		if !ok {
+			return "", errors.New("feature has no geometry")
+		}
+		return geoJSONToWKT(geometry)
+	case "GeometryCollection":
+		geometries, _ := g["geometries"].([]interface{})
+		if len(geometries) == 0 {
+			return "GEOMETRYCOLLECTION EMPTY", nil
+		}
+		parts := make([]string, len(geometries))
+		for i, raw := range geometries {
+			geometry, ok := raw.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("geometry %d of collection is not an object", i)
+			}
+			wkt, err := geoJSONToWKT(geometry)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = wkt
+		}
+		return "GEOMETRYCOLLECTION(" + strings.Join(parts, ",") + ")", nil
+	case "Point":
+		depth = 0
+	case "MultiPoint", "LineString":
+		depth = 1
+	case "MultiLineString", "Polygon":
+		depth = 2
+	case "MultiPolygon":
+		depth = 3
+	default:
+		return "", fmt.Errorf("unsupported geometry type %q", typ)
+	}
+
+	name := strings.ToUpper(typ)
+	coordinates, ok := g["coordinates"].([]interface{})
+	if !ok || len(coordinates) == 0 {
+		return name + " EMPTY", nil
+	}
+	if depth == 0 {
+		position, err := wktPosition(coordinates)
+		if err != nil {
+			return "", err
+		}
+		return name + "(" + position + ")", nil
+	}
+	text, err := wktCoordinates(coordinates, depth)
+	if err != nil {
+		return "", err
+	}
+	return name + text, nil
+}
+
+// wktCoordinates formats nested coordinate arrays, depth is the number of
+// arrays around the positions.
+func wktCoordinates(coordinates []interface{}, depth int) (string, error) {
+	parts := make([]string, len(coordinates))
+	for i, raw := range coordinates {
+		nested, ok := raw.([]interface{})
+		if !ok {
+			return "", fmt.Errorf("expected coordinate array, got %T", raw)
+		}
+		var err error
+		if depth == 1 {
+			parts[i], err = wktPosition(nested)
+		} else {
+			parts[i], err = wktCoordinates(nested, depth-1)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "(" + strings.Join(parts, ",") + ")", nil
+}
+
+// wktPosition formats a position, e.g. [13.4, 52.5] becomes "13.4 52.5".
+func wktPosition(position []interface{}) (string, error) {
+	if len(position) < 2 {
+		return "", fmt.Errorf("position needs at least 2 coordinates, got %d", len(position))
+	}
+	parts := make([]string, len(position))
+	for i, raw := range position {
+		switch v := raw.(type) {
+		case json.Number:
+			parts[i] = v.String()
+		case float64:
+			parts[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case int:
+			parts[i] = strconv.Itoa(v)
+		default:
+			return "", fmt.Errorf("expected number in position, got %T", raw)
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
@@ -0,0 +1,117 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jackc/pgtype"
+	"github.com/matryer/is"
+)
+
+func TestRegisterTypes(t *testing.T) {
+	is := is.New(t)
+
+	ci := pgtype.NewConnInfo()
+	registerTypes(ci, []customType{
+		// domain based on another domain, registered after its base
+		{oid: 100003, name: "positive_mood", typeType: typeTypeDomain, baseOID: 100002},
+		{oid: 100002, name: "strict_mood", typeType: typeTypeDomain, baseOID: 100000},
+		{oid: 100000, name: "mood", typeType: typeTypeEnum, arrayOID: 100001, members: []string{"sad", "happy"}},
+		{oid: 100004, name: "email", typeType: typeTypeDomain, baseOID: pgtype.TextOID},
+		// based on a type pgx doesn't know
+		{oid: 100005, name: "location", typeType: typeTypeDomain, baseOID: 99999},
+	})
+
+	for _, oid := range []uint32{100000, 100001, 100002, 100003, 100004} {
+		_, ok := ci.DataTypeForOID(oid)
+		is.True(ok)
+	}
+	_, ok := ci.DataTypeForOID(100005)
+	is.True(!ok)
+
+	dt, _ := ci.DataTypeForOID(100001)
+	is.NoErr(dt.Value.Set([]interface{}{"sad", "happy"}))
+	text, err := dt.Value.(pgtype.TextEncoder).EncodeText(ci, nil)
+	is.NoErr(err)
+	is.Equal(string(text), "{sad,happy}")
+}
+
+func TestGeometryText(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    interface{}
+		dataType string
+		want     interface{}
+		wantErr  bool
+	}{{
+		name:     "wkt",
+		value:    "POINT(13.4 52.5)",
+		dataType: "geometry",
+		want:     "POINT(13.4 52.5)",
+	}, {
+		name: "geojson object",
+		value: map[string]interface{}{
+			"type":        "Point",
+			"coordinates": []interface{}{json.Number("13.4"), json.Number("52.5")},
+		},
+		dataType: "geography(Point,4326)",
+		want:     "SRID=4326;POINT(13.4 52.5)",
+	}, {
+		name:     "geojson string with column srid",
+		value:    `{"type":"LineString","coordinates":[[0,0],[1,1.5]]}`,
+		dataType: "geometry(LineString,3857)",
+		want:     "SRID=3857;LINESTRING(0 0,1 1.5)",
+	}, {
+		name:     "polygon",
+		value:    `{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1],[0,0]]]}`,
+		dataType: "geometry",
+		want:     "SRID=4326;POLYGON((0 0,1 0,1 1,0 0))",
+	}, {
+		name:     "multi polygon",
+		value:    `{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,0]]],[[[5,5],[6,5],[6,6],[5,5]]]]}`,
+		dataType: "geometry",
+		want:     "SRID=4326;MULTIPOLYGON(((0 0,1 0,1 1,0 0)),((5 5,6 5,6 6,5 5)))",
+	}, {
+		name:     "feature with collection",
+		value:    `{"type":"Feature","geometry":{"type":"GeometryCollection","geometries":[{"type":"Point","coordinates":[1,2,3]},{"type":"MultiPoint","coordinates":[]}]}}`,
+		dataType: "geometry",
+		want:     "SRID=4326;GEOMETRYCOLLECTION(POINT(1 2 3),MULTIPOINT EMPTY)",
+	}, {
+		name:     "unsupported type",
+		value:    `{"type":"Circle","coordinates":[1,2]}`,
+		dataType: "geometry",
+		wantErr:  true,
+	}, {
+		name:     "invalid position",
+		value:    `{"type":"Point","coordinates":[1]}`,
+		dataType: "geometry",
+		wantErr:  true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			got, err := geometryText(tc.value, tc.dataType)
+			if tc.wantErr {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(got, tc.want)
+		})
+	}
+}
@@ -15,14 +15,22 @@
 package destination
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/conduitio/conduit-connector-postgres/destination/internal/writer"
+	"github.com/conduitio/conduit-connector-postgres/retry"
+	"github.com/conduitio/conduit-connector-postgres/stats"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 )
 
@@ -34,80 +42,363 @@ type Destination struct {
 
 	conn   *pgx.Conn
 	config config
+	// lastUsed is the time conn was last used to write records.
+	lastUsed time.Time
+
+	// tables caches the column definitions of tables.
+	tables map[string]*tableInfo
+	// partitions caches the partitioning info of tables, nil entries mark
+	// tables that are not partitioned.
+	partitions map[string]*partitionInfo
+	// lastPosition is the position of the last record written before the
+	// destination was restarted, records up to this position are skipped. It
+	// is reset once a newer record is written.
+	lastPosition sdk.Position
+	// window contains the positions of the recently written records, it is
+	// nil if dedupWindow is not set.
+	window *positionWindow
+	// historyTables contains the quoted names of the history tables created
+	// in this run.
+	historyTables map[string]bool
+	// heavyFieldsTables contains the quoted names of the heavy fields tables
+	// created in this run.
+	heavyFieldsTables map[string]bool
+	// keyOrders contains the order of the last record written for each key,
+	// it is nil if outOfOrderRecords is ignore.
+	keyOrders *keyOrders
+
+	// rateLimiter limits the number of records written per second.
+	rateLimiter *rateLimiter
+	// writeSem limits the number of workers writing at the same time, see
+	// writeAssigned.
+	writeSem semaphore
+	// retry retries writes that failed with a transient error.
+	retry *retry.Budget
+	// deadLetterTable is the quoted name of the table oversized records are
+	// written into.
+	deadLetterTable string
+	// preview receives the statements that are not executed in dry run mode.
+	preview *statementPreview
+	// loads maps tables to the ID of the snapshot run they were truncated
+	// for in truncate-and-load mode.
+	loads map[string]string
+	// stagedLoads maps tables to the snapshot run currently loaded into their
+	// staging table.
+	stagedLoads map[string]*stagedLoad
+	// useMerge is true if upserts are executed with MERGE, it is set when
+	// the destination is opened and the server supports MERGE.
+	useMerge bool
+	// rowCounters contains the rows changed by committed writes, it is nil
+	// if countRows is disabled.
+	rowCounters *rowCounters
+	// pendingCounts contains the rows changed by the current write attempt.
+	pendingCounts rowCounts
+	// stats logs the counters of the destination periodically, it is nil
+	// until the destination is opened.
+	stats *stats.Logger
+
+	// buffer stores records until they are written by the drain goroutine,
+	// it is nil if no buffer is configured.
+	buffer *diskBuffer
+	// workers write buffered records concurrently, they are only opened if
+	// writeConcurrency is greater than 1.
+	workers []*Destination
+	// drainCancel stops the drain goroutine.
+	drainCancel context.CancelFunc
+	// drainDone is closed when the drain goroutine returns.
+	drainDone chan struct{}
+	drainM    sync.Mutex
+	// drainErr is the error that stopped the drain goroutine.
+	drainErr error
 }
 
 const (
-	actionDelete = "delete"
-	actionInsert = "insert"
-	actionUpdate = "update"
+	actionDelete   = "delete"
+	actionInsert   = "insert"
+	actionUpdate   = "update"
+	actionSnapshot = "snapshot"
+	// actionSchemaChange marks records describing a schema change of the
+	// source table, they are not written.
+	actionSchemaChange = "schema_change"
+	// actionSequence marks records containing the value of a sequence of the
+	// source table, they advance the sequence of the column in the table.
+	actionSequence = "sequence"
 )
 
-type config struct {
-	url           string
-	tableName     string
-	keyColumnName string
+// isRowChange returns false for records that don't describe a row, e.g.
+// schema changes and sequence values.
+func isRowChange(r sdk.Record) bool {
+	switch r.Metadata["action"] {
+	case actionSchemaChange, actionSequence:
+		return false
+	}
+	return true
 }
 
+// metadataPayloadBefore is the metadata key containing the row before an
+// update encoded as JSON.
+const metadataPayloadBefore = "payload.before"
+
+// codeReadOnlySQLTransaction is the SQLSTATE code of writes executed on a
+// server that only accepts reads.
+const codeReadOnlySQLTransaction = "25006"
+
 func NewDestination() sdk.Destination {
 	return &Destination{}
 }
 
 func (d *Destination) Configure(ctx context.Context, cfg map[string]string) error {
-	d.config = config{
-		url:           cfg["url"],
-		tableName:     cfg["table"],
-		keyColumnName: cfg["keyColumnName"],
+	config, err := parseConfig(cfg)
+	if err != nil {
+		return err
+	}
+	d.config = config
+	d.rateLimiter = newRateLimiter(config.maxRecordsPerSecond)
+	d.writeSem = newSemaphore(config.maxConcurrentWrites)
+	d.retry = retry.New(config.retry)
+	if config.countRows {
+		d.rowCounters = &rowCounters{}
 	}
 	return nil
 }
 
 func (d *Destination) Open(ctx context.Context) error {
-	if err := d.connect(ctx, d.config.url); err != nil {
+	err := d.retry.Do(ctx, "connect", func(ctx context.Context) error {
+		return d.connect(ctx, d.config.url)
+	})
+	if err != nil {
 		return fmt.Errorf("failed to connecto to postgres: %w", err)
 	}
+	if d.config.dryRun {
+		d.preview, err = openStatementPreview(d.config.dryRunPath)
+		if err != nil {
+			return err
+		}
+		sdk.Logger(ctx).Warn().Msg("dry run enabled, records are not written into the database")
+	}
+	// init SQL can change the session, e.g. the role, which should apply to
+	// the tables created below
+	if err := d.runInitSQL(ctx); err != nil {
+		return err
+	}
+	// init SQL can create the table, so it's checked afterwards
+	if d.config.healthCheck {
+		if err := d.checkHealth(ctx); err != nil {
+			return err
+		}
+	}
+	if d.config.upsertMethod == UpsertMethodMerge {
+		if err := d.detectMerge(ctx); err != nil {
+			return err
+		}
+	}
+	if d.config.createKeyIndex {
+		if err := d.ensureKeyIndex(ctx); err != nil {
+			return err
+		}
+	}
+	if d.config.trackPositions {
+		if err := d.createPositionTable(ctx); err != nil {
+			return err
+		}
+		pos, err := d.loadPosition(ctx)
+		if err != nil {
+			return err
+		}
+		if pos != nil {
+			sdk.Logger(ctx).Info().
+				Bytes("position", pos).
+				Msg("skipping records up to the last written position")
+		}
+		d.lastPosition = pos
+	}
+	if d.config.loadMode == LoadModeStaged && !d.config.dryRun {
+		if err := d.createStagedLoadsTable(ctx); err != nil {
+			return err
+		}
+		if d.stagedLoads, err = d.loadStagedLoads(ctx); err != nil {
+			return err
+		}
+	}
+	if d.config.dedupWindow > 0 {
+		if err := d.createWindowTable(ctx); err != nil {
+			return err
+		}
+		if d.window, err = d.loadWindow(ctx); err != nil {
+			return err
+		}
+	}
+	if d.config.outOfOrderRecords != OutOfOrderRecordsIgnore {
+		d.keyOrders = newKeyOrders(maxOrderedKeys)
+	}
+	if d.config.oversizedRecords == OversizedRecordsDeadLetter {
+		ident, err := parseTableName(d.config.deadLetterTable, d.config.schema)
+		if err != nil {
+			return err
+		}
+		d.deadLetterTable = ident.Sanitize()
+		if err := d.createDeadLetterTable(ctx); err != nil {
+			return err
+		}
+	}
+	if d.config.writeConcurrency > 1 {
+		if err := d.openWorkers(ctx); err != nil {
+			return err
+		}
+	}
+	if d.config.bufferPath != "" {
+		d.buffer, err = openDiskBuffer(ctx, d.config.bufferPath, d.config.bufferMaxRecords)
+		if err != nil {
+			return err
+		}
+		d.startDrain(ctx)
+	}
+	d.stats = stats.New(d.config.statsInterval, d.statsFields)
+	d.stats.Start(ctx)
 	return nil
 }
 
+// Write writes the record into the database. If maxRecordsPerSecond is
+// reached, it blocks until the record can be written or the context is
+// canceled.
 func (d *Destination) Write(ctx context.Context, record sdk.Record) error {
-	return d.write(ctx, record)
-}
-
-func (d *Destination) Flush(context.Context) error {
+	if err := d.rateLimiter.Wait(ctx); err != nil {
+		return err
+	}
+	record, err := d.generateKey(record)
+	if err != nil {
+		return err
+	}
+	if ok, err := d.checkOrder(ctx, record); err != nil || !ok {
+		return err
+	}
+	if err := d.truncateForLoad(ctx, []sdk.Record{record}); err != nil {
+		return err
+	}
+	if err := d.stageForLoad(ctx, []sdk.Record{record}); err != nil {
+		return err
+	}
+	if err := d.createHistoryTables(ctx, []sdk.Record{record}); err != nil {
+		return err
+	}
+	if err := d.createHeavyFieldsTables(ctx, []sdk.Record{record}); err != nil {
+		return err
+	}
+	err = d.retryWrite(ctx, "write", func(ctx context.Context) error {
+		// the change, its heavy fields and its history are written in one
+		// transaction
+		if d.config.trackPositions || d.window != nil || d.config.writeHistory ||
+			d.config.heavyFieldsMode == HeavyFieldsModeSideTable {
+			return d.writeWithPosition(ctx, record)
+		}
+		return d.write(ctx, record)
+	})
+	if err != nil {
+		return err
+	}
+	if d.config.validateWrites && isRowChange(record) {
+		d.validateWrite(ctx, record)
+	}
 	return nil
 }
 
 func (d *Destination) Teardown(ctx context.Context) error {
+	if d.buffer != nil {
+		d.stopDrain(ctx)
+		if err := d.buffer.Close(); err != nil {
+			return fmt.Errorf("failed to close buffer: %w", err)
+		}
+	}
+	if err := d.closeWorkers(ctx); err != nil {
+		return fmt.Errorf("failed to close writer connection: %w", err)
+	}
+	d.stats.Stop(ctx)
+	// the connection is closed even if the teardown SQL fails
+	teardownErr := d.runTeardownSQL(ctx)
+	if d.preview != nil {
+		if err := d.preview.Close(); err != nil {
+			return fmt.Errorf("failed to close dry run file: %w", err)
+		}
+	}
 	if d.conn != nil {
-		return d.conn.Close(ctx)
+		if err := d.conn.Close(ctx); err != nil {
+			return err
+		}
 	}
-	return nil
+	return teardownErr
 }
 
 func (d *Destination) connect(ctx context.Context, uri string) error {
-	conn, err := pgx.Connect(ctx, uri)
+	conn, err := d.config.session.Connect(ctx, uri)
 	if err != nil {
 		return fmt.Errorf("failed to open connection: %w", err)
 	}
+	if d.config.dialect.readsCatalog() {
+		if err := registerCustomTypes(ctx, conn); err != nil {
+			_ = conn.Close(ctx)
+			return err
+		}
+	}
 	d.conn = conn
+	d.lastUsed = time.Now()
+	return nil
+}
+
+// isReadOnlyError returns true if the error was caused by writing to a server
+// that only accepts reads, e.g. a primary that was demoted to a standby.
+func isReadOnlyError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == codeReadOnlySQLTransaction
+}
+
+// write applies the change of the record, see apply. If heavy fields are
+// written into a side table, they are written next. If writeHistory is
+// enabled, the change is mirrored into the history table of the table.
+func (d *Destination) write(ctx context.Context, r sdk.Record) error {
+	r, ok, err := d.checkRecordSize(ctx, r)
+	if err != nil || !ok {
+		return err
+	}
+	if err := d.apply(ctx, r); err != nil {
+		return err
+	}
+	if isRowChange(r) {
+		if err := d.writeHeavyFields(ctx, r); err != nil {
+			return err
+		}
+	}
+	if d.config.writeHistory && isRowChange(r) {
+		return d.writeHistory(ctx, r)
+	}
 	return nil
 }
 
-// write routes incoming records to their appropriate handler based on the
+// apply routes incoming records to their appropriate handler based on the
 // action declared in the metadata.
 // Defaults to insert behavior if no action is specified.
-func (d *Destination) write(ctx context.Context, r sdk.Record) error {
+func (d *Destination) apply(ctx context.Context, r sdk.Record) error {
 	action, ok := r.Metadata["action"]
 	if !ok {
 		return d.handleInsert(ctx, r)
 	}
 
 	switch action {
-	case actionInsert:
+	case actionInsert, actionSnapshot:
+		if d.isLoad(r) {
+			return d.load(ctx, r)
+		}
 		return d.handleInsert(ctx, r)
 	case actionUpdate:
 		return d.handleUpdate(ctx, r)
 	case actionDelete:
 		return d.handleDelete(ctx, r)
+	case actionSchemaChange:
+		sdk.Logger(ctx).Info().
+			Str("table", r.Metadata["table"]).
+			Msg("skipping schema change record, schema changes are not applied to the destination")
+		return nil
+	case actionSequence:
+		return d.advanceSequence(ctx, r)
 	default:
 		return d.handleInsert(ctx, r)
 	}
@@ -117,11 +408,12 @@ func (d *Destination) write(ctx context.Context, r sdk.Record) error {
 // plainly insert the data.
 // * If a key exists, but no key column name is configured, it attempts a plain
 // insert to that database.
+// * A key generated by the connector is new, so it's inserted as well.
 func (d *Destination) handleInsert(ctx context.Context, r sdk.Record) error {
 	if !hasKey(r) {
 		return d.insert(ctx, r)
 	}
-	if d.config.keyColumnName == "" {
+	if d.config.keyColumnName == "" || hasGeneratedKey(r) {
 		return d.insert(ctx, r)
 	}
 	return d.upsert(ctx, r)
@@ -143,66 +435,207 @@ func (d *Destination) handleDelete(ctx context.Context, r sdk.Record) error {
 }
 
 func (d *Destination) upsert(ctx context.Context, r sdk.Record) error {
+	row, err := d.prepareUpsert(ctx, r)
+	if err != nil {
+		return err
+	}
+	return d.execUpsert(ctx, r, row)
+}
+
+// upsertRow is a record prepared to be upserted into a table.
+type upsertRow struct {
+	key           sdk.StructuredData
+	payload       sdk.StructuredData
+	keyColumnName string
+	// tableName is the table the row is written into, it's the partition if
+	// the row is routed to a partition.
+	tableName string
+	// identityColumns and nullColumns are passed to writer.Options.
+	identityColumns []string
+	nullColumns     []string
+	// before is the row before the update if conditional updates are
+	// enabled and the record contains it.
+	before sdk.StructuredData
+}
+
+// prepareUpsert extracts the key and payload of the record and determines the
+// table and columns they are written into.
+func (d *Destination) prepareUpsert(ctx context.Context, r sdk.Record) (upsertRow, error) {
 	payload, err := getPayload(r)
 	if err != nil {
-		return fmt.Errorf("failed to get payload: %w", err)
+		return upsertRow{}, fmt.Errorf("failed to get payload: %w", err)
 	}
 
-	key, err := getKey(r)
+	key, err := d.getKey(r)
 	if err != nil {
-		return fmt.Errorf("failed to get key: %w", err)
+		return upsertRow{}, fmt.Errorf("failed to get key: %w", err)
 	}
 
-	keyColumnName := getKeyColumnName(key, d.config.keyColumnName)
+	row := upsertRow{
+		key:           key,
+		payload:       payload,
+		keyColumnName: getKeyColumnName(key, d.config.keyColumnName),
+	}
 
-	tableName, err := d.getTableName(r.Metadata)
+	row.tableName, err = d.getRowTableName(r)
 	if err != nil {
-		return fmt.Errorf("failed to get table name for write: %w", err)
+		return upsertRow{}, fmt.Errorf("failed to get table name for write: %w", err)
 	}
 
-	query, args, err := formatUpsertQuery(key, payload, keyColumnName, tableName)
+	err = d.prepareValues(ctx, row.tableName, payload)
+	if err != nil {
+		return upsertRow{}, err
+	}
+	d.removeTimestampFields(payload)
+	if d.config.conditionalUpdates {
+		row.before, err = getBefore(r)
+		if err != nil {
+			return upsertRow{}, fmt.Errorf("failed to get row before update: %w", err)
+		}
+		if row.before != nil {
+			if err := d.prepareValues(ctx, row.tableName, row.before); err != nil {
+				return upsertRow{}, err
+			}
+		}
+	}
+	if d.config.dialect.readsCatalog() {
+		// MERGE doesn't need a unique index on the key column, so it doesn't
+		// have to include the partition key, a custom conflict target is
+		// validated by Postgres
+		if !d.useMerge && d.config.conflictTarget == "" {
+			err = d.validatePartitionedUpsert(ctx, row.tableName, row.keyColumnName)
+			if err != nil {
+				return upsertRow{}, err
+			}
+		}
+		row.identityColumns, err = d.excludeSystemColumns(ctx, row.tableName, key, payload)
+		if err != nil {
+			return upsertRow{}, err
+		}
+		if d.config.treatMissingAsNull {
+			row.nullColumns, err = d.missingColumns(ctx, row.tableName, key, payload)
+			if err != nil {
+				return upsertRow{}, err
+			}
+		}
+		row.tableName, err = d.routeToPartition(ctx, row.tableName, key, payload)
+		if err != nil {
+			return upsertRow{}, err
+		}
+	}
+	return row, nil
+}
+
+// writerRow returns the row passed to the statement writers.
+func (r upsertRow) writerRow() writer.Row {
+	return writer.Row{
+		Table:     r.tableName,
+		KeyColumn: r.keyColumnName,
+		Key:       r.key,
+		Payload:   r.payload,
+	}
+}
+
+// upsertOptions returns the options of the statement upserting the row.
+func (d *Destination) upsertOptions(row upsertRow) writer.Options {
+	return writer.Options{
+		IdentityColumns: row.identityColumns,
+		MergeColumns:    d.config.jsonMergeColumns,
+		NullColumns:     row.nullColumns,
+		Before:          row.before,
+		ConflictTarget:  d.config.conflictTarget,
+		CreatedAtColumn: d.config.setCreatedAtColumn,
+		UpdatedAtColumn: d.config.setUpdatedAtColumn,
+
+		UpdateColumns:     d.config.updateColumns,
+		ExcludeFromUpdate: d.config.excludeFromUpdate,
+		ColumnExpressions: d.config.columnExpressions,
+	}
+}
+
+// upsertWriter returns the writer formatting the upsert of the row.
+func (d *Destination) upsertWriter(row upsertRow) writer.UpsertWriter {
+	switch {
+	case d.useMerge:
+		return writer.Merge{}
+	case d.config.dialect == DialectCockroachDB && len(d.config.jsonMergeColumns) == 0 && row.before == nil && d.config.conflictTarget == "" &&
+		d.config.setCreatedAtColumn == "" && d.config.setUpdatedAtColumn == "" &&
+		len(d.config.updateColumns) == 0 && len(d.config.excludeFromUpdate) == 0:
+		// UPSERT replaces all columns, including the created at column
+		return writer.Cockroach{}
+	default:
+		return writer.Postgres{}
+	}
+}
+
+// execUpsert writes a single prepared row.
+func (d *Destination) execUpsert(ctx context.Context, r sdk.Record, row upsertRow) error {
+	if !d.config.dialect.supportsOnConflict() {
+		return d.deleteAndInsert(ctx, row.writerRow())
+	}
+
+	opts := d.upsertOptions(row)
+	if d.useMerge {
+		// MERGE casts the parameters to the column types
+		info, err := d.getTableInfo(ctx, row.tableName)
+		if err != nil {
+			return err
+		}
+		opts.ColumnTypes = info
+	}
+	stmt, err := d.upsertWriter(row).Upsert(row.writerRow(), opts)
 	if err != nil {
 		return fmt.Errorf("error formatting query: %w", err)
 	}
 
-	_, err = d.conn.Exec(ctx, query, args...)
+	affected, err := d.execUpsertQuery(ctx, stmt.SQL, stmt.Args, 1)
 	if err != nil {
 		return fmt.Errorf("insert exec failed: %w", err)
 	}
+	if row.before != nil && affected == 0 && !d.config.dryRun {
+		sdk.Logger(ctx).Warn().
+			Str("table", row.tableName).
+			Bytes("position", r.Position).
+			Msg("skipping update, the stored row doesn't match the row before the update")
+	}
 
 	return nil
 }
 
 func (d *Destination) remove(ctx context.Context, r sdk.Record) error {
-	key, err := getKey(r)
+	key, err := d.getKey(r)
 	if err != nil {
 		return err
 	}
 	keyColumnName := getKeyColumnName(key, d.config.keyColumnName)
-	tableName, err := d.getTableName(r.Metadata)
+	tableName, err := d.getRowTableName(r)
 	if err != nil {
 		return fmt.Errorf("failed to get table name for write: %w", err)
 	}
-	query, args, err := psql.
-		Delete(tableName).
-		Where(sq.Eq{keyColumnName: key[keyColumnName]}).
-		ToSql()
+	stmt, err := writer.Postgres{}.Delete(
+		writer.Row{Table: tableName, KeyColumn: keyColumnName, Key: key},
+		writer.Options{ColumnExpressions: d.config.columnExpressions},
+	)
 	if err != nil {
 		return fmt.Errorf("error formatting delete query: %w", err)
 	}
-	_, err = d.conn.Exec(ctx, query, args...)
-	return err
+	tag, err := d.exec(ctx, stmt.SQL, stmt.Args...)
+	if err != nil {
+		return err
+	}
+	d.countDeletes(tag, 1)
+	return nil
 }
 
 // insert is an append-only operation that doesn't care about keys, but
 // can error on constraints violations so should only be used when no table
 // key or unique constraints are otherwise present.
 func (d *Destination) insert(ctx context.Context, r sdk.Record) error {
-	tableName, err := d.getTableName(r.Metadata)
+	tableName, err := d.getRowTableName(r)
 	if err != nil {
 		return err
 	}
-	key, err := getKey(r)
+	key, err := d.getKey(r)
 	if err != nil {
 		return err
 	}
@@ -210,17 +643,38 @@ func (d *Destination) insert(ctx context.Context, r sdk.Record) error {
 	if err != nil {
 		return err
 	}
-	colArgs, valArgs := formatColumnsAndValues(key, payload)
-	query, args, err := psql.
-		Insert(tableName).
-		Columns(colArgs...).
-		Values(valArgs...).
-		ToSql()
+	err = d.prepareValues(ctx, tableName, payload)
+	if err != nil {
+		return err
+	}
+	d.removeTimestampFields(payload)
+	d.removeKeyField(key, payload)
+	var identityColumns []string
+	if d.config.dialect.readsCatalog() {
+		identityColumns, err = d.excludeSystemColumns(ctx, tableName, key, payload)
+		if err != nil {
+			return err
+		}
+		tableName, err = d.routeToPartition(ctx, tableName, key, payload)
+		if err != nil {
+			return err
+		}
+	}
+	stmt, err := writer.Postgres{}.Insert(writer.Row{Table: tableName, Key: key, Payload: payload}, writer.InsertOptions{
+		DedupColumn:           d.config.dedupColumn,
+		OverridingSystemValue: len(identityColumns) > 0,
+		TimestampColumns:      []string{d.config.setCreatedAtColumn, d.config.setUpdatedAtColumn},
+		ColumnExpressions:     d.config.columnExpressions,
+	})
 	if err != nil {
 		return fmt.Errorf("error formatting insert query: %w", err)
 	}
-	_, err = d.conn.Exec(ctx, query, args...)
-	return err
+	tag, err := d.exec(ctx, stmt.SQL, stmt.Args...)
+	if err != nil {
+		return err
+	}
+	d.countInserts(tag, 1)
+	return nil
 }
 
 func getPayload(r sdk.Record) (sdk.StructuredData, error) {
@@ -230,6 +684,36 @@ func getPayload(r sdk.Record) (sdk.StructuredData, error) {
 	return structuredDataFormatter(r.Payload.Bytes())
 }
 
+// getBefore returns the row before the update from the record metadata or nil
+// if the record doesn't contain it.
+func getBefore(r sdk.Record) (sdk.StructuredData, error) {
+	raw, ok := r.Metadata[metadataPayloadBefore]
+	if !ok {
+		return nil, nil
+	}
+	return structuredDataFormatter([]byte(raw))
+}
+
+// getKey returns the key of the record with field names converted into column
+// names.
+func (d *Destination) getKey(r sdk.Record) (sdk.StructuredData, error) {
+	if v, ok := rawKey(r); ok {
+		if d.config.keyColumnName == "" {
+			return nil, fmt.Errorf("key is not a JSON object, %q needs to be set to write raw keys", ConfigKeyKeyColumnName)
+		}
+		// keyColumnName is the name of the column, it's not converted
+		return sdk.StructuredData{d.config.keyColumnName: v}, nil
+	}
+	key, err := getKey(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := convertFieldNames(key, d.config.fieldNameConversion); err != nil {
+		return nil, fmt.Errorf("failed to convert key field names: %w", err)
+	}
+	return key, nil
+}
+
 func getKey(r sdk.Record) (sdk.StructuredData, error) {
 	if r.Key == nil {
 		return sdk.StructuredData{}, nil
@@ -237,97 +721,78 @@ func getKey(r sdk.Record) (sdk.StructuredData, error) {
 	return structuredDataFormatter(r.Key.Bytes())
 }
 
+// rawKey returns the value of a key that isn't a JSON object, e.g. a plain
+// string ID of a Kafka message. A JSON string is unquoted, any other value is
+// returned as text and converted to the type of the key column by pgx. It
+// returns false if the key is empty or a JSON object.
+func rawKey(r sdk.Record) (interface{}, bool) {
+	if r.Key == nil {
+		return nil, false
+	}
+	if _, ok := r.Key.(sdk.StructuredData); ok {
+		return nil, false
+	}
+	raw := bytes.TrimSpace(r.Key.Bytes())
+	if len(raw) == 0 || raw[0] == '{' {
+		return nil, false
+	}
+	var s string
+	if raw[0] == '"' && json.Unmarshal(raw, &s) == nil {
+		return s, true
+	}
+	return string(raw), true
+}
+
+// structuredDataFormatter parses raw JSON into structured data. Numbers are
+// decoded as json.Number instead of float64, so bigints above 2^53 and decimals
+// keep their precision.
 func structuredDataFormatter(raw []byte) (sdk.StructuredData, error) {
 	if len(raw) == 0 {
 		return sdk.StructuredData{}, nil
 	}
 	data := make(map[string]interface{})
-	err := json.Unmarshal(raw, &data)
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	err := dec.Decode(&data)
 	if err != nil {
 		return nil, err
 	}
-	return data, nil
-}
-
-// formatUpsertQuery manually formats the UPSERT and ON CONFLICT query statements.
-// The `ON CONFLICT` portion of this query needs to specify the constraint
-// name.
-// * In our case, we can only rely on the record.Key's parsed key value.
-// * If other schema constraints prevent a write, this won't upsert on
-// that conflict.
-func formatUpsertQuery(
-	key sdk.StructuredData,
-	payload sdk.StructuredData,
-	keyColumnName string,
-	tableName string,
-) (string, []interface{}, error) {
-	upsertQuery := fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET", keyColumnName)
-	for column := range payload {
-		// tuples form a comma separated list, so they need a comma at the end.
-		// `EXCLUDED` references the new record's values. This will overwrite
-		// every column's value except for the key column.
-		tuple := fmt.Sprintf("%s=EXCLUDED.%s,", column, column)
-		// TODO: Consider removing this space.
-		upsertQuery += " "
-		// add the tuple to the query string
-		upsertQuery += tuple
-	}
-
-	// remove the last comma from the list of tuples
-	upsertQuery = strings.TrimSuffix(upsertQuery, ",")
-
-	// we have to manually append a semi colon to the upsert sql;
-	upsertQuery += ";"
-
-	colArgs, valArgs := formatColumnsAndValues(key, payload)
-
-	query, args, err := psql.
-		Insert(tableName).
-		Columns(colArgs...).
-		Values(valArgs...).
-		SuffixExpr(sq.Expr(upsertQuery)).
-		ToSql()
-	if err != nil {
-		return "", nil, fmt.Errorf("error formatting query: %w", err)
-	}
-
-	return query, args, nil
-}
-
-// formatColumnsAndValues turns the key and payload into a slice of ordered
-// columns and values for upserting into Postgres.
-func formatColumnsAndValues(key, payload sdk.StructuredData) ([]string, []interface{}) {
-	var colArgs []string
-	var valArgs []interface{}
-
-	// range over both the key and payload values in order to format the
-	// query for args and values in proper order
-	for key, val := range key {
-		colArgs = append(colArgs, key)
-		valArgs = append(valArgs, val)
-		delete(payload, key) // NB: Delete Key from payload arguments
-	}
-
-	for field, value := range payload {
-		colArgs = append(colArgs, field)
-		valArgs = append(valArgs, value)
+	for k, v := range data {
+		if n, ok := v.(json.Number); ok {
+			// pgx doesn't know json.Number, pass the number as a string and
+			// let pgx convert it to the type of the column. Nested numbers
+			// stay json.Number, they are encoded back to JSON as is.
+			data[k] = n.String()
+		}
 	}
-
-	return colArgs, valArgs
+	return data, nil
 }
 
 // return either the records metadata value for table or the default configured
 // value for table. Otherwise it will error since we require some table to be
-// set to write into.
+// set to write into. The table name is qualified with the configured schema if
+// it doesn't contain one and returned as a quoted identifier.
 func (d *Destination) getTableName(metadata map[string]string) (string, error) {
+	return d.getSuffixedTableName(metadata, "")
+}
+
+// getSuffixedTableName returns the quoted name of the table the record is
+// written into with the suffix appended to the name of the table, the schema
+// stays the same.
+func (d *Destination) getSuffixedTableName(metadata map[string]string, suffix string) (string, error) {
 	tableName, ok := metadata["table"]
 	if !ok {
 		if d.config.tableName == "" {
 			return "", fmt.Errorf("no table provided for default writes")
 		}
-		return d.config.tableName, nil
+		tableName = d.config.tableName
+	}
+	ident, err := parseTableName(tableName, d.config.schema)
+	if err != nil {
+		return "", err
 	}
-	return tableName, nil
+	ident[len(ident)-1] += suffix
+	return ident.Sanitize(), nil
 }
 
 // getKeyColumnName will return the name of the first item in the key or the
@@ -345,6 +810,36 @@ func getKeyColumnName(key sdk.StructuredData, defaultKeyName string) string {
 	return defaultKeyName
 }
 
+// removeTimestampFields removes the fields of the timestamp columns from the
+// payload, the columns are maintained by the destination.
+func (d *Destination) removeTimestampFields(payload sdk.StructuredData) {
+	if d.config.setCreatedAtColumn != "" {
+		delete(payload, d.config.setCreatedAtColumn)
+	}
+	if d.config.setUpdatedAtColumn != "" {
+		delete(payload, d.config.setUpdatedAtColumn)
+	}
+}
+
+// sortedFields returns the field names of the data in alphabetical order.
+func sortedFields(data sdk.StructuredData) []string {
+	fields := make([]string, 0, len(data))
+	for field := range data {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 func hasKey(r sdk.Record) bool {
 	return r.Key != nil && len(r.Key.Bytes()) > 0
 }
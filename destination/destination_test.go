@@ -16,6 +16,7 @@ package destination
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 
 	sdk "github.com/conduitio/conduit-connector-sdk"
@@ -177,6 +178,87 @@ func TestAdapter_Write(t *testing.T) {
 		})
 	}
 }
+
+func TestDestination_MissingColumns(t *testing.T) {
+	is := is.New(t)
+
+	d := &Destination{
+		config: config{
+			dedupColumn:   "hash",
+			excludeFields: []string{"internal"},
+		},
+		tables: map[string]*tableInfo{"users": {columns: map[string]tableColumn{
+			"id":       {name: "id", identity: "d"},
+			"name":     {name: "name"},
+			"email":    {name: "email"},
+			"phone":    {name: "phone"},
+			"search":   {name: "search", generated: true},
+			"hash":     {name: "hash"},
+			"internal": {name: "internal"},
+		}}},
+	}
+
+	got, err := d.missingColumns(context.Background(), "users",
+		sdk.StructuredData{"id": 1},
+		sdk.StructuredData{"name": "foo", "email": nil},
+	)
+	is.NoErr(err)
+	is.Equal(got, []string{"phone"})
+}
+
+func TestGetBefore(t *testing.T) {
+	is := is.New(t)
+
+	before, err := getBefore(sdk.Record{})
+	is.NoErr(err)
+	is.Equal(before, nil)
+
+	before, err = getBefore(sdk.Record{Metadata: map[string]string{
+		metadataPayloadBefore: `{"id":1,"name":"foo"}`,
+	}})
+	is.NoErr(err)
+	is.Equal(before, sdk.StructuredData{"id": "1", "name": "foo"})
+}
+
+func TestDestination_GetKeyRaw(t *testing.T) {
+	is := is.New(t)
+	d := &Destination{config: config{keyColumnName: "id"}}
+
+	tests := []struct {
+		key  sdk.Data
+		want sdk.StructuredData
+	}{
+		{key: sdk.RawData("user-1"), want: sdk.StructuredData{"id": "user-1"}},
+		{key: sdk.RawData(`"user-1"`), want: sdk.StructuredData{"id": "user-1"}},
+		{key: sdk.RawData("42"), want: sdk.StructuredData{"id": "42"}},
+		{key: sdk.RawData(`{"id":42}`), want: sdk.StructuredData{"id": "42"}},
+		{key: sdk.StructuredData{"id": "user-1"}, want: sdk.StructuredData{"id": "user-1"}},
+	}
+	for _, tt := range tests {
+		got, err := d.getKey(sdk.Record{Key: tt.key})
+		is.NoErr(err)
+		is.Equal(got, tt.want)
+	}
+
+	d.config.keyColumnName = ""
+	_, err := d.getKey(sdk.Record{Key: sdk.RawData("user-1")})
+	is.Equal(err.Error(), `key is not a JSON object, "keyColumnName" needs to be set to write raw keys`)
+}
+
+func TestStructuredDataFormatter_Numbers(t *testing.T) {
+	is := is.New(t)
+
+	got, err := structuredDataFormatter([]byte(`{"id":9007199254740993,"price":12.3456789012345678901,"attrs":{"count":9007199254740993}}`))
+	is.NoErr(err)
+	is.Equal(got["id"], "9007199254740993")
+	is.Equal(got["price"], "12.3456789012345678901")
+
+	// nested numbers are encoded back to JSON without losing precision
+	attrs, err := json.Marshal(got["attrs"])
+	is.NoErr(err)
+	is.Equal(string(attrs), `{"count":9007199254740993}`)
+}
+
 func getTestPostgres(t *testing.T) *pgx.Conn {
 	is := is.New(t)
 	prepareDB := []string{
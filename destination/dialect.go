@@ -0,0 +1,150 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/conduitio/conduit-connector-postgres/destination/internal/writer"
+)
+
+// Dialect adjusts the generated SQL for databases that are compatible with
+// Postgres, but don't support all of its features.
+type Dialect string
+
+const (
+	// DialectPostgres generates SQL for Postgres.
+	DialectPostgres Dialect = "postgres"
+	// DialectCockroachDB uses UPSERT statements instead of INSERT ... ON
+	// CONFLICT. UPSERT always resolves conflicts on the primary key.
+	DialectCockroachDB Dialect = "cockroachdb"
+	// DialectTimescaleDB validates conflict targets of upserts into
+	// hypertables, which need to include the time dimension.
+	DialectTimescaleDB Dialect = "timescaledb"
+	// DialectRedshift doesn't support ON CONFLICT, upserts are executed as a
+	// DELETE followed by an INSERT in a single transaction.
+	DialectRedshift Dialect = "redshift"
+)
+
+var dialectAll = []Dialect{DialectPostgres, DialectCockroachDB, DialectTimescaleDB, DialectRedshift}
+
+func isDialectSupported(raw string) bool {
+	for _, d := range dialectAll {
+		if string(d) == raw {
+			return true
+		}
+	}
+	return false
+}
+
+// readsCatalog returns true if the dialect exposes the Postgres catalog
+// tables used to detect partitioned tables, identity and generated columns.
+func (d Dialect) readsCatalog() bool {
+	return d == DialectPostgres || d == DialectTimescaleDB
+}
+
+// supportsOnConflict returns true if the dialect supports INSERT ... ON
+// CONFLICT.
+func (d Dialect) supportsOnConflict() bool {
+	return d != DialectRedshift
+}
+
+// supportsJSON returns true if the dialect supports the jsonb type and its
+// functions.
+func (d Dialect) supportsJSON() bool {
+	return d != DialectRedshift
+}
+
+// supportsCopy returns true if the dialect supports COPY FROM STDIN.
+func (d Dialect) supportsCopy() bool {
+	return d != DialectRedshift
+}
+
+// supportsDeferredConstraints returns true if the dialect supports SET
+// CONSTRAINTS ALL DEFERRED.
+func (d Dialect) supportsDeferredConstraints() bool {
+	return d == DialectPostgres || d == DialectTimescaleDB
+}
+
+// supportsSessionReplicationRole returns true if the dialect supports the
+// session_replication_role setting.
+func (d Dialect) supportsSessionReplicationRole() bool {
+	return d == DialectPostgres || d == DialectTimescaleDB
+}
+
+// supportsXmax returns true if rows have the xmax system column, which is 0
+// for rows inserted by an upsert.
+func (d Dialect) supportsXmax() bool {
+	return d == DialectPostgres || d == DialectTimescaleDB
+}
+
+// deleteAndInsert replaces the row with the key for dialects that don't
+// support ON CONFLICT. Both statements are executed in a transaction, so
+// readers never observe the row as missing.
+func (d *Destination) deleteAndInsert(ctx context.Context, row writer.Row) error {
+	w := writer.Postgres{}
+	exprs := d.config.columnExpressions
+	deleteStmt, err := w.Delete(row, writer.Options{ColumnExpressions: exprs})
+	if err != nil {
+		return fmt.Errorf("error formatting delete query: %w", err)
+	}
+	insertStmt, err := w.Insert(row, writer.InsertOptions{ColumnExpressions: exprs})
+	if err != nil {
+		return fmt.Errorf("error formatting insert query: %w", err)
+	}
+
+	tx, err := d.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // no-op if the transaction is committed
+
+	// the transaction is open on the connection, so all writes executed on
+	// the connection are part of the transaction
+	if _, err := d.exec(ctx, deleteStmt.SQL, deleteStmt.Args...); err != nil {
+		return fmt.Errorf("delete exec failed: %w", err)
+	}
+	if _, err := d.exec(ctx, insertStmt.SQL, insertStmt.Args...); err != nil {
+		return fmt.Errorf("insert exec failed: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// loadHypertableDimensions returns the dimension columns of a TimescaleDB
+// hypertable or nil if the table is not a hypertable. Unique indexes on a
+// hypertable need to include all dimension columns, same as the partition key
+// of a partitioned table.
+func (d *Destination) loadHypertableDimensions(ctx context.Context, table string) ([]partitionKeyColumn, error) {
+	query := `SELECT column_name, column_type::text
+		FROM timescaledb_information.dimensions
+		WHERE format('%I.%I', hypertable_schema, hypertable_name)::regclass = $1::regclass
+		ORDER BY dimension_number`
+	rows, err := d.conn.Query(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keyColumns []partitionKeyColumn
+	for rows.Next() {
+		var col partitionKeyColumn
+		if err := rows.Scan(&col.name, &col.dataType); err != nil {
+			return nil, err
+		}
+		keyColumns = append(keyColumns, col)
+	}
+	return keyColumns, rows.Err()
+}
@@ -0,0 +1,95 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgconn"
+)
+
+// exec executes a statement that changes the database. In dry run mode the
+// statement is previewed instead and an empty command tag is returned.
+func (d *Destination) exec(ctx context.Context, query string, args ...interface{}) (pgconn.CommandTag, error) {
+	if !d.config.dryRun {
+		return d.conn.Exec(ctx, query, args...)
+	}
+	if err := d.preview.write(ctx, query, args); err != nil {
+		return nil, fmt.Errorf("failed to preview statement: %w", err)
+	}
+	return nil, nil
+}
+
+// statementPreview receives the statements skipped in dry run mode. They are
+// written as JSON lines into a file if one is configured, otherwise they are
+// logged.
+type statementPreview struct {
+	m sync.Mutex
+	w io.WriteCloser
+}
+
+// previewedStatement is the representation of a statement in the preview file.
+type previewedStatement struct {
+	Query string        `json:"query"`
+	Args  []interface{} `json:"args"`
+}
+
+// openStatementPreview opens the preview. If path is not empty, statements
+// are appended to the file at path.
+func openStatementPreview(path string) (*statementPreview, error) {
+	p := &statementPreview{}
+	if path == "" {
+		return p, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dry run file %s: %w", path, err)
+	}
+	p.w = f
+	return p, nil
+}
+
+func (p *statementPreview) write(ctx context.Context, query string, args []interface{}) error {
+	if p.w == nil {
+		sdk.Logger(ctx).Info().
+			Str("query", query).
+			Interface("args", args).
+			Msg("dry run, skipping statement")
+		return nil
+	}
+
+	line, err := json.Marshal(previewedStatement{Query: query, Args: args})
+	if err != nil {
+		return err
+	}
+	p.m.Lock()
+	defer p.m.Unlock()
+	_, err = p.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the preview file.
+func (p *statementPreview) Close() error {
+	if p.w == nil {
+		return nil
+	}
+	return p.w.Close()
+}
@@ -0,0 +1,56 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestDestination_DryRun(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "statements.jsonl")
+
+	preview, err := openStatementPreview(path)
+	is.NoErr(err)
+	d := &Destination{
+		config:  config{dryRun: true, keyColumnName: "id"},
+		preview: preview,
+	}
+
+	// the connection is nil, so the statement must not be executed
+	err = d.execUpsert(ctx, sdk.Record{}, upsertRow{
+		key:           sdk.StructuredData{"id": 1},
+		payload:       sdk.StructuredData{"name": "foo"},
+		keyColumnName: "id",
+		tableName:     "users",
+	})
+	is.NoErr(err)
+	_, err = d.exec(ctx, "DELETE FROM users WHERE id = $1", 2)
+	is.NoErr(err)
+	is.NoErr(preview.Close())
+
+	got, err := os.ReadFile(path)
+	is.NoErr(err)
+	is.Equal(string(got), `{"query":"INSERT INTO users (id,name) VALUES ($1,$2) ON CONFLICT (id) DO UPDATE SET name=EXCLUDED.name;","args":[1,"foo"]}
+{"query":"DELETE FROM users WHERE id = $1","args":[2]}
+`)
+}
@@ -0,0 +1,46 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/conduitio/conduit-connector-postgres/destination/internal/writer"
+)
+
+// parseColumnExpressions parses the column expressions, the keys have the
+// format "columnExpression.<column>". Each expression needs to reference the
+// value with $value.
+func parseColumnExpressions(cfgRaw map[string]string) (writer.ColumnExpressions, error) {
+	var exprs writer.ColumnExpressions
+	for k, expr := range cfgRaw {
+		if !strings.HasPrefix(k, ConfigKeyColumnExpressionPrefix) {
+			continue
+		}
+		column := strings.TrimPrefix(k, ConfigKeyColumnExpressionPrefix)
+		if column == "" {
+			return nil, fmt.Errorf("%q is not a valid column expression key, expected format \"columnExpression.<column>\"", k)
+		}
+		if !strings.Contains(expr, writer.ExpressionValue) {
+			return nil, fmt.Errorf("%q contains unsupported value %q, expected an SQL expression containing %s", k, expr, writer.ExpressionValue)
+		}
+		if exprs == nil {
+			exprs = make(writer.ColumnExpressions)
+		}
+		exprs[column] = expr
+	}
+	return exprs, nil
+}
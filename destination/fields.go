@@ -0,0 +1,105 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/conduitio/conduit-connector-postgres/fieldname"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// FieldNameConversion determines how field names of the key and payload are
+// converted into column names.
+type FieldNameConversion string
+
+const (
+	// FieldNameConversionNone uses field names as column names.
+	FieldNameConversionNone FieldNameConversion = "none"
+	// FieldNameConversionSnakeCase converts camelCase and PascalCase field
+	// names into snake_case, e.g. userID becomes user_id, the same way as the
+	// source, see fieldname.SnakeCase.
+	FieldNameConversionSnakeCase FieldNameConversion = "snake_case"
+	// FieldNameConversionLowercase converts field names to lower case.
+	FieldNameConversionLowercase FieldNameConversion = "lowercase"
+)
+
+var fieldNameConversionAll = []FieldNameConversion{
+	FieldNameConversionNone,
+	FieldNameConversionSnakeCase,
+	FieldNameConversionLowercase,
+}
+
+func isFieldNameConversionSupported(raw string) bool {
+	for _, c := range fieldNameConversionAll {
+		if string(c) == raw {
+			return true
+		}
+	}
+	return false
+}
+
+// convert returns the column name of the field.
+func (c FieldNameConversion) convert(field string) string {
+	switch c {
+	case FieldNameConversionSnakeCase:
+		return fieldname.SnakeCase(field)
+	case FieldNameConversionLowercase:
+		return strings.ToLower(field)
+	default:
+		return field
+	}
+}
+
+// convertFieldNames renames the fields of the data to the converted names. It
+// returns an error if two fields are converted to the same name, since one of
+// the values would be lost.
+func convertFieldNames(data sdk.StructuredData, conversion FieldNameConversion) error {
+	if conversion == FieldNameConversionNone || conversion == "" {
+		return nil
+	}
+	renamed := make(map[string]string) // converted name -> original name
+	for _, field := range sortedFields(data) {
+		name := conversion.convert(field)
+		if orig, ok := renamed[name]; ok {
+			return fmt.Errorf("fields %q and %q are both converted to %q", orig, field, name)
+		}
+		renamed[name] = field
+	}
+	values := make(map[string]interface{}, len(data))
+	for name, field := range renamed {
+		values[name] = data[field]
+	}
+	for field := range data {
+		delete(data, field)
+	}
+	for name, value := range values {
+		data[name] = value
+	}
+	return nil
+}
+
+// filterFields removes fields from the payload that are not in include (if
+// include is not empty) or that are in exclude. Fields are matched after nested
+// objects are flattened, so flattened fields can be selected by their column
+// name.
+func filterFields(payload sdk.StructuredData, include, exclude []string) {
+	for field := range payload {
+		if (len(include) > 0 && !contains(include, field)) || contains(exclude, field) {
+			delete(payload, field)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestFilterFields(t *testing.T) {
+	testCases := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    sdk.StructuredData
+	}{{
+		name: "no filter",
+		want: sdk.StructuredData{"id": 1, "name": "foo", "debug": true},
+	}, {
+		name:    "include",
+		include: []string{"id", "name", "missing"},
+		want:    sdk.StructuredData{"id": 1, "name": "foo"},
+	}, {
+		name:    "exclude",
+		exclude: []string{"debug"},
+		want:    sdk.StructuredData{"id": 1, "name": "foo"},
+	}, {
+		name:    "include and exclude",
+		include: []string{"id", "name"},
+		exclude: []string{"name"},
+		want:    sdk.StructuredData{"id": 1},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			payload := sdk.StructuredData{"id": 1, "name": "foo", "debug": true}
+			filterFields(payload, tc.include, tc.exclude)
+			is.Equal(payload, tc.want)
+		})
+	}
+}
+
+func TestConvertFieldNames(t *testing.T) {
+	testCases := []struct {
+		name       string
+		conversion FieldNameConversion
+		given      sdk.StructuredData
+		want       sdk.StructuredData
+		wantErr    string
+	}{{
+		name:       "none",
+		conversion: FieldNameConversionNone,
+		given:      sdk.StructuredData{"userId": 1, "Name": "foo"},
+		want:       sdk.StructuredData{"userId": 1, "Name": "foo"},
+	}, {
+		name:       "snake case",
+		conversion: FieldNameConversionSnakeCase,
+		given:      sdk.StructuredData{"userId": 1, "Name": "foo", "created_at": "now"},
+		want:       sdk.StructuredData{"user_id": 1, "name": "foo", "created_at": "now"},
+	}, {
+		name:       "lowercase",
+		conversion: FieldNameConversionLowercase,
+		given:      sdk.StructuredData{"userId": 1, "Name": "foo"},
+		want:       sdk.StructuredData{"userid": 1, "name": "foo"},
+	}, {
+		name:       "unchanged names",
+		conversion: FieldNameConversionLowercase,
+		given:      sdk.StructuredData{"A": 1, "b": 2},
+		want:       sdk.StructuredData{"a": 1, "b": 2},
+	}, {
+		name:       "collision",
+		conversion: FieldNameConversionSnakeCase,
+		given:      sdk.StructuredData{"userId": 1, "user_id": 2},
+		wantErr:    `fields "userId" and "user_id" are both converted to "user_id"`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			err := convertFieldNames(tc.given, tc.conversion)
+			if tc.wantErr != "" {
+				is.Equal(err.Error(), tc.wantErr)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(tc.given, tc.want)
+		})
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+
+	"github.com/conduitio/conduit-connector-postgres/health"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// checkHealth checks that the configured table, or all of its shards, exists
+// and the current user can insert, update and delete its rows. Tables named in
+// the metadata of records are not known before they are written, so they
+// aren't checked.
+func (d *Destination) checkHealth(ctx context.Context) error {
+	c := health.New(d.conn)
+	if d.config.tableName != "" {
+		tables, err := d.getShardTableNames(nil)
+		if err != nil {
+			return err
+		}
+		for _, table := range tables {
+			c.Table(ctx, table, "INSERT", "UPDATE", "DELETE")
+		}
+	}
+	if err := c.Err(); err != nil {
+		return err
+	}
+	sdk.Logger(ctx).Info().Msg("health check passed")
+	return nil
+}
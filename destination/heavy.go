@@ -0,0 +1,205 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// HeavyFieldsMode determines how the values of heavy fields are written.
+type HeavyFieldsMode string
+
+const (
+	// HeavyFieldsModeCompress writes the values of heavy fields as gzip
+	// compressed JSON into bytea columns of the same name.
+	HeavyFieldsModeCompress HeavyFieldsMode = "compress"
+	// HeavyFieldsModeSideTable writes the values of heavy fields into a side
+	// table next to the table, one row per key and field.
+	HeavyFieldsModeSideTable HeavyFieldsMode = "sideTable"
+)
+
+var heavyFieldsModeAll = []HeavyFieldsMode{HeavyFieldsModeCompress, HeavyFieldsModeSideTable}
+
+func isHeavyFieldsModeSupported(raw string) bool {
+	for _, m := range heavyFieldsModeAll {
+		if string(m) == raw {
+			return true
+		}
+	}
+	return false
+}
+
+// heavyFieldsTableSuffix is appended to the name of a table to get the name of
+// the side table the values of its heavy fields are written into.
+const heavyFieldsTableSuffix = "_heavy_fields"
+
+// getHeavyFieldsTableName returns the quoted name of the side table of the
+// table the record is written into, it's created in the same schema.
+func (d *Destination) getHeavyFieldsTableName(metadata map[string]string) (string, error) {
+	return d.getSuffixedTableName(metadata, heavyFieldsTableSuffix)
+}
+
+// extractHeavyFields removes the heavy fields from the payload and returns
+// their values. Fields are matched by their name in the record, before field
+// names are converted.
+func (d *Destination) extractHeavyFields(payload sdk.StructuredData) sdk.StructuredData {
+	if len(d.config.heavyFields) == 0 {
+		return nil
+	}
+	heavy := make(sdk.StructuredData, len(d.config.heavyFields))
+	for _, field := range d.config.heavyFields {
+		if v, ok := payload[field]; ok {
+			heavy[field] = v
+			delete(payload, field)
+		}
+	}
+	return heavy
+}
+
+// compressHeavyFields adds the heavy fields to the payload with their values
+// compressed, if heavy fields are compressed. In the side table mode they are
+// written with writeHeavyFields instead and stay out of the payload.
+func (d *Destination) compressHeavyFields(payload sdk.StructuredData, heavy sdk.StructuredData) error {
+	if d.config.heavyFieldsMode != HeavyFieldsModeCompress {
+		return nil
+	}
+	for field, value := range heavy {
+		if value == nil {
+			payload[field] = nil
+			continue
+		}
+		compressed, err := compressValue(value)
+		if err != nil {
+			return fmt.Errorf("failed to compress field %q: %w", field, err)
+		}
+		payload[field] = compressed
+	}
+	return nil
+}
+
+// compressValue returns the value encoded as JSON and compressed with gzip.
+// The result starts with the gzip magic bytes 0x1f 0x8b, which mark it as
+// compressed.
+func compressValue(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// createHeavyFieldsTables creates the side tables of the tables the records
+// are written into, see createHistoryTables.
+func (d *Destination) createHeavyFieldsTables(ctx context.Context, records []sdk.Record) error {
+	if d.config.heavyFieldsMode != HeavyFieldsModeSideTable {
+		return nil
+	}
+	for _, r := range records {
+		if !isRowChange(r) {
+			continue
+		}
+		table, err := d.getHeavyFieldsTableName(r.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to get heavy fields table name: %w", err)
+		}
+		if d.heavyFieldsTables[table] {
+			continue
+		}
+		query := `CREATE TABLE IF NOT EXISTS ` + table + ` (
+			key jsonb NOT NULL,
+			field text NOT NULL,
+			value jsonb,
+			PRIMARY KEY (key, field)
+		)`
+		if _, err := d.exec(ctx, query); err != nil {
+			return fmt.Errorf("failed to create heavy fields table %s: %w", table, err)
+		}
+		if d.heavyFieldsTables == nil {
+			d.heavyFieldsTables = make(map[string]bool)
+		}
+		d.heavyFieldsTables[table] = true
+	}
+	return nil
+}
+
+// writeHeavyFields writes the values of the heavy fields of the record into
+// the side table, which needs to be created with createHeavyFieldsTables
+// first. Fields missing in the payload are left unchanged, the rows of a
+// deleted key are deleted. The key is stored as JSON, like in the history
+// table.
+func (d *Destination) writeHeavyFields(ctx context.Context, r sdk.Record) error {
+	if d.config.heavyFieldsMode != HeavyFieldsModeSideTable {
+		return nil
+	}
+	table, err := d.getHeavyFieldsTableName(r.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to get heavy fields table name: %w", err)
+	}
+	key, _, _, err := historyValues(r)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return fmt.Errorf("%q %q requires records with a key", ConfigKeyHeavyFieldsMode, HeavyFieldsModeSideTable)
+	}
+
+	if r.Metadata["action"] == actionDelete {
+		query, args, err := psql.Delete(table).Where("key = ?", key).ToSql()
+		if err != nil {
+			return fmt.Errorf("error formatting heavy fields query: %w", err)
+		}
+		if _, err := d.exec(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to delete heavy fields from %s: %w", table, err)
+		}
+		return nil
+	}
+
+	payload, err := getPayload(r)
+	if err != nil {
+		return fmt.Errorf("failed to get payload: %w", err)
+	}
+	heavy := d.extractHeavyFields(payload)
+	if len(heavy) == 0 {
+		return nil
+	}
+	builder := psql.Insert(table).Columns("key", "field", "value")
+	for _, field := range sortedFields(heavy) {
+		value, err := json.Marshal(heavy[field])
+		if err != nil {
+			return fmt.Errorf("failed to encode field %q: %w", field, err)
+		}
+		builder = builder.Values(key, field, string(value))
+	}
+	query, args, err := builder.
+		Suffix("ON CONFLICT (key, field) DO UPDATE SET value = EXCLUDED.value").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("error formatting heavy fields query: %w", err)
+	}
+	if _, err := d.exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to write heavy fields into %s: %w", table, err)
+	}
+	return nil
+}
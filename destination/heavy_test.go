@@ -0,0 +1,101 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestDestination_PrepareValues_CompressHeavyFields(t *testing.T) {
+	is := is.New(t)
+	d := &Destination{config: config{
+		heavyFields:         []string{"rawDocument", "attachments"},
+		heavyFieldsMode:     HeavyFieldsModeCompress,
+		fieldNameConversion: FieldNameConversionSnakeCase,
+		dialect:             DialectCockroachDB, // doesn't read the catalog
+	}}
+
+	payload, err := structuredDataFormatter([]byte(`{
+		"userName": "foo",
+		"rawDocument": {"pages": [1, 2.50]},
+		"attachments": null
+	}`))
+	is.NoErr(err)
+	is.NoErr(d.prepareValues(context.Background(), `"users"`, payload))
+	is.Equal(len(payload), 3)
+	is.Equal(payload["user_name"], "foo")
+	is.Equal(payload["attachments"], nil)
+
+	compressed, ok := payload["rawDocument"].([]byte)
+	is.True(ok)
+	is.True(bytes.HasPrefix(compressed, []byte{0x1f, 0x8b})) // gzip magic bytes
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	is.NoErr(err)
+	got, err := io.ReadAll(r)
+	is.NoErr(err)
+	is.Equal(string(got), "{\"pages\":[1,2.50]}\n") // numbers keep their precision
+}
+
+func TestDestination_WriteHeavyFields(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "statements.jsonl")
+
+	preview, err := openStatementPreview(path)
+	is.NoErr(err)
+	d := &Destination{
+		config: config{
+			dryRun:          true,
+			keyColumnName:   "id",
+			heavyFields:     []string{"document", "attachments", "missing"},
+			heavyFieldsMode: HeavyFieldsModeSideTable,
+		},
+		preview: preview,
+	}
+
+	records := []sdk.Record{{
+		Metadata: map[string]string{"table": "users", "action": "update"},
+		Key:      sdk.RawData(`{"id":1}`),
+		Payload:  sdk.RawData(`{"id":1,"name":"foo","document":{"a":1},"attachments":null}`),
+	}, {
+		Metadata: map[string]string{"table": "users", "action": "update"},
+		Key:      sdk.RawData(`{"id":2}`),
+		Payload:  sdk.RawData(`{"id":2,"name":"bar"}`),
+	}, {
+		Metadata: map[string]string{"table": "users", "action": "delete"},
+		Key:      sdk.RawData(`{"id":1}`),
+	}}
+	is.NoErr(d.createHeavyFieldsTables(ctx, records))
+	for _, r := range records {
+		is.NoErr(d.writeHeavyFields(ctx, r))
+	}
+	is.NoErr(preview.Close())
+
+	got, err := os.ReadFile(path)
+	is.NoErr(err)
+	is.Equal(string(got), `{"query":"CREATE TABLE IF NOT EXISTS \"users_heavy_fields\" (\n\t\t\tkey jsonb NOT NULL,\n\t\t\tfield text NOT NULL,\n\t\t\tvalue jsonb,\n\t\t\tPRIMARY KEY (key, field)\n\t\t)","args":null}
+{"query":"INSERT INTO \"users_heavy_fields\" (key,field,value) VALUES ($1,$2,$3),($4,$5,$6) ON CONFLICT (key, field) DO UPDATE SET value = EXCLUDED.value","args":["{\"id\":1}","attachments","null","{\"id\":1}","document","{\"a\":1}"]}
+{"query":"DELETE FROM \"users_heavy_fields\" WHERE key = $1","args":["{\"id\":1}"]}
+`)
+}
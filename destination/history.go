@@ -0,0 +1,138 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// historyTableSuffix is appended to the name of a table to get the name of
+// the table its changes are mirrored into.
+const historyTableSuffix = "_history"
+
+// getHistoryTableName returns the quoted name of the history table of the
+// table the record is written into, it's created in the same schema.
+func (d *Destination) getHistoryTableName(metadata map[string]string) (string, error) {
+	return d.getSuffixedTableName(metadata, historyTableSuffix)
+}
+
+// createHistoryTables creates the history tables of the tables the records
+// are written into. Like tables truncated for a load, they are created before
+// the records are written, so a rolled back write doesn't drop a table that
+// is already marked as created.
+func (d *Destination) createHistoryTables(ctx context.Context, records []sdk.Record) error {
+	if !d.config.writeHistory {
+		return nil
+	}
+	for _, r := range records {
+		if !isRowChange(r) {
+			continue
+		}
+		table, err := d.getHistoryTableName(r.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to get history table name: %w", err)
+		}
+		if err := d.createHistoryTable(ctx, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createHistoryTable creates the history table if it doesn't exist. Tables
+// are only created once per connector run.
+func (d *Destination) createHistoryTable(ctx context.Context, table string) error {
+	if d.historyTables[table] {
+		return nil
+	}
+	query := `CREATE TABLE IF NOT EXISTS ` + table + ` (
+		id bigserial PRIMARY KEY,
+		operation text NOT NULL,
+		key jsonb,
+		before jsonb,
+		after jsonb,
+		metadata jsonb,
+		position bytea NOT NULL,
+		changed_at timestamptz NOT NULL DEFAULT now()
+	)`
+	if _, err := d.exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to create history table %s: %w", table, err)
+	}
+	if d.historyTables == nil {
+		d.historyTables = make(map[string]bool)
+	}
+	d.historyTables[table] = true
+	return nil
+}
+
+// writeHistory mirrors the change applied by the record into the history
+// table, which needs to be created with createHistoryTables first. The key
+// and payloads are stored as they were received, before field names are
+// converted or fields are dropped.
+func (d *Destination) writeHistory(ctx context.Context, r sdk.Record) error {
+	table, err := d.getHistoryTableName(r.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to get history table name: %w", err)
+	}
+	key, before, after, err := historyValues(r)
+	if err != nil {
+		return err
+	}
+	operation, ok := r.Metadata["action"]
+	if !ok {
+		operation = actionInsert
+	}
+
+	query, args, err := psql.
+		Insert(table).
+		Columns("operation", "key", "before", "after", "metadata", "position").
+		Values(operation, key, before, after, r.Metadata, []byte(r.Position)).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("error formatting history query: %w", err)
+	}
+	if _, err := d.exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to write change into history table %s: %w", table, err)
+	}
+	return nil
+}
+
+// historyValues returns the key, the row before the change and the row after
+// the change as JSON, missing values are stored as NULL. The JSON is taken
+// from the record as is, so numbers keep their precision. A raw key is stored
+// as a JSON string, the row after a delete is NULL.
+func historyValues(r sdk.Record) (key, before, after interface{}, err error) {
+	switch v, ok := rawKey(r); {
+	case ok:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to encode key: %w", err)
+		}
+		key = string(b)
+	case hasKey(r):
+		key = string(r.Key.Bytes())
+	}
+	if raw, ok := r.Metadata[metadataPayloadBefore]; ok {
+		before = raw
+	}
+	if r.Metadata["action"] != actionDelete && r.Payload != nil && len(r.Payload.Bytes()) > 0 {
+		after = string(r.Payload.Bytes())
+	}
+	return key, before, after, nil
+}
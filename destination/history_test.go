@@ -0,0 +1,71 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestDestination_WriteHistory(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "statements.jsonl")
+
+	preview, err := openStatementPreview(path)
+	is.NoErr(err)
+	d := &Destination{
+		config: config{
+			dryRun:       true,
+			tableName:    "users",
+			schema:       "app",
+			writeHistory: true,
+		},
+		preview: preview,
+	}
+	records := []sdk.Record{{
+		Position: sdk.Position("1"),
+		Metadata: map[string]string{"action": actionUpdate, metadataPayloadBefore: `{"name":"old"}`},
+		Key:      sdk.StructuredData{"id": 1},
+		Payload:  sdk.StructuredData{"name": "new"},
+	}, {
+		Position: sdk.Position("2"),
+		Metadata: map[string]string{"action": actionDelete, "table": "public.users"},
+		Key:      sdk.RawData(`"abc"`),
+	}}
+
+	// tables are created once
+	is.NoErr(d.createHistoryTables(ctx, records))
+	is.NoErr(d.createHistoryTables(ctx, records))
+	for _, r := range records {
+		is.NoErr(d.writeHistory(ctx, r))
+	}
+	is.NoErr(preview.Close())
+
+	got, err := os.ReadFile(path)
+	is.NoErr(err)
+	lines := strings.Split(strings.TrimSpace(string(got)), "\n")
+	is.Equal(len(lines), 4)
+	is.True(strings.HasPrefix(lines[0], `{"query":"CREATE TABLE IF NOT EXISTS \"app\".\"users_history\" (`))
+	is.True(strings.HasPrefix(lines[1], `{"query":"CREATE TABLE IF NOT EXISTS \"public\".\"users_history\" (`))
+	is.Equal(lines[2], `{"query":"INSERT INTO \"app\".\"users_history\" (operation,key,before,after,metadata,position) VALUES ($1,$2,$3,$4,$5,$6)","args":["update","{\"id\":1}","{\"name\":\"old\"}","{\"name\":\"new\"}",{"action":"update","payload.before":"{\"name\":\"old\"}"},"MQ=="]}`)
+	is.Equal(lines[3], `{"query":"INSERT INTO \"public\".\"users_history\" (operation,key,before,after,metadata,position) VALUES ($1,$2,$3,$4,$5,$6)","args":["delete","\"abc\"",null,null,{"action":"delete","table":"public.users"},"Mg=="]}`)
+}
@@ -0,0 +1,53 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"fmt"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// runInitSQL executes initSQL on the connection opened by Open, before the
+// destination prepares its tables. Statements without parameters are sent
+// with the simple query protocol, so initSQL can contain multiple statements
+// separated by semicolons, which are executed in a single transaction.
+func (d *Destination) runInitSQL(ctx context.Context) error {
+	if d.config.initSQL == "" {
+		return nil
+	}
+	sdk.Logger(ctx).Info().Msg("executing init SQL")
+	if _, err := d.exec(ctx, d.config.initSQL); err != nil {
+		return fmt.Errorf("failed to execute %q: %w", ConfigKeyInitSQL, err)
+	}
+	return nil
+}
+
+// runTeardownSQL executes teardownSQL before the connection is closed by
+// Teardown, the connection is reopened if it broke.
+func (d *Destination) runTeardownSQL(ctx context.Context) error {
+	if d.config.teardownSQL == "" || d.conn == nil {
+		return nil
+	}
+	if err := d.ensureConn(ctx); err != nil {
+		return fmt.Errorf("failed to execute %q: %w", ConfigKeyTeardownSQL, err)
+	}
+	sdk.Logger(ctx).Info().Msg("executing teardown SQL")
+	if _, err := d.exec(ctx, d.config.teardownSQL); err != nil {
+		return fmt.Errorf("failed to execute %q: %w", ConfigKeyTeardownSQL, err)
+	}
+	return nil
+}
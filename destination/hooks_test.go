@@ -0,0 +1,52 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestDestination_RunInitSQL(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "statements.jsonl")
+
+	preview, err := openStatementPreview(path)
+	is.NoErr(err)
+	d := &Destination{
+		config: config{
+			dryRun:      true,
+			initSQL:     "SET ROLE writer; SET session_replication_role = replica",
+			teardownSQL: "RESET ROLE",
+		},
+		preview: preview,
+	}
+
+	is.NoErr(d.runInitSQL(ctx))
+	// the destination was never opened, so there is no connection to run the
+	// teardown SQL on
+	is.NoErr(d.runTeardownSQL(ctx))
+	is.NoErr(preview.Close())
+
+	got, err := os.ReadFile(path)
+	is.NoErr(err)
+	is.Equal(string(got), `{"query":"SET ROLE writer; SET session_replication_role = replica","args":null}
+`)
+}
@@ -0,0 +1,100 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// parseIdentifier parses a possibly qualified SQL identifier like
+// analytics.events into its parts. Parts are separated by dots, the same rules
+// as in Postgres apply: unquoted parts are folded to lower case, parts in
+// double quotes are kept as they are and can contain dots and escaped double
+// quotes ("").
+func parseIdentifier(raw string) (pgx.Identifier, error) {
+	var ident pgx.Identifier
+	var part strings.Builder
+	quoted := false    // true while inside double quotes
+	wasQuoted := false // true if the current part was quoted
+	flush := func() error {
+		name := part.String()
+		if !wasQuoted {
+			name = strings.ToLower(strings.TrimSpace(name))
+		}
+		if name == "" {
+			return fmt.Errorf("identifier %q contains an empty name", raw)
+		}
+		ident = append(ident, name)
+		part.Reset()
+		wasQuoted = false
+		return nil
+	}
+
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case quoted && c == '"' && i+1 < len(raw) && raw[i+1] == '"':
+			part.WriteByte('"')
+			i++
+		case quoted && c == '"':
+			quoted = false
+		case quoted:
+			part.WriteByte(c)
+		case c == '"':
+			if strings.TrimSpace(part.String()) != "" || wasQuoted {
+				return nil, fmt.Errorf("identifier %q contains an unexpected double quote", raw)
+			}
+			part.Reset()
+			quoted, wasQuoted = true, true
+		case c == '.':
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case wasQuoted && c != ' ':
+			return nil, fmt.Errorf("identifier %q contains characters after a closing double quote", raw)
+		case wasQuoted:
+			// whitespace after a quoted name is ignored
+		default:
+			part.WriteByte(c)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("identifier %q contains an unterminated double quote", raw)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return ident, nil
+}
+
+// parseTableName parses a table name that can be qualified with a schema. If
+// the name is not qualified and schema is not empty, the table is qualified
+// with schema.
+func parseTableName(raw string, schema string) (pgx.Identifier, error) {
+	ident, err := parseIdentifier(raw)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(ident) > 2:
+		return nil, fmt.Errorf("table name %q contains too many parts, expected <table> or <schema>.<table>", raw)
+	case len(ident) == 1 && schema != "":
+		ident = pgx.Identifier{schema, ident[0]}
+	}
+	return ident, nil
+}
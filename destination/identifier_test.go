@@ -0,0 +1,83 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/matryer/is"
+)
+
+func TestParseIdentifier(t *testing.T) {
+	testCases := []struct {
+		raw     string
+		want    pgx.Identifier
+		wantErr string
+	}{{
+		raw:  "events",
+		want: pgx.Identifier{"events"},
+	}, {
+		raw:  "Analytics.Events",
+		want: pgx.Identifier{"analytics", "events"},
+	}, {
+		raw:  ` analytics . "My ""Events"".v2" `,
+		want: pgx.Identifier{"analytics", `My "Events".v2`},
+	}, {
+		raw:     "analytics.",
+		wantErr: `identifier "analytics." contains an empty name`,
+	}, {
+		raw:     `"events`,
+		wantErr: `identifier "\"events" contains an unterminated double quote`,
+	}, {
+		raw:     `"a"b`,
+		wantErr: `identifier "\"a\"b" contains characters after a closing double quote`,
+	}, {
+		raw:     `a"b"`,
+		wantErr: `identifier "a\"b\"" contains an unexpected double quote`,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.raw, func(t *testing.T) {
+			is := is.New(t)
+			got, err := parseIdentifier(tc.raw)
+			if tc.wantErr != "" {
+				is.Equal(err.Error(), tc.wantErr)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestParseTableName(t *testing.T) {
+	is := is.New(t)
+
+	got, err := parseTableName("events", "analytics")
+	is.NoErr(err)
+	is.Equal(got.Sanitize(), `"analytics"."events"`)
+
+	got, err = parseTableName("public.events", "analytics")
+	is.NoErr(err)
+	is.Equal(got.Sanitize(), `"public"."events"`)
+
+	got, err = parseTableName("events", "")
+	is.NoErr(err)
+	is.Equal(got.Sanitize(), `"events"`)
+
+	_, err = parseTableName("db.public.events", "")
+	is.Equal(err.Error(), `table name "db.public.events" contains too many parts, expected <table> or <schema>.<table>`)
+}
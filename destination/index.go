@@ -0,0 +1,114 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgx/v4"
+)
+
+// keyIndex describes a unique index that covers only the key column.
+type keyIndex struct {
+	name  string
+	valid bool
+}
+
+// ensureKeyIndex creates a unique index on the configured key column of the
+// configured table, unless one already exists. Upserts need a unique index on
+// the conflict target, otherwise Postgres rejects the ON CONFLICT clause.
+//
+// The index is created concurrently, so writes to the table are not blocked
+// while it is built, but the creation has to wait for all transactions that
+// could use the table to finish. If the creation fails, Postgres leaves an
+// invalid index behind that needs to be dropped manually.
+func (d *Destination) ensureKeyIndex(ctx context.Context) error {
+	ident, err := parseTableName(d.config.tableName, d.config.schema)
+	if err != nil {
+		return err
+	}
+	table, column := ident.Sanitize(), d.config.keyColumnName
+
+	index, err := d.findKeyIndex(ctx, table, column)
+	if err != nil {
+		return fmt.Errorf("failed to look up unique index on %s(%s): %w", table, column, err)
+	}
+	if index != nil {
+		if !index.valid {
+			return fmt.Errorf("unique index %s on %s(%s) is invalid, probably a previous concurrent creation failed, drop it and restart the connector", index.name, table, column)
+		}
+		sdk.Logger(ctx).Debug().
+			Str("table", table).
+			Str("index", index.name).
+			Msg("unique index on key column exists")
+		return nil
+	}
+
+	query := formatCreateKeyIndexQuery(ident, column)
+	sdk.Logger(ctx).Warn().
+		Str("table", table).
+		Str("query", query).
+		Msg("creating unique index on key column concurrently, this waits for running transactions on the table and can take a while on large tables")
+
+	// CREATE INDEX CONCURRENTLY can't run in a transaction, Exec without
+	// arguments uses the simple protocol which doesn't start one
+	if _, err := d.exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to create unique index on %s(%s): %w", table, column, err)
+	}
+	return nil
+}
+
+// findKeyIndex returns the unique index that covers only the column or nil if
+// none exists. Partial indexes are ignored, since they can't be used as a
+// conflict target without repeating their predicate.
+func (d *Destination) findKeyIndex(ctx context.Context, table, column string) (*keyIndex, error) {
+	query := `SELECT c.relname, i.indisvalid
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indexrelid
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = i.indkey[0]
+		WHERE i.indrelid = $1::regclass
+			AND i.indisunique
+			AND i.indnatts = 1
+			AND i.indpred IS NULL
+			AND a.attname = $2
+		ORDER BY i.indisvalid DESC
+		LIMIT 1`
+
+	var index keyIndex
+	err := d.conn.QueryRow(ctx, query, table, column).Scan(&index.name, &index.valid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+// formatCreateKeyIndexQuery formats the query that creates a unique index on
+// the column. The index is named after the table and column, the same way
+// Postgres names the index backing a UNIQUE constraint.
+func formatCreateKeyIndexQuery(table pgx.Identifier, column string) string {
+	// the index is created in the schema of the table, so the name must not
+	// contain the schema
+	name := table[len(table)-1] + "_" + column + "_key"
+	return fmt.Sprintf(
+		"CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS %s ON %s (%s)",
+		pgx.Identifier{name}.Sanitize(), table.Sanitize(), pgx.Identifier{column}.Sanitize(),
+	)
+}
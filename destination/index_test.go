@@ -0,0 +1,35 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/matryer/is"
+)
+
+func TestFormatCreateKeyIndexQuery(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(
+		formatCreateKeyIndexQuery(pgx.Identifier{"users"}, "id"),
+		`CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS "users_id_key" ON "users" ("id")`,
+	)
+	is.Equal(
+		formatCreateKeyIndexQuery(pgx.Identifier{"public", "users"}, "id"),
+		`CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS "users_id_key" ON "public"."users" ("id")`,
+	)
+}
@@ -0,0 +1,42 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Cockroach formats upserts with the UPSERT statement of CockroachDB, which
+// inserts the row or replaces the row with the same primary key. UPSERT
+// replaces all columns, so it ignores all options except the column
+// expressions.
+type Cockroach struct{}
+
+var _ UpsertWriter = Cockroach{}
+
+// Upsert formats an UPSERT query.
+func (Cockroach) Upsert(row Row, opts Options) (Statement, error) {
+	colArgs, valArgs := columnsAndValues(row.Key, row.Payload, opts.ColumnExpressions)
+	query, args, err := psql.
+		Insert(row.Table).
+		Columns(colArgs...).
+		Values(valArgs...).
+		ToSql()
+	if err != nil {
+		return Statement{}, fmt.Errorf("error formatting query: %w", err)
+	}
+	return Statement{SQL: "UPSERT" + strings.TrimPrefix(query, "INSERT"), Args: args}, nil
+}
@@ -0,0 +1,36 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestCockroach_Upsert(t *testing.T) {
+	is := is.New(t)
+
+	stmt, err := Cockroach{}.Upsert(Row{
+		Table:     "users",
+		KeyColumn: "id",
+		Key:       sdk.StructuredData{"id": 1},
+		Payload:   sdk.StructuredData{"id": 1, "name": "foo"},
+	}, Options{})
+	is.NoErr(err)
+	is.Equal(stmt.SQL, "UPSERT INTO users (id,name) VALUES ($1,$2)")
+	is.Equal(stmt.Args, []interface{}{1, "foo"})
+}
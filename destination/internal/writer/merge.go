@@ -0,0 +1,111 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Merge formats upserts with MERGE, which matches rows on the key column
+// without requiring a unique index. MERGE is supported since Postgres 15.
+type Merge struct{}
+
+var _ UpsertWriter = Merge{}
+
+// Upsert formats a MERGE query that updates the row matching the key or
+// inserts a new row. The values are passed as a single row VALUES list,
+// parameters are cast to the column types so Postgres can compare them with
+// the target columns. Identity, merge and update columns and the row before the
+// update are handled the same way as in Postgres.Upsert. The conflict target is
+// ignored, rows are always matched on the key column.
+func (Merge) Upsert(row Row, opts Options) (Statement, error) {
+	colArgs, valArgs := ColumnsAndValues(row.Key, row.Payload)
+	if !contains(colArgs, row.KeyColumn) {
+		return Statement{}, fmt.Errorf("key column %q is missing in the record", row.KeyColumn)
+	}
+
+	params := make([]string, len(colArgs))
+	sourceCols := make([]string, len(colArgs))
+	var updates []string
+	for i, column := range colArgs {
+		params[i] = fmt.Sprintf("$%d", i+1)
+		if expr, ok := opts.ColumnExpressions.param(column, params[i]); ok {
+			// the expression determines the type of the value
+			params[i] = expr
+		} else if dataType, ok := opts.columnType(column); ok {
+			params[i] += "::" + dataType
+		}
+		sourceCols[i] = "s." + column
+
+		if column == row.KeyColumn || contains(opts.IdentityColumns, column) || !opts.Updates(column) {
+			continue
+		}
+		update := fmt.Sprintf("%s = s.%s", column, column)
+		if contains(opts.MergeColumns, column) {
+			update = fmt.Sprintf("%s = COALESCE(t.%s, '{}'::jsonb) || s.%s", column, column, column)
+		}
+		updates = append(updates, update)
+	}
+	for _, column := range opts.NullColumns {
+		if opts.Updates(column) {
+			updates = append(updates, fmt.Sprintf("%s = NULL", column))
+		}
+	}
+	for _, column := range []string{opts.CreatedAtColumn, opts.UpdatedAtColumn} {
+		if column == "" {
+			continue
+		}
+		colArgs = append(colArgs, column)
+		params = append(params, "now()")
+		sourceCols = append(sourceCols, "s."+column)
+	}
+	if opts.UpdatedAtColumn != "" {
+		updates = append(updates, fmt.Sprintf("%s = s.%s", opts.UpdatedAtColumn, opts.UpdatedAtColumn))
+	}
+
+	matched := "THEN DO NOTHING"
+	if len(updates) > 0 {
+		matched = "THEN UPDATE SET " + strings.Join(updates, ", ")
+		if len(opts.Before) > 0 {
+			var conditions []string
+			for _, column := range sortedFields(opts.Before) {
+				valArgs = append(valArgs, opts.Before[column])
+				param := fmt.Sprintf("$%d", len(valArgs))
+				if expr, ok := opts.ColumnExpressions.param(column, param); ok {
+					param = expr
+				} else if dataType, ok := opts.columnType(column); ok {
+					param += "::" + dataType
+				}
+				conditions = append(conditions, fmt.Sprintf("t.%s IS NOT DISTINCT FROM %s", column, param))
+			}
+			matched = "AND " + strings.Join(conditions, " AND ") + " " + matched
+		}
+	}
+	overriding := ""
+	if len(opts.IdentityColumns) > 0 {
+		overriding = " OVERRIDING SYSTEM VALUE"
+	}
+
+	query := fmt.Sprintf(
+		"MERGE INTO %s AS t USING (VALUES (%s)) AS s (%s) ON t.%s = s.%s "+
+			"WHEN MATCHED %s "+
+			"WHEN NOT MATCHED THEN INSERT (%s)%s VALUES (%s)",
+		row.Table, strings.Join(params, ", "), strings.Join(colArgs, ", "), row.KeyColumn, row.KeyColumn,
+		matched,
+		strings.Join(colArgs, ", "), overriding, strings.Join(sourceCols, ", "),
+	)
+	return Statement{SQL: query, Args: valArgs}, nil
+}
@@ -0,0 +1,124 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+// columnTypes maps column names to their types.
+type columnTypes map[string]string
+
+func (c columnTypes) ColumnType(column string) (string, bool) {
+	dataType, ok := c[column]
+	return dataType, ok
+}
+
+func TestMerge_Upsert(t *testing.T) {
+	types := columnTypes{"id": "bigint", "attrs": "jsonb"}
+
+	testCases := []struct {
+		name      string
+		payload   sdk.StructuredData
+		opts      Options
+		wantQuery string
+		wantArgs  []interface{}
+	}{{
+		name:    "update",
+		payload: sdk.StructuredData{"attrs": `{"a":1}`},
+		wantQuery: "MERGE INTO users AS t USING (VALUES ($1::bigint, $2::jsonb)) AS s (id, attrs) ON t.id = s.id " +
+			"WHEN MATCHED THEN UPDATE SET attrs = s.attrs " +
+			"WHEN NOT MATCHED THEN INSERT (id, attrs) VALUES (s.id, s.attrs)",
+		wantArgs: []interface{}{1, `{"a":1}`},
+	}, {
+		name:    "merge column",
+		payload: sdk.StructuredData{"attrs": `{"a":1}`},
+		opts:    Options{MergeColumns: []string{"attrs"}},
+		wantQuery: "MERGE INTO users AS t USING (VALUES ($1::bigint, $2::jsonb)) AS s (id, attrs) ON t.id = s.id " +
+			"WHEN MATCHED THEN UPDATE SET attrs = COALESCE(t.attrs, '{}'::jsonb) || s.attrs " +
+			"WHEN NOT MATCHED THEN INSERT (id, attrs) VALUES (s.id, s.attrs)",
+		wantArgs: []interface{}{1, `{"a":1}`},
+	}, {
+		name:    "timestamps",
+		payload: sdk.StructuredData{"attrs": `{"a":1}`},
+		opts:    Options{CreatedAtColumn: "created_at", UpdatedAtColumn: "updated_at"},
+		wantQuery: "MERGE INTO users AS t USING (VALUES ($1::bigint, $2::jsonb, now(), now())) AS s (id, attrs, created_at, updated_at) ON t.id = s.id " +
+			"WHEN MATCHED THEN UPDATE SET attrs = s.attrs, updated_at = s.updated_at " +
+			"WHEN NOT MATCHED THEN INSERT (id, attrs, created_at, updated_at) VALUES (s.id, s.attrs, s.created_at, s.updated_at)",
+		wantArgs: []interface{}{1, `{"a":1}`},
+	}, {
+		name:    "before",
+		payload: sdk.StructuredData{"attrs": `{"a":2}`},
+		opts:    Options{Before: sdk.StructuredData{"id": 1, "attrs": `{"a":1}`}},
+		wantQuery: "MERGE INTO users AS t USING (VALUES ($1::bigint, $2::jsonb)) AS s (id, attrs) ON t.id = s.id " +
+			"WHEN MATCHED AND t.attrs IS NOT DISTINCT FROM $3::jsonb AND t.id IS NOT DISTINCT FROM $4::bigint THEN UPDATE SET attrs = s.attrs " +
+			"WHEN NOT MATCHED THEN INSERT (id, attrs) VALUES (s.id, s.attrs)",
+		wantArgs: []interface{}{1, `{"a":2}`, `{"a":1}`, 1},
+	}, {
+		name:    "exclude from update",
+		payload: sdk.StructuredData{"attrs": `{"a":1}`},
+		opts:    Options{ExcludeFromUpdate: []string{"attrs"}},
+		wantQuery: "MERGE INTO users AS t USING (VALUES ($1::bigint, $2::jsonb)) AS s (id, attrs) ON t.id = s.id " +
+			"WHEN MATCHED THEN DO NOTHING " +
+			"WHEN NOT MATCHED THEN INSERT (id, attrs) VALUES (s.id, s.attrs)",
+		wantArgs: []interface{}{1, `{"a":1}`},
+	}, {
+		name:    "null columns",
+		payload: sdk.StructuredData{},
+		opts:    Options{NullColumns: []string{"attrs"}},
+		wantQuery: "MERGE INTO users AS t USING (VALUES ($1::bigint)) AS s (id) ON t.id = s.id " +
+			"WHEN MATCHED THEN UPDATE SET attrs = NULL " +
+			"WHEN NOT MATCHED THEN INSERT (id) VALUES (s.id)",
+		wantArgs: []interface{}{1},
+	}, {
+		name:    "only key",
+		payload: sdk.StructuredData{},
+		opts:    Options{IdentityColumns: []string{"id"}},
+		wantQuery: "MERGE INTO users AS t USING (VALUES ($1::bigint)) AS s (id) ON t.id = s.id " +
+			"WHEN MATCHED THEN DO NOTHING " +
+			"WHEN NOT MATCHED THEN INSERT (id) OVERRIDING SYSTEM VALUE VALUES (s.id)",
+		wantArgs: []interface{}{1},
+	}, {
+		name:    "column expressions",
+		payload: sdk.StructuredData{"attrs": `{"a":2}`},
+		opts: Options{
+			ColumnExpressions: ColumnExpressions{"attrs": "jsonb_strip_nulls($value::jsonb)"},
+			Before:            sdk.StructuredData{"attrs": `{"a":1}`},
+		},
+		wantQuery: "MERGE INTO users AS t USING (VALUES ($1::bigint, jsonb_strip_nulls($2::jsonb))) AS s (id, attrs) ON t.id = s.id " +
+			"WHEN MATCHED AND t.attrs IS NOT DISTINCT FROM jsonb_strip_nulls($3::jsonb) THEN UPDATE SET attrs = s.attrs " +
+			"WHEN NOT MATCHED THEN INSERT (id, attrs) VALUES (s.id, s.attrs)",
+		wantArgs: []interface{}{1, `{"a":2}`, `{"a":1}`},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			tc.opts.ColumnTypes = types
+			stmt, err := Merge{}.Upsert(Row{
+				Table:     "users",
+				KeyColumn: "id",
+				Key:       sdk.StructuredData{"id": 1},
+				Payload:   tc.payload,
+			}, tc.opts)
+			is.NoErr(err)
+			is.Equal(stmt.SQL, tc.wantQuery)
+			is.Equal(stmt.Args, tc.wantArgs)
+		})
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// Postgres formats statements with INSERT ... ON CONFLICT, it's the default
+// writer.
+type Postgres struct{}
+
+var (
+	_ UpsertWriter = Postgres{}
+	_ BulkWriter   = Postgres{}
+	_ DeleteWriter = Postgres{}
+)
+
+// Upsert manually formats the UPSERT and ON CONFLICT query statements.
+// The `ON CONFLICT` portion of this query needs to specify the constraint
+// name.
+// * In our case, we can only rely on the record.Key's parsed key value.
+// * If other schema constraints prevent a write, this won't upsert on
+// that conflict.
+// * Identity columns are inserted with OVERRIDING SYSTEM VALUE and are never
+// updated, since Postgres only allows them to be updated to DEFAULT.
+// * Merge columns are jsonb columns whose existing value is merged with the
+// new value instead of being replaced.
+// * Columns missing in the payload keep their value, unless they are listed
+// in the null columns.
+// * If the row before the update is set, the existing row is only updated if
+// it still matches it.
+// * If a conflict target is set, it replaces the key column in the ON CONFLICT
+// clause, so rows can be matched by partial or expression indexes.
+// * If update columns are set, only these columns are updated, excluded
+// columns are only written on insert. If no column is left to update,
+// conflicting rows are kept as they are.
+// * The created at column is set to now() on insert, the updated at column on
+// insert and update.
+func (Postgres) Upsert(row Row, opts Options) (Statement, error) {
+	columns := make([]string, 0, len(row.Payload))
+	for column := range row.Payload {
+		columns = append(columns, column)
+	}
+	upsertQuery, conditionArgs := ConflictClause(columns, row.KeyColumn, row.Table, opts)
+
+	colArgs, valArgs := columnsAndValues(row.Key, row.Payload, opts.ColumnExpressions)
+	colArgs, valArgs = withTimestamps(colArgs, valArgs, opts.CreatedAtColumn, opts.UpdatedAtColumn)
+
+	query, args, err := psql.
+		Insert(row.Table).
+		Columns(colArgs...).
+		Values(valArgs...).
+		SuffixExpr(sq.Expr(upsertQuery, conditionArgs...)).
+		ToSql()
+	if err != nil {
+		return Statement{}, fmt.Errorf("error formatting query: %w", err)
+	}
+
+	if len(opts.IdentityColumns) > 0 {
+		query = withOverridingSystemValue(query)
+	}
+	return Statement{SQL: query, Args: args}, nil
+}
+
+// BulkUpsert formats a single INSERT ... ON CONFLICT query upserting all rows,
+// see Upsert. Columns are sorted, so the query is the same for all batches
+// with the same columns.
+func (Postgres) BulkUpsert(rows []Row, opts Options) (Statement, error) {
+	first := rows[0]
+	payloadColumns := sortedFields(first.Payload)
+	upsertQuery, conditionArgs := ConflictClause(payloadColumns, first.KeyColumn, first.Table, opts)
+
+	columns := sortedFields(first.Key)
+	for _, column := range payloadColumns {
+		if _, ok := first.Key[column]; !ok {
+			columns = append(columns, column)
+		}
+	}
+
+	builder := psql.Insert(first.Table)
+	var insertColumns []string
+	for _, row := range rows {
+		values := make([]interface{}, len(columns))
+		for i, column := range columns {
+			if v, ok := row.Key[column]; ok {
+				values[i] = opts.ColumnExpressions.value(column, v)
+			} else {
+				values[i] = opts.ColumnExpressions.value(column, row.Payload[column])
+			}
+		}
+		insertColumns, values = withTimestamps(columns, values, opts.CreatedAtColumn, opts.UpdatedAtColumn)
+		builder = builder.Values(values...)
+	}
+	builder = builder.Columns(insertColumns...)
+	query, args, err := builder.SuffixExpr(sq.Expr(upsertQuery, conditionArgs...)).ToSql()
+	if err != nil {
+		return Statement{}, fmt.Errorf("error formatting query: %w", err)
+	}
+
+	if len(opts.IdentityColumns) > 0 {
+		query = withOverridingSystemValue(query)
+	}
+	return Statement{SQL: query, Args: args}, nil
+}
+
+// ConflictClause formats the ON CONFLICT clause of an upsert that updates the
+// columns, see Upsert.
+func ConflictClause(columns []string, keyColumn string, table string, opts Options) (string, []interface{}) {
+	conflictTarget := fmt.Sprintf("(%s)", keyColumn)
+	if opts.ConflictTarget != "" {
+		conflictTarget = opts.ConflictTarget
+	}
+	prefix := fmt.Sprintf("ON CONFLICT %s DO UPDATE SET", conflictTarget)
+	upsertQuery := prefix
+	for _, column := range columns {
+		if contains(opts.IdentityColumns, column) || !opts.Updates(column) {
+			continue
+		}
+		// tuples form a comma separated list, so they need a comma at the end.
+		// `EXCLUDED` references the new record's values. This will overwrite
+		// every column's value except for the key column.
+		tuple := fmt.Sprintf("%s=EXCLUDED.%s,", column, column)
+		if contains(opts.MergeColumns, column) {
+			// the top level keys of the new document overwrite the keys of
+			// the existing document, all other keys are kept
+			tuple = fmt.Sprintf("%s=COALESCE(%s.%s, '{}'::jsonb) || EXCLUDED.%s,", column, table, column, column)
+		}
+		// TODO: Consider removing this space.
+		upsertQuery += " "
+		// add the tuple to the query string
+		upsertQuery += tuple
+	}
+	for _, column := range opts.NullColumns {
+		if opts.Updates(column) {
+			upsertQuery += fmt.Sprintf(" %s=NULL,", column)
+		}
+	}
+	if opts.UpdatedAtColumn != "" {
+		upsertQuery += fmt.Sprintf(" %s=now(),", opts.UpdatedAtColumn)
+	}
+	if upsertQuery == prefix {
+		// none of the columns are updated
+		return fmt.Sprintf("ON CONFLICT %s DO NOTHING;", conflictTarget), nil
+	}
+
+	// remove the last comma from the list of tuples
+	upsertQuery = strings.TrimSuffix(upsertQuery, ",")
+
+	var conditionArgs []interface{}
+	if len(opts.Before) > 0 {
+		var conditions []string
+		for _, column := range sortedFields(opts.Before) {
+			conditions = append(conditions, fmt.Sprintf("%s.%s IS NOT DISTINCT FROM ?", table, column))
+			conditionArgs = append(conditionArgs, opts.ColumnExpressions.value(column, opts.Before[column]))
+		}
+		upsertQuery += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// we have to manually append a semi colon to the upsert sql;
+	upsertQuery += ";"
+
+	return upsertQuery, conditionArgs
+}
+
+// InsertOptions contains options of plain inserts.
+type InsertOptions struct {
+	// DedupColumn is the column the hash of the row is written into, rows
+	// with an already stored hash are skipped.
+	DedupColumn string
+	// OverridingSystemValue writes identity columns with OVERRIDING SYSTEM
+	// VALUE.
+	OverridingSystemValue bool
+	// TimestampColumns are set to now(), empty columns are skipped.
+	TimestampColumns []string
+	// ColumnExpressions are the SQL expressions values of columns are
+	// written with.
+	ColumnExpressions ColumnExpressions
+}
+
+// Insert formats a plain INSERT query. If the dedup column is set, the hash of
+// the row is written into that column and rows with an already stored hash are
+// skipped, so replaying the same record doesn't produce a duplicate row.
+func (Postgres) Insert(row Row, opts InsertOptions) (Statement, error) {
+	var hash string
+	if opts.DedupColumn != "" {
+		var err error
+		hash, err = recordHash(row.Key, row.Payload)
+		if err != nil {
+			return Statement{}, fmt.Errorf("failed to hash record: %w", err)
+		}
+	}
+
+	colArgs, valArgs := columnsAndValues(row.Key, row.Payload, opts.ColumnExpressions)
+	colArgs, valArgs = withTimestamps(colArgs, valArgs, opts.TimestampColumns...)
+
+	builder := psql.Insert(row.Table)
+	if opts.DedupColumn != "" {
+		colArgs = append(colArgs, opts.DedupColumn)
+		valArgs = append(valArgs, hash)
+		builder = builder.Suffix(fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", opts.DedupColumn))
+	}
+
+	query, args, err := builder.
+		Columns(colArgs...).
+		Values(valArgs...).
+		ToSql()
+	if err != nil {
+		return Statement{}, err
+	}
+
+	if opts.OverridingSystemValue {
+		query = withOverridingSystemValue(query)
+	}
+	return Statement{SQL: query, Args: args}, nil
+}
+
+// Delete formats a query that deletes the row with the key.
+func (Postgres) Delete(row Row, opts Options) (Statement, error) {
+	value := opts.ColumnExpressions.value(row.KeyColumn, row.Key[row.KeyColumn])
+	query, args, err := psql.
+		Delete(row.Table).
+		Where(sq.Expr(row.KeyColumn+" = ?", value)).
+		ToSql()
+	if err != nil {
+		return Statement{}, err
+	}
+	return Statement{SQL: query, Args: args}, nil
+}
+
+// recordHash returns the hex encoded SHA-256 hash of the key and payload.
+// Map keys are sorted when encoding to JSON, so the same record always produces
+// the same hash regardless of field order.
+func recordHash(key, payload sdk.StructuredData) (string, error) {
+	b, err := json.Marshal([]sdk.StructuredData{key, payload})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
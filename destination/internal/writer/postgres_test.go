@@ -0,0 +1,260 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package writer
+
+import (
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestPostgres_Insert_Dedup(t *testing.T) {
+	is := is.New(t)
+
+	stmt, err := Postgres{}.Insert(Row{
+		Table:   "events",
+		Key:     sdk.StructuredData{"id": 1},
+		Payload: sdk.StructuredData{"column1": "foo"},
+	}, InsertOptions{DedupColumn: "record_hash"})
+	is.NoErr(err)
+	is.Equal(stmt.SQL, "INSERT INTO events (id,column1,record_hash) VALUES ($1,$2,$3) ON CONFLICT (record_hash) DO NOTHING")
+	is.Equal(len(stmt.Args), 3)
+
+	// the same record has to produce the same hash
+	again, err := Postgres{}.Insert(Row{
+		Table:   "events",
+		Key:     sdk.StructuredData{"id": 1},
+		Payload: sdk.StructuredData{"column1": "foo"},
+	}, InsertOptions{DedupColumn: "record_hash"})
+	is.NoErr(err)
+	is.Equal(stmt.Args[2], again.Args[2])
+
+	// a different payload has to produce a different hash
+	other, err := Postgres{}.Insert(Row{
+		Table:   "events",
+		Key:     sdk.StructuredData{"id": 1},
+		Payload: sdk.StructuredData{"column1": "bar"},
+	}, InsertOptions{DedupColumn: "record_hash"})
+	is.NoErr(err)
+	is.True(stmt.Args[2] != other.Args[2])
+}
+
+func TestPostgres_Upsert_IdentityColumn(t *testing.T) {
+	is := is.New(t)
+
+	stmt, err := Postgres{}.Upsert(Row{
+		Table:     "users",
+		KeyColumn: "id",
+		Key:       sdk.StructuredData{"id": 1},
+		Payload:   sdk.StructuredData{"id": 1, "name": "foo"},
+	}, Options{IdentityColumns: []string{"id"}})
+	is.NoErr(err)
+	is.Equal(stmt.SQL, "INSERT INTO users (id,name) OVERRIDING SYSTEM VALUE VALUES ($1,$2) ON CONFLICT (id) DO UPDATE SET name=EXCLUDED.name;")
+}
+
+func TestPostgres_Upsert_MergeColumn(t *testing.T) {
+	is := is.New(t)
+
+	stmt, err := Postgres{}.Upsert(Row{
+		Table:     "products",
+		KeyColumn: "id",
+		Key:       sdk.StructuredData{"id": 1},
+		Payload:   sdk.StructuredData{"attributes": map[string]interface{}{"color": "red"}},
+	}, Options{MergeColumns: []string{"attributes"}})
+	is.NoErr(err)
+	is.Equal(stmt.SQL, "INSERT INTO products (id,attributes) VALUES ($1,$2) ON CONFLICT (id) DO UPDATE SET attributes=COALESCE(products.attributes, '{}'::jsonb) || EXCLUDED.attributes;")
+}
+
+func TestPostgres_Upsert_Before(t *testing.T) {
+	is := is.New(t)
+
+	stmt, err := Postgres{}.Upsert(Row{
+		Table:     "users",
+		KeyColumn: "id",
+		Key:       sdk.StructuredData{"id": 1},
+		Payload:   sdk.StructuredData{"name": "bar"},
+	}, Options{Before: sdk.StructuredData{"name": "foo", "id": 1}})
+	is.NoErr(err)
+	is.Equal(stmt.SQL, "INSERT INTO users (id,name) VALUES ($1,$2) ON CONFLICT (id) DO UPDATE SET name=EXCLUDED.name WHERE users.id IS NOT DISTINCT FROM $3 AND users.name IS NOT DISTINCT FROM $4;")
+	is.Equal(stmt.Args, []interface{}{1, "bar", 1, "foo"})
+}
+
+func TestPostgres_Upsert_NullColumns(t *testing.T) {
+	is := is.New(t)
+
+	stmt, err := Postgres{}.Upsert(Row{
+		Table:     "users",
+		KeyColumn: "id",
+		Key:       sdk.StructuredData{"id": 1},
+		Payload:   sdk.StructuredData{"name": "foo"},
+	}, Options{NullColumns: []string{"email", "phone"}})
+	is.NoErr(err)
+	is.Equal(stmt.SQL, "INSERT INTO users (id,name) VALUES ($1,$2) ON CONFLICT (id) DO UPDATE SET name=EXCLUDED.name, email=NULL, phone=NULL;")
+}
+
+func TestPostgres_Upsert_ConflictTarget(t *testing.T) {
+	is := is.New(t)
+
+	stmt, err := Postgres{}.Upsert(Row{
+		Table:     "users",
+		KeyColumn: "id",
+		Key:       sdk.StructuredData{"id": 1},
+		Payload:   sdk.StructuredData{"email": "foo@example.com"},
+	}, Options{ConflictTarget: "(lower(email)) WHERE deleted_at IS NULL"})
+	is.NoErr(err)
+	is.Equal(stmt.SQL, "INSERT INTO users (id,email) VALUES ($1,$2) ON CONFLICT (lower(email)) WHERE deleted_at IS NULL DO UPDATE SET email=EXCLUDED.email;")
+}
+
+func TestPostgres_Upsert_Timestamps(t *testing.T) {
+	is := is.New(t)
+
+	stmt, err := Postgres{}.Upsert(Row{
+		Table:     "users",
+		KeyColumn: "id",
+		Key:       sdk.StructuredData{"id": 1},
+		Payload:   sdk.StructuredData{"name": "foo"},
+	}, Options{CreatedAtColumn: "created_at", UpdatedAtColumn: "updated_at"})
+	is.NoErr(err)
+	is.Equal(stmt.SQL, "INSERT INTO users (id,name,created_at,updated_at) VALUES ($1,$2,now(),now()) ON CONFLICT (id) DO UPDATE SET name=EXCLUDED.name, updated_at=now();")
+	is.Equal(stmt.Args, []interface{}{1, "foo"})
+}
+
+func TestConflictClause_UpdateColumns(t *testing.T) {
+	columns := []string{"status", "amount", "created_by"}
+	testCases := []struct {
+		name string
+		opts Options
+		want string
+	}{{
+		name: "update columns",
+		opts: Options{UpdateColumns: []string{"status", "amount"}},
+		want: "ON CONFLICT (id) DO UPDATE SET status=EXCLUDED.status, amount=EXCLUDED.amount;",
+	}, {
+		name: "exclude from update",
+		opts: Options{ExcludeFromUpdate: []string{"created_by"}, NullColumns: []string{"created_by", "note"}},
+		want: "ON CONFLICT (id) DO UPDATE SET status=EXCLUDED.status, amount=EXCLUDED.amount, note=NULL;",
+	}, {
+		name: "updated at column",
+		opts: Options{UpdateColumns: []string{"status"}, UpdatedAtColumn: "updated_at"},
+		want: "ON CONFLICT (id) DO UPDATE SET status=EXCLUDED.status, updated_at=now();",
+	}, {
+		name: "nothing to update",
+		opts: Options{UpdateColumns: []string{"note"}, Before: sdk.StructuredData{"status": "open"}},
+		want: "ON CONFLICT (id) DO NOTHING;",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			got, args := ConflictClause(columns, "id", "orders", tc.opts)
+			is.Equal(got, tc.want)
+			is.Equal(len(args), 0)
+		})
+	}
+}
+
+func TestPostgres_Insert_Timestamps(t *testing.T) {
+	is := is.New(t)
+
+	stmt, err := Postgres{}.Insert(Row{
+		Table:   "events",
+		Key:     sdk.StructuredData{},
+		Payload: sdk.StructuredData{"name": "foo"},
+	}, InsertOptions{TimestampColumns: []string{"", "updated_at"}})
+	is.NoErr(err)
+	is.Equal(stmt.SQL, "INSERT INTO events (name,updated_at) VALUES ($1,now())")
+}
+
+func TestPostgres_BulkUpsert(t *testing.T) {
+	is := is.New(t)
+
+	stmt, err := Postgres{}.BulkUpsert([]Row{{
+		Key:       sdk.StructuredData{"id": 1},
+		Payload:   sdk.StructuredData{"name": "foo", "email": "foo@example.com"},
+		KeyColumn: "id",
+		Table:     "users",
+	}, {
+		Key:       sdk.StructuredData{"id": 2},
+		Payload:   sdk.StructuredData{"name": "bar", "email": nil},
+		KeyColumn: "id",
+		Table:     "users",
+	}}, Options{NullColumns: []string{"phone"}})
+	is.NoErr(err)
+	is.Equal(stmt.SQL, "INSERT INTO users (id,email,name) VALUES ($1,$2,$3),($4,$5,$6) ON CONFLICT (id) DO UPDATE SET email=EXCLUDED.email, name=EXCLUDED.name, phone=NULL;")
+	is.Equal(stmt.Args, []interface{}{1, "foo@example.com", "foo", 2, nil, "bar"})
+}
+
+func TestPostgres_Delete(t *testing.T) {
+	is := is.New(t)
+
+	stmt, err := Postgres{}.Delete(Row{Table: "users", KeyColumn: "id", Key: sdk.StructuredData{"id": 1}}, Options{})
+	is.NoErr(err)
+	is.Equal(stmt.SQL, "DELETE FROM users WHERE id = $1")
+	is.Equal(stmt.Args, []interface{}{1})
+}
+
+func TestPostgres_ColumnExpressions(t *testing.T) {
+	is := is.New(t)
+	exprs := ColumnExpressions{
+		"email": "lower($value)",
+		"tags":  "CASE WHEN $value::jsonb ? 'none' THEN NULL ELSE $value::jsonb END",
+	}
+
+	stmt, err := Postgres{}.Upsert(Row{
+		Table:     "users",
+		KeyColumn: "id",
+		Key:       sdk.StructuredData{"id": 1},
+		Payload:   sdk.StructuredData{"email": "Foo@Example.com"},
+	}, Options{ColumnExpressions: exprs, Before: sdk.StructuredData{"email": "Bar@Example.com"}})
+	is.NoErr(err)
+	is.Equal(stmt.SQL, "INSERT INTO users (id,email) VALUES ($1,lower($2)) ON CONFLICT (id) DO UPDATE SET email=EXCLUDED.email WHERE users.email IS NOT DISTINCT FROM lower($3);")
+	is.Equal(stmt.Args, []interface{}{1, "Foo@Example.com", "Bar@Example.com"})
+
+	stmt, err = Postgres{}.BulkUpsert([]Row{{
+		Table:     "users",
+		KeyColumn: "id",
+		Key:       sdk.StructuredData{"id": 1},
+		Payload:   sdk.StructuredData{"tags": `["a"]`},
+	}, {
+		Table:     "users",
+		KeyColumn: "id",
+		Key:       sdk.StructuredData{"id": 2},
+		Payload:   sdk.StructuredData{"tags": `["none"]`},
+	}}, Options{ColumnExpressions: exprs})
+	is.NoErr(err)
+	is.Equal(stmt.SQL, "INSERT INTO users (id,tags) VALUES "+
+		"($1,CASE WHEN $2::jsonb ? 'none' THEN NULL ELSE $3::jsonb END),"+
+		"($4,CASE WHEN $5::jsonb ? 'none' THEN NULL ELSE $6::jsonb END) "+
+		"ON CONFLICT (id) DO UPDATE SET tags=EXCLUDED.tags;")
+	is.Equal(stmt.Args, []interface{}{1, `["a"]`, `["a"]`, 2, `["none"]`, `["none"]`})
+
+	stmt, err = Postgres{}.Insert(Row{
+		Table:   "users",
+		Key:     sdk.StructuredData{},
+		Payload: sdk.StructuredData{"email": "Foo@Example.com"},
+	}, InsertOptions{ColumnExpressions: exprs})
+	is.NoErr(err)
+	is.Equal(stmt.SQL, "INSERT INTO users (email) VALUES (lower($1))")
+
+	stmt, err = Postgres{}.Delete(Row{
+		Table:     "users",
+		KeyColumn: "email",
+		Key:       sdk.StructuredData{"email": "Foo@Example.com"},
+	}, Options{ColumnExpressions: exprs})
+	is.NoErr(err)
+	is.Equal(stmt.SQL, "DELETE FROM users WHERE email = lower($1)")
+	is.Equal(stmt.Args, []interface{}{"Foo@Example.com"})
+}
@@ -0,0 +1,229 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package writer formats the statements the destination writes rows with.
+// Each write mode implements the interfaces of the statements it supports, the
+// destination picks the writer and executes the statements, so it stays in
+// charge of transactions, retries, dry runs and row counts.
+package writer
+
+import (
+	"sort"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+var psql = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+
+// Row is a row written into a table.
+type Row struct {
+	// Table is the quoted name of the table.
+	Table string
+	// KeyColumn is the column existing rows are matched by.
+	KeyColumn string
+	Key       sdk.StructuredData
+	Payload   sdk.StructuredData
+}
+
+// Statement is a SQL statement and its arguments.
+type Statement struct {
+	SQL  string
+	Args []interface{}
+}
+
+// UpsertWriter formats statements that insert a row or update the existing
+// row with the same key.
+type UpsertWriter interface {
+	Upsert(row Row, opts Options) (Statement, error)
+}
+
+// BulkWriter formats statements that upsert multiple rows at once. The rows
+// need to have the same table, key and payload columns, and must not contain
+// the same key twice.
+type BulkWriter interface {
+	BulkUpsert(rows []Row, opts Options) (Statement, error)
+}
+
+// DeleteWriter formats statements that delete the row with the key. Only the
+// column expressions of the options are used.
+type DeleteWriter interface {
+	Delete(row Row, opts Options) (Statement, error)
+}
+
+// ColumnTypes returns the formatted type of a column of the table, e.g.
+// "bigint" or "timestamp with time zone".
+type ColumnTypes interface {
+	ColumnType(column string) (string, bool)
+}
+
+// Options contains options that change how conflicting rows are updated.
+type Options struct {
+	// IdentityColumns are written with OVERRIDING SYSTEM VALUE and never
+	// updated.
+	IdentityColumns []string
+	// MergeColumns are jsonb columns that are merged with the existing value
+	// instead of being replaced.
+	MergeColumns []string
+	// NullColumns are columns missing in the record that are set to NULL
+	// when the row is updated.
+	NullColumns []string
+	// Before is the row before the update, if set the existing row is only
+	// updated if it matches.
+	Before sdk.StructuredData
+	// ConflictTarget is the raw conflict target of the ON CONFLICT clause, the
+	// key column is used if empty.
+	ConflictTarget string
+	// CreatedAtColumn is set to now() when a row is inserted.
+	CreatedAtColumn string
+	// UpdatedAtColumn is set to now() when a row is inserted or updated.
+	UpdatedAtColumn string
+	// UpdateColumns are the only columns updated on conflict, all columns are
+	// updated if empty.
+	UpdateColumns []string
+	// ExcludeFromUpdate are columns that are only written when a row is
+	// inserted and never updated.
+	ExcludeFromUpdate []string
+	// ColumnTypes are the types of the columns of the table, parameters are
+	// cast to them if the statement needs it, e.g. MERGE.
+	ColumnTypes ColumnTypes
+	// ColumnExpressions are the SQL expressions values of columns are
+	// written with.
+	ColumnExpressions ColumnExpressions
+}
+
+// Updates returns true if the column is updated when the row exists, see
+// UpdateColumns and ExcludeFromUpdate. The updated at column is always
+// updated.
+func (o Options) Updates(column string) bool {
+	if len(o.UpdateColumns) > 0 && !contains(o.UpdateColumns, column) {
+		return false
+	}
+	return !contains(o.ExcludeFromUpdate, column)
+}
+
+// columnType returns the type of the column if the column types are known.
+func (o Options) columnType(column string) (string, bool) {
+	if o.ColumnTypes == nil {
+		return "", false
+	}
+	return o.ColumnTypes.ColumnType(column)
+}
+
+// ExpressionValue is replaced with the parameter of the value in column
+// expressions.
+const ExpressionValue = "$value"
+
+// ColumnExpressions maps columns to SQL expressions their values are written
+// with instead of the bare parameter, e.g. lower($value). The expressions are
+// applied to the values of the key, the payload and the row before the update.
+type ColumnExpressions map[string]string
+
+// value returns the value wrapped in the expression of the column, or the
+// value as is if the column has no expression.
+func (e ColumnExpressions) value(column string, v interface{}) interface{} {
+	expr, ok := e[column]
+	if !ok {
+		return v
+	}
+	// ? is the placeholder of squirrel, literal question marks (e.g. the
+	// jsonb ? operator) need to be escaped
+	sql := strings.ReplaceAll(strings.ReplaceAll(expr, "?", "??"), ExpressionValue, "?")
+	args := make([]interface{}, strings.Count(expr, ExpressionValue))
+	for i := range args {
+		args[i] = v
+	}
+	return sq.Expr(sql, args...)
+}
+
+// param returns the expression of the column with the numbered parameter of
+// the value, e.g. lower($2). It returns false if the column has no expression.
+func (e ColumnExpressions) param(column string, param string) (string, bool) {
+	expr, ok := e[column]
+	if !ok {
+		return "", false
+	}
+	return strings.ReplaceAll(expr, ExpressionValue, param), true
+}
+
+// ColumnsAndValues turns the key and payload into a slice of ordered columns
+// and values. Key fields are removed from the payload.
+func ColumnsAndValues(key, payload sdk.StructuredData) ([]string, []interface{}) {
+	var colArgs []string
+	var valArgs []interface{}
+
+	// range over both the key and payload values in order to format the
+	// query for args and values in proper order
+	for key, val := range key {
+		colArgs = append(colArgs, key)
+		valArgs = append(valArgs, val)
+		delete(payload, key) // NB: Delete Key from payload arguments
+	}
+
+	for field, value := range payload {
+		colArgs = append(colArgs, field)
+		valArgs = append(valArgs, value)
+	}
+
+	return colArgs, valArgs
+}
+
+// columnsAndValues returns the columns and values like ColumnsAndValues, with
+// the values wrapped in the column expressions.
+func columnsAndValues(key, payload sdk.StructuredData, exprs ColumnExpressions) ([]string, []interface{}) {
+	colArgs, valArgs := ColumnsAndValues(key, payload)
+	for i, column := range colArgs {
+		valArgs[i] = exprs.value(column, valArgs[i])
+	}
+	return colArgs, valArgs
+}
+
+// withTimestamps appends the non-empty timestamp columns with the value now()
+// to the columns and values of an INSERT query.
+func withTimestamps(colArgs []string, valArgs []interface{}, columns ...string) ([]string, []interface{}) {
+	for _, column := range columns {
+		if column != "" {
+			colArgs = append(colArgs, column)
+			valArgs = append(valArgs, sq.Expr("now()"))
+		}
+	}
+	return colArgs, valArgs
+}
+
+// withOverridingSystemValue adds the OVERRIDING SYSTEM VALUE clause to an
+// INSERT query. Squirrel doesn't support the clause, it needs to be placed
+// between the column list and VALUES.
+func withOverridingSystemValue(query string) string {
+	return strings.Replace(query, ") VALUES (", ") OVERRIDING SYSTEM VALUE VALUES (", 1)
+}
+
+// sortedFields returns the field names of the data in alphabetical order.
+func sortedFields(data sdk.StructuredData) []string {
+	fields := make([]string, 0, len(data))
+	for field := range data {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// TxIsolationLevel determines the isolation level of the transactions the
+// destination writes in.
+type TxIsolationLevel string
+
+const (
+	TxIsolationLevelReadCommitted  TxIsolationLevel = "readCommitted"
+	TxIsolationLevelRepeatableRead TxIsolationLevel = "repeatableRead"
+	TxIsolationLevelSerializable   TxIsolationLevel = "serializable"
+)
+
+var txIsolationLevelAll = []TxIsolationLevel{
+	TxIsolationLevelReadCommitted,
+	TxIsolationLevelRepeatableRead,
+	TxIsolationLevelSerializable,
+}
+
+func isTxIsolationLevelSupported(raw string) bool {
+	for _, l := range txIsolationLevelAll {
+		if string(l) == raw {
+			return true
+		}
+	}
+	return false
+}
+
+// pgx returns the isolation level as used by pgx, the default isolation level
+// of the session is used if the level is empty.
+func (l TxIsolationLevel) pgx() pgx.TxIsoLevel {
+	switch l {
+	case TxIsolationLevelReadCommitted:
+		return pgx.ReadCommitted
+	case TxIsolationLevelRepeatableRead:
+		return pgx.RepeatableRead
+	case TxIsolationLevelSerializable:
+		return pgx.Serializable
+	default:
+		return ""
+	}
+}
+
+// failsOnConflicts returns true if transactions with the isolation level fail
+// with a serialization failure when they conflict with a concurrent
+// transaction.
+func (l TxIsolationLevel) failsOnConflicts() bool {
+	return l == TxIsolationLevelRepeatableRead || l == TxIsolationLevelSerializable
+}
+
+const (
+	// codeSerializationFailure is the SQLSTATE code of transactions that
+	// conflicted with a concurrent transaction.
+	codeSerializationFailure = "40001"
+
+	// serializationMaxAttempts limits how often a write failing with a
+	// serialization failure is executed, independent of the retry config.
+	serializationMaxAttempts = 5
+	// serializationBackoff is the base of the randomized delay before a
+	// write failing with a serialization failure is repeated.
+	serializationBackoff = 20 * time.Millisecond
+)
+
+// begin starts a transaction with the configured isolation level.
+func (d *Destination) begin(ctx context.Context) (pgx.Tx, error) {
+	tx, err := d.conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: d.config.txIsolationLevel.pgx()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	return tx, nil
+}
+
+// writeSerialized executes the write with writeWithTimeout. If the isolation
+// level makes transactions fail when they conflict with concurrent
+// transactions, writes failing with a serialization failure are repeated up to
+// serializationMaxAttempts times, since such failures are expected and the
+// rolled back transaction can simply be executed again. The retry config
+// applies to the last error.
+func (d *Destination) writeSerialized(ctx context.Context, name string, write func(context.Context) error) error {
+	err := d.writeWithTimeout(ctx, write)
+	if !d.config.txIsolationLevel.failsOnConflicts() {
+		return err
+	}
+	for attempt := 1; attempt < serializationMaxAttempts && isSerializationFailure(err); attempt++ {
+		// randomized, so conflicting writers don't collide again
+		backoff := time.Duration(attempt)*serializationBackoff +
+			time.Duration(rand.Int63n(int64(serializationBackoff))) //nolint:gosec // no need for a secure random number
+		sdk.Logger(ctx).Debug().Err(err).
+			Str("operation", name).
+			Int("attempt", attempt).
+			Dur("backoff", backoff).
+			Msg("transaction conflicted with a concurrent transaction, repeating it")
+		if err := sleep(ctx, backoff); err != nil {
+			return err
+		}
+		err = d.writeWithTimeout(ctx, write)
+	}
+	return err
+}
+
+// isSerializationFailure returns true if the error was caused by a transaction
+// that conflicted with a concurrent transaction.
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == codeSerializationFailure
+}
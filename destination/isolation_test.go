@@ -0,0 +1,76 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/matryer/is"
+)
+
+func TestDestination_WriteSerialized(t *testing.T) {
+	conflict := fmt.Errorf("failed to write: %w", &pgconn.PgError{Code: codeSerializationFailure})
+	other := &pgconn.PgError{Code: "23505"}
+
+	testCases := []struct {
+		name         string
+		level        TxIsolationLevel
+		errs         []error
+		wantAttempts int
+		wantErr      error
+	}{{
+		name:         "conflict resolved",
+		level:        TxIsolationLevelSerializable,
+		errs:         []error{conflict, conflict, nil},
+		wantAttempts: 3,
+	}, {
+		name:         "conflicts exhaust attempts",
+		level:        TxIsolationLevelRepeatableRead,
+		errs:         []error{conflict, conflict, conflict, conflict, conflict, nil},
+		wantAttempts: serializationMaxAttempts,
+		wantErr:      conflict,
+	}, {
+		name:         "other error",
+		level:        TxIsolationLevelSerializable,
+		errs:         []error{other, nil},
+		wantAttempts: 1,
+		wantErr:      other,
+	}, {
+		name:         "read committed",
+		level:        TxIsolationLevelReadCommitted,
+		errs:         []error{conflict, nil},
+		wantAttempts: 1,
+		wantErr:      conflict,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			d := &Destination{config: config{txIsolationLevel: tc.level}}
+			var attempts int
+			err := d.writeSerialized(context.Background(), "write batch", func(context.Context) error {
+				err := tc.errs[attempts]
+				attempts++
+				return err
+			})
+			is.Equal(attempts, tc.wantAttempts)
+			is.True(errors.Is(err, tc.wantErr))
+		})
+	}
+}
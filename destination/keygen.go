@@ -0,0 +1,118 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// KeyGeneration determines how the key of inserted records without a key is
+// generated.
+type KeyGeneration string
+
+const (
+	// KeyGenerationDefault leaves the key column out of the insert, so it's
+	// filled by its DEFAULT, e.g. a serial, an identity or gen_random_uuid().
+	KeyGenerationDefault KeyGeneration = "default"
+	// KeyGenerationUUID generates a random UUID in the connector, which is
+	// written into the key column and stored in the record metadata.
+	KeyGenerationUUID KeyGeneration = "uuid"
+)
+
+var keyGenerationAll = []KeyGeneration{KeyGenerationDefault, KeyGenerationUUID}
+
+func isKeyGenerationSupported(raw string) bool {
+	for _, g := range keyGenerationAll {
+		if string(g) == raw {
+			return true
+		}
+	}
+	return false
+}
+
+// metadataGeneratedKey is the metadata key containing the key generated by
+// the connector.
+const metadataGeneratedKey = "postgres.generatedKey"
+
+// generateKey returns the record with a generated key if it's inserted without
+// a key and generateKey is uuid. The key is also stored in the metadata, so
+// it's written into the history table with the record.
+func (d *Destination) generateKey(r sdk.Record) (sdk.Record, error) {
+	if d.config.generateKey != KeyGenerationUUID || hasKey(r) {
+		return r, nil
+	}
+	switch r.Metadata["action"] {
+	case actionUpdate, actionDelete, actionSchemaChange, actionSequence:
+		return r, nil
+	}
+	id, err := newUUID()
+	if err != nil {
+		return sdk.Record{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+	metadata := make(map[string]string, len(r.Metadata)+1)
+	for k, v := range r.Metadata {
+		metadata[k] = v
+	}
+	metadata[metadataGeneratedKey] = id
+	r.Metadata = metadata
+	// a raw key is written into keyColumnName as is
+	r.Key = sdk.RawData(id)
+	return r, nil
+}
+
+// generateKeys returns the records with generated keys, see generateKey.
+func (d *Destination) generateKeys(records []sdk.Record) ([]sdk.Record, error) {
+	if d.config.generateKey != KeyGenerationUUID {
+		return records, nil
+	}
+	out := make([]sdk.Record, len(records))
+	for i, r := range records {
+		var err error
+		if out[i], err = d.generateKey(r); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// hasGeneratedKey returns true if the key of the record was generated by the
+// connector. The key is new, so the record is inserted instead of upserted.
+func hasGeneratedKey(r sdk.Record) bool {
+	_, ok := r.Metadata[metadataGeneratedKey]
+	return ok
+}
+
+// removeKeyField removes the field of the key column from the payload of a
+// record without a key if generateKey is default, so the column is filled by
+// its DEFAULT instead of a value sent by the source, e.g. null.
+func (d *Destination) removeKeyField(key, payload sdk.StructuredData) {
+	if d.config.generateKey == KeyGenerationDefault && len(key) == 0 {
+		delete(payload, d.config.keyColumnName)
+	}
+}
+
+// newUUID returns a random version 4 UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
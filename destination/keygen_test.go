@@ -0,0 +1,118 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewUUID(t *testing.T) {
+	is := is.New(t)
+	a, err := newUUID()
+	is.NoErr(err)
+	b, err := newUUID()
+	is.NoErr(err)
+	is.True(uuidPattern.MatchString(a))
+	is.True(a != b)
+}
+
+func TestDestination_GenerateKey(t *testing.T) {
+	is := is.New(t)
+	d := &Destination{config: config{keyColumnName: "id", generateKey: KeyGenerationUUID}}
+
+	metadata := map[string]string{"table": "events", "action": "insert"}
+	r, err := d.generateKey(sdk.Record{Metadata: metadata, Payload: sdk.RawData(`{"name":"foo"}`)})
+	is.NoErr(err)
+	id := r.Metadata[metadataGeneratedKey]
+	is.True(uuidPattern.MatchString(id))
+	is.Equal(string(r.Key.Bytes()), id)
+	is.True(hasGeneratedKey(r))
+	is.True(!d.isUpsert(r))    // generated keys are inserted
+	is.Equal(len(metadata), 2) // the metadata of the record is copied
+
+	// records with a key, updates and deletes keep their key
+	for _, r := range []sdk.Record{
+		{Metadata: map[string]string{"action": "insert"}, Key: sdk.RawData(`{"id":1}`)},
+		{Metadata: map[string]string{"action": "update"}},
+		{Metadata: map[string]string{"action": "delete"}},
+	} {
+		got, err := d.generateKey(r)
+		is.NoErr(err)
+		is.Equal(got, r)
+	}
+}
+
+func TestDestination_GenerateKey_Write(t *testing.T) {
+	testCases := []struct {
+		name     string
+		generate KeyGeneration
+		want     func(is *is.I, stmt previewedStatement)
+	}{{
+		name:     "default",
+		generate: KeyGenerationDefault,
+		want: func(is *is.I, stmt previewedStatement) {
+			// the key column is filled by its DEFAULT
+			is.Equal(stmt.Query, `INSERT INTO "events" (name) VALUES ($1)`)
+			is.Equal(stmt.Args, []interface{}{"foo"})
+		},
+	}, {
+		name:     "uuid",
+		generate: KeyGenerationUUID,
+		want: func(is *is.I, stmt previewedStatement) {
+			is.Equal(stmt.Query, `INSERT INTO "events" (id,name) VALUES ($1,$2)`)
+			is.Equal(len(stmt.Args), 2)
+			is.True(uuidPattern.MatchString(stmt.Args[0].(string)))
+		},
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			ctx := context.Background()
+			path := filepath.Join(t.TempDir(), "statements.jsonl")
+
+			preview, err := openStatementPreview(path)
+			is.NoErr(err)
+			d := &Destination{
+				config:  config{dryRun: true, keyColumnName: "id", generateKey: tc.generate},
+				preview: preview,
+			}
+
+			r, err := d.generateKey(sdk.Record{
+				Metadata: map[string]string{"table": "events", "action": "insert"},
+				Payload:  sdk.RawData(`{"id":null,"name":"foo"}`),
+			})
+			is.NoErr(err)
+			is.NoErr(d.write(ctx, r))
+			is.NoErr(preview.Close())
+
+			got, err := os.ReadFile(path)
+			is.NoErr(err)
+			var stmt previewedStatement
+			is.NoErr(json.Unmarshal([]byte(strings.TrimSpace(string(got))), &stmt))
+			tc.want(is, stmt)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces out calls to Wait so that at most a fixed number of calls
+// return per second. A nil rateLimiter doesn't limit anything.
+type rateLimiter struct {
+	m        sync.Mutex
+	interval time.Duration
+	// next is the earliest time the next call to Wait can return.
+	next time.Time
+}
+
+// newRateLimiter returns a limiter that allows perSecond calls per second, or
+// nil if perSecond is 0.
+func newRateLimiter(perSecond int) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Second / time.Duration(perSecond)}
+}
+
+// Wait blocks until the next call is allowed or the context is canceled.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.m.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		// we were idle, don't let unused capacity pile up
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.m.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// semaphore limits the number of concurrently running operations. A nil
+// semaphore doesn't limit anything.
+type semaphore chan struct{}
+
+// newSemaphore returns a semaphore that allows n concurrent operations, or nil
+// if n is 0.
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+// Acquire blocks until an operation is allowed to run or the context is
+// canceled. Release needs to be called if no error is returned.
+func (s semaphore) Acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case s <- struct{}{}:
+		return nil
+	}
+}
+
+// Release signals that an operation is done.
+func (s semaphore) Release() {
+	if s == nil {
+		return
+	}
+	<-s
+}
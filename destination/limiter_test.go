@@ -0,0 +1,70 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestRateLimiter(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	l := newRateLimiter(100)
+	start := time.Now()
+	for i := 0; i < 11; i++ {
+		is.NoErr(l.Wait(ctx))
+	}
+	// the first call returns immediately, the other 10 are spaced by 10ms
+	is.True(time.Since(start) >= 100*time.Millisecond)
+}
+
+func TestRateLimiter_Canceled(t *testing.T) {
+	is := is.New(t)
+
+	l := newRateLimiter(1)
+	is.NoErr(l.Wait(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	is.Equal(l.Wait(ctx), context.Canceled)
+}
+
+func TestRateLimiter_Nil(t *testing.T) {
+	is := is.New(t)
+	is.Equal(newRateLimiter(0), nil)
+	is.NoErr(newRateLimiter(0).Wait(context.Background()))
+}
+
+func TestSemaphore(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	s := newSemaphore(1)
+	is.NoErr(s.Acquire(ctx))
+
+	// second acquire blocks until the context is canceled
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	is.Equal(s.Acquire(cctx), context.DeadlineExceeded)
+
+	s.Release()
+	is.NoErr(s.Acquire(ctx))
+	s.Release()
+}
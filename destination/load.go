@@ -0,0 +1,328 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/conduitio/conduit-connector-postgres/destination/internal/writer"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// LoadMode determines how snapshot records are written.
+type LoadMode string
+
+const (
+	// LoadModeUpsert writes snapshot records like inserts.
+	LoadModeUpsert LoadMode = "upsert"
+	// LoadModeTruncateAndLoad truncates the table when the first record of a
+	// snapshot arrives and writes snapshot records with COPY.
+	LoadModeTruncateAndLoad LoadMode = "truncateAndLoad"
+	// LoadModeStaged writes snapshot records with COPY into a staging table
+	// and replaces the rows of the table with the staged rows once the
+	// snapshot is complete.
+	LoadModeStaged LoadMode = "staged"
+)
+
+var loadModeAll = []LoadMode{LoadModeUpsert, LoadModeTruncateAndLoad, LoadModeStaged}
+
+func isLoadModeSupported(raw string) bool {
+	for _, m := range loadModeAll {
+		if string(m) == raw {
+			return true
+		}
+	}
+	return false
+}
+
+// metadataSnapshotID is the metadata key containing the ID of the snapshot
+// run that produced the record.
+const metadataSnapshotID = "snapshot.id"
+
+// isLoad returns true if the record is written with COPY.
+func (d *Destination) isLoad(r sdk.Record) bool {
+	return d.config.loadMode != LoadModeUpsert && r.Metadata["action"] == actionSnapshot
+}
+
+// truncateForLoad truncates the tables of the snapshot records that are the
+// first records of their snapshot run, identified by the metadata field
+// snapshot.id. Tables are truncated in their own transaction before the
+// records are written, so a retried write doesn't truncate the rows written
+// by a previous attempt.
+func (d *Destination) truncateForLoad(ctx context.Context, records []sdk.Record) error {
+	if d.config.loadMode != LoadModeTruncateAndLoad {
+		return nil
+	}
+	for _, r := range records {
+		if !d.isLoad(r) {
+			continue
+		}
+		table, err := d.getTableName(r.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to get table name for write: %w", err)
+		}
+		snapshotID := r.Metadata[metadataSnapshotID]
+		if id, ok := d.loads[table]; ok && id == snapshotID {
+			continue
+		}
+
+		if _, err := d.exec(ctx, "TRUNCATE TABLE "+table); err != nil {
+			return fmt.Errorf("failed to truncate table %s: %w", table, err)
+		}
+		sdk.Logger(ctx).Info().
+			Str("table", table).
+			Str("snapshotID", snapshotID).
+			Msg("truncated table, loading snapshot")
+		if d.loads == nil {
+			d.loads = make(map[string]string)
+		}
+		d.loads[table] = snapshotID
+	}
+	return nil
+}
+
+// loadRow is a snapshot record prepared to be written with COPY.
+type loadRow struct {
+	tableName string
+	// stagedTable is the quoted name of the table the staging table the row
+	// is written into is swapped into, it's empty if the row isn't staged.
+	stagedTable string
+	columns     []string
+	values      []interface{}
+	// jsonColumns marks the columns whose values are encoded as JSON.
+	jsonColumns map[string]bool
+}
+
+// load writes a single snapshot record with COPY.
+func (d *Destination) load(ctx context.Context, r sdk.Record) error {
+	row, err := d.prepareLoad(ctx, r)
+	if err != nil {
+		return err
+	}
+	return d.execLoad(ctx, []loadRow{row})
+}
+
+// prepareLoad extracts the columns and values of a snapshot record.
+func (d *Destination) prepareLoad(ctx context.Context, r sdk.Record) (loadRow, error) {
+	tableName, err := d.getRowTableName(r)
+	if err != nil {
+		return loadRow{}, fmt.Errorf("failed to get table name for write: %w", err)
+	}
+	key, err := d.getKey(r)
+	if err != nil {
+		return loadRow{}, fmt.Errorf("failed to get key: %w", err)
+	}
+	payload, err := getPayload(r)
+	if err != nil {
+		return loadRow{}, fmt.Errorf("failed to get payload: %w", err)
+	}
+	if err := d.prepareValues(ctx, tableName, payload); err != nil {
+		return loadRow{}, err
+	}
+	d.removeTimestampFields(payload)
+	d.removeKeyField(key, payload)
+
+	row := loadRow{tableName: tableName}
+	if d.config.dialect.readsCatalog() {
+		// COPY writes identity columns like OVERRIDING SYSTEM VALUE, so the
+		// returned identity columns need no special handling
+		if _, err := d.excludeSystemColumns(ctx, tableName, key, payload); err != nil {
+			return loadRow{}, err
+		}
+		info, err := d.getTableInfo(ctx, tableName)
+		if err != nil {
+			return loadRow{}, err
+		}
+		row.jsonColumns = make(map[string]bool)
+		for name, col := range info.columns {
+			if isJSONType(col.dataType) {
+				row.jsonColumns[name] = true
+			}
+		}
+	}
+
+	row.columns, row.values = writer.ColumnsAndValues(key, payload)
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	for _, column := range []string{d.config.setCreatedAtColumn, d.config.setUpdatedAtColumn} {
+		if column != "" {
+			row.columns = append(row.columns, column)
+			row.values = append(row.values, now)
+		}
+	}
+	if load, ok := d.stagedLoads[tableName]; ok {
+		// staged rows are copied into the staging table and swapped into
+		// the table once the snapshot is complete
+		row.tableName = load.stagingTable
+		row.stagedTable = tableName
+		for _, column := range row.columns {
+			load.columns[column] = true
+		}
+	}
+	return row, nil
+}
+
+// loadGroup contains snapshot rows written into the same table with the same
+// columns.
+type loadGroup struct {
+	id   string
+	rows []loadRow
+}
+
+// addToLoadGroup adds the row to the group of rows with the same table and
+// columns, a new group is appended if none exists. The values of the row are
+// reordered to match the columns of the group.
+func addToLoadGroup(groups []*loadGroup, row loadRow) []*loadGroup {
+	values := make(map[string]interface{}, len(row.columns))
+	for i, column := range row.columns {
+		values[column] = row.values[i]
+	}
+	columns := sortedFields(values)
+	row.columns = columns
+	row.values = make([]interface{}, len(columns))
+	for i, column := range columns {
+		row.values[i] = values[column]
+	}
+
+	id := row.tableName + "\x00" + strings.Join(columns, ",")
+	for _, g := range groups {
+		if g.id == id {
+			g.rows = append(g.rows, row)
+			return groups
+		}
+	}
+	return append(groups, &loadGroup{id: id, rows: []loadRow{row}})
+}
+
+// execLoad writes the rows with a single COPY statement, all rows need to have
+// the same table and columns in the same order. Values are sent in the CSV
+// format and parsed by Postgres, the same way as literals in a statement.
+func (d *Destination) execLoad(ctx context.Context, rows []loadRow) error {
+	first := rows[0]
+	query := fmt.Sprintf("COPY %s (%s) FROM STDIN WITH (FORMAT csv)", first.tableName, strings.Join(first.columns, ", "))
+
+	var buf bytes.Buffer
+	for _, row := range rows {
+		for i, v := range row.values {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCSVValue(&buf, v, row.jsonColumns[row.columns[i]]); err != nil {
+				return fmt.Errorf("failed to encode column %q: %w", row.columns[i], err)
+			}
+		}
+		buf.WriteByte('\n')
+	}
+
+	if d.config.dryRun {
+		if err := d.preview.write(ctx, query, []interface{}{buf.String()}); err != nil {
+			return fmt.Errorf("failed to preview statement: %w", err)
+		}
+	} else {
+		tag, err := d.conn.PgConn().CopyFrom(ctx, &buf, query)
+		if err != nil {
+			return fmt.Errorf("copy into %s failed: %w", first.tableName, err)
+		}
+		d.countInserts(tag, len(rows))
+	}
+	if first.stagedTable != "" {
+		return d.storeStagedColumns(ctx, first.stagedTable, first.columns)
+	}
+	return nil
+}
+
+// writeCSVValue writes the value as a CSV field. NULL is written as an
+// unquoted empty field, all other values are quoted, so empty strings are
+// not taken for NULL.
+func writeCSVValue(buf *bytes.Buffer, v interface{}, isJSON bool) error {
+	if v == nil {
+		return nil
+	}
+	text, err := copyText(v, isJSON)
+	if err != nil {
+		return err
+	}
+	buf.WriteByte('"')
+	buf.WriteString(strings.ReplaceAll(text, `"`, `""`))
+	buf.WriteByte('"')
+	return nil
+}
+
+// copyText returns the text representation of a value as Postgres parses it.
+// Objects and values of json columns are encoded as JSON, arrays of other
+// columns as array literals.
+func copyText(v interface{}, isJSON bool) (string, error) {
+	if isJSON {
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []byte:
+		return `\x` + hex.EncodeToString(v), nil
+	case []interface{}:
+		return arrayLiteral(v)
+	case json.Number:
+		return v.String(), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	default:
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+}
+
+// arrayLiteral formats the values as a Postgres array literal, e.g.
+// {"a","b",NULL}. Nested arrays become multidimensional arrays.
+func arrayLiteral(values []interface{}) (string, error) {
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		switch v := v.(type) {
+		case nil:
+			sb.WriteString("NULL")
+		case []interface{}:
+			nested, err := arrayLiteral(v)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(nested)
+		default:
+			text, err := copyText(v, false)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteByte('"')
+			sb.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text))
+			sb.WriteByte('"')
+		}
+	}
+	sb.WriteByte('}')
+	return sb.String(), nil
+}
@@ -0,0 +1,99 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestDestination_TruncateAndLoad(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "statements.jsonl")
+
+	preview, err := openStatementPreview(path)
+	is.NoErr(err)
+	d := &Destination{
+		config: config{
+			dryRun:        true,
+			tableName:     "users",
+			keyColumnName: "id",
+			loadMode:      LoadModeTruncateAndLoad,
+			dialect:       DialectCockroachDB, // doesn't read the catalog
+		},
+		preview: preview,
+	}
+	snapshot := func(id int, snapshotID string) sdk.Record {
+		return sdk.Record{
+			Metadata: map[string]string{"action": actionSnapshot, metadataSnapshotID: snapshotID},
+			Key:      sdk.StructuredData{"id": id},
+			Payload:  sdk.StructuredData{"name": `a "quoted" name`, "email": nil},
+		}
+	}
+	records := []sdk.Record{snapshot(1, "first"), snapshot(2, "first")}
+
+	// the table is truncated once per snapshot run
+	is.NoErr(d.truncateForLoad(ctx, records))
+	is.NoErr(d.truncateForLoad(ctx, []sdk.Record{{Metadata: map[string]string{"action": actionInsert}}}))
+	var groups []*loadGroup
+	for _, r := range records {
+		row, err := d.prepareLoad(ctx, r)
+		is.NoErr(err)
+		groups = addToLoadGroup(groups, row)
+	}
+	is.Equal(len(groups), 1)
+	is.NoErr(d.execLoad(ctx, groups[0].rows))
+	is.NoErr(d.truncateForLoad(ctx, []sdk.Record{snapshot(1, "second")}))
+	is.NoErr(preview.Close())
+
+	got, err := os.ReadFile(path)
+	is.NoErr(err)
+	is.Equal(string(got), `{"query":"TRUNCATE TABLE \"users\"","args":null}
+{"query":"COPY \"users\" (email, id, name) FROM STDIN WITH (FORMAT csv)","args":[",\"1\",\"a \"\"quoted\"\" name\"\n,\"2\",\"a \"\"quoted\"\" name\"\n"]}
+{"query":"TRUNCATE TABLE \"users\"","args":null}
+`)
+}
+
+func TestCopyText(t *testing.T) {
+	is := is.New(t)
+
+	tests := []struct {
+		value  interface{}
+		isJSON bool
+		want   string
+	}{
+		{value: "foo", want: "foo"},
+		{value: true, want: "true"},
+		{value: json.Number("9007199254740993"), want: "9007199254740993"},
+		{value: 1.5, want: "1.5"},
+		{value: []byte{0xde, 0xad}, want: `\xdead`},
+		{value: []interface{}{"a", `b"c`, nil}, want: `{"a","b\"c",NULL}`},
+		{value: []interface{}{[]interface{}{"1", "2"}, []interface{}{"3", "4"}}, want: `{{"1","2"},{"3","4"}}`},
+		{value: []interface{}{"a", "b"}, isJSON: true, want: `["a","b"]`},
+		{value: map[string]interface{}{"a": "b"}, want: `{"a":"b"}`},
+	}
+	for _, tt := range tests {
+		got, err := copyText(tt.value, tt.isJSON)
+		is.NoErr(err)
+		is.Equal(got, tt.want)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// columnMapping maps the value at a path in the payload to a column.
+type columnMapping struct {
+	// path is the path as configured, e.g. meta.tags[0].
+	path   string
+	steps  []pathStep
+	column string
+}
+
+// pathStep is a step of a path, either the field of an object or the index of
+// an array.
+type pathStep struct {
+	field   string
+	index   int
+	isIndex bool
+}
+
+// parseColumnMappings collects all config values with the prefix
+// "columnMapping.", the rest of the key is the path and the value the column.
+// Mappings are sorted by path.
+func parseColumnMappings(cfgRaw map[string]string) ([]columnMapping, error) {
+	var mappings []columnMapping
+	columns := make(map[string]string) // column -> config key
+	for k, column := range cfgRaw {
+		if !strings.HasPrefix(k, ConfigKeyColumnMappingPrefix) {
+			continue
+		}
+		path := strings.TrimPrefix(k, ConfigKeyColumnMappingPrefix)
+		steps, err := parsePath(path)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid column mapping key, expected format \"columnMapping.<path>\": %w", k, err)
+		}
+		if column == "" {
+			return nil, fmt.Errorf("%q requires a column name", k)
+		}
+		if other, ok := columns[column]; ok {
+			if other > k {
+				other, k = k, other
+			}
+			return nil, fmt.Errorf("%q and %q both map to column %q", other, k, column)
+		}
+		columns[column] = k
+		mappings = append(mappings, columnMapping{path: path, steps: steps, column: column})
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].path < mappings[j].path
+	})
+	return mappings, nil
+}
+
+// parsePath parses a path of field names separated by dots, each optionally
+// followed by array indexes in brackets, e.g. address.city or meta.tags[0].
+func parsePath(path string) ([]pathStep, error) {
+	if path == "" {
+		return nil, errors.New("path is empty")
+	}
+	var steps []pathStep
+	for _, part := range strings.Split(path, ".") {
+		field := part
+		var indexes string
+		if i := strings.IndexByte(part, '['); i >= 0 {
+			field, indexes = part[:i], part[i:]
+		}
+		if field == "" {
+			return nil, fmt.Errorf("path %q contains an empty field name", path)
+		}
+		steps = append(steps, pathStep{field: field})
+		for indexes != "" {
+			end := strings.IndexByte(indexes, ']')
+			if indexes[0] != '[' || end < 0 {
+				return nil, fmt.Errorf("path %q contains an invalid index %q", path, indexes)
+			}
+			index, err := strconv.Atoi(indexes[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("path %q contains an invalid index %q, expected a non-negative integer", path, indexes[:end+1])
+			}
+			steps = append(steps, pathStep{index: index, isIndex: true})
+			indexes = indexes[end+1:]
+		}
+	}
+	return steps, nil
+}
+
+// extract returns the value at the path of the mapping, the second return
+// value is false if the path doesn't exist in the payload.
+func (m columnMapping) extract(payload sdk.StructuredData) (interface{}, bool) {
+	var value interface{} = map[string]interface{}(payload)
+	for _, step := range m.steps {
+		if step.isIndex {
+			array, ok := value.([]interface{})
+			if !ok || step.index >= len(array) {
+				return nil, false
+			}
+			value = array[step.index]
+			continue
+		}
+		var object map[string]interface{}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			object = v
+		case sdk.StructuredData:
+			object = v
+		default:
+			return nil, false
+		}
+		v, ok := object[step.field]
+		if !ok {
+			return nil, false
+		}
+		value = v
+	}
+	return value, true
+}
+
+// mapColumns returns the values of the mapped columns that exist in the
+// payload. Values are extracted before field names are converted, so paths
+// refer to the field names of the record.
+func mapColumns(payload sdk.StructuredData, mappings []columnMapping) map[string]interface{} {
+	if len(mappings) == 0 {
+		return nil
+	}
+	values := make(map[string]interface{}, len(mappings))
+	for _, m := range mappings {
+		if v, ok := m.extract(payload); ok {
+			values[m.column] = v
+		}
+	}
+	return values
+}
@@ -0,0 +1,118 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestParsePath(t *testing.T) {
+	testCases := []struct {
+		path    string
+		want    []pathStep
+		wantErr error
+	}{{
+		path: "address.city",
+		want: []pathStep{{field: "address"}, {field: "city"}},
+	}, {
+		path: "meta.tags[0]",
+		want: []pathStep{{field: "meta"}, {field: "tags"}, {index: 0, isIndex: true}},
+	}, {
+		path: "matrix[1][2].value",
+		want: []pathStep{{field: "matrix"}, {index: 1, isIndex: true}, {index: 2, isIndex: true}, {field: "value"}},
+	}, {
+		path:    "address..city",
+		wantErr: errors.New(`path "address..city" contains an empty field name`),
+	}, {
+		path:    "tags[first]",
+		wantErr: errors.New(`path "tags[first]" contains an invalid index "[first]", expected a non-negative integer`),
+	}, {
+		path:    "tags[0",
+		wantErr: errors.New(`path "tags[0" contains an invalid index "[0"`),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			is := is.New(t)
+			got, err := parsePath(tc.path)
+			is.Equal(err, tc.wantErr)
+			is.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestDestination_PrepareValues_ColumnMapping(t *testing.T) {
+	is := is.New(t)
+
+	mappings, err := parseColumnMappings(map[string]string{
+		"columnMapping.address.city": "city",
+		"columnMapping.meta.tags[0]": "primary_tag",
+		"columnMapping.meta.missing": "missing",
+	})
+	is.NoErr(err)
+	d := &Destination{config: config{
+		columnMappings:      mappings,
+		fieldNameConversion: FieldNameConversionSnakeCase,
+		excludeFields:       []string{"address", "meta"},
+		dialect:             DialectCockroachDB, // doesn't read the catalog
+	}}
+
+	payload, err := structuredDataFormatter([]byte(`{
+		"userName": "foo",
+		"address": {"city": "Berlin", "zip": 10115},
+		"meta": {"tags": ["a", "b"]}
+	}`))
+	is.NoErr(err)
+	is.NoErr(d.prepareValues(context.Background(), `"users"`, payload))
+	is.Equal(payload, sdk.StructuredData{
+		"user_name":   "foo",
+		"city":        "Berlin",
+		"primary_tag": "a",
+	})
+}
+
+func TestParseColumnMappings_SameColumn(t *testing.T) {
+	is := is.New(t)
+	_, err := parseColumnMappings(map[string]string{
+		"columnMapping.address.city": "city",
+		"columnMapping.city":         "city",
+	})
+	is.Equal(err, errors.New(`"columnMapping.address.city" and "columnMapping.city" both map to column "city"`))
+}
+
+func TestColumnMapping_Extract(t *testing.T) {
+	is := is.New(t)
+	steps, err := parsePath("items[1].price")
+	is.NoErr(err)
+	m := columnMapping{steps: steps, column: "price"}
+
+	v, ok := m.extract(sdk.StructuredData{"items": []interface{}{
+		map[string]interface{}{"price": json.Number("1.5")},
+		map[string]interface{}{"price": json.Number("2.5")},
+	}})
+	is.True(ok)
+	is.Equal(v, json.Number("2.5"))
+
+	_, ok = m.extract(sdk.StructuredData{"items": []interface{}{}})
+	is.True(!ok)
+	_, ok = m.extract(sdk.StructuredData{"items": "none"})
+	is.True(!ok)
+}
@@ -0,0 +1,68 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"fmt"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// UpsertMethod determines the statement used to upsert records.
+type UpsertMethod string
+
+const (
+	// UpsertMethodOnConflict upserts records with INSERT ... ON CONFLICT,
+	// which requires a unique index on the key column.
+	UpsertMethodOnConflict UpsertMethod = "onConflict"
+	// UpsertMethodMerge upserts records with MERGE, which matches rows on the
+	// key column without requiring a unique index. MERGE is supported since
+	// Postgres 15, older servers fall back to UpsertMethodOnConflict.
+	UpsertMethodMerge UpsertMethod = "merge"
+)
+
+var upsertMethodAll = []UpsertMethod{UpsertMethodOnConflict, UpsertMethodMerge}
+
+func isUpsertMethodSupported(raw string) bool {
+	for _, m := range upsertMethodAll {
+		if string(m) == raw {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeMinServerVersion is the first server_version_num that supports MERGE.
+const mergeMinServerVersion = 150000
+
+// detectMerge checks if the server supports MERGE and falls back to ON
+// CONFLICT if it doesn't.
+func (d *Destination) detectMerge(ctx context.Context) error {
+	var version int
+	err := d.conn.QueryRow(ctx, "SELECT current_setting('server_version_num')::int").Scan(&version)
+	if err != nil {
+		return fmt.Errorf("failed to detect server version: %w", err)
+	}
+	if version < mergeMinServerVersion {
+		sdk.Logger(ctx).Warn().
+			Int("serverVersion", version).
+			Msgf("server doesn't support MERGE, falling back to %q", UpsertMethodOnConflict)
+		d.useMerge = false
+		return nil
+	}
+	d.useMerge = true
+	return nil
+}
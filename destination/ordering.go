@@ -0,0 +1,172 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// OutOfOrderRecords determines how records are handled that arrive after a
+// newer record of the same key.
+type OutOfOrderRecords string
+
+const (
+	// OutOfOrderRecordsIgnore writes records without checking their order.
+	OutOfOrderRecordsIgnore OutOfOrderRecords = "ignore"
+	// OutOfOrderRecordsWarn logs a warning and writes the record.
+	OutOfOrderRecordsWarn OutOfOrderRecords = "warn"
+	// OutOfOrderRecordsSkip logs a warning and skips the record, so it
+	// doesn't overwrite the newer row.
+	OutOfOrderRecordsSkip OutOfOrderRecords = "skip"
+	// OutOfOrderRecordsReject fails the write of the record.
+	OutOfOrderRecordsReject OutOfOrderRecords = "reject"
+)
+
+var outOfOrderRecordsAll = []OutOfOrderRecords{
+	OutOfOrderRecordsIgnore,
+	OutOfOrderRecordsWarn,
+	OutOfOrderRecordsSkip,
+	OutOfOrderRecordsReject,
+}
+
+func isOutOfOrderRecordsSupported(raw string) bool {
+	for _, m := range outOfOrderRecordsAll {
+		if string(m) == raw {
+			return true
+		}
+	}
+	return false
+}
+
+// maxOrderedKeys is the number of keys whose last record is remembered to
+// detect out of order records, the least recently written keys are
+// forgotten first.
+const maxOrderedKeys = 100000
+
+// recordOrder is the part of a record that determines its order.
+type recordOrder struct {
+	position  sdk.Position
+	createdAt time.Time
+}
+
+// compareOrder compares the order of two records, see comparePositions. If
+// the positions can't be compared, the creation times of the records are
+// compared instead. The second return value is false if neither can be
+// compared.
+func compareOrder(a, b recordOrder) (int, bool) {
+	if cmp, ok := comparePositions(a.position, b.position); ok {
+		return cmp, true
+	}
+	if a.createdAt.IsZero() || b.createdAt.IsZero() {
+		return 0, false
+	}
+	switch {
+	case a.createdAt.Before(b.createdAt):
+		return -1, true
+	case a.createdAt.After(b.createdAt):
+		return 1, true
+	default:
+		return 0, true
+	}
+}
+
+// keyOrders remembers the order of the last record of each key, it's bounded
+// to maxOrderedKeys keys.
+type keyOrders struct {
+	m       sync.Mutex
+	max     int
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type keyOrderEntry struct {
+	key   string
+	order recordOrder
+}
+
+func newKeyOrders(max int) *keyOrders {
+	return &keyOrders{
+		max:     max,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// update compares the order of the record with the last record of the key.
+// It returns the order of the last record and true if the record is older,
+// otherwise the record becomes the last record of the key.
+func (k *keyOrders) update(key string, order recordOrder) (recordOrder, bool) {
+	k.m.Lock()
+	defer k.m.Unlock()
+
+	if el, ok := k.entries[key]; ok {
+		entry := el.Value.(*keyOrderEntry)
+		if cmp, ok := compareOrder(order, entry.order); ok && cmp < 0 {
+			return entry.order, true
+		}
+		entry.order = order
+		k.lru.MoveToFront(el)
+		return recordOrder{}, false
+	}
+
+	k.entries[key] = k.lru.PushFront(&keyOrderEntry{key: key, order: order})
+	if k.lru.Len() > k.max {
+		oldest := k.lru.Back()
+		k.lru.Remove(oldest)
+		delete(k.entries, oldest.Value.(*keyOrderEntry).key)
+	}
+	return recordOrder{}, false
+}
+
+// checkOrder applies the configured handling to records that are older than
+// the last record written for the same key, the order is only known for keys
+// written since the destination was opened. It returns false if the record
+// should not be written.
+func (d *Destination) checkOrder(ctx context.Context, r sdk.Record) (bool, error) {
+	if d.keyOrders == nil || !d.isKeyedWrite(r) {
+		return true, nil
+	}
+	key, err := d.batchKey(r)
+	if err != nil {
+		return false, err
+	}
+	last, older := d.keyOrders.update(key, recordOrder{position: r.Position, createdAt: r.CreatedAt})
+	if !older {
+		return true, nil
+	}
+
+	switch d.config.outOfOrderRecords {
+	case OutOfOrderRecordsReject:
+		return false, fmt.Errorf("record at position %q arrived after the newer record at position %q of the same key", r.Position, last.position)
+	case OutOfOrderRecordsSkip:
+		sdk.Logger(ctx).Warn().
+			Bytes("position", r.Position).
+			Bytes("lastPosition", last.position).
+			Msg("skipping record, a newer record of the same key was already written")
+		return false, nil
+	default:
+		sdk.Logger(ctx).Warn().
+			Bytes("position", r.Position).
+			Bytes("lastPosition", last.position).
+			Msg("record arrived after a newer record of the same key, writing it anyway")
+		return true, nil
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestKeyOrders_Update(t *testing.T) {
+	is := is.New(t)
+	now := time.Now()
+
+	k := newKeyOrders(2)
+	_, older := k.update("a", recordOrder{position: sdk.Position("0/16B3748")})
+	is.True(!older)
+	_, older = k.update("a", recordOrder{position: sdk.Position("0/16B3750")})
+	is.True(!older)
+
+	last, older := k.update("a", recordOrder{position: sdk.Position("0/16B3740")})
+	is.True(older)
+	is.Equal(last.position, sdk.Position("0/16B3750"))
+
+	// positions that can't be compared fall back to the creation time
+	_, older = k.update("b", recordOrder{position: sdk.Position("x"), createdAt: now})
+	is.True(!older)
+	_, older = k.update("b", recordOrder{position: sdk.Position("y"), createdAt: now.Add(-time.Second)})
+	is.True(older)
+	_, older = k.update("b", recordOrder{position: sdk.Position("z")})
+	is.True(!older)
+
+	// the least recently written key is forgotten
+	_, older = k.update("c", recordOrder{position: sdk.Position("5")})
+	is.True(!older)
+	is.Equal(len(k.entries), 2)
+	_, older = k.update("a", recordOrder{position: sdk.Position("0/0")})
+	is.True(!older)
+}
+
+func TestDestination_CheckOrder(t *testing.T) {
+	record := func(pos string) sdk.Record {
+		return sdk.Record{
+			Position: sdk.Position(pos),
+			Metadata: map[string]string{"action": actionUpdate},
+			Key:      sdk.StructuredData{"id": 1},
+			Payload:  sdk.StructuredData{"id": 1, "name": "foo"},
+		}
+	}
+	newDestination := func(mode OutOfOrderRecords) *Destination {
+		return &Destination{
+			config:    config{tableName: "users", keyColumnName: "id", outOfOrderRecords: mode},
+			keyOrders: newKeyOrders(maxOrderedKeys),
+		}
+	}
+
+	testCases := []struct {
+		mode    OutOfOrderRecords
+		wantOK  bool
+		wantErr error
+	}{{
+		mode:   OutOfOrderRecordsWarn,
+		wantOK: true,
+	}, {
+		mode:   OutOfOrderRecordsSkip,
+		wantOK: false,
+	}, {
+		mode:    OutOfOrderRecordsReject,
+		wantErr: errors.New(`record at position "0/10" arrived after the newer record at position "0/20" of the same key`),
+	}}
+	for _, tc := range testCases {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			is := is.New(t)
+			ctx := context.Background()
+			d := newDestination(tc.mode)
+
+			ok, err := d.checkOrder(ctx, record("0/20"))
+			is.NoErr(err)
+			is.True(ok)
+
+			ok, err = d.checkOrder(ctx, record("0/10"))
+			is.Equal(err, tc.wantErr)
+			is.Equal(ok, tc.wantOK)
+		})
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgx/v4"
+)
+
+// partitionInfo describes a declaratively partitioned table.
+type partitionInfo struct {
+	// keyColumns are the columns of the partition key. If the partition key
+	// contains an expression the corresponding entry is empty.
+	keyColumns []partitionKeyColumn
+	// partitions contains the names of the child partitions, the index of a
+	// partition is returned by routingQuery.
+	partitions []string
+	// routingQuery returns the index of the partition that accepts the
+	// partition key values passed as arguments, or -1 if none does.
+	routingQuery string
+}
+
+type partitionKeyColumn struct {
+	name     string
+	dataType string
+}
+
+// hasExpressionKey returns true if the partition key contains an expression
+// instead of plain columns.
+func (p *partitionInfo) hasExpressionKey() bool {
+	for _, col := range p.keyColumns {
+		if col.name == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// validateConflictTarget returns an error if the conflict target doesn't
+// contain all partition key columns. Postgres requires unique constraints on
+// partitioned tables to include the partition key, so an ON CONFLICT clause
+// without it can't be matched to a constraint.
+func (p *partitionInfo) validateConflictTarget(table string, conflictColumns ...string) error {
+	for _, col := range p.keyColumns {
+		found := false
+		for _, cc := range conflictColumns {
+			if cc == col.name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf(
+				"table %s is partitioned by %v, the conflict target %v must include all partition key columns",
+				table, p.keyColumnNames(), conflictColumns,
+			)
+		}
+	}
+	return nil
+}
+
+func (p *partitionInfo) keyColumnNames() []string {
+	names := make([]string, len(p.keyColumns))
+	for i, col := range p.keyColumns {
+		names[i] = col.name
+	}
+	return names
+}
+
+// getPartitionInfo returns the partitioning info of the table or nil if the
+// table is not partitioned. Results are cached per table.
+func (d *Destination) getPartitionInfo(ctx context.Context, table string) (*partitionInfo, error) {
+	if info, ok := d.partitions[table]; ok {
+		return info, nil
+	}
+
+	info, err := d.loadPartitionInfo(ctx, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load partition info for table %s: %w", table, err)
+	}
+
+	if d.partitions == nil {
+		d.partitions = make(map[string]*partitionInfo)
+	}
+	d.partitions[table] = info
+	return info, nil
+}
+
+func (d *Destination) loadPartitionInfo(ctx context.Context, table string) (*partitionInfo, error) {
+	query := `SELECT COALESCE(a.attname, ''), COALESCE(format_type(a.atttypid, a.atttypmod), '')
+		FROM pg_partitioned_table pt
+		CROSS JOIN LATERAL unnest(pt.partattrs::int2[]) WITH ORDINALITY AS k(attnum, pos)
+		LEFT JOIN pg_attribute a ON a.attrelid = pt.partrelid AND a.attnum = k.attnum
+		WHERE pt.partrelid = $1::regclass
+		ORDER BY k.pos`
+	rows, err := d.conn.Query(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	var keyColumns []partitionKeyColumn
+	for rows.Next() {
+		var col partitionKeyColumn
+		if err := rows.Scan(&col.name, &col.dataType); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		keyColumns = append(keyColumns, col)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(keyColumns) == 0 && d.config.dialect == DialectTimescaleDB {
+		// hypertables are partitioned into chunks by TimescaleDB, the chunks
+		// are managed by TimescaleDB, so we never route records to them
+		keyColumns, err = d.loadHypertableDimensions(ctx, table)
+		if err != nil {
+			return nil, err
+		}
+		if len(keyColumns) > 0 {
+			return &partitionInfo{keyColumns: keyColumns}, nil
+		}
+	}
+	if len(keyColumns) == 0 {
+		// table is not partitioned
+		return nil, nil
+	}
+
+	info := &partitionInfo{keyColumns: keyColumns}
+	if !d.config.routeToPartitions || info.hasExpressionKey() {
+		// no need to fetch partitions, we won't route records
+		return info, nil
+	}
+
+	query = `SELECT c.oid::regclass::text, COALESCE(pg_get_partition_constraintdef(c.oid), 'true')
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = $1::regclass`
+	rows, err = d.conn.Query(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	var constraints []string
+	for rows.Next() {
+		var name, constraint string
+		if err := rows.Scan(&name, &constraint); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		info.partitions = append(info.partitions, name)
+		constraints = append(constraints, constraint)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(constraints) > 0 {
+		info.routingQuery = formatPartitionRoutingQuery(keyColumns, constraints)
+	}
+	return info, nil
+}
+
+// formatPartitionRoutingQuery builds a query that evaluates the partition
+// constraints against the partition key values passed as arguments and returns
+// the index of the first matching partition.
+func formatPartitionRoutingQuery(keyColumns []partitionKeyColumn, constraints []string) string {
+	var sb strings.Builder
+	sb.WriteString("SELECT CASE")
+	for i, constraint := range constraints {
+		fmt.Fprintf(&sb, " WHEN %s THEN %d", constraint, i)
+	}
+	sb.WriteString(" ELSE -1 END FROM (SELECT ")
+	for i, col := range keyColumns {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		fmt.Fprintf(&sb, "$%d::%s AS %s", i+1, col.dataType, pgx.Identifier{col.name}.Sanitize())
+	}
+	sb.WriteString(") AS v")
+	return sb.String()
+}
+
+// validatePartitionedUpsert makes sure that an upsert into a partitioned table
+// uses a conflict target that includes the partition key.
+func (d *Destination) validatePartitionedUpsert(ctx context.Context, table string, conflictColumns ...string) error {
+	info, err := d.getPartitionInfo(ctx, table)
+	if err != nil {
+		return err
+	}
+	if info == nil || info.hasExpressionKey() {
+		// expressions can't be validated, postgres will complain if needed
+		return nil
+	}
+	return info.validateConflictTarget(table, conflictColumns...)
+}
+
+// routeToPartition returns the name of the child partition that accepts the
+// record. If the table is not partitioned, routing is disabled or the
+// partition can't be determined, the table name is returned unchanged and
+// Postgres routes the row itself.
+func (d *Destination) routeToPartition(
+	ctx context.Context,
+	table string,
+	key sdk.StructuredData,
+	payload sdk.StructuredData,
+) (string, error) {
+	if !d.config.routeToPartitions {
+		return table, nil
+	}
+	info, err := d.getPartitionInfo(ctx, table)
+	if err != nil {
+		return "", err
+	}
+	if info == nil || info.routingQuery == "" {
+		return table, nil
+	}
+
+	args := make([]interface{}, len(info.keyColumns))
+	for i, col := range info.keyColumns {
+		val, ok := payload[col.name]
+		if !ok {
+			val, ok = key[col.name]
+		}
+		if !ok {
+			// partition key is missing, let postgres figure it out
+			return table, nil
+		}
+		args[i] = val
+	}
+
+	var index int
+	if err := d.conn.QueryRow(ctx, info.routingQuery, args...).Scan(&index); err != nil {
+		return "", fmt.Errorf("failed to route record to partition of table %s: %w", table, err)
+	}
+	if index < 0 || index >= len(info.partitions) {
+		return table, nil
+	}
+	return info.partitions[index], nil
+}
@@ -0,0 +1,50 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestFormatPartitionRoutingQuery(t *testing.T) {
+	is := is.New(t)
+
+	got := formatPartitionRoutingQuery(
+		[]partitionKeyColumn{{name: "created_at", dataType: "date"}},
+		[]string{
+			"((created_at IS NOT NULL) AND (created_at < '2022-01-01'::date))",
+			"((created_at IS NOT NULL) AND (created_at >= '2022-01-01'::date))",
+		},
+	)
+	is.Equal(got, `SELECT CASE`+
+		` WHEN ((created_at IS NOT NULL) AND (created_at < '2022-01-01'::date)) THEN 0`+
+		` WHEN ((created_at IS NOT NULL) AND (created_at >= '2022-01-01'::date)) THEN 1`+
+		` ELSE -1 END FROM (SELECT $1::date AS "created_at") AS v`)
+}
+
+func TestPartitionInfo_ValidateConflictTarget(t *testing.T) {
+	is := is.New(t)
+
+	info := &partitionInfo{
+		keyColumns: []partitionKeyColumn{{name: "created_at", dataType: "date"}},
+	}
+	is.NoErr(info.validateConflictTarget("events", "id", "created_at"))
+
+	err := info.validateConflictTarget("events", "id")
+	is.True(err != nil)
+	is.Equal(err.Error(), "table events is partitioned by [created_at], the conflict target [id] must include all partition key columns")
+}
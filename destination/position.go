@@ -0,0 +1,204 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v4"
+)
+
+// positionTable is the table that stores the position of the last record
+// written by each destination with trackPositions enabled.
+const positionTable = "_conduit_positions"
+
+// createPositionTable creates the position table if it doesn't exist.
+func (d *Destination) createPositionTable(ctx context.Context) error {
+	query := `CREATE TABLE IF NOT EXISTS ` + positionTable + ` (
+		id text PRIMARY KEY,
+		position bytea NOT NULL,
+		updated_at timestamptz NOT NULL DEFAULT now()
+	)`
+	if _, err := d.conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to create position table %s: %w", positionTable, err)
+	}
+	return nil
+}
+
+// loadPosition returns the position of the last record written by this
+// destination or nil if no record was written yet.
+func (d *Destination) loadPosition(ctx context.Context) (sdk.Position, error) {
+	query := `SELECT position FROM ` + positionTable + ` WHERE id = $1`
+	var pos []byte
+	err := d.conn.QueryRow(ctx, query, d.config.positionID).Scan(&pos)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load position from %s: %w", positionTable, err)
+	}
+	return pos, nil
+}
+
+// storePosition stores the position of the last written record. It needs to be
+// executed in the same transaction as the write of the record.
+func storePosition(ctx context.Context, tx pgx.Tx, id string, pos sdk.Position) error {
+	query := `INSERT INTO ` + positionTable + ` (id, position) VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET position = EXCLUDED.position, updated_at = now()`
+	if _, err := tx.Exec(ctx, query, id, []byte(pos)); err != nil {
+		return fmt.Errorf("failed to store position in %s: %w", positionTable, err)
+	}
+	return nil
+}
+
+// writeWithPosition writes the record and stores its position in a single
+// transaction, as the last written position if trackPositions is enabled and
+// in the window if dedupWindow is set. Records that were already written are
+// skipped.
+func (d *Destination) writeWithPosition(ctx context.Context, r sdk.Record) error {
+	if d.skipWritten(ctx, r.Position) {
+		return nil
+	}
+
+	tx, err := d.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // no-op if the transaction is committed
+
+	// the transaction is open on the connection, so all writes executed on
+	// the connection are part of the transaction
+	if err := d.write(ctx, r); err != nil {
+		return err
+	}
+	if d.config.trackPositions {
+		if err := storePosition(ctx, tx, d.config.positionID, r.Position); err != nil {
+			return err
+		}
+	}
+	if d.window != nil {
+		if err := storeWindow(ctx, tx, d.config.positionID, d.window, []sdk.Position{r.Position}); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	if d.window != nil {
+		d.window.add(r.Position)
+	}
+	return nil
+}
+
+// skipWritten returns true if the record at the position was already written
+// before the destination was restarted. Positions are compared only until the
+// first record after the last written position is seen, after that all
+// records are written unless their position is in the dedup window.
+func (d *Destination) skipWritten(ctx context.Context, pos sdk.Position) bool {
+	if d.window != nil && d.window.contains(pos) {
+		sdk.Logger(ctx).Debug().
+			Bytes("position", pos).
+			Msg("skipping record, its position is in the dedup window")
+		return true
+	}
+	if d.lastPosition == nil {
+		return false
+	}
+
+	cmp, ok := comparePositions(pos, d.lastPosition)
+	switch {
+	case !ok:
+		sdk.Logger(ctx).Warn().
+			Bytes("position", pos).
+			Bytes("lastPosition", d.lastPosition).
+			Msg("can't compare record position with last written position, writing record (it might be a duplicate)")
+	case cmp <= 0:
+		sdk.Logger(ctx).Debug().
+			Bytes("position", pos).
+			Bytes("lastPosition", d.lastPosition).
+			Msg("skipping record, it was already written")
+		return true
+	}
+
+	// we caught up with the last written position, stop comparing
+	d.lastPosition = nil
+	return false
+}
+
+// comparePositions compares two positions and returns -1 if a is before b, 0
+// if they are equal and 1 if a is after b. Positions are opaque, only positions
+// that are Postgres LSNs or integers can be ordered. Like the positions of this
+// connector's source, they can be followed by a suffix separated with "#",
+// e.g. "0/16B3748#schema:public.users" or "42#public.users#1042". Positions
+// are ordered by their LSN or integer first and by their suffix second, a
+// position without a suffix sorts before the same position with a suffix. The
+// second return value is false if the positions can't be compared.
+func comparePositions(a, b sdk.Position) (int, bool) {
+	if bytes.Equal(a, b) {
+		return 0, true
+	}
+	prefixA, suffixA := splitPosition(a)
+	prefixB, suffixB := splitPosition(b)
+	var cmp int
+	if lsnA, err := pglogrepl.ParseLSN(prefixA); err == nil {
+		lsnB, err := pglogrepl.ParseLSN(prefixB)
+		if err != nil {
+			return 0, false
+		}
+		cmp = compareUint64(uint64(lsnA), uint64(lsnB))
+	} else if intA, err := strconv.ParseUint(prefixA, 10, 64); err == nil {
+		intB, err := strconv.ParseUint(prefixB, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		cmp = compareUint64(intA, intB)
+	} else {
+		return 0, false
+	}
+	if cmp != 0 {
+		return cmp, true
+	}
+	// the suffixes are compared as bytes, a missing suffix sorts first
+	return bytes.Compare(suffixA, suffixB), true
+}
+
+// splitPosition splits the position at the first "#" into the LSN or integer
+// and the suffix. The suffix is nil if the position doesn't contain one.
+func splitPosition(pos sdk.Position) (string, []byte) {
+	raw := string(pos)
+	i := strings.Index(raw, "#")
+	if i < 0 {
+		return raw, nil
+	}
+	return raw[:i], pos[i+1:]
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
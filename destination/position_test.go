@@ -0,0 +1,73 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestComparePositions(t *testing.T) {
+	testCases := []struct {
+		a, b   string
+		want   int
+		wantOk bool
+	}{
+		{a: "0/16B3748", b: "0/16B3748", want: 0, wantOk: true},
+		{a: "0/16B3748", b: "1/0", want: -1, wantOk: true},
+		{a: "1/0", b: "0/FFFFFFFF", want: 1, wantOk: true},
+		{a: "9", b: "10", want: -1, wantOk: true},
+		{a: "10", b: "9", want: 1, wantOk: true},
+		{a: "foo", b: "foo", want: 0, wantOk: true},
+		{a: "foo", b: "bar", wantOk: false},
+		{a: "10", b: "0/A", wantOk: false},
+		// positions with a suffix
+		{a: "0/16B3747#schema:public.users", b: "0/16B3748", want: -1, wantOk: true},
+		{a: "0/16B3747#schema:public.users", b: "0/16B3747", want: 1, wantOk: true},
+		{a: "0/16B3748#seq:1", b: "0/16B3748#seq:2", want: -1, wantOk: true},
+		{a: "0/16B3748#schema:public.users#seq:1", b: "0/16B3748#schema:public.users", want: 1, wantOk: true},
+		{a: "42#public.users#1042", b: "43#public.users#1043", want: -1, wantOk: true},
+		{a: "42#public.users#1042", b: "43#public.users", want: -1, wantOk: true},
+		{a: "42#public.users#1042", b: "9", want: 1, wantOk: true},
+		{a: "42#public.users#1042", b: "42#public.users#1042", want: 0, wantOk: true},
+		{a: "42#public.users#1042", b: "0/2A#public.users#1042", wantOk: false},
+		{a: "foo#1", b: "foo#2", wantOk: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.a+"_"+tc.b, func(t *testing.T) {
+			is := is.New(t)
+			got, ok := comparePositions(sdk.Position(tc.a), sdk.Position(tc.b))
+			is.Equal(ok, tc.wantOk)
+			is.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestSkipWritten(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	d := &Destination{lastPosition: sdk.Position("0/20")}
+	is.True(d.skipWritten(ctx, sdk.Position("0/10")))
+	is.True(d.skipWritten(ctx, sdk.Position("0/20")))
+	is.True(!d.skipWritten(ctx, sdk.Position("0/30")))
+
+	// once caught up, positions are not compared anymore
+	is.Equal(d.lastPosition, nil)
+	is.True(!d.skipWritten(ctx, sdk.Position("0/10")))
+}
@@ -0,0 +1,59 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"fmt"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// advanceSequenceQuery sets the sequence owned by a column to a value, unless
+// the sequence is already ahead of it. Columns without a sequence are skipped.
+const advanceSequenceQuery = `SELECT setval(s.seq, GREATEST($3::bigint, COALESCE(pg_sequence_last_value(s.seq), $3::bigint)))
+	FROM (SELECT pg_get_serial_sequence($1, $2)::regclass AS seq) s
+	WHERE s.seq IS NOT NULL`
+
+// advanceSequence applies a sequence record, which contains the last value of
+// the sequence owned by a column of the source table. The sequence owned by
+// the same column of the table is advanced to the value, so rows inserted
+// into the table after a failover don't collide with replicated rows. The
+// sequence is never moved back. If the table is sharded, the sequences of all
+// shards are advanced.
+func (d *Destination) advanceSequence(ctx context.Context, r sdk.Record) error {
+	tableNames, err := d.getShardTableNames(r.Metadata)
+	if err != nil {
+		return err
+	}
+	payload, err := getPayload(r)
+	if err != nil {
+		return err
+	}
+	column, ok := payload["column"].(string)
+	if !ok || column == "" {
+		return fmt.Errorf("sequence record of table %s contains no column", tableNames[0])
+	}
+	value, ok := payload["lastValue"]
+	if !ok {
+		return fmt.Errorf("sequence record of table %s contains no value", tableNames[0])
+	}
+	for _, tableName := range tableNames {
+		if _, err := d.exec(ctx, advanceSequenceQuery, tableName, column, value); err != nil {
+			return fmt.Errorf("failed to advance sequence of column %s of table %s: %w", column, tableName, err)
+		}
+	}
+	return nil
+}
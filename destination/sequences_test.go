@@ -0,0 +1,58 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestDestination_AdvanceSequence(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "statements.jsonl")
+
+	preview, err := openStatementPreview(path)
+	is.NoErr(err)
+	d := &Destination{
+		config:  config{dryRun: true, keyColumnName: "id"},
+		preview: preview,
+	}
+
+	r := sdk.Record{
+		Metadata: map[string]string{"table": "users", "action": "sequence"},
+		Key:      sdk.StructuredData{"sequence": "public.users_id_seq"},
+		Payload:  sdk.StructuredData{"column": "id", "lastValue": int64(42)},
+	}
+	// sequence records have a key, but they don't upsert a row
+	is.True(!d.isUpsert(r))
+	is.True(!isRowChange(r))
+	is.NoErr(d.write(ctx, r))
+	is.NoErr(preview.Close())
+
+	got, err := os.ReadFile(path)
+	is.NoErr(err)
+	var stmt previewedStatement
+	is.NoErr(json.Unmarshal([]byte(strings.TrimSpace(string(got))), &stmt))
+	is.Equal(stmt.Query, advanceSequenceQuery)
+	is.Equal(stmt.Args, []interface{}{`"users"`, "id", "42"})
+}
@@ -0,0 +1,83 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// getRowTableName returns the quoted name of the table the row of the record
+// is written into. If shardCount is set, it's the shard of the table the key
+// of the record hashes to, e.g. "public"."orders_3".
+func (d *Destination) getRowTableName(r sdk.Record) (string, error) {
+	if d.config.shardCount == 0 {
+		return d.getTableName(r.Metadata)
+	}
+	key, err := d.getKey(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to get key: %w", err)
+	}
+	shard, err := d.shard(key)
+	if err != nil {
+		return "", err
+	}
+	return d.getSuffixedTableName(r.Metadata, shardSuffix(shard))
+}
+
+// shard returns the shard the key hashes to. The key is encoded as JSON, which
+// sorts the fields, so the same key always lands in the same shard regardless
+// of the field order.
+func (d *Destination) shard(key sdk.StructuredData) (int, error) {
+	if len(key) == 0 {
+		return 0, fmt.Errorf("record has no key, %q requires records with a key", ConfigKeyShardCount)
+	}
+	b, err := json.Marshal(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode key: %w", err)
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(b)
+	return int(h.Sum32() % uint32(d.config.shardCount)), nil
+}
+
+// getShardTableNames returns the quoted names of all shards of the table the
+// record is written into, or only the table if sharding is disabled.
+func (d *Destination) getShardTableNames(metadata map[string]string) ([]string, error) {
+	if d.config.shardCount == 0 {
+		table, err := d.getTableName(metadata)
+		if err != nil {
+			return nil, err
+		}
+		return []string{table}, nil
+	}
+	tables := make([]string, d.config.shardCount)
+	for i := range tables {
+		table, err := d.getSuffixedTableName(metadata, shardSuffix(i))
+		if err != nil {
+			return nil, err
+		}
+		tables[i] = table
+	}
+	return tables, nil
+}
+
+func shardSuffix(shard int) string {
+	return "_" + strconv.Itoa(shard)
+}
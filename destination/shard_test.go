@@ -0,0 +1,70 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"errors"
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestDestination_GetRowTableName(t *testing.T) {
+	is := is.New(t)
+
+	d := &Destination{config: config{tableName: "orders", schema: "app"}}
+	r := sdk.Record{Key: sdk.StructuredData{"id": 1}}
+	got, err := d.getRowTableName(r)
+	is.NoErr(err)
+	is.Equal(got, `"app"."orders"`)
+
+	d.config.shardCount = 4
+	got, err = d.getRowTableName(r)
+	is.NoErr(err)
+	is.Equal(got, `"app"."orders_1"`)
+
+	// the shard only depends on the key
+	r.Payload = sdk.StructuredData{"status": "paid"}
+	again, err := d.getRowTableName(r)
+	is.NoErr(err)
+	is.Equal(again, got)
+
+	// keys are spread across all shards
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		table, err := d.getRowTableName(sdk.Record{Key: sdk.StructuredData{"id": i}})
+		is.NoErr(err)
+		seen[table] = true
+	}
+	is.Equal(len(seen), 4)
+
+	_, err = d.getRowTableName(sdk.Record{})
+	is.Equal(err, errors.New(`record has no key, "shardCount" requires records with a key`))
+}
+
+func TestDestination_GetShardTableNames(t *testing.T) {
+	is := is.New(t)
+
+	d := &Destination{config: config{tableName: "orders"}}
+	got, err := d.getShardTableNames(nil)
+	is.NoErr(err)
+	is.Equal(got, []string{`"orders"`})
+
+	d.config.shardCount = 3
+	got, err = d.getShardTableNames(map[string]string{"table": "app.users"})
+	is.NoErr(err)
+	is.Equal(got, []string{`"app"."users_0"`, `"app"."users_1"`, `"app"."users_2"`})
+}
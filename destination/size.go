@@ -0,0 +1,210 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// OversizedRecords determines how records with a payload larger than
+// maxRecordSize are handled.
+type OversizedRecords string
+
+const (
+	// OversizedRecordsReject fails the write of an oversized record.
+	OversizedRecordsReject OversizedRecords = "reject"
+	// OversizedRecordsOverflow removes the largest payload fields until the
+	// payload fits and stores the sizes of the removed fields in the overflow
+	// column.
+	OversizedRecordsOverflow OversizedRecords = "overflow"
+	// OversizedRecordsDeadLetter writes an oversized record into the dead
+	// letter table instead, with its payload compressed, so it can be
+	// replayed.
+	OversizedRecordsDeadLetter OversizedRecords = "deadLetter"
+)
+
+var oversizedRecordsAll = []OversizedRecords{
+	OversizedRecordsReject,
+	OversizedRecordsOverflow,
+	OversizedRecordsDeadLetter,
+}
+
+func isOversizedRecordsSupported(raw string) bool {
+	for _, m := range oversizedRecordsAll {
+		if string(m) == raw {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRecordSize applies the configured handling to records whose payload is
+// larger than maxRecordSize. It returns the record that should be written,
+// which has a truncated payload in overflow mode, and false if the record
+// should not be written at all.
+func (d *Destination) checkRecordSize(ctx context.Context, r sdk.Record) (sdk.Record, bool, error) {
+	if d.config.maxRecordSize == 0 || r.Payload == nil {
+		return r, true, nil
+	}
+	switch r.Metadata["action"] {
+	case actionDelete, actionSchemaChange, actionSequence:
+		// the payload is not written
+		return r, true, nil
+	}
+	size := len(r.Payload.Bytes())
+	if size <= d.config.maxRecordSize {
+		return r, true, nil
+	}
+
+	switch d.config.oversizedRecords {
+	case OversizedRecordsOverflow:
+		payload, err := getPayload(r)
+		if err != nil {
+			return sdk.Record{}, false, fmt.Errorf("failed to get payload: %w", err)
+		}
+		removed, err := truncatePayload(payload, d.config.overflowColumn, d.config.maxRecordSize)
+		if err != nil {
+			return sdk.Record{}, false, err
+		}
+		sdk.Logger(ctx).Warn().
+			Bytes("position", r.Position).
+			Int("size", size).
+			Strs("fields", sortedFields(removed)).
+			Msg("payload exceeds maxRecordSize, removed the largest fields")
+		r.Payload = payload
+		return r, true, nil
+	case OversizedRecordsDeadLetter:
+		if err := d.writeDeadLetter(ctx, r, size); err != nil {
+			return sdk.Record{}, false, err
+		}
+		sdk.Logger(ctx).Warn().
+			Bytes("position", r.Position).
+			Int("size", size).
+			Str("table", d.deadLetterTable).
+			Msg("payload exceeds maxRecordSize, wrote record into dead letter table")
+		return sdk.Record{}, false, nil
+	default:
+		return sdk.Record{}, false, fmt.Errorf(
+			"payload of record at position %q has %d bytes, exceeding %q of %d bytes",
+			r.Position, size, ConfigKeyMaxRecordSize, d.config.maxRecordSize,
+		)
+	}
+}
+
+// truncatePayload removes the largest fields from the payload until the
+// payload encoded as JSON, including the overflow column, has at most max
+// bytes. The overflow column is set to an object mapping the removed fields to
+// their size in bytes, the removed fields are returned.
+func truncatePayload(payload sdk.StructuredData, overflowColumn string, max int) (sdk.StructuredData, error) {
+	type field struct {
+		name string
+		size int
+	}
+	fields := make([]field, 0, len(payload))
+	for name, v := range payload {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode field %q: %w", name, err)
+		}
+		fields = append(fields, field{name: name, size: len(b)})
+	}
+	// largest first, ties are broken by name so the result is deterministic
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].size != fields[j].size {
+			return fields[i].size > fields[j].size
+		}
+		return fields[i].name < fields[j].name
+	})
+
+	removed := make(sdk.StructuredData)
+	for _, f := range fields {
+		payload[overflowColumn] = removed
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) <= max {
+			break
+		}
+		delete(payload, f.name)
+		removed[f.name] = f.size
+	}
+	payload[overflowColumn] = removed
+	return removed, nil
+}
+
+// createDeadLetterTable creates the dead letter table if it doesn't exist. The
+// payload column is added to tables created without it.
+func (d *Destination) createDeadLetterTable(ctx context.Context) error {
+	query := `CREATE TABLE IF NOT EXISTS ` + d.deadLetterTable + ` (
+		position bytea NOT NULL,
+		key bytea,
+		metadata jsonb,
+		payload_size bigint NOT NULL,
+		payload bytea,
+		created_at timestamptz NOT NULL DEFAULT now()
+	);
+	ALTER TABLE ` + d.deadLetterTable + ` ADD COLUMN IF NOT EXISTS payload bytea`
+	if _, err := d.exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to create dead letter table %s: %w", d.deadLetterTable, err)
+	}
+	return nil
+}
+
+// writeDeadLetter writes the position, key, metadata and payload of the record
+// into the dead letter table. The payload is compressed with gzip, it's
+// stored as received, so the record can be replayed.
+func (d *Destination) writeDeadLetter(ctx context.Context, r sdk.Record, size int) error {
+	var key []byte
+	if r.Key != nil {
+		key = r.Key.Bytes()
+	}
+	payload, err := compressBytes(r.Payload.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to compress payload: %w", err)
+	}
+	query, args, err := psql.
+		Insert(d.deadLetterTable).
+		Columns("position", "key", "metadata", "payload_size", "payload").
+		Values([]byte(r.Position), key, r.Metadata, size, payload).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("error formatting dead letter query: %w", err)
+	}
+	if _, err := d.exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to write record into dead letter table %s: %w", d.deadLetterTable, err)
+	}
+	return nil
+}
+
+// compressBytes compresses the bytes with gzip.
+func compressBytes(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,124 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestTruncatePayload(t *testing.T) {
+	is := is.New(t)
+
+	payload := sdk.StructuredData{
+		"id":          1,
+		"name":        "foo",
+		"body":        strings.Repeat("a", 100),
+		"attachments": strings.Repeat("b", 50),
+	}
+	removed, err := truncatePayload(payload, "overflow", 80)
+	is.NoErr(err)
+	is.Equal(removed, sdk.StructuredData{"body": 102, "attachments": 52})
+	is.Equal(payload, sdk.StructuredData{
+		"id":       1,
+		"name":     "foo",
+		"overflow": removed,
+	})
+}
+
+func TestDestination_CheckRecordSize(t *testing.T) {
+	r := sdk.Record{
+		Position: sdk.Position("1"),
+		Metadata: map[string]string{"action": actionInsert},
+		Payload:  sdk.RawData(`{"id":1,"body":"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}`),
+	}
+
+	t.Run("within limit", func(t *testing.T) {
+		is := is.New(t)
+		d := &Destination{config: config{maxRecordSize: 100}}
+		got, ok, err := d.checkRecordSize(context.Background(), r)
+		is.NoErr(err)
+		is.True(ok)
+		is.Equal(got, r)
+	})
+	t.Run("reject", func(t *testing.T) {
+		is := is.New(t)
+		d := &Destination{config: config{maxRecordSize: 20, oversizedRecords: OversizedRecordsReject}}
+		_, ok, err := d.checkRecordSize(context.Background(), r)
+		is.Equal(err, errors.New(`payload of record at position "1" has 68 bytes, exceeding "maxRecordSize" of 20 bytes`))
+		is.True(!ok)
+	})
+	t.Run("overflow", func(t *testing.T) {
+		is := is.New(t)
+		d := &Destination{config: config{maxRecordSize: 40, oversizedRecords: OversizedRecordsOverflow, overflowColumn: "overflow"}}
+		got, ok, err := d.checkRecordSize(context.Background(), r)
+		is.NoErr(err)
+		is.True(ok)
+		is.Equal(string(got.Payload.Bytes()), `{"id":"1","overflow":{"body":52}}`)
+	})
+	t.Run("dead letter", func(t *testing.T) {
+		is := is.New(t)
+		path := filepath.Join(t.TempDir(), "statements.jsonl")
+		preview, err := openStatementPreview(path)
+		is.NoErr(err)
+		d := &Destination{
+			config:          config{dryRun: true, maxRecordSize: 20, oversizedRecords: OversizedRecordsDeadLetter},
+			preview:         preview,
+			deadLetterTable: `"dead_letters"`,
+		}
+		_, ok, err := d.checkRecordSize(context.Background(), r)
+		is.NoErr(err)
+		is.True(!ok)
+		is.NoErr(preview.Close())
+
+		raw, err := os.ReadFile(path)
+		is.NoErr(err)
+		var stmt struct {
+			Query string
+			Args  []interface{}
+		}
+		is.NoErr(json.Unmarshal(raw, &stmt))
+		is.Equal(stmt.Query, `INSERT INTO "dead_letters" (position,key,metadata,payload_size,payload) VALUES ($1,$2,$3,$4,$5)`)
+		// the payload is stored compressed, so the record can be replayed
+		compressed, err := base64.StdEncoding.DecodeString(stmt.Args[4].(string))
+		is.NoErr(err)
+		zr, err := gzip.NewReader(bytes.NewReader(compressed))
+		is.NoErr(err)
+		payload, err := io.ReadAll(zr)
+		is.NoErr(err)
+		is.Equal(payload, r.Payload.Bytes())
+	})
+	t.Run("delete", func(t *testing.T) {
+		is := is.New(t)
+		d := &Destination{config: config{maxRecordSize: 20}}
+		deleted := r
+		deleted.Metadata = map[string]string{"action": actionDelete}
+		_, ok, err := d.checkRecordSize(context.Background(), deleted)
+		is.NoErr(err)
+		is.True(ok)
+	})
+}
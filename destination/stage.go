@@ -0,0 +1,260 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+const (
+	// stagingTableSuffix is appended to the name of a table to get the name
+	// of the table snapshot rows are staged in.
+	stagingTableSuffix = "_staging"
+	// stagedLoadsTable stores the snapshot runs staged for each table, so a
+	// staged run survives a restart of the destination.
+	stagedLoadsTable = "_conduit_staged_loads"
+)
+
+// stagedLoad is a snapshot run that is loaded into a staging table.
+type stagedLoad struct {
+	snapshotID string
+	// stagingTable is the quoted name of the staging table.
+	stagingTable string
+	// columns contains the columns written into the staging table.
+	columns map[string]bool
+	// restored is true if the run was staged before the destination was
+	// restarted, it's unknown if the run was completed.
+	restored bool
+}
+
+// createStagedLoadsTable creates the table storing the staged runs if it
+// doesn't exist.
+func (d *Destination) createStagedLoadsTable(ctx context.Context) error {
+	query := `CREATE TABLE IF NOT EXISTS ` + stagedLoadsTable + ` (
+		table_name text PRIMARY KEY,
+		snapshot_id text NOT NULL,
+		staging_table text NOT NULL,
+		columns text[] NOT NULL DEFAULT '{}',
+		updated_at timestamptz NOT NULL DEFAULT now()
+	)`
+	if _, err := d.conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to create staged loads table %s: %w", stagedLoadsTable, err)
+	}
+	return nil
+}
+
+// loadStagedLoads restores the runs that were staged before the destination
+// was restarted.
+func (d *Destination) loadStagedLoads(ctx context.Context) (map[string]*stagedLoad, error) {
+	query := `SELECT table_name, snapshot_id, staging_table, columns FROM ` + stagedLoadsTable
+	rows, err := d.conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load staged loads from %s: %w", stagedLoadsTable, err)
+	}
+	defer rows.Close()
+
+	loads := make(map[string]*stagedLoad)
+	for rows.Next() {
+		var table string
+		var columns []string
+		load := &stagedLoad{restored: true, columns: make(map[string]bool)}
+		if err := rows.Scan(&table, &load.snapshotID, &load.stagingTable, &columns); err != nil {
+			return nil, fmt.Errorf("failed to scan staged load: %w", err)
+		}
+		for _, column := range columns {
+			load.columns[column] = true
+		}
+		loads[table] = load
+		sdk.Logger(ctx).Info().
+			Str("table", table).
+			Str("stagingTable", load.stagingTable).
+			Str("snapshotID", load.snapshotID).
+			Msg("resuming staged snapshot")
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load staged loads from %s: %w", stagedLoadsTable, err)
+	}
+	return loads, nil
+}
+
+// storeStagedColumns adds the columns to the columns stored for the staged run
+// of the table. It's executed after the rows are copied into the staging
+// table, in the same transaction.
+func (d *Destination) storeStagedColumns(ctx context.Context, table string, columns []string) error {
+	query := `UPDATE ` + stagedLoadsTable + ` SET columns = ARRAY(SELECT DISTINCT unnest(columns || $2::text[]) ORDER BY 1), updated_at = now() WHERE table_name = $1`
+	if _, err := d.exec(ctx, query, table, columns); err != nil {
+		return fmt.Errorf("failed to store staged columns in %s: %w", stagedLoadsTable, err)
+	}
+	return nil
+}
+
+// isStaged returns true if the record belongs to the snapshot run that is
+// currently staged for its table.
+func (d *Destination) isStaged(table string, r sdk.Record) bool {
+	load, ok := d.stagedLoads[table]
+	return ok && d.isLoad(r) && r.Metadata[metadataSnapshotID] == load.snapshotID
+}
+
+// splitAtSwaps splits the records before each record that completes a staged
+// snapshot run, so the staged rows can be swapped into the table before the
+// record is written. Records are returned in a single batch if no run is
+// completed.
+func (d *Destination) splitAtSwaps(records []sdk.Record) ([][]sdk.Record, error) {
+	if d.config.loadMode != LoadModeStaged {
+		return [][]sdk.Record{records}, nil
+	}
+	// runs contains the snapshot IDs staged per table, including the runs
+	// started by the records
+	runs := make(map[string]string, len(d.stagedLoads))
+	for table, load := range d.stagedLoads {
+		runs[table] = load.snapshotID
+	}
+
+	var batches [][]sdk.Record
+	start := 0
+	for i, r := range records {
+		table, err := d.getTableName(r.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get table name for write: %w", err)
+		}
+		snapshotID, staged := runs[table]
+		switch {
+		case d.isLoad(r):
+			runs[table] = r.Metadata[metadataSnapshotID]
+			if !staged || snapshotID == runs[table] {
+				continue
+			}
+		case staged:
+			delete(runs, table)
+		default:
+			continue
+		}
+		if i > start {
+			batches = append(batches, records[start:i])
+			start = i
+		}
+	}
+	return append(batches, records[start:]), nil
+}
+
+// stageForLoad prepares the staged loads of the records. Runs that are
+// completed by a record, because it's not part of the run, are swapped into
+// their table first. The staging table of a new snapshot run is created if it
+// doesn't exist and truncated. Like truncateForLoad, it's executed before the
+// records are written, batches need to be split with splitAtSwaps first.
+func (d *Destination) stageForLoad(ctx context.Context, records []sdk.Record) error {
+	if d.config.loadMode != LoadModeStaged {
+		return nil
+	}
+	for _, r := range records {
+		table, err := d.getTableName(r.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to get table name for write: %w", err)
+		}
+		if d.isStaged(table, r) {
+			continue
+		}
+		if load, ok := d.stagedLoads[table]; ok {
+			if load.restored && d.isLoad(r) {
+				// the run staged before the restart was possibly interrupted,
+				// the new run replaces it
+				sdk.Logger(ctx).Warn().
+					Str("table", table).
+					Str("snapshotID", load.snapshotID).
+					Msg("discarding snapshot staged before the restart, a new snapshot started")
+			} else if err := d.swapStaged(ctx, table, load); err != nil {
+				return err
+			}
+			delete(d.stagedLoads, table)
+		}
+		if !d.isLoad(r) {
+			continue
+		}
+
+		stagingTable, err := d.getSuffixedTableName(r.Metadata, stagingTableSuffix)
+		if err != nil {
+			return fmt.Errorf("failed to get staging table name: %w", err)
+		}
+		// the staging table is logged, the staged run is resumed after a
+		// restart and its rows need to survive a crash of the server
+		snapshotID := r.Metadata[metadataSnapshotID]
+		query := fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s (LIKE %s INCLUDING DEFAULTS); TRUNCATE TABLE %s; ALTER TABLE %s SET LOGGED; "+
+				"INSERT INTO %s (table_name, snapshot_id, staging_table) VALUES (%s, %s, %s) "+
+				"ON CONFLICT (table_name) DO UPDATE SET snapshot_id = EXCLUDED.snapshot_id, staging_table = EXCLUDED.staging_table, columns = '{}', updated_at = now()",
+			stagingTable, table, stagingTable, stagingTable,
+			stagedLoadsTable, quoteLiteral(table), quoteLiteral(snapshotID), quoteLiteral(stagingTable),
+		)
+		if _, err := d.exec(ctx, query); err != nil {
+			return fmt.Errorf("failed to prepare staging table %s: %w", stagingTable, err)
+		}
+		sdk.Logger(ctx).Info().
+			Str("table", table).
+			Str("stagingTable", stagingTable).
+			Str("snapshotID", snapshotID).
+			Msg("staging snapshot")
+		if d.stagedLoads == nil {
+			d.stagedLoads = make(map[string]*stagedLoad)
+		}
+		d.stagedLoads[table] = &stagedLoad{
+			snapshotID:   snapshotID,
+			stagingTable: stagingTable,
+			columns:      make(map[string]bool),
+		}
+	}
+	return nil
+}
+
+// swapStaged replaces the rows of the table with the rows of the staging
+// table and removes the staged run. The statements are sent in a single query,
+// so they are executed in one transaction and readers never see a partially
+// loaded table.
+func (d *Destination) swapStaged(ctx context.Context, table string, load *stagedLoad) error {
+	names := make([]string, 0, len(load.columns))
+	for column := range load.columns {
+		names = append(names, column)
+	}
+	sort.Strings(names)
+	columns := strings.Join(names, ", ")
+	var query string
+	if columns == "" {
+		// no rows were staged, e.g. because all of them were skipped
+		query = fmt.Sprintf("TRUNCATE TABLE %s", table)
+	} else {
+		query = fmt.Sprintf(
+			"TRUNCATE TABLE %s; INSERT INTO %s (%s) OVERRIDING SYSTEM VALUE SELECT %s FROM %s; TRUNCATE TABLE %s",
+			table, table, columns, columns, load.stagingTable, load.stagingTable,
+		)
+	}
+	query += fmt.Sprintf("; DELETE FROM %s WHERE table_name = %s", stagedLoadsTable, quoteLiteral(table))
+	if _, err := d.exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to swap staging table %s into %s: %w", load.stagingTable, table, err)
+	}
+	sdk.Logger(ctx).Info().
+		Str("table", table).
+		Str("snapshotID", load.snapshotID).
+		Msg("swapped staged snapshot into table")
+	return nil
+}
+
+// quoteLiteral quotes the string as an SQL string literal.
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
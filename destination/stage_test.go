@@ -0,0 +1,148 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestDestination_StagedLoad(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "statements.jsonl")
+
+	preview, err := openStatementPreview(path)
+	is.NoErr(err)
+	d := &Destination{
+		config: config{
+			dryRun:        true,
+			tableName:     "users",
+			keyColumnName: "id",
+			loadMode:      LoadModeStaged,
+			dialect:       DialectCockroachDB, // doesn't read the catalog
+		},
+		preview: preview,
+	}
+	snapshot := func(id int, snapshotID string) sdk.Record {
+		return sdk.Record{
+			Metadata: map[string]string{"action": actionSnapshot, metadataSnapshotID: snapshotID},
+			Key:      sdk.StructuredData{"id": id},
+			Payload:  sdk.StructuredData{"name": "foo"},
+		}
+	}
+	update := sdk.Record{
+		Metadata: map[string]string{"action": actionUpdate},
+		Key:      sdk.StructuredData{"id": 1},
+		Payload:  sdk.StructuredData{"name": "bar"},
+	}
+
+	records := []sdk.Record{snapshot(1, "first"), snapshot(2, "first"), update, snapshot(1, "second")}
+	batches, err := d.splitAtSwaps(records)
+	is.NoErr(err)
+	is.Equal(batches, [][]sdk.Record{records[:2], records[2:]})
+
+	// snapshot rows are copied into the staging table
+	is.NoErr(d.stageForLoad(ctx, batches[0]))
+	var groups []*loadGroup
+	for _, r := range batches[0] {
+		row, err := d.prepareLoad(ctx, r)
+		is.NoErr(err)
+		groups = addToLoadGroup(groups, row)
+	}
+	is.Equal(len(groups), 1)
+	is.NoErr(d.execLoad(ctx, groups[0].rows))
+
+	// the first record after the snapshot swaps the staged rows into the
+	// table, the next snapshot is staged again
+	is.NoErr(d.stageForLoad(ctx, batches[1]))
+	is.Equal(d.stagedLoads[`"users"`].snapshotID, "second")
+	is.NoErr(preview.Close())
+
+	got, err := os.ReadFile(path)
+	is.NoErr(err)
+	is.Equal(string(got), `{"query":"CREATE TABLE IF NOT EXISTS \"users_staging\" (LIKE \"users\" INCLUDING DEFAULTS); TRUNCATE TABLE \"users_staging\"; ALTER TABLE \"users_staging\" SET LOGGED; INSERT INTO _conduit_staged_loads (table_name, snapshot_id, staging_table) VALUES ('\"users\"', 'first', '\"users_staging\"') ON CONFLICT (table_name) DO UPDATE SET snapshot_id = EXCLUDED.snapshot_id, staging_table = EXCLUDED.staging_table, columns = '{}', updated_at = now()","args":null}
+{"query":"COPY \"users_staging\" (id, name) FROM STDIN WITH (FORMAT csv)","args":["\"1\",\"foo\"\n\"2\",\"foo\"\n"]}
+{"query":"UPDATE _conduit_staged_loads SET columns = ARRAY(SELECT DISTINCT unnest(columns || $2::text[]) ORDER BY 1), updated_at = now() WHERE table_name = $1","args":["\"users\"",["id","name"]]}
+{"query":"TRUNCATE TABLE \"users\"; INSERT INTO \"users\" (id, name) OVERRIDING SYSTEM VALUE SELECT id, name FROM \"users_staging\"; TRUNCATE TABLE \"users_staging\"; DELETE FROM _conduit_staged_loads WHERE table_name = '\"users\"'","args":null}
+{"query":"CREATE TABLE IF NOT EXISTS \"users_staging\" (LIKE \"users\" INCLUDING DEFAULTS); TRUNCATE TABLE \"users_staging\"; ALTER TABLE \"users_staging\" SET LOGGED; INSERT INTO _conduit_staged_loads (table_name, snapshot_id, staging_table) VALUES ('\"users\"', 'second', '\"users_staging\"') ON CONFLICT (table_name) DO UPDATE SET snapshot_id = EXCLUDED.snapshot_id, staging_table = EXCLUDED.staging_table, columns = '{}', updated_at = now()","args":null}
+`)
+}
+
+func TestDestination_StagedLoadRestored(t *testing.T) {
+	ctx := context.Background()
+	restored := func() map[string]*stagedLoad {
+		return map[string]*stagedLoad{
+			`"users"`: {
+				snapshotID:   "first",
+				stagingTable: `"users_staging"`,
+				columns:      map[string]bool{"id": true, "name": true},
+				restored:     true,
+			},
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		record   sdk.Record
+		wantSwap bool
+	}{{
+		name: "change swaps restored run",
+		record: sdk.Record{
+			Metadata: map[string]string{"action": actionUpdate},
+			Key:      sdk.StructuredData{"id": 1},
+		},
+		wantSwap: true,
+	}, {
+		name: "new run discards restored run",
+		record: sdk.Record{
+			Metadata: map[string]string{"action": actionSnapshot, metadataSnapshotID: "second"},
+			Key:      sdk.StructuredData{"id": 1},
+		},
+		wantSwap: false,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			path := filepath.Join(t.TempDir(), "statements.jsonl")
+			preview, err := openStatementPreview(path)
+			is.NoErr(err)
+			d := &Destination{
+				config: config{
+					dryRun:        true,
+					tableName:     "users",
+					keyColumnName: "id",
+					loadMode:      LoadModeStaged,
+					dialect:       DialectCockroachDB,
+				},
+				preview:     preview,
+				stagedLoads: restored(),
+			}
+
+			is.NoErr(d.stageForLoad(ctx, []sdk.Record{tc.record}))
+			is.NoErr(preview.Close())
+			got, err := os.ReadFile(path)
+			is.NoErr(err)
+			is.Equal(strings.Contains(string(got), `INSERT INTO \"users\" (id, name) OVERRIDING SYSTEM VALUE SELECT id, name FROM \"users_staging\"`), tc.wantSwap)
+		})
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+const (
+	// value of pg_attribute.attidentity for GENERATED ALWAYS identity columns
+	identityAlways = "a"
+	// value of pg_attribute.attgenerated for stored generated columns
+	generatedStored = "s"
+)
+
+// tableInfo contains the column definitions of a table as stored in the
+// catalog.
+type tableInfo struct {
+	columns map[string]tableColumn
+}
+
+// column returns the definition of the column, it returns false if the column
+// doesn't exist or the table info is nil.
+func (t *tableInfo) column(name string) (tableColumn, bool) {
+	if t == nil {
+		return tableColumn{}, false
+	}
+	col, ok := t.columns[name]
+	return col, ok
+}
+
+// ColumnType returns the formatted type of the column, it implements
+// writer.ColumnTypes.
+func (t *tableInfo) ColumnType(name string) (string, bool) {
+	col, ok := t.column(name)
+	return col.dataType, ok
+}
+
+type tableColumn struct {
+	name     string
+	dataType string
+	// identity is "a" for GENERATED ALWAYS, "d" for GENERATED BY DEFAULT or
+	// empty if the column is not an identity column.
+	identity string
+	// generated is true if the column is a generated column.
+	generated bool
+}
+
+// getTableInfo returns the column definitions of the table. Results are cached
+// per table.
+func (d *Destination) getTableInfo(ctx context.Context, table string) (*tableInfo, error) {
+	if info, ok := d.tables[table]; ok {
+		return info, nil
+	}
+
+	info, err := d.loadTableInfo(ctx, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load column info for table %s: %w", table, err)
+	}
+
+	if d.tables == nil {
+		d.tables = make(map[string]*tableInfo)
+	}
+	d.tables[table] = info
+	return info, nil
+}
+
+func (d *Destination) loadTableInfo(ctx context.Context, table string) (*tableInfo, error) {
+	query := `SELECT a.attname, format_type(a.atttypid, a.atttypmod), a.attidentity::text, a.attgenerated::text
+		FROM pg_attribute a
+		WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped`
+	rows, err := d.conn.Query(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	info := &tableInfo{columns: make(map[string]tableColumn)}
+	for rows.Next() {
+		var col tableColumn
+		var generated string
+		if err := rows.Scan(&col.name, &col.dataType, &col.identity, &generated); err != nil {
+			return nil, err
+		}
+		col.generated = generated == generatedStored
+		info.columns[col.name] = col
+	}
+	return info, rows.Err()
+}
+
+// excludeSystemColumns removes fields from the key and payload that map to
+// columns which can't be written. Generated columns are always removed,
+// identity columns declared as GENERATED ALWAYS are removed from the payload
+// unless overridingSystemValue is enabled. The returned identity columns are
+// written with OVERRIDING SYSTEM VALUE and can't be updated on conflict.
+func (d *Destination) excludeSystemColumns(
+	ctx context.Context,
+	table string,
+	key sdk.StructuredData,
+	payload sdk.StructuredData,
+) ([]string, error) {
+	info, err := d.getTableInfo(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var identityColumns []string
+	for field := range key {
+		col, ok := info.columns[field]
+		switch {
+		case !ok:
+			continue
+		case col.generated:
+			delete(key, field)
+		case col.identity == identityAlways:
+			// we can't drop the key, otherwise the row couldn't be matched
+			if !d.config.overridingSystemValue {
+				return nil, fmt.Errorf(
+					"key column %q of table %s is an identity column declared as GENERATED ALWAYS, enable %q to write it",
+					field, table, ConfigKeyOverridingSystemValue,
+				)
+			}
+			identityColumns = append(identityColumns, field)
+		}
+	}
+	for field := range payload {
+		col, ok := info.columns[field]
+		switch {
+		case !ok:
+			continue
+		case col.generated:
+			delete(payload, field)
+		case col.identity == identityAlways:
+			if !d.config.overridingSystemValue {
+				delete(payload, field)
+				continue
+			}
+			if _, ok := key[field]; !ok {
+				identityColumns = append(identityColumns, field)
+			}
+		}
+	}
+	return identityColumns, nil
+}
+
+// missingColumns returns the columns of the table that are neither set by the
+// key nor the payload, sorted by name. Generated and identity columns can't
+// be set to NULL and are skipped, as are the dedup column and columns dropped
+// by includeFields and excludeFields.
+func (d *Destination) missingColumns(
+	ctx context.Context,
+	table string,
+	key sdk.StructuredData,
+	payload sdk.StructuredData,
+) ([]string, error) {
+	info, err := d.getTableInfo(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for name, col := range info.columns {
+		if _, ok := key[name]; ok {
+			continue
+		}
+		if _, ok := payload[name]; ok {
+			continue
+		}
+		if col.generated || col.identity != "" || name == d.config.dedupColumn ||
+			name == d.config.setCreatedAtColumn || name == d.config.setUpdatedAtColumn {
+			continue
+		}
+		if (len(d.config.includeFields) > 0 && !contains(d.config.includeFields, name)) ||
+			contains(d.config.excludeFields, name) {
+			continue
+		}
+		missing = append(missing, name)
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
@@ -0,0 +1,121 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timestampLayoutNames maps the names of the layouts of the time package to
+// the layouts, so layouts containing commas can be configured.
+var timestampLayoutNames = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+}
+
+// defaultTimestampLayouts are the layouts timestamps are parsed with if
+// assumeTimezone or strictTimestamps is set without timestampLayouts.
+// Fractional seconds are optional in all of them.
+var defaultTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+const (
+	// timestampFormat is the format of values written into timestamp
+	// columns, they are written in the assumed timezone.
+	timestampFormat = "2006-01-02 15:04:05.999999999"
+	// timestamptzFormat is the format of values written into timestamptz
+	// columns, they contain the offset of the parsed timestamp.
+	timestamptzFormat = time.RFC3339Nano
+)
+
+// parseTimestampLayouts returns the layouts with layout names replaced by
+// their layouts.
+func parseTimestampLayouts(layouts []string) []string {
+	for i, layout := range layouts {
+		if named, ok := timestampLayoutNames[layout]; ok {
+			layouts[i] = named
+		}
+	}
+	return layouts
+}
+
+// parsesTimestamps returns true if strings written into timestamp and
+// timestamptz columns are parsed by the destination instead of being cast by
+// Postgres.
+func (c config) parsesTimestamps() bool {
+	return len(c.timestampLayouts) > 0 || c.assumeTimezone != nil || c.strictTimestamps
+}
+
+// isTimestampType returns true if the formatted type is timestamp or
+// timestamptz, with or without precision.
+func isTimestampType(dataType string) bool {
+	return strings.HasPrefix(dataType, "timestamp")
+}
+
+// convertTimestamp parses a string written into a timestamp or timestamptz
+// column with the configured layouts and returns it in a format Postgres
+// parses the same regardless of its DateStyle and TimeZone settings.
+// Timestamps without an offset are in the assumed timezone, which defaults to
+// UTC. Values written into timestamp columns are converted into the assumed
+// timezone. Values that match no layout are returned as is, so Postgres casts
+// them, unless strictTimestamps is enabled.
+func (d *Destination) convertTimestamp(value interface{}, dataType string) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok {
+		return value, nil
+	}
+	switch s {
+	case "infinity", "-infinity":
+		// special values are understood by Postgres
+		return s, nil
+	}
+	loc := d.config.assumeTimezone
+	if loc == nil {
+		loc = time.UTC
+	}
+	layouts := d.config.timestampLayouts
+	if len(layouts) == 0 {
+		layouts = defaultTimestampLayouts
+	}
+	for _, layout := range layouts {
+		t, err := time.ParseInLocation(layout, s, loc)
+		if err != nil {
+			continue
+		}
+		if strings.HasSuffix(dataType, "with time zone") {
+			return t.Format(timestamptzFormat), nil
+		}
+		return t.In(loc).Format(timestampFormat), nil
+	}
+	if d.config.strictTimestamps {
+		return nil, fmt.Errorf("%q doesn't match any of the timestamp layouts %q", s, layouts)
+	}
+	return s, nil
+}
@@ -0,0 +1,105 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestDestination_ConvertTimestamp(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("timezone database not available: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		config   config
+		value    interface{}
+		dataType string
+		want     interface{}
+		wantErr  bool
+	}{{
+		name:     "timestamptz with offset",
+		config:   config{assumeTimezone: berlin},
+		value:    "2022-03-01T10:00:00.5+02:00",
+		dataType: "timestamp with time zone",
+		want:     "2022-03-01T10:00:00.5+02:00",
+	}, {
+		name:     "timestamptz without offset in assumed timezone",
+		config:   config{assumeTimezone: berlin},
+		value:    "2022-03-01 10:00:00",
+		dataType: "timestamp(3) with time zone",
+		want:     "2022-03-01T10:00:00+01:00",
+	}, {
+		name:     "timestamp converted into assumed timezone",
+		config:   config{assumeTimezone: berlin},
+		value:    "2022-03-01T10:00:00Z",
+		dataType: "timestamp without time zone",
+		want:     "2022-03-01 11:00:00",
+	}, {
+		name:     "timestamp defaults to UTC",
+		config:   config{strictTimestamps: true},
+		value:    "2022-03-01T10:00:00+02:00",
+		dataType: "timestamp without time zone",
+		want:     "2022-03-01 08:00:00",
+	}, {
+		name:     "configured layout",
+		config:   config{timestampLayouts: parseTimestampLayouts([]string{"02/01/2006 15:04", "RFC1123Z"})},
+		value:    "Tue, 01 Mar 2022 10:00:00 +0200",
+		dataType: "timestamp with time zone",
+		want:     "2022-03-01T10:00:00+02:00",
+	}, {
+		name:     "unmatched value is cast by Postgres",
+		config:   config{timestampLayouts: []string{"02/01/2006 15:04"}},
+		value:    "yesterday",
+		dataType: "timestamp with time zone",
+		want:     "yesterday",
+	}, {
+		name:     "unmatched value in strict mode",
+		config:   config{strictTimestamps: true},
+		value:    "01.03.2022",
+		dataType: "timestamp with time zone",
+		wantErr:  true,
+	}, {
+		name:     "special value",
+		config:   config{strictTimestamps: true},
+		value:    "infinity",
+		dataType: "timestamp with time zone",
+		want:     "infinity",
+	}, {
+		name:     "null",
+		config:   config{strictTimestamps: true},
+		value:    nil,
+		dataType: "timestamp with time zone",
+		want:     nil,
+	}}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			d := &Destination{config: tc.config}
+			got, err := d.convertTimestamp(tc.value, tc.dataType)
+			if tc.wantErr {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(got, tc.want)
+		})
+	}
+}
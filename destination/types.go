@@ -0,0 +1,159 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// prepareValues converts arrays and nested objects in the payload into values
+// that pgx can write into the target columns. Arrays written into array
+// columns are converted into native Postgres arrays, arrays and objects written
+// into json or jsonb columns are encoded as JSON, GeoJSON written into geometry
+// and geography columns is converted into EWKT, strings written into timestamp
+// columns are parsed if configured, see convertTimestamp. If flattenObjects is
+// enabled,
+// nested objects that aren't written into a json or jsonb column are flattened
+// into columns prefixed with the name of the field. Fields that are not
+// selected by includeFields and excludeFields are removed. Field names are
+// converted according to fieldNameConversion before and after flattening, so
+// flattened fields are converted as well. Values mapped to columns with
+// columnMapping are extracted before any of this and are always written, the
+// same goes for heavyFields, which are compressed or left out of the payload
+// if they're written into a side table, see heavyFieldsMode.
+func (d *Destination) prepareValues(ctx context.Context, table string, payload sdk.StructuredData) error {
+	var info *tableInfo
+	if d.config.dialect.readsCatalog() {
+		var err error
+		info, err = d.getTableInfo(ctx, table)
+		if err != nil {
+			return err
+		}
+	}
+
+	mapped := mapColumns(payload, d.config.columnMappings)
+	heavy := d.extractHeavyFields(payload)
+	if err := convertFieldNames(payload, d.config.fieldNameConversion); err != nil {
+		return fmt.Errorf("failed to convert payload field names: %w", err)
+	}
+	if d.config.flattenObjects {
+		flattenObjects(payload, info, d.config.flattenSeparator)
+		if err := convertFieldNames(payload, d.config.fieldNameConversion); err != nil {
+			return fmt.Errorf("failed to convert payload field names: %w", err)
+		}
+	}
+	filterFields(payload, d.config.includeFields, d.config.excludeFields)
+	for column, value := range mapped {
+		payload[column] = value
+	}
+	if err := d.compressHeavyFields(payload, heavy); err != nil {
+		return err
+	}
+	for field, value := range payload {
+		col, ok := info.column(field)
+		switch {
+		case ok && isJSONType(col.dataType):
+			// encoded as JSON, json.Number keeps its precision
+		case ok && isArrayType(col.dataType):
+			payload[field] = numbersToStrings(value)
+		case ok && isTimestampType(col.dataType) && d.config.parsesTimestamps():
+			v, err := d.convertTimestamp(value, col.dataType)
+			if err != nil {
+				return fmt.Errorf("failed to convert field %q into %s: %w", field, col.dataType, err)
+			}
+			payload[field] = v
+		case ok && isGeometryType(col.dataType):
+			v, err := geometryText(value, col.dataType)
+			if err != nil {
+				return fmt.Errorf("failed to convert field %q into %s: %w", field, col.dataType, err)
+			}
+			payload[field] = v
+		default:
+			// flattened objects can contain numbers
+			if n, ok := value.(json.Number); ok {
+				payload[field] = n.String()
+			}
+		}
+	}
+	return nil
+}
+
+// flattenObjects replaces nested objects in the payload with one field per
+// key of the object, named <field><separator><key>. Objects are flattened
+// recursively, objects that map to a json, jsonb, geometry or geography column
+// are kept.
+func flattenObjects(payload sdk.StructuredData, info *tableInfo, separator string) {
+	for {
+		fields := objectFields(payload, info)
+		if len(fields) == 0 {
+			return
+		}
+		for _, field := range fields {
+			obj := payload[field].(map[string]interface{})
+			delete(payload, field)
+			for k, v := range obj {
+				payload[field+separator+k] = v
+			}
+		}
+	}
+}
+
+// objectFields returns the fields in the payload that contain an object and
+// don't map to a json, jsonb, geometry or geography column.
+func objectFields(payload sdk.StructuredData, info *tableInfo) []string {
+	var fields []string
+	for field, value := range payload {
+		if _, ok := value.(map[string]interface{}); !ok {
+			continue
+		}
+		if col, ok := info.column(field); ok && (isJSONType(col.dataType) || isGeometryType(col.dataType)) {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// numbersToStrings replaces json.Number values in arrays with strings, so
+// pgx can convert them into the element type of the array column.
+func numbersToStrings(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		return v.String()
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, elem := range v {
+			out[i] = numbersToStrings(elem)
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+// isArrayType returns true if the formatted type is an array type.
+func isArrayType(dataType string) bool {
+	return strings.HasSuffix(dataType, "]")
+}
+
+// isJSONType returns true if the formatted type is json or jsonb.
+func isJSONType(dataType string) bool {
+	return dataType == "json" || dataType == "jsonb"
+}
@@ -0,0 +1,62 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"encoding/json"
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestFlattenObjects(t *testing.T) {
+	is := is.New(t)
+
+	info := &tableInfo{columns: map[string]tableColumn{
+		"attributes": {name: "attributes", dataType: "jsonb"},
+	}}
+	payload := sdk.StructuredData{
+		"id": "1",
+		"address": map[string]interface{}{
+			"city": "Berlin",
+			"geo": map[string]interface{}{
+				"lat": json.Number("52.52"),
+			},
+		},
+		"attributes": map[string]interface{}{"color": "red"},
+	}
+
+	flattenObjects(payload, info, "_")
+	is.Equal(payload, sdk.StructuredData{
+		"id":              "1",
+		"address_city":    "Berlin",
+		"address_geo_lat": json.Number("52.52"),
+		"attributes":      map[string]interface{}{"color": "red"},
+	})
+}
+
+func TestNumbersToStrings(t *testing.T) {
+	is := is.New(t)
+
+	got := numbersToStrings([]interface{}{
+		json.Number("9007199254740993"),
+		[]interface{}{json.Number("1.5"), "a"},
+	})
+	is.Equal(got, []interface{}{
+		"9007199254740993",
+		[]interface{}{"1.5", "a"},
+	})
+}
@@ -0,0 +1,208 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgx/v4"
+)
+
+// fieldMismatch describes a payload field whose value differs from the value
+// stored in the row.
+type fieldMismatch struct {
+	field string
+	want  string
+	got   string
+}
+
+// validateWrite reads the row with the key of the record back and logs the
+// fields whose stored value doesn't match the value in the record. Deleted
+// rows are expected to be gone. Validation problems are logged and never fail
+// the write.
+func (d *Destination) validateWrite(ctx context.Context, r sdk.Record) {
+	if !hasKey(r) {
+		// rows without a key can't be looked up
+		return
+	}
+	if d.config.loadMode == LoadModeStaged && d.isLoad(r) {
+		// staged rows are only written into the table once the snapshot is
+		// complete
+		return
+	}
+	err := d.validateRow(ctx, r)
+	if err != nil {
+		sdk.Logger(ctx).Warn().Err(err).
+			Bytes("position", r.Position).
+			Msg("failed to validate write")
+	}
+}
+
+func (d *Destination) validateRow(ctx context.Context, r sdk.Record) error {
+	key, err := d.getKey(r)
+	if err != nil {
+		return fmt.Errorf("failed to get key: %w", err)
+	}
+	keyColumnName := getKeyColumnName(key, d.config.keyColumnName)
+	tableName, err := d.getRowTableName(r)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("SELECT to_jsonb(t) FROM %s t WHERE %s = $1", tableName, keyColumnName)
+	var raw []byte
+	err = d.conn.QueryRow(ctx, query, key[keyColumnName]).Scan(&raw)
+	exists := !errors.Is(err, pgx.ErrNoRows)
+	if err != nil && exists {
+		return fmt.Errorf("failed to read row: %w", err)
+	}
+
+	logger := sdk.Logger(ctx).Warn().
+		Str("table", tableName).
+		Str("key", fmt.Sprint(key[keyColumnName])).
+		Bytes("position", r.Position)
+
+	if r.Metadata["action"] == actionDelete {
+		if exists {
+			logger.Msg("write validation failed: deleted row still exists")
+		}
+		return nil
+	}
+	if !exists {
+		logger.Msg("write validation failed: row doesn't exist")
+		return nil
+	}
+
+	payload, err := getPayload(r)
+	if err != nil {
+		return fmt.Errorf("failed to get payload: %w", err)
+	}
+	err = d.prepareValues(ctx, tableName, payload)
+	if err != nil {
+		return err
+	}
+	var row map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &row); err != nil {
+		return fmt.Errorf("failed to decode row: %w", err)
+	}
+
+	for _, m := range compareRow(payload, row) {
+		logger.
+			Str("field", m.field).
+			Str("want", m.want).
+			Str("got", m.got).
+			Msg("write validation failed: stored value doesn't match record")
+	}
+	return nil
+}
+
+// compareRow compares the payload with the row encoded as JSON and returns the
+// mismatching fields sorted by name. Values are compared loosely, strings
+// match numbers and booleans with the same text, since numbers in payloads are
+// passed to Postgres as strings.
+func compareRow(payload sdk.StructuredData, row map[string]json.RawMessage) []fieldMismatch {
+	var mismatches []fieldMismatch
+	for field, value := range payload {
+		want, err := json.Marshal(value)
+		if err != nil {
+			want = []byte(fmt.Sprint(value))
+		}
+		got, ok := row[field]
+		if !ok {
+			mismatches = append(mismatches, fieldMismatch{field: field, want: string(want), got: "<missing column>"})
+			continue
+		}
+		if !jsonEqual(want, got) {
+			mismatches = append(mismatches, fieldMismatch{field: field, want: string(want), got: string(got)})
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].field < mismatches[j].field
+	})
+	return mismatches
+}
+
+// jsonEqual returns true if both JSON documents are loosely equal, see
+// looseEqual.
+func jsonEqual(a, b []byte) bool {
+	va, err := decodeJSON(a)
+	if err != nil {
+		return false
+	}
+	vb, err := decodeJSON(b)
+	if err != nil {
+		return false
+	}
+	return looseEqual(va, vb)
+}
+
+func decodeJSON(raw []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	err := dec.Decode(&v)
+	return v, err
+}
+
+// looseEqual compares decoded JSON values. A string is equal to a number or
+// boolean with the same text representation, all other values need to be
+// equal.
+func looseEqual(a, b interface{}) bool {
+	switch va := a.(type) {
+	case map[string]interface{}:
+		vb, ok := b.(map[string]interface{})
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for k, v := range va {
+			if w, ok := vb[k]; !ok || !looseEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		vb, ok := b.([]interface{})
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for i := range va {
+			if !looseEqual(va[i], vb[i]) {
+				return false
+			}
+		}
+		return true
+	case string:
+		switch vb := b.(type) {
+		case string:
+			return va == vb
+		case json.Number, bool:
+			return va == fmt.Sprint(vb)
+		}
+		return false
+	case json.Number, bool:
+		if _, ok := b.(string); ok {
+			return looseEqual(b, a)
+		}
+		return a == b
+	default:
+		return a == b
+	}
+}
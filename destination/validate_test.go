@@ -0,0 +1,53 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"encoding/json"
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestCompareRow(t *testing.T) {
+	is := is.New(t)
+
+	payload := sdk.StructuredData{
+		"id":      "12345678901234567890",
+		"name":    "foo",
+		"active":  "true",
+		"price":   "1.50",
+		"tags":    []interface{}{"1", "2"},
+		"attrs":   map[string]interface{}{"color": "red", "size": json.Number("3")},
+		"created": "2022-04-01T10:30:00Z",
+		"extra":   "bar",
+	}
+	row := map[string]json.RawMessage{
+		"id":      json.RawMessage(`12345678901234567890`),
+		"name":    json.RawMessage(`"foo"`),
+		"active":  json.RawMessage(`true`),
+		"price":   json.RawMessage(`1.5`),
+		"tags":    json.RawMessage(`[1, 2]`),
+		"attrs":   json.RawMessage(`{"size": 3, "color": "red"}`),
+		"created": json.RawMessage(`"2022-04-01T10:30:00+00:00"`),
+	}
+
+	is.Equal(compareRow(payload, row), []fieldMismatch{
+		{field: "created", want: `"2022-04-01T10:30:00Z"`, got: `"2022-04-01T10:30:00+00:00"`},
+		{field: "extra", want: `"bar"`, got: "<missing column>"},
+		{field: "price", want: `"1.50"`, got: `1.5`},
+	})
+}
@@ -0,0 +1,134 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"fmt"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgx/v4"
+)
+
+// windowTable is the table that stores the positions of the records recently
+// written by each destination with dedupWindow enabled.
+const windowTable = "_conduit_written_positions"
+
+// positionWindow contains the positions of the last written records, the
+// oldest position is dropped when a new one is added to a full window.
+type positionWindow struct {
+	size int
+	// seq is the sequence number of the last added position, it keeps
+	// increasing across restarts.
+	seq       int64
+	positions map[string]int
+	// order contains the positions from oldest to newest.
+	order []string
+}
+
+func newPositionWindow(size int) *positionWindow {
+	return &positionWindow{
+		size:      size,
+		positions: make(map[string]int),
+	}
+}
+
+// contains returns true if the position is in the window.
+func (w *positionWindow) contains(pos sdk.Position) bool {
+	return w.positions[string(pos)] > 0
+}
+
+// add adds the position as the newest position of the window.
+func (w *positionWindow) add(pos sdk.Position) {
+	w.seq++
+	w.positions[string(pos)]++
+	w.order = append(w.order, string(pos))
+	for len(w.order) > w.size {
+		oldest := w.order[0]
+		w.order = w.order[1:]
+		if w.positions[oldest]--; w.positions[oldest] == 0 {
+			delete(w.positions, oldest)
+		}
+	}
+}
+
+// createWindowTable creates the window table if it doesn't exist.
+func (d *Destination) createWindowTable(ctx context.Context) error {
+	query := `CREATE TABLE IF NOT EXISTS ` + windowTable + ` (
+		id text NOT NULL,
+		seq bigint NOT NULL,
+		position bytea NOT NULL,
+		written_at timestamptz NOT NULL DEFAULT now(),
+		PRIMARY KEY (id, seq)
+	)`
+	if _, err := d.conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to create window table %s: %w", windowTable, err)
+	}
+	return nil
+}
+
+// loadWindow returns a window with the positions of the records last written
+// by this destination.
+func (d *Destination) loadWindow(ctx context.Context) (*positionWindow, error) {
+	query := `SELECT seq, position FROM ` + windowTable + ` WHERE id = $1 ORDER BY seq DESC LIMIT $2`
+	rows, err := d.conn.Query(ctx, query, d.config.positionID, d.config.dedupWindow)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load positions from %s: %w", windowTable, err)
+	}
+	defer rows.Close()
+
+	var seqs []int64
+	var positions []sdk.Position
+	for rows.Next() {
+		var seq int64
+		var pos []byte
+		if err := rows.Scan(&seq, &pos); err != nil {
+			return nil, fmt.Errorf("failed to load positions from %s: %w", windowTable, err)
+		}
+		seqs = append(seqs, seq)
+		positions = append(positions, pos)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load positions from %s: %w", windowTable, err)
+	}
+
+	w := newPositionWindow(d.config.dedupWindow)
+	// positions are added from oldest to newest
+	for i := len(positions) - 1; i >= 0; i-- {
+		w.seq = seqs[i] - 1
+		w.add(positions[i])
+	}
+	return w, nil
+}
+
+// storeWindow stores the positions of the written records and removes the
+// positions that dropped out of the window. It needs to be executed in the
+// same transaction as the writes of the records, the positions are added to
+// the window once the transaction is committed.
+func storeWindow(ctx context.Context, tx pgx.Tx, id string, w *positionWindow, positions []sdk.Position) error {
+	seq := w.seq
+	for _, pos := range positions {
+		seq++
+		query := `INSERT INTO ` + windowTable + ` (id, seq, position) VALUES ($1, $2, $3)`
+		if _, err := tx.Exec(ctx, query, id, seq, []byte(pos)); err != nil {
+			return fmt.Errorf("failed to store position in %s: %w", windowTable, err)
+		}
+	}
+	query := `DELETE FROM ` + windowTable + ` WHERE id = $1 AND seq <= $2`
+	if _, err := tx.Exec(ctx, query, id, seq-int64(w.size)); err != nil {
+		return fmt.Errorf("failed to remove old positions from %s: %w", windowTable, err)
+	}
+	return nil
+}
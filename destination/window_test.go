@@ -0,0 +1,59 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestPositionWindow(t *testing.T) {
+	is := is.New(t)
+
+	w := newPositionWindow(2)
+	w.add(sdk.Position("a"))
+	w.add(sdk.Position("b"))
+	is.True(w.contains(sdk.Position("a")))
+	is.True(w.contains(sdk.Position("b")))
+
+	// a drops out of the window
+	w.add(sdk.Position("c"))
+	is.True(!w.contains(sdk.Position("a")))
+	is.True(w.contains(sdk.Position("b")))
+	is.True(w.contains(sdk.Position("c")))
+	is.Equal(w.seq, int64(3))
+
+	// a position added twice stays until both entries dropped out
+	w.add(sdk.Position("c"))
+	w.add(sdk.Position("d"))
+	is.True(!w.contains(sdk.Position("b")))
+	is.True(w.contains(sdk.Position("c")))
+	w.add(sdk.Position("e"))
+	is.True(!w.contains(sdk.Position("c")))
+	is.Equal(len(w.positions), 2)
+}
+
+func TestSkipWritten_Window(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	d := &Destination{window: newPositionWindow(10)}
+	d.window.add(sdk.Position("kafka-3-17"))
+	is.True(d.skipWritten(ctx, sdk.Position("kafka-3-17")))
+	is.True(!d.skipWritten(ctx, sdk.Position("kafka-3-18")))
+}
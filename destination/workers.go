@@ -0,0 +1,171 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// openWorkers opens the destinations used to write buffered records
+// concurrently, see newWorker.
+func (d *Destination) openWorkers(ctx context.Context) error {
+	d.workers = make([]*Destination, d.config.writeConcurrency)
+	for i := range d.workers {
+		w := d.newWorker()
+		err := d.retry.Do(ctx, "connect", func(ctx context.Context) error {
+			return w.connect(ctx, d.config.url)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to open connection of writer %d: %w", i, err)
+		}
+		d.workers[i] = w
+	}
+	return nil
+}
+
+// newWorker returns a destination writing a share of the buffered records.
+// Each worker has its own connection and table caches, limits, retries, the
+// order of the keys and the dry run preview are shared with d. The records of
+// a key are always written by the same worker, see workerIndex, so out of
+// order records are detected as if they were written by d.
+func (d *Destination) newWorker() *Destination {
+	return &Destination{
+		config:          d.config,
+		rateLimiter:     d.rateLimiter,
+		writeSem:        d.writeSem,
+		retry:           d.retry,
+		keyOrders:       d.keyOrders,
+		deadLetterTable: d.deadLetterTable,
+		preview:         d.preview,
+		useMerge:        d.useMerge,
+		rowCounters:     d.rowCounters,
+	}
+}
+
+// closeWorkers closes the connections of the workers.
+func (d *Destination) closeWorkers(ctx context.Context) error {
+	var firstErr error
+	for _, w := range d.workers {
+		if w == nil || w.conn == nil {
+			continue
+		}
+		if err := w.conn.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// writeConcurrently distributes the records onto the workers and waits until
+// all workers are done. Records with a key are assigned to a worker by the
+// hash of their table and key, other records by the hash of their table, so
+// operations on the same row are written in the order they were received.
+//
+// written marks the records that were already written by a previous call with
+// the same records, they are skipped, so a retry doesn't write records of
+// workers that succeeded again. Records are marked as they are written. If a
+// worker fails, it stops writing its remaining records and the first error is
+// returned once all workers are done.
+func (d *Destination) writeConcurrently(ctx context.Context, records []sdk.Record, written []bool) error {
+	assigned := make([][]int, len(d.workers))
+	for i, r := range records {
+		if written[i] {
+			continue
+		}
+		w, err := d.workerIndex(r)
+		if err != nil {
+			return err
+		}
+		assigned[w] = append(assigned[w], i)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(d.workers))
+	for w, indexes := range assigned {
+		if len(indexes) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(w int, indexes []int) {
+			defer wg.Done()
+			errs[w] = d.workers[w].writeAssigned(ctx, records, indexes, written)
+		}(w, indexes)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAssigned writes the records at the indexes in order and marks them as
+// written. If batchSize is greater than 1, up to batchSize records are written
+// together with writeBatch. Each write blocks while maxConcurrentWrites other
+// workers are writing.
+func (d *Destination) writeAssigned(ctx context.Context, records []sdk.Record, indexes []int, written []bool) error {
+	for len(indexes) > 0 {
+		n := d.config.batchSize
+		if n > len(indexes) {
+			n = len(indexes)
+		}
+		if err := d.writeSem.Acquire(ctx); err != nil {
+			return err
+		}
+		var err error
+		if n == 1 {
+			err = d.Write(ctx, records[indexes[0]])
+		} else {
+			batch := make([]sdk.Record, n)
+			for i, index := range indexes[:n] {
+				batch[i] = records[index]
+			}
+			err = d.writeBatch(ctx, batch)
+		}
+		d.writeSem.Release()
+		if err != nil {
+			return err
+		}
+		for _, index := range indexes[:n] {
+			written[index] = true
+		}
+		indexes = indexes[n:]
+	}
+	return nil
+}
+
+// workerIndex returns the index of the worker writing the record.
+func (d *Destination) workerIndex(r sdk.Record) (int, error) {
+	var id string
+	var err error
+	if hasKey(r) {
+		id, err = d.batchKey(r)
+	} else {
+		id, err = d.getTableName(r.Metadata)
+	}
+	if err != nil {
+		return 0, err
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return int(h.Sum32() % uint32(len(d.workers))), nil
+}
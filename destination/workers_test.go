@@ -0,0 +1,90 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package destination
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestDestination_WorkerIndex(t *testing.T) {
+	is := is.New(t)
+
+	d := &Destination{
+		config:  config{tableName: "users", keyColumnName: "id"},
+		workers: make([]*Destination, 8),
+	}
+	index := func(r sdk.Record) int {
+		w, err := d.workerIndex(r)
+		is.NoErr(err)
+		is.True(w >= 0 && w < len(d.workers))
+		return w
+	}
+
+	// all operations on a key are written by the same worker, regardless of
+	// the action and the formatting of the key
+	insert := index(sdk.Record{
+		Metadata: map[string]string{"action": actionInsert},
+		Key:      sdk.RawData(`{"id":1}`),
+		Payload:  sdk.StructuredData{"id": 1, "name": "foo"},
+	})
+	is.Equal(index(sdk.Record{
+		Metadata: map[string]string{"action": actionDelete},
+		Key:      sdk.RawData(`{ "id": 1 }`),
+	}), insert)
+
+	// keyless records of a table are written by the same worker
+	keyless := sdk.Record{Payload: sdk.StructuredData{"name": "foo"}}
+	is.Equal(index(keyless), index(sdk.Record{Metadata: map[string]string{"table": "users"}}))
+
+	// keys are spread over the workers
+	seen := make(map[int]bool)
+	for i := 0; i < 100; i++ {
+		seen[index(sdk.Record{Key: sdk.StructuredData{"id": i}})] = true
+	}
+	is.True(len(seen) > 1)
+}
+
+func TestDestination_NewWorker_OutOfOrder(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	d := &Destination{
+		config:    config{tableName: "users", keyColumnName: "id", outOfOrderRecords: OutOfOrderRecordsReject},
+		keyOrders: newKeyOrders(maxOrderedKeys),
+	}
+	record := func(pos string) sdk.Record {
+		return sdk.Record{
+			Position: sdk.Position(pos),
+			Metadata: map[string]string{"action": actionUpdate},
+			Key:      sdk.StructuredData{"id": 1},
+			Payload:  sdk.StructuredData{"id": 1, "name": "foo"},
+		}
+	}
+
+	// the order of keys written by d is known to the workers
+	ok, err := d.checkOrder(ctx, record("0/20"))
+	is.NoErr(err)
+	is.True(ok)
+
+	w := d.newWorker()
+	ok, err = w.checkOrder(ctx, record("0/10"))
+	is.Equal(err, errors.New(`record at position "0/10" arrived after the newer record at position "0/20" of the same key`))
+	is.True(!ok)
+}
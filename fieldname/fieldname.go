@@ -0,0 +1,93 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fieldname turns column names into the field names of record keys
+// and payloads. It is shared by the source and destination, so field names
+// converted by the destination match the names produced by the source.
+package fieldname
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Mode determines how column names are turned into field names.
+type Mode string
+
+const (
+	// ModePreserve uses the column names as they are.
+	ModePreserve Mode = "preserve"
+	// ModeLowercase converts column names to lowercase, e.g. UserID becomes
+	// userid.
+	ModeLowercase Mode = "lowercase"
+	// ModeSnakeCase converts column names to lowercase snake case, e.g.
+	// UserID and "User Id" become user_id.
+	ModeSnakeCase Mode = "snake_case"
+)
+
+// All contains all supported modes.
+var All = []Mode{ModePreserve, ModeLowercase, ModeSnakeCase}
+
+// Parse returns the mode with the name, or an error if it's not supported.
+func Parse(raw string) (Mode, error) {
+	for _, m := range All {
+		if string(m) == raw {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("expected one of %v", All)
+}
+
+// Name returns the field name of the column. The column name is used as is if
+// the mode is empty.
+func Name(mode Mode, column string) string {
+	switch mode {
+	case ModeLowercase:
+		return strings.ToLower(column)
+	case ModeSnakeCase:
+		return SnakeCase(column)
+	default:
+		return column
+	}
+}
+
+// SnakeCase converts the name to lowercase and separates words with
+// underscores. A new word starts at an uppercase letter following a lowercase
+// letter or digit, and at the last uppercase letter of an acronym followed by
+// a lowercase letter (HTTPStatus becomes http_status). Spaces, hyphens and
+// dots are replaced with underscores, repeated and trailing underscores are
+// removed.
+func SnakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		switch {
+		case r == ' ' || r == '-' || r == '.' || r == '_':
+			if !strings.HasSuffix(b.String(), "_") {
+				b.WriteRune('_')
+			}
+			continue
+		case unicode.IsUpper(r) && i > 0:
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if (unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower)) &&
+				!strings.HasSuffix(b.String(), "_") {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
@@ -0,0 +1,64 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fieldname
+
+import (
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestName(t *testing.T) {
+	testCases := []struct {
+		column    string
+		lowercase string
+		snakeCase string
+	}{
+		{column: "id", lowercase: "id", snakeCase: "id"},
+		{column: "user_id", lowercase: "user_id", snakeCase: "user_id"},
+		{column: "UserID", lowercase: "userid", snakeCase: "user_id"},
+		{column: "userId", lowercase: "userid", snakeCase: "user_id"},
+		{column: "HTTPStatus", lowercase: "httpstatus", snakeCase: "http_status"},
+		{column: "Address2Line", lowercase: "address2line", snakeCase: "address2_line"},
+		{column: "Order Date", lowercase: "order date", snakeCase: "order_date"},
+		{column: "first-name", lowercase: "first-name", snakeCase: "first_name"},
+		{column: "_id", lowercase: "_id", snakeCase: "_id"},
+		{column: "Last__Name", lowercase: "last__name", snakeCase: "last_name"},
+		{column: "User Id", lowercase: "user id", snakeCase: "user_id"},
+		{column: "HTTPServer", lowercase: "httpserver", snakeCase: "http_server"},
+		{column: "createdAt2", lowercase: "createdat2", snakeCase: "created_at2"},
+		{column: "APIKey", lowercase: "apikey", snakeCase: "api_key"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.column, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(Name(ModePreserve, tc.column), tc.column)
+			is.Equal(Name("", tc.column), tc.column)
+			is.Equal(Name(ModeLowercase, tc.column), tc.lowercase)
+			is.Equal(Name(ModeSnakeCase, tc.column), tc.snakeCase)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	is := is.New(t)
+
+	m, err := Parse("snake_case")
+	is.NoErr(err)
+	is.Equal(m, ModeSnakeCase)
+
+	_, err = Parse("camelCase")
+	is.Equal(err.Error(), "expected one of [preserve lowercase snake_case]")
+}
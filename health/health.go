@@ -0,0 +1,111 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package health checks that the database is set up for the connector before
+// the pipeline starts moving data. It is shared by the source and destination,
+// all problems found are reported at once.
+package health
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Check runs checks on a connection and collects the problems found. Queries
+// that fail are reported as problems as well, so a check never stops early.
+type Check struct {
+	conn     *pgx.Conn
+	problems []string
+}
+
+// New returns a check running its queries on the connection.
+func New(conn *pgx.Conn) *Check {
+	return &Check{conn: conn}
+}
+
+// Problems returns the problems found so far.
+func (c *Check) Problems() []string {
+	return c.problems
+}
+
+// Err returns an error listing all problems found, or nil if there are none.
+func (c *Check) Err() error {
+	if len(c.problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("health check found %d problem(s): %s", len(c.problems), strings.Join(c.problems, "; "))
+}
+
+func (c *Check) addf(format string, args ...interface{}) {
+	c.problems = append(c.problems, fmt.Sprintf(format, args...))
+}
+
+// Table checks that the table exists and the current user has the privileges
+// on it, e.g. INSERT or SELECT. The name is parsed like in SQL, so it can be
+// qualified with a schema and quoted.
+func (c *Check) Table(ctx context.Context, table string, privileges ...string) {
+	var exists bool
+	err := c.conn.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", table).Scan(&exists)
+	if err != nil {
+		c.addf("failed to check table %s: %v", table, err)
+		return
+	}
+	if !exists {
+		c.addf("table %s doesn't exist", table)
+		return
+	}
+	var missing []string
+	for _, p := range privileges {
+		var ok bool
+		err := c.conn.QueryRow(ctx, "SELECT has_table_privilege($1, $2)", table, p).Scan(&ok)
+		if err != nil {
+			c.addf("failed to check %s privilege on table %s: %v", p, table, err)
+			continue
+		}
+		if !ok {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		c.addf("current user lacks the %s privilege(s) on table %s", strings.Join(missing, ", "), table)
+	}
+}
+
+// LogicalReplication checks that wal_level is logical and the current user can
+// use replication connections, i.e. is a superuser, has the REPLICATION
+// attribute or is a member of rds_replication on Amazon RDS.
+func (c *Check) LogicalReplication(ctx context.Context) {
+	var walLevel string
+	if err := c.conn.QueryRow(ctx, "SELECT current_setting('wal_level')").Scan(&walLevel); err != nil {
+		c.addf("failed to check wal_level: %v", err)
+	} else if walLevel != "logical" {
+		c.addf("wal_level is %q, logical replication requires \"logical\"", walLevel)
+	}
+
+	query := `SELECT r.rolsuper OR r.rolreplication OR EXISTS (
+			SELECT 1 FROM pg_roles g
+			WHERE g.rolname = 'rds_replication' AND pg_has_role(r.oid, g.oid, 'member')
+		)
+		FROM pg_roles r
+		WHERE r.rolname = current_user`
+	var canReplicate bool
+	if err := c.conn.QueryRow(ctx, query).Scan(&canReplicate); err != nil {
+		c.addf("failed to check replication privilege: %v", err)
+	} else if !canReplicate {
+		c.addf("current user lacks the REPLICATION attribute required by logical replication")
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestCheck_Err(t *testing.T) {
+	is := is.New(t)
+	c := New(nil)
+	is.NoErr(c.Err())
+
+	c.addf("table %s doesn't exist", "users")
+	c.addf("wal_level is %q, logical replication requires \"logical\"", "replica")
+	is.Equal(len(c.Problems()), 2)
+	is.Equal(c.Err(), errors.New(`health check found 2 problem(s): table users doesn't exist; wal_level is "replica", logical replication requires "logical"`))
+}
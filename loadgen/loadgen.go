@@ -0,0 +1,253 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package loadgen measures the write throughput of the destination by writing
+// generated records into a table of a Postgres database.
+package loadgen
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/conduitio/conduit-connector-postgres/destination"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgx/v4"
+)
+
+// Mode determines how the generated records are written.
+type Mode string
+
+const (
+	// ModeInsert writes each record with a plain INSERT.
+	ModeInsert Mode = "insert"
+	// ModeUpsert writes each record with an upsert, keys repeat after
+	// Config.Keys records, so rows are inserted and updated.
+	ModeUpsert Mode = "upsert"
+	// ModeBatch writes upserts in batches of Config.BatchSize records.
+	ModeBatch Mode = "batch"
+	// ModeCopy writes snapshot records with COPY in truncate-and-load mode,
+	// in batches of Config.BatchSize records.
+	ModeCopy Mode = "copy"
+)
+
+// ModeAll contains all supported modes.
+var ModeAll = []Mode{ModeInsert, ModeUpsert, ModeBatch, ModeCopy}
+
+// IsModeSupported returns true if raw is a supported mode.
+func IsModeSupported(raw string) bool {
+	for _, m := range ModeAll {
+		if string(m) == raw {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultBatchSize is the batch size used if Config.BatchSize is 0.
+const DefaultBatchSize = 1000
+
+// Config configures a load run.
+type Config struct {
+	// URL is the connection string of the database.
+	URL string
+	// Table is the table the records are written into, it's dropped and
+	// created before and dropped after the run.
+	Table string
+	// Mode determines how the records are written.
+	Mode Mode
+	// Records is the number of records written.
+	Records int
+	// BatchSize is the number of records written in a single transaction in
+	// the batch and copy modes, DefaultBatchSize is used if 0.
+	BatchSize int
+	// Keys is the number of distinct keys in the upsert and batch modes,
+	// every key is only written once if 0.
+	Keys int
+}
+
+// Result contains the measurements of a load run.
+type Result struct {
+	Records  int
+	Duration time.Duration
+}
+
+// RecordsPerSecond returns the write throughput of the run.
+func (r Result) RecordsPerSecond() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Records) / r.Duration.Seconds()
+}
+
+// Run creates the table, writes the records with the destination and
+// returns the time it took to write them, excluding the setup and teardown of
+// the destination.
+func Run(ctx context.Context, cfg Config) (Result, error) {
+	if !IsModeSupported(string(cfg.Mode)) {
+		return Result{}, fmt.Errorf("unsupported mode %q, expected one of %v", cfg.Mode, ModeAll)
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+
+	conn, err := pgx.Connect(ctx, cfg.URL)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close(ctx)
+	table := pgx.Identifier{cfg.Table}.Sanitize()
+	if err := createTable(ctx, conn, table); err != nil {
+		return Result{}, err
+	}
+	defer func() {
+		_, _ = conn.Exec(context.Background(), "DROP TABLE IF EXISTS "+table)
+	}()
+
+	dir, err := os.MkdirTemp("", "loadgen")
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create buffer directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := destination.NewDestination()
+	if err := d.Configure(ctx, destinationConfig(cfg, filepath.Join(dir, "buffer"))); err != nil {
+		return Result{}, fmt.Errorf("failed to configure destination: %w", err)
+	}
+	if err := d.Open(ctx); err != nil {
+		return Result{}, fmt.Errorf("failed to open destination: %w", err)
+	}
+	defer func() {
+		_ = d.Teardown(context.Background())
+	}()
+
+	start := time.Now()
+	if cfg.Mode == ModeBatch || cfg.Mode == ModeCopy {
+		err = writeAsync(ctx, d, cfg)
+	} else {
+		err = write(ctx, d, cfg)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Records: cfg.Records, Duration: time.Since(start)}, nil
+}
+
+func createTable(ctx context.Context, conn *pgx.Conn, table string) error {
+	query := `DROP TABLE IF EXISTS ` + table + `;
+		CREATE TABLE ` + table + ` (
+			id bigint PRIMARY KEY,
+			name text,
+			amount integer,
+			active boolean,
+			updated_at timestamptz
+		)`
+	if _, err := conn.Exec(ctx, query); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", table, err)
+	}
+	return nil
+}
+
+// destinationConfig returns the destination config of the mode, records
+// written asynchronously are buffered in the file at bufferPath.
+func destinationConfig(cfg Config, bufferPath string) map[string]string {
+	raw := map[string]string{
+		destination.ConfigKeyURL:   cfg.URL,
+		destination.ConfigKeyTable: cfg.Table,
+	}
+	if cfg.Mode != ModeInsert {
+		raw[destination.ConfigKeyKeyColumnName] = "id"
+	}
+	if cfg.Mode == ModeBatch || cfg.Mode == ModeCopy {
+		raw[destination.ConfigKeyBufferPath] = bufferPath
+		raw[destination.ConfigKeyBufferMaxRecords] = strconv.Itoa(2 * cfg.BatchSize)
+		raw[destination.ConfigKeyBatchSize] = strconv.Itoa(cfg.BatchSize)
+	}
+	if cfg.Mode == ModeCopy {
+		raw[destination.ConfigKeyLoadMode] = string(destination.LoadModeTruncateAndLoad)
+	}
+	return raw
+}
+
+// record returns the i-th generated record.
+func record(cfg Config, i int) sdk.Record {
+	id := i
+	if cfg.Keys > 0 && cfg.Mode != ModeCopy {
+		id = i % cfg.Keys
+	}
+	r := sdk.Record{
+		Position: sdk.Position(strconv.Itoa(i + 1)),
+		Metadata: map[string]string{"action": "insert"},
+		Payload: sdk.StructuredData{
+			"id":         id,
+			"name":       "record " + strconv.Itoa(i),
+			"amount":     i,
+			"active":     i%2 == 0,
+			"updated_at": time.Now().UTC().Format(time.RFC3339Nano),
+		},
+	}
+	switch cfg.Mode {
+	case ModeUpsert, ModeBatch:
+		r.Metadata["action"] = "update"
+		r.Key = sdk.StructuredData{"id": id}
+	case ModeCopy:
+		r.Metadata["action"] = "snapshot"
+		r.Metadata["snapshot.id"] = "loadgen"
+		r.Key = sdk.StructuredData{"id": id}
+	}
+	return r
+}
+
+func write(ctx context.Context, d sdk.Destination, cfg Config) error {
+	for i := 0; i < cfg.Records; i++ {
+		if err := d.Write(ctx, record(cfg, i)); err != nil {
+			return fmt.Errorf("failed to write record %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// writeAsync appends the records to the buffer of the destination and waits
+// until all of them are written.
+func writeAsync(ctx context.Context, d sdk.Destination, cfg Config) error {
+	var m sync.Mutex
+	var ackErr error
+	ack := func(err error) error {
+		m.Lock()
+		defer m.Unlock()
+		if err != nil && ackErr == nil {
+			ackErr = err
+		}
+		return nil
+	}
+	for i := 0; i < cfg.Records; i++ {
+		if err := d.WriteAsync(ctx, record(cfg, i), ack); err != nil {
+			return fmt.Errorf("failed to write record %d: %w", i, err)
+		}
+	}
+	if err := d.Flush(ctx); err != nil {
+		return fmt.Errorf("failed to flush records: %w", err)
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	if ackErr != nil {
+		return fmt.Errorf("failed to write records: %w", ackErr)
+	}
+	return nil
+}
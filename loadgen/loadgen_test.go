@@ -0,0 +1,74 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loadgen
+
+import (
+	"context"
+	"testing"
+
+	"github.com/conduitio/conduit-connector-postgres/destination"
+	"github.com/conduitio/conduit-connector-postgres/test"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func BenchmarkRun(b *testing.B) {
+	for _, mode := range ModeAll {
+		mode := mode
+		b.Run(string(mode), func(b *testing.B) {
+			result, err := Run(context.Background(), Config{
+				URL:     test.RegularConnString,
+				Table:   "conduit_loadgen_bench",
+				Mode:    mode,
+				Records: b.N,
+				Keys:    b.N / 2,
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportMetric(result.RecordsPerSecond(), "records/s")
+		})
+	}
+}
+
+func TestDestinationConfig(t *testing.T) {
+	for _, mode := range ModeAll {
+		mode := mode
+		t.Run(string(mode), func(t *testing.T) {
+			is := is.New(t)
+			cfg := Config{
+				URL:       test.RegularConnString,
+				Table:     "conduit_loadgen",
+				Mode:      mode,
+				BatchSize: DefaultBatchSize,
+			}
+			d := destination.NewDestination()
+			err := d.Configure(context.Background(), destinationConfig(cfg, t.TempDir()+"/buffer"))
+			is.NoErr(err)
+		})
+	}
+}
+
+func TestRecord_Keys(t *testing.T) {
+	is := is.New(t)
+	cfg := Config{Mode: ModeUpsert, Keys: 3}
+	is.Equal(record(cfg, 4).Key, record(cfg, 1).Key)
+	is.Equal(record(cfg, 4).Metadata["action"], "update")
+
+	// snapshot records are loaded into an empty table, keys never repeat
+	cfg.Mode = ModeCopy
+	is.Equal(record(cfg, 4).Key, sdk.StructuredData{"id": 4})
+	is.Equal(record(cfg, 4).Metadata["action"], "snapshot")
+}
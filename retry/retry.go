@@ -0,0 +1,234 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package retry retries operations that failed with a transient Postgres
+// error. It is shared by the source and destination, so both connectors are
+// configured the same way.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgconn"
+)
+
+const (
+	ConfigKeyMaxAttempts    = "retry.maxAttempts"
+	ConfigKeyMaxElapsedTime = "retry.maxElapsedTime"
+	ConfigKeyCodes          = "retry.codes"
+
+	// DefaultCodes matches SQLSTATE codes of errors that are safe to retry:
+	// connection exceptions (class 08), writes to a read-only server (after a
+	// failover), serialization failures, deadlocks, too many connections and
+	// server shutdowns.
+	DefaultCodes = "^08,^25006$,^40001$,^40P01$,^53300$,^57P0[123]$"
+)
+
+const (
+	initialBackoff = 100 * time.Millisecond
+	maxBackoff     = 10 * time.Second
+
+	// codeConnectionFailure is the SQLSTATE code of connection failures.
+	codeConnectionFailure = "08006"
+)
+
+// Config controls how often and for how long an operation is retried.
+type Config struct {
+	// MaxAttempts is the maximum number of times an operation is executed,
+	// 1 disables retries.
+	MaxAttempts int
+	// MaxElapsedTime is the maximum time spent retrying an operation, 0 means
+	// no limit.
+	MaxElapsedTime time.Duration
+	// Codes are matched against the SQLSTATE code of an error, errors with a
+	// matching code are retried.
+	Codes []*regexp.Regexp
+}
+
+// ParseConfig parses the retry config, it is disabled by default.
+func ParseConfig(cfgRaw map[string]string) (Config, error) {
+	cfg := Config{MaxAttempts: 1}
+
+	if raw := cfgRaw[ConfigKeyMaxAttempts]; raw != "" {
+		attempts, err := strconv.Atoi(raw)
+		if err != nil || attempts < 1 {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected a positive integer", ConfigKeyMaxAttempts, raw)
+		}
+		cfg.MaxAttempts = attempts
+	}
+	if raw := cfgRaw[ConfigKeyMaxElapsedTime]; raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected a duration", ConfigKeyMaxElapsedTime, raw)
+		}
+		cfg.MaxElapsedTime = d
+	}
+
+	codes := cfgRaw[ConfigKeyCodes]
+	if codes == "" {
+		codes = DefaultCodes
+	}
+	for _, raw := range strings.Split(codes, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		re, err := regexp.Compile(raw)
+		if err != nil {
+			return Config{}, fmt.Errorf("%q contains invalid regular expression %q: %w", ConfigKeyCodes, raw, err)
+		}
+		cfg.Codes = append(cfg.Codes, re)
+	}
+
+	return cfg, nil
+}
+
+// Budget retries operations according to the config and counts the attempts.
+// It is safe for concurrent use.
+type Budget struct {
+	config Config
+	stats  Stats
+
+	// sleep is replaced in tests
+	sleep func(context.Context, time.Duration) error
+}
+
+// Stats contains the counters of a Budget.
+type Stats struct {
+	// Retries is the number of times an operation was retried.
+	Retries uint64
+	// Exhausted is the number of operations that failed with a retryable
+	// error after the budget was used up.
+	Exhausted uint64
+}
+
+// Fields returns the counters as fields of the stats log line, see
+// stats.Logger.
+func (s Stats) Fields() map[string]interface{} {
+	return map[string]interface{}{
+		"retries":          s.Retries,
+		"retriesExhausted": s.Exhausted,
+	}
+}
+
+// New creates a Budget with the config.
+func New(config Config) *Budget {
+	return &Budget{
+		config: config,
+		sleep:  sleep,
+	}
+}
+
+// Stats returns a snapshot of the counters.
+func (b *Budget) Stats() Stats {
+	return Stats{
+		Retries:   atomic.LoadUint64(&b.stats.Retries),
+		Exhausted: atomic.LoadUint64(&b.stats.Exhausted),
+	}
+}
+
+// Do executes the operation and retries it with an exponential backoff while
+// it returns a retryable error and the budget is not used up. The last error
+// is returned.
+func (b *Budget) Do(ctx context.Context, name string, op func(context.Context) error) error {
+	if b == nil {
+		return op(ctx)
+	}
+	start := time.Now()
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := op(ctx)
+		if err == nil || !b.Retryable(err) {
+			return err
+		}
+
+		elapsed := time.Since(start)
+		if attempt >= b.config.MaxAttempts ||
+			(b.config.MaxElapsedTime > 0 && elapsed+backoff > b.config.MaxElapsedTime) {
+			if b.config.MaxAttempts > 1 {
+				exhausted := atomic.AddUint64(&b.stats.Exhausted, 1)
+				sdk.Logger(ctx).Warn().Err(err).
+					Str("operation", name).
+					Int("attempts", attempt).
+					Dur("elapsed", elapsed).
+					Uint64("exhaustedTotal", exhausted).
+					Msg("retry budget exhausted")
+			}
+			return err
+		}
+
+		retries := atomic.AddUint64(&b.stats.Retries, 1)
+		sdk.Logger(ctx).Warn().Err(err).
+			Str("operation", name).
+			Int("attempt", attempt).
+			Dur("backoff", backoff).
+			Uint64("retriesTotal", retries).
+			Msg("operation failed with retryable error, retrying")
+
+		if err := b.sleep(ctx, backoff); err != nil {
+			return err
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// Retryable returns true if the error is a Postgres error with a SQLSTATE code
+// matching one of the configured codes, or if the error happened before
+// anything was sent to the server. Network errors are treated as errors with
+// the code 08006 (connection_failure).
+func (b *Budget) Retryable(err error) bool {
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+	var code string
+	var pgErr *pgconn.PgError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &pgErr):
+		code = pgErr.Code
+	case errors.As(err, &netErr):
+		code = codeConnectionFailure
+	default:
+		return false
+	}
+	for _, re := range b.config.Codes {
+		if re.MatchString(code) {
+			return true
+		}
+	}
+	return false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
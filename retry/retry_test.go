@@ -0,0 +1,122 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/matryer/is"
+)
+
+func TestParseConfig(t *testing.T) {
+	is := is.New(t)
+
+	cfg, err := ParseConfig(map[string]string{})
+	is.NoErr(err)
+	is.Equal(cfg.MaxAttempts, 1)
+	is.Equal(cfg.MaxElapsedTime, time.Duration(0))
+	is.Equal(len(cfg.Codes), 6)
+
+	cfg, err = ParseConfig(map[string]string{
+		ConfigKeyMaxAttempts:    "5",
+		ConfigKeyMaxElapsedTime: "1m",
+		ConfigKeyCodes:          "^40001$, ^23",
+	})
+	is.NoErr(err)
+	is.Equal(cfg.MaxAttempts, 5)
+	is.Equal(cfg.MaxElapsedTime, time.Minute)
+	is.Equal(len(cfg.Codes), 2)
+	is.Equal(cfg.Codes[1].String(), "^23")
+
+	_, err = ParseConfig(map[string]string{ConfigKeyMaxAttempts: "0"})
+	is.Equal(err, errors.New(`"retry.maxAttempts" contains unsupported value "0", expected a positive integer`))
+
+	_, err = ParseConfig(map[string]string{ConfigKeyCodes: "("})
+	is.True(err != nil)
+}
+
+func TestBudget_Do(t *testing.T) {
+	retryable := &pgconn.PgError{Code: "40001"}
+	permanent := &pgconn.PgError{Code: "23505"}
+
+	testCases := []struct {
+		name         string
+		maxAttempts  int
+		errs         []error
+		wantErr      error
+		wantAttempts int
+		wantStats    Stats
+	}{{
+		name:         "success",
+		maxAttempts:  3,
+		errs:         []error{nil},
+		wantAttempts: 1,
+	}, {
+		name:         "retry until success",
+		maxAttempts:  3,
+		errs:         []error{retryable, retryable, nil},
+		wantAttempts: 3,
+		wantStats:    Stats{Retries: 2},
+	}, {
+		name:         "permanent error",
+		maxAttempts:  3,
+		errs:         []error{permanent},
+		wantErr:      permanent,
+		wantAttempts: 1,
+	}, {
+		name:         "budget exhausted",
+		maxAttempts:  2,
+		errs:         []error{retryable, retryable},
+		wantErr:      retryable,
+		wantAttempts: 2,
+		wantStats:    Stats{Retries: 1, Exhausted: 1},
+	}, {
+		name:         "retries disabled",
+		maxAttempts:  1,
+		errs:         []error{retryable},
+		wantErr:      retryable,
+		wantAttempts: 1,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			cfg, err := ParseConfig(map[string]string{})
+			is.NoErr(err)
+			cfg.MaxAttempts = tc.maxAttempts
+			b := New(cfg)
+			b.sleep = func(context.Context, time.Duration) error { return nil }
+
+			attempts := 0
+			err = b.Do(context.Background(), "test", func(context.Context) error {
+				err := tc.errs[attempts]
+				attempts++
+				return err
+			})
+			is.Equal(err, tc.wantErr)
+			is.Equal(attempts, tc.wantAttempts)
+			is.Equal(b.Stats(), tc.wantStats)
+			is.Equal(b.Stats().Fields(), map[string]interface{}{
+				"retries":          tc.wantStats.Retries,
+				"retriesExhausted": tc.wantStats.Exhausted,
+			})
+		})
+	}
+}
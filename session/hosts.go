@@ -0,0 +1,84 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// defaultPort is used for hosts without a port.
+const defaultPort = "5432"
+
+// withHosts replaces the hosts in the connection string. Connection URLs get
+// the hosts as a comma separated list in the authority, keyword/value
+// connection strings get host and port keywords appended, which take
+// precedence over earlier ones.
+func withHosts(connString string, hosts []string) string {
+	hostList := make([]string, len(hosts))
+	portList := make([]string, len(hosts))
+	for i, h := range hosts {
+		host, port, err := net.SplitHostPort(h)
+		if err != nil {
+			// no port
+			host, port = h, defaultPort
+		}
+		hostList[i], portList[i] = host, port
+	}
+
+	if i := strings.Index(connString, "://"); i != -1 {
+		scheme, rest := connString[:i+3], connString[i+3:]
+		end := strings.IndexAny(rest, "/?")
+		if end == -1 {
+			end = len(rest)
+		}
+		var userinfo string
+		if at := strings.LastIndex(rest[:end], "@"); at != -1 {
+			userinfo = rest[:at+1]
+		}
+		// every host needs a port, otherwise the URL can't be parsed
+		authority := make([]string, len(hosts))
+		for i := range hosts {
+			authority[i] = net.JoinHostPort(hostList[i], portList[i])
+		}
+		return scheme + userinfo + strings.Join(authority, ",") + rest[end:]
+	}
+	return connString + " host=" + strings.Join(hostList, ",") + " port=" + strings.Join(portList, ",")
+}
+
+// hasMultipleHosts returns true if the config contains fallbacks to other
+// hosts. Fallbacks to the same host only differ in their TLS config.
+func hasMultipleHosts(connConfig *pgx.ConnConfig) bool {
+	for _, fb := range connConfig.Fallbacks {
+		if fb.Host != connConfig.Host || fb.Port != connConfig.Port {
+			return true
+		}
+	}
+	return false
+}
+
+// withFailover makes connections to multiple hosts only succeed on a server
+// that accepts writes, so the connector connects to the new primary after a
+// switchover. It is not applied if target_session_attrs is set in the
+// connection string.
+func withFailover(connConfig *pgx.ConnConfig, connString string) {
+	if !hasMultipleHosts(connConfig) || strings.Contains(connString, "target_session_attrs") {
+		return
+	}
+	connConfig.ValidateConnect = pgconn.ValidateConnectTargetSessionAttrsReadWrite
+}
@@ -0,0 +1,148 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// iamTokenExpiry is how long an IAM auth token can be used to connect,
+	// RDS rejects tokens valid for more than 15 minutes.
+	iamTokenExpiry = 15 * time.Minute
+	// emptyPayloadHash is the hex encoded SHA-256 hash of an empty payload.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// awsCredentials are the AWS credentials IAM auth tokens are signed with.
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// awsCredentialsFromEnv returns the credentials from the standard AWS
+// environment variables. The session token is only set for temporary
+// credentials, e.g. of an assumed role.
+func awsCredentialsFromEnv() (awsCredentials, error) {
+	creds := awsCredentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.accessKeyID == "" || creds.secretAccessKey == "" {
+		return awsCredentials{}, errors.New("AWS credentials not found, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return creds, nil
+}
+
+// awsRegionFromEnv returns the region from the standard AWS environment
+// variables.
+func awsRegionFromEnv() string {
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	return os.Getenv("AWS_DEFAULT_REGION")
+}
+
+// withIAMAuth replaces the password of the connection with an IAM auth token
+// for Amazon RDS. The token is generated when the config is created and is
+// valid for 15 minutes, it's only checked when connecting, so open
+// connections stay open after it expired. Connections opened later need a
+// new config, see ConnConfig.
+func (c Config) withIAMAuth(connConfig *pgx.ConnConfig) error {
+	if hasMultipleHosts(connConfig) {
+		return fmt.Errorf("%q doesn't support multiple hosts", ConfigKeyAWSIAMAuth)
+	}
+	if connConfig.TLSConfig == nil {
+		return fmt.Errorf("%q requires TLS, set sslmode in the URL to require, verify-ca or verify-full", ConfigKeyAWSIAMAuth)
+	}
+	creds, err := awsCredentialsFromEnv()
+	if err != nil {
+		return err
+	}
+	endpoint := net.JoinHostPort(connConfig.Host, strconv.Itoa(int(connConfig.Port)))
+	connConfig.Password = iamAuthToken(endpoint, c.AWSRegion, connConfig.User, creds, time.Now())
+	return nil
+}
+
+// iamAuthToken returns an IAM auth token for the database user at the
+// endpoint, which is host:port. The token is a URL presigned with AWS
+// Signature Version 4 for the rds-db service, without the scheme. It's the
+// same token aws rds generate-db-auth-token returns.
+func iamAuthToken(endpoint, region, user string, creds awsCredentials, now time.Time) string {
+	now = now.UTC()
+	date := now.Format("20060102")
+	amzDate := now.Format("20060102T150405Z")
+	scope := strings.Join([]string{date, region, "rds-db", "aws4_request"}, "/")
+
+	query := url.Values{
+		"Action":              {"connect"},
+		"DBUser":              {user},
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {creds.accessKeyID + "/" + scope},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {strconv.Itoa(int(iamTokenExpiry.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if creds.sessionToken != "" {
+		query.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+	// Encode sorts by key, AWS expects spaces to be encoded as %20
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		"/",
+		canonicalQuery,
+		"host:" + endpoint,
+		"",
+		"host",
+		emptyPayloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "rds-db")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	return endpoint + "/?" + canonicalQuery + "&X-Amz-Signature=" + signature
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,258 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package session configures the Postgres session of connections opened by the
+// connectors. It is shared by the source and destination, so both connectors
+// are configured the same way.
+package session
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	ConfigKeySearchPath          = "session.searchPath"
+	ConfigKeyStatementTimeout    = "session.statementTimeout"
+	ConfigKeyLockTimeout         = "session.lockTimeout"
+	ConfigKeyApplicationName     = "session.applicationName"
+	ConfigKeyHosts               = "session.hosts"
+	ConfigKeyPoolerCompatibility = "session.poolerCompatibility"
+	ConfigKeyKeepalive           = "session.keepalive"
+	ConfigKeyTLSServerName       = "session.tlsServerName"
+	ConfigKeyAWSIAMAuth          = "session.awsIAMAuth"
+	ConfigKeyAWSRegion           = "session.awsRegion"
+
+	// DefaultApplicationName is used as the application name of the session if
+	// neither the config nor the URL contain one.
+	DefaultApplicationName = "conduit-connector-postgres"
+)
+
+// Config contains settings applied to the session when connecting. Settings
+// that are not set keep the value from the connection URL or the server
+// default.
+type Config struct {
+	// SearchPath is the schema search path used to resolve unqualified table
+	// names.
+	SearchPath string
+	// StatementTimeout aborts statements running longer than the timeout.
+	StatementTimeout time.Duration
+	// LockTimeout aborts statements waiting longer than the timeout for a
+	// lock.
+	LockTimeout time.Duration
+	// ApplicationName is shown in pg_stat_activity, so the sessions of the
+	// connector can be identified.
+	ApplicationName string
+	// Hosts replaces the hosts in the connection URL. If more than one host
+	// is configured, connections are only opened to a server that accepts
+	// writes.
+	Hosts []string
+	// PoolerCompatibility makes connections work through a connection pooler
+	// in transaction pooling mode (e.g. pgbouncer). Statements are executed
+	// with the simple protocol, so no prepared statements are kept in the
+	// session, and no session settings are sent when connecting.
+	PoolerCompatibility bool
+	// Keepalive is the interval of TCP keepalive probes, so connections that
+	// were dropped by a firewall or the server are detected while they are
+	// idle. 0 keeps the default of 5 minutes.
+	Keepalive time.Duration
+	// TLSServerName overrides the host name the server certificate is
+	// verified against and sent with SNI, so connections through a tunnel or
+	// proxy can use sslmode=verify-full.
+	TLSServerName string
+	// AWSIAMAuth authenticates with an IAM auth token for Amazon RDS instead
+	// of a password. The token is signed with the AWS credentials from the
+	// environment.
+	AWSIAMAuth bool
+	// AWSRegion is the region of the RDS instance, it defaults to the region
+	// from the environment.
+	AWSRegion string
+	// ReplicationRole is sent as session_replication_role, it's not parsed
+	// by ParseConfig but set by the destination, since only writes are
+	// affected by it.
+	ReplicationRole string
+}
+
+// ParseConfig parses the session config.
+func ParseConfig(cfgRaw map[string]string) (Config, error) {
+	cfg := Config{
+		SearchPath:      cfgRaw[ConfigKeySearchPath],
+		ApplicationName: cfgRaw[ConfigKeyApplicationName],
+		TLSServerName:   cfgRaw[ConfigKeyTLSServerName],
+	}
+
+	if raw := cfgRaw[ConfigKeyHosts]; raw != "" {
+		for _, host := range strings.Split(raw, ",") {
+			host = strings.TrimSpace(host)
+			if host == "" {
+				return Config{}, fmt.Errorf("%q contains unsupported value %q, expected a comma separated list of hosts", ConfigKeyHosts, raw)
+			}
+			cfg.Hosts = append(cfg.Hosts, host)
+		}
+	}
+
+	var err error
+	if cfg.StatementTimeout, err = parseTimeout(cfgRaw, ConfigKeyStatementTimeout); err != nil {
+		return Config{}, err
+	}
+	if cfg.LockTimeout, err = parseTimeout(cfgRaw, ConfigKeyLockTimeout); err != nil {
+		return Config{}, err
+	}
+	if cfg.Keepalive, err = parseTimeout(cfgRaw, ConfigKeyKeepalive); err != nil {
+		return Config{}, err
+	}
+	if raw := cfgRaw[ConfigKeyPoolerCompatibility]; raw != "" {
+		if cfg.PoolerCompatibility, err = strconv.ParseBool(raw); err != nil {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected a boolean", ConfigKeyPoolerCompatibility, raw)
+		}
+	}
+	if cfg.PoolerCompatibility {
+		// a pooler hands out server connections to other clients between
+		// transactions, so settings of the session would leak or get lost
+		for _, key := range []string{ConfigKeySearchPath, ConfigKeyStatementTimeout, ConfigKeyLockTimeout} {
+			if cfgRaw[key] != "" {
+				return Config{}, fmt.Errorf("%q can't be combined with %q, set it for the database role instead", key, ConfigKeyPoolerCompatibility)
+			}
+		}
+	}
+
+	if raw := cfgRaw[ConfigKeyAWSIAMAuth]; raw != "" {
+		if cfg.AWSIAMAuth, err = strconv.ParseBool(raw); err != nil {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected a boolean", ConfigKeyAWSIAMAuth, raw)
+		}
+	}
+	if cfg.AWSIAMAuth {
+		if cfgRaw[ConfigKeyPassword] != "" {
+			return Config{}, fmt.Errorf("%q can't be combined with %q", ConfigKeyPassword, ConfigKeyAWSIAMAuth)
+		}
+		cfg.AWSRegion = cfgRaw[ConfigKeyAWSRegion]
+		if cfg.AWSRegion == "" {
+			cfg.AWSRegion = awsRegionFromEnv()
+		}
+		if cfg.AWSRegion == "" {
+			return Config{}, fmt.Errorf("%q requires %q or the AWS_REGION environment variable to be set", ConfigKeyAWSIAMAuth, ConfigKeyAWSRegion)
+		}
+	} else if cfgRaw[ConfigKeyAWSRegion] != "" {
+		return Config{}, fmt.Errorf("%q requires %q to be enabled", ConfigKeyAWSRegion, ConfigKeyAWSIAMAuth)
+	}
+
+	return cfg, nil
+}
+
+func parseTimeout(cfgRaw map[string]string, key string) (time.Duration, error) {
+	raw := cfgRaw[key]
+	if raw == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%q contains unsupported value %q, expected a duration", key, raw)
+	}
+	if d > 0 && d < time.Millisecond {
+		return 0, fmt.Errorf("%q contains unsupported value %q, expected at least 1ms", key, raw)
+	}
+	return d, nil
+}
+
+// ConnConfig parses the connection URL and applies the session settings to
+// the runtime parameters sent to the server on connect. If the URL or Hosts
+// contain multiple hosts, the connection fails over to the next host and only
+// succeeds on a server that accepts writes, unless target_session_attrs is
+// set in the URL.
+func (c Config) ConnConfig(url string) (*pgx.ConnConfig, error) {
+	if len(c.Hosts) > 0 {
+		url = withHosts(url, c.Hosts)
+	}
+	connConfig, err := pgx.ParseConfig(url)
+	if err != nil {
+		return nil, err
+	}
+	withFailover(connConfig, url)
+	if connConfig.RuntimeParams == nil {
+		connConfig.RuntimeParams = make(map[string]string)
+	}
+	params := connConfig.RuntimeParams
+
+	if c.SearchPath != "" {
+		params["search_path"] = c.SearchPath
+	}
+	if c.StatementTimeout > 0 {
+		params["statement_timeout"] = strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10)
+	}
+	if c.LockTimeout > 0 {
+		params["lock_timeout"] = strconv.FormatInt(c.LockTimeout.Milliseconds(), 10)
+	}
+	if c.ReplicationRole != "" {
+		params["session_replication_role"] = c.ReplicationRole
+	}
+	if c.Keepalive > 0 {
+		dialer := &net.Dialer{KeepAlive: c.Keepalive, Timeout: connConfig.ConnectTimeout}
+		connConfig.DialFunc = dialer.DialContext
+	}
+	if c.PoolerCompatibility {
+		// prepared statements are bound to the server connection, which
+		// changes between transactions
+		connConfig.PreferSimpleProtocol = true
+		connConfig.BuildStatementCache = nil
+	}
+	if c.TLSServerName != "" {
+		if err := c.withTLSServerName(connConfig); err != nil {
+			return nil, err
+		}
+	}
+	if c.AWSIAMAuth {
+		if err := c.withIAMAuth(connConfig); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case c.ApplicationName != "":
+		params["application_name"] = c.ApplicationName
+	case params["application_name"] == "":
+		params["application_name"] = DefaultApplicationName
+	}
+
+	return connConfig, nil
+}
+
+// withTLSServerName sets the server name of all TLS configs of the
+// connection, fallbacks without TLS (e.g. with sslmode=prefer) are kept.
+func (c Config) withTLSServerName(connConfig *pgx.ConnConfig) error {
+	if connConfig.TLSConfig == nil {
+		return fmt.Errorf("%q requires TLS, set sslmode in the URL to require, verify-ca or verify-full", ConfigKeyTLSServerName)
+	}
+	connConfig.TLSConfig.ServerName = c.TLSServerName
+	for _, fb := range connConfig.Fallbacks {
+		if fb.TLSConfig != nil {
+			fb.TLSConfig.ServerName = c.TLSServerName
+		}
+	}
+	return nil
+}
+
+// Connect opens a connection to the database at the URL with the session
+// settings applied.
+func (c Config) Connect(ctx context.Context, url string) (*pgx.Conn, error) {
+	connConfig, err := c.ConnConfig(url)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.ConnectConfig(ctx, connConfig)
+}
@@ -0,0 +1,121 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	ConfigKeyURL      = "url"
+	ConfigKeyHost     = "host"
+	ConfigKeyPort     = "port"
+	ConfigKeyUser     = "user"
+	ConfigKeyPassword = "password"
+	ConfigKeyDBName   = "dbname"
+)
+
+// urlFieldKeys are the config keys of the connection parameters that can be
+// set separately from the URL, in the order they are appended.
+var urlFieldKeys = []string{ConfigKeyHost, ConfigKeyPort, ConfigKeyUser, ConfigKeyPassword, ConfigKeyDBName}
+
+// envReference matches references to environment variables like ${PG_URL}.
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ResolveURL returns the connection string built from the url config value
+// and the separate connection parameters host, port, user, password and
+// dbname. References to environment variables like ${PG_PASSWORD} are
+// replaced with their value in all of them. Parameters that are set take
+// precedence over the corresponding part of the URL, they are passed without
+// escaping issues as query parameters of a URL or as quoted values of a
+// keyword/value connection string. An empty string is returned if neither
+// the URL nor any parameter is set.
+func ResolveURL(cfgRaw map[string]string) (string, error) {
+	connString, err := expandEnv(ConfigKeyURL, cfgRaw[ConfigKeyURL])
+	if err != nil {
+		return "", err
+	}
+
+	var keys []string
+	params := make(map[string]string)
+	for _, key := range urlFieldKeys {
+		raw, ok := cfgRaw[key]
+		if !ok || raw == "" {
+			continue
+		}
+		if params[key], err = expandEnv(key, raw); err != nil {
+			return "", err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return connString, nil
+	}
+	if params[ConfigKeyHost] != "" && cfgRaw[ConfigKeyHosts] != "" {
+		return "", fmt.Errorf("%q can't be combined with %q", ConfigKeyHost, ConfigKeyHosts)
+	}
+
+	if connString == "" || isURL(connString) {
+		if connString == "" {
+			connString = "postgres://"
+		}
+		query := make(url.Values)
+		for _, key := range keys {
+			query.Set(key, params[key])
+		}
+		sep := "?"
+		if strings.Contains(connString, "?") {
+			sep = "&"
+		}
+		return connString + sep + query.Encode(), nil
+	}
+
+	// keywords appended to a keyword/value connection string take precedence
+	// over earlier ones
+	var sb strings.Builder
+	sb.WriteString(connString)
+	for _, key := range keys {
+		fmt.Fprintf(&sb, " %s='%s'", key, strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(params[key]))
+	}
+	return sb.String(), nil
+}
+
+// isURL returns true if the connection string is a URL, otherwise it's a
+// keyword/value connection string.
+func isURL(connString string) bool {
+	return strings.HasPrefix(connString, "postgres://") || strings.HasPrefix(connString, "postgresql://")
+}
+
+// expandEnv replaces references to environment variables in the config value
+// with their value. It returns an error if a referenced variable is not set.
+func expandEnv(key, raw string) (string, error) {
+	var err error
+	expanded := envReference.ReplaceAllStringFunc(raw, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("%q references environment variable %q, which is not set", key, name)
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
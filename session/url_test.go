@@ -0,0 +1,116 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/matryer/is"
+)
+
+func TestResolveURL(t *testing.T) {
+	t.Setenv("TEST_PG_URL", "postgres://app@db:5432/orders")
+	t.Setenv("TEST_PG_PASSWORD", `p@ss:w/rd?'\`)
+
+	testCases := []struct {
+		name    string
+		cfgRaw  map[string]string
+		want    string
+		wantErr error
+	}{{
+		name:   "url",
+		cfgRaw: map[string]string{ConfigKeyURL: "postgres://app:secret@db:5432/orders"},
+		want:   "postgres://app:secret@db:5432/orders",
+	}, {
+		name:   "nothing set",
+		cfgRaw: map[string]string{},
+		want:   "",
+	}, {
+		name:   "url from environment",
+		cfgRaw: map[string]string{ConfigKeyURL: "${TEST_PG_URL}?sslmode=disable"},
+		want:   "postgres://app@db:5432/orders?sslmode=disable",
+	}, {
+		name: "fields only",
+		cfgRaw: map[string]string{
+			ConfigKeyHost:     "db",
+			ConfigKeyPort:     "5433",
+			ConfigKeyUser:     "app",
+			ConfigKeyPassword: "${TEST_PG_PASSWORD}",
+			ConfigKeyDBName:   "orders",
+		},
+		want: "postgres://?dbname=orders&host=db&password=p%40ss%3Aw%2Frd%3F%27%5C&port=5433&user=app",
+	}, {
+		name: "fields override url",
+		cfgRaw: map[string]string{
+			ConfigKeyURL:      "postgres://app@db:5432/orders?sslmode=disable",
+			ConfigKeyPassword: "${TEST_PG_PASSWORD}",
+		},
+		want: "postgres://app@db:5432/orders?sslmode=disable&password=p%40ss%3Aw%2Frd%3F%27%5C",
+	}, {
+		name: "fields with keyword/value connection string",
+		cfgRaw: map[string]string{
+			ConfigKeyURL:      "host=db dbname=orders",
+			ConfigKeyPassword: "${TEST_PG_PASSWORD}",
+		},
+		want: `host=db dbname=orders password='p@ss:w/rd?\'\\'`,
+	}, {
+		name:    "missing environment variable",
+		cfgRaw:  map[string]string{ConfigKeyPassword: "${TEST_PG_MISSING}"},
+		wantErr: errors.New(`"password" references environment variable "TEST_PG_MISSING", which is not set`),
+	}, {
+		name:    "host with hosts",
+		cfgRaw:  map[string]string{ConfigKeyHost: "db", ConfigKeyHosts: "pg1,pg2"},
+		wantErr: errors.New(`"host" can't be combined with "session.hosts"`),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			got, err := ResolveURL(tc.cfgRaw)
+			if tc.wantErr != nil {
+				is.Equal(err, tc.wantErr)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestResolveURL_Parse(t *testing.T) {
+	t.Setenv("TEST_PG_PASSWORD", `p@ss:w/rd?'\`)
+
+	for _, url := range []string{"", "postgres://other@localhost/postgres", "host=localhost user=other"} {
+		t.Run(url, func(t *testing.T) {
+			is := is.New(t)
+			connString, err := ResolveURL(map[string]string{
+				ConfigKeyURL:      url,
+				ConfigKeyHost:     "db",
+				ConfigKeyUser:     "app",
+				ConfigKeyPassword: "${TEST_PG_PASSWORD}",
+				ConfigKeyDBName:   "orders",
+			})
+			is.NoErr(err)
+			connConfig, err := pgx.ParseConfig(connString)
+			is.NoErr(err)
+			is.Equal(connConfig.Host, "db")
+			is.Equal(connConfig.User, "app")
+			is.Equal(connConfig.Password, `p@ss:w/rd?'\`)
+			is.Equal(connConfig.Database, "orders")
+		})
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package collection names the collection of records, the name is stored in
+// the "table" metadata field, which the destination uses to route records.
+package collection
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// PlaceholderSchema is replaced with the schema of the table.
+	PlaceholderSchema = "{schema}"
+	// PlaceholderTable is replaced with the name of the table.
+	PlaceholderTable = "{table}"
+
+	// DefaultTemplate names collections after the table.
+	DefaultTemplate = PlaceholderTable
+)
+
+var placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// Validate returns an error if the template contains placeholders other than
+// {schema} and {table}.
+func Validate(template string) error {
+	for _, p := range placeholderPattern.FindAllString(template, -1) {
+		if p != PlaceholderSchema && p != PlaceholderTable {
+			return fmt.Errorf("unknown placeholder %s, expected %s or %s", p, PlaceholderSchema, PlaceholderTable)
+		}
+	}
+	return nil
+}
+
+// Name returns the collection name of the table in the schema, the
+// placeholders in the template are replaced with the schema and table name.
+// DefaultTemplate is used if the template is empty.
+func Name(template, schema, table string) string {
+	if template == "" {
+		template = DefaultTemplate
+	}
+	return strings.NewReplacer(PlaceholderSchema, schema, PlaceholderTable, table).Replace(template)
+}
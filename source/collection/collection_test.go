@@ -0,0 +1,64 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collection
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestName(t *testing.T) {
+	testCases := []struct {
+		template string
+		want     string
+	}{
+		{template: "", want: "users"},
+		{template: "{table}", want: "users"},
+		{template: "{schema}.{table}", want: "app.users"},
+		{template: "pg_{schema}_{table}_v1", want: "pg_app_users_v1"},
+		{template: "users_archive", want: "users_archive"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.template, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(Name(tc.template, "app", "users"), tc.want)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		template string
+		wantErr  error
+	}{
+		{template: "{schema}.{table}"},
+		{template: "archive"},
+		{template: "{db}.{table}", wantErr: errors.New("unknown placeholder {db}, expected {schema} or {table}")},
+		{template: "{Table}", wantErr: errors.New("unknown placeholder {Table}, expected {schema} or {table}")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.template, func(t *testing.T) {
+			is := is.New(t)
+			err := Validate(tc.template)
+			if tc.wantErr != nil {
+				is.Equal(err.Error(), tc.wantErr.Error())
+			} else {
+				is.NoErr(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package columnfilter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/conduitio/conduit-connector-postgres/fieldname"
+)
+
+// Config determines which columns end up in a record payload and which
+// columns are masked before the record leaves the connector.
+type Config struct {
+	// Include is the list of columns that should be included in the payload,
+	// all columns are included if empty.
+	Include []string
+	// Exclude is the list of columns that are removed from the payload.
+	Exclude []string
+	// Hash is the list of columns whose values are replaced with the hex
+	// encoded SHA-256 hash of the value.
+	Hash []string
+	// Redact is the list of columns whose values are replaced with nil.
+	Redact []string
+	// FieldNames determines how column names are turned into the field names
+	// of keys and payloads, column names are used as is if empty.
+	FieldNames fieldname.Mode
+}
+
+// Filter filters and masks column values based on a Config. A nil filter is
+// valid and lets all columns pass unchanged.
+type Filter struct {
+	include map[string]bool
+	exclude map[string]bool
+	hash    map[string]bool
+	redact  map[string]bool
+
+	fieldNames fieldname.Mode
+}
+
+// New creates a new filter.
+func New(config Config) *Filter {
+	return &Filter{
+		include: toSet(config.Include),
+		exclude: toSet(config.Exclude),
+		hash:    toSet(config.Hash),
+		redact:  toSet(config.Redact),
+
+		fieldNames: config.FieldNames,
+	}
+}
+
+// Field returns the name of the key or payload field of the column.
+func (f *Filter) Field(column string) string {
+	if f == nil {
+		return column
+	}
+	return fieldname.Name(f.fieldNames, column)
+}
+
+// Include returns true if the column should be part of the payload.
+func (f *Filter) Include(column string) bool {
+	if f == nil {
+		return true
+	}
+	if f.include != nil && !f.include[column] {
+		return false
+	}
+	return !f.exclude[column]
+}
+
+// Excludes returns true if the column is explicitly excluded. The key column
+// must not be excluded, its value would leave the connector in the key.
+func (f *Filter) Excludes(column string) bool {
+	return f != nil && f.exclude[column]
+}
+
+// Mask returns the value that should be emitted for the column. Values of
+// columns that are not masked are returned unchanged.
+func (f *Filter) Mask(column string, value interface{}) (interface{}, error) {
+	if f == nil || value == nil {
+		return value, nil
+	}
+	switch {
+	case f.redact[column]:
+		return nil, nil
+	case f.hash[column]:
+		return hash(value)
+	default:
+		return value, nil
+	}
+}
+
+// Apply returns the value of the column after filtering and masking. The
+// returned bool is false if the column should be dropped.
+func (f *Filter) Apply(column string, value interface{}) (interface{}, bool, error) {
+	if !f.Include(column) {
+		return nil, false, nil
+	}
+	v, err := f.Mask(column, value)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to mask column %q: %w", column, err)
+	}
+	return v, true, nil
+}
+
+func hash(value interface{}) (string, error) {
+	var b []byte
+	switch v := value.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		var err error
+		b, err = json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func toSet(list []string) map[string]bool {
+	if len(list) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(list))
+	for _, v := range list {
+		set[v] = true
+	}
+	return set
+}
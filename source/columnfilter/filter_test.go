@@ -0,0 +1,81 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package columnfilter
+
+import (
+	"testing"
+
+	"github.com/conduitio/conduit-connector-postgres/fieldname"
+	"github.com/matryer/is"
+)
+
+func TestFilter_Apply(t *testing.T) {
+	f := New(Config{
+		Include: []string{"id", "email", "phone", "ssn"},
+		Exclude: []string{"ssn"},
+		Hash:    []string{"email"},
+		Redact:  []string{"phone"},
+	})
+
+	testCases := []struct {
+		column string
+		value  interface{}
+		want   interface{}
+		wantOk bool
+	}{
+		{column: "id", value: int64(1), want: int64(1), wantOk: true},
+		{column: "name", value: "john", want: nil, wantOk: false},       // not included
+		{column: "ssn", value: "123-45-6789", want: nil, wantOk: false}, // excluded
+		{column: "phone", value: "555-1234", want: nil, wantOk: true},   // redacted
+		{
+			column: "email",
+			value:  "john@example.com",
+			want:   "855f96e983f1f8e8be944692b6f719fd54329826cb62e98015efee8e2e071dd4",
+			wantOk: true,
+		},
+		{column: "email", value: nil, want: nil, wantOk: true}, // nil is not hashed
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.column, func(t *testing.T) {
+			is := is.New(t)
+			got, ok, err := f.Apply(tc.column, tc.value)
+			is.NoErr(err)
+			is.Equal(ok, tc.wantOk)
+			is.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestFilter_Nil(t *testing.T) {
+	is := is.New(t)
+	var f *Filter
+
+	got, ok, err := f.Apply("foo", "bar")
+	is.NoErr(err)
+	is.True(ok)
+	is.Equal(got, "bar")
+	is.Equal(f.Field("FooBar"), "FooBar")
+}
+
+func TestFilter_Field(t *testing.T) {
+	is := is.New(t)
+
+	f := New(Config{FieldNames: fieldname.ModeSnakeCase})
+	is.Equal(f.Field("UserID"), "user_id")
+
+	f = New(Config{})
+	is.Equal(f.Field("UserID"), "UserID")
+}
@@ -16,21 +16,63 @@ package source
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/conduitio/conduit-connector-postgres/fieldname"
+	"github.com/conduitio/conduit-connector-postgres/retry"
+	"github.com/conduitio/conduit-connector-postgres/session"
+	"github.com/conduitio/conduit-connector-postgres/source/collection"
+	"github.com/conduitio/conduit-connector-postgres/stats"
+	"github.com/jackc/pglogrepl"
 )
 
 const (
-	ConfigKeyURL                    = "url"
-	ConfigKeyTable                  = "table"
-	ConfigKeyColumns                = "columns"
-	ConfigKeyKey                    = "key"
-	ConfigKeySnapshotMode           = "snapshotMode"
-	ConfigKeyCDCMode                = "cdcMode"
-	ConfigKeyLogreplPublicationName = "logrepl.publicationName"
-	ConfigKeyLogreplSlotName        = "logrepl.slotName"
+	ConfigKeyURL                         = "url"
+	ConfigKeyTable                       = "table"
+	ConfigKeyColumns                     = "columns"
+	ConfigKeyKey                         = "key"
+	ConfigKeySnapshotMode                = "snapshotMode"
+	ConfigKeySnapshotFetchSize           = "snapshotFetchSize"
+	ConfigKeySnapshotColumnDefaults      = "snapshotColumnDefaults"
+	ConfigKeyCollectionName              = "collectionName"
+	ConfigKeyFieldNames                  = "fieldNames"
+	ConfigKeyHealthCheck                 = "healthCheck"
+	ConfigKeyCDCMode                     = "cdcMode"
+	ConfigKeyLogreplPublicationName      = "logrepl.publicationName"
+	ConfigKeyLogreplSlotName             = "logrepl.slotName"
+	ConfigKeyLogreplLagThreshold         = "logrepl.lagThreshold"
+	ConfigKeyLogreplLagDuration          = "logrepl.lagDuration"
+	ConfigKeyLogreplRetentionThreshold   = "logrepl.retentionThreshold"
+	ConfigKeyLogreplSchemaChanges        = "logrepl.schemaChanges"
+	ConfigKeyLogreplReplicaIdentity      = "logrepl.replicaIdentity"
+	ConfigKeyLogreplReplicaIdentityIndex = "logrepl.replicaIdentityIndex"
+	ConfigKeyLogreplGroupTransactions    = "logrepl.groupTransactions"
+	ConfigKeyLogreplStartLSN             = "logrepl.startLSN"
+	ConfigKeyLogreplStopLSN              = "logrepl.stopLSN"
+	ConfigKeyLogreplCaptureSequences     = "logrepl.captureSequences"
+	ConfigKeyLogreplSequencesInterval    = "logrepl.sequencesInterval"
+
+	ConfigKeyLongPollingInterval                = "longPolling.interval"
+	ConfigKeyLongPollingRefreshMaterializedView = "longPolling.refreshMaterializedView"
+
+	// ConfigKeyTablesPrefix is the prefix of table specific config keys, the
+	// full key has the format "tables.<table>.<option>".
+	ConfigKeyTablesPrefix = "tables."
+	// Table specific options, see TableConfig.
+	ConfigTableKeyOrderBy        = "orderBy"
+	ConfigTableKeyIncludeColumns = "includeColumns"
+	ConfigTableKeyExcludeColumns = "excludeColumns"
+	ConfigTableKeyHashColumns    = "hashColumns"
+	ConfigTableKeyRedactColumns  = "redactColumns"
+	ConfigTableKeyFilter         = "filter"
+	ConfigTableKeyCollectionName = "collectionName"
 
 	DefaultPublicationName = "conduitpub"
 	DefaultSlotName        = "conduitslot"
+	DefaultLagDuration     = 5 * time.Minute
+	DefaultPollingInterval = 10 * time.Second
 )
 
 type Config struct {
@@ -41,6 +83,23 @@ type Config struct {
 
 	// SnapshotMode determines if and when a snapshot is made.
 	SnapshotMode SnapshotMode
+	// SnapshotFetchSize is the number of rows read per query when taking a
+	// snapshot. Rows are read in pages ordered by the key, so no query stays
+	// open for the whole snapshot. All rows are read with a single query if
+	// set to 0.
+	SnapshotFetchSize int
+	// SnapshotColumnDefaults adds the default and generation expressions of
+	// the columns to the metadata of snapshot records.
+	SnapshotColumnDefaults bool
+	// CollectionName is the template of the collection name stored in the
+	// "table" metadata field of records, see collection.Name.
+	CollectionName string
+	// FieldNames determines how column names are turned into the field names
+	// of record keys and payloads.
+	FieldNames fieldname.Mode
+	// HealthCheck makes the connector check that the table exists and the
+	// database is set up for the CDC mode when it's opened.
+	HealthCheck bool
 	// CDCMode determines how the connector should listen to changes.
 	CDCMode CDCMode
 
@@ -50,6 +109,110 @@ type Config struct {
 	// LogreplSlotName determines the replication slot name in case the
 	// connector uses logical replication to listen to changes (see CDCMode).
 	LogreplSlotName string
+	// LogreplLagThreshold is the number of bytes the replication slot can lag
+	// behind the end of the WAL before the lag is reported. The lag is not
+	// monitored if set to 0.
+	LogreplLagThreshold uint64
+	// LogreplLagDuration is the time the lag needs to stay above
+	// LogreplLagThreshold before it is reported.
+	LogreplLagDuration time.Duration
+	// LogreplRetentionThreshold is the number of WAL bytes the replication
+	// slot can retain on the server before the retention is reported. The
+	// retention needs to stay above the threshold for LogreplLagDuration, it
+	// is not reported if set to 0.
+	LogreplRetentionThreshold uint64
+	// LogreplSchemaChanges determines how schema changes of the table are
+	// handled in case the connector uses logical replication.
+	LogreplSchemaChanges SchemaChangesMode
+	// LogreplReplicaIdentity determines how the replica identity of the table
+	// is handled when the connector starts in case it uses logical
+	// replication.
+	LogreplReplicaIdentity ReplicaIdentityMode
+	// LogreplReplicaIdentityIndex is the index used as the replica identity
+	// if LogreplReplicaIdentity is ReplicaIdentityModeIndex.
+	LogreplReplicaIdentityIndex string
+	// LogreplGroupTransactions holds back the changes of a transaction until
+	// it's committed and tags them with their position in the transaction.
+	LogreplGroupTransactions bool
+	// LogreplStartLSN is the LSN after which changes are read in the first
+	// run of the pipeline, it requires SnapshotModeNever.
+	LogreplStartLSN pglogrepl.LSN
+	// LogreplStopLSN stops logical replication once all transactions
+	// committed at or before it were read.
+	LogreplStopLSN pglogrepl.LSN
+	// LogreplCaptureSequences emits the current values of the sequences owned
+	// by the columns of the table after the snapshot.
+	LogreplCaptureSequences bool
+	// LogreplSequencesInterval is the interval in which the values of
+	// sequences are captured again, they are only captured once if set to 0.
+	LogreplSequencesInterval time.Duration
+
+	// LongPollingInterval is the time between two polls in case the connector
+	// uses long polling to listen to changes (see CDCMode).
+	LongPollingInterval time.Duration
+	// LongPollingRefreshMaterializedView makes the connector refresh the
+	// materialized view before each poll.
+	LongPollingRefreshMaterializedView bool
+
+	// Tables contains table specific configuration, indexed by table name.
+	Tables map[string]TableConfig
+
+	// Retry controls how operations failing with a transient error are
+	// retried.
+	Retry retry.Config
+	// Session contains settings applied to the Postgres session.
+	Session session.Config
+	// StatsInterval is the interval in which the stats of the source are
+	// logged, 0 only logs them on teardown.
+	StatsInterval time.Duration
+}
+
+// TableConfig holds configuration values that apply to a single table.
+type TableConfig struct {
+	// OrderBy is the expression used to order rows when taking a snapshot,
+	// defaults to the key column.
+	OrderBy string
+	// IncludeColumns is the list of columns included in payloads, it takes
+	// precedence over Config.Columns.
+	IncludeColumns []string
+	// ExcludeColumns is the list of columns removed from payloads.
+	ExcludeColumns []string
+	// HashColumns is the list of columns whose values are replaced with a
+	// SHA-256 hash.
+	HashColumns []string
+	// RedactColumns is the list of columns whose values are replaced with null.
+	RedactColumns []string
+	// Filter is a SQL expression used as the WHERE clause of snapshot queries
+	// and, on Postgres 15+, of the table in the publication. Rows that don't
+	// match are not read.
+	Filter string
+	// CollectionName is the template of the collection name of the table,
+	// it takes precedence over Config.CollectionName.
+	CollectionName string
+}
+
+// TableConfig returns the configuration for the table, or an empty config if
+// none is set.
+func (c Config) TableConfig(table string) TableConfig {
+	return c.Tables[table]
+}
+
+// TableCollectionName returns the template of the collection name of the
+// table.
+func (c Config) TableCollectionName(table string) string {
+	if name := c.TableConfig(table).CollectionName; name != "" {
+		return name
+	}
+	return c.CollectionName
+}
+
+// TableColumns returns the columns that should be included in payloads of
+// the table, nil means all columns.
+func (c Config) TableColumns(table string) []string {
+	if cols := c.TableConfig(table).IncludeColumns; len(cols) > 0 {
+		return cols
+	}
+	return c.Columns
 }
 
 type SnapshotMode string
@@ -73,21 +236,66 @@ const (
 	CDCModeLongPolling CDCMode = "long_polling"
 )
 
+type SchemaChangesMode string
+
+const (
+	// SchemaChangesModeLog logs schema changes, records are built using the
+	// new schema.
+	SchemaChangesModeLog SchemaChangesMode = "log"
+	// SchemaChangesModeRecord additionally emits a record with the action
+	// "schema_change" describing the change.
+	SchemaChangesModeRecord SchemaChangesMode = "record"
+)
+
+type ReplicaIdentityMode string
+
+const (
+	// ReplicaIdentityModeCheck fails if updates and deletes of the table
+	// don't contain the key column.
+	ReplicaIdentityModeCheck ReplicaIdentityMode = "check"
+	// ReplicaIdentityModeFull sets the replica identity of the table to FULL
+	// if it isn't, so updates and deletes contain the whole old row.
+	ReplicaIdentityModeFull ReplicaIdentityMode = "full"
+	// ReplicaIdentityModeIndex sets the replica identity of the table to the
+	// configured index if it isn't.
+	ReplicaIdentityModeIndex ReplicaIdentityMode = "index"
+	// ReplicaIdentityModeIgnore doesn't check the replica identity.
+	ReplicaIdentityModeIgnore ReplicaIdentityMode = "ignore"
+)
+
 var snapshotModeAll = []SnapshotMode{SnapshotModeInitial, SnapshotModeNever}
 var cdcModeAll = []CDCMode{CDCModeAuto, CDCModeLogrepl, CDCModeLongPolling}
+var schemaChangesModeAll = []SchemaChangesMode{SchemaChangesModeLog, SchemaChangesModeRecord}
+var replicaIdentityModeAll = []ReplicaIdentityMode{
+	ReplicaIdentityModeCheck,
+	ReplicaIdentityModeFull,
+	ReplicaIdentityModeIndex,
+	ReplicaIdentityModeIgnore,
+}
 
 func ParseConfig(cfgRaw map[string]string) (Config, error) {
 	cfg := Config{
-		URL:                    cfgRaw[ConfigKeyURL],
 		Table:                  cfgRaw[ConfigKeyTable],
 		Columns:                nil, // default
 		Key:                    cfgRaw[ConfigKeyKey],
 		SnapshotMode:           SnapshotModeInitial,
+		CollectionName:         collection.DefaultTemplate,
+		FieldNames:             fieldname.ModePreserve,
 		CDCMode:                CDCModeAuto,
 		LogreplPublicationName: DefaultPublicationName,
 		LogreplSlotName:        DefaultSlotName,
+		LogreplLagDuration:     DefaultLagDuration,
+		LogreplSchemaChanges:   SchemaChangesModeLog,
+		LogreplReplicaIdentity: ReplicaIdentityModeCheck,
+		LongPollingInterval:    DefaultPollingInterval,
+
+		LogreplReplicaIdentityIndex: cfgRaw[ConfigKeyLogreplReplicaIdentityIndex],
 	}
 
+	var err error
+	if cfg.URL, err = session.ResolveURL(cfgRaw); err != nil {
+		return Config{}, err
+	}
 	if cfg.URL == "" {
 		return Config{}, requiredConfigErr(ConfigKeyURL)
 	}
@@ -103,6 +311,40 @@ func ParseConfig(cfgRaw map[string]string) (Config, error) {
 		}
 		cfg.SnapshotMode = SnapshotMode(modeRaw)
 	}
+	if sizeRaw := cfgRaw[ConfigKeySnapshotFetchSize]; sizeRaw != "" {
+		size, err := strconv.Atoi(sizeRaw)
+		if err != nil || size < 0 {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected a non-negative integer", ConfigKeySnapshotFetchSize, sizeRaw)
+		}
+		cfg.SnapshotFetchSize = size
+	}
+	if defaultsRaw := cfgRaw[ConfigKeySnapshotColumnDefaults]; defaultsRaw != "" {
+		defaults, err := strconv.ParseBool(defaultsRaw)
+		if err != nil {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected a boolean", ConfigKeySnapshotColumnDefaults, defaultsRaw)
+		}
+		cfg.SnapshotColumnDefaults = defaults
+	}
+	if name := cfgRaw[ConfigKeyCollectionName]; name != "" {
+		if err := collection.Validate(name); err != nil {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q: %v", ConfigKeyCollectionName, name, err)
+		}
+		cfg.CollectionName = name
+	}
+	if namesRaw := cfgRaw[ConfigKeyFieldNames]; namesRaw != "" {
+		mode, err := fieldname.Parse(namesRaw)
+		if err != nil {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, %v", ConfigKeyFieldNames, namesRaw, err)
+		}
+		cfg.FieldNames = mode
+	}
+	if checkRaw := cfgRaw[ConfigKeyHealthCheck]; checkRaw != "" {
+		check, err := strconv.ParseBool(checkRaw)
+		if err != nil {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected a boolean", ConfigKeyHealthCheck, checkRaw)
+		}
+		cfg.HealthCheck = check
+	}
 	if modeRaw := cfgRaw[ConfigKeyCDCMode]; modeRaw != "" {
 		if !isCDCModeSupported(modeRaw) {
 			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected one of %v", ConfigKeyCDCMode, modeRaw, cdcModeAll)
@@ -115,10 +357,195 @@ func ParseConfig(cfgRaw map[string]string) (Config, error) {
 	if cfgRaw[ConfigKeyLogreplSlotName] != "" {
 		cfg.LogreplSlotName = cfgRaw[ConfigKeyLogreplSlotName]
 	}
+	if thresholdRaw := cfgRaw[ConfigKeyLogreplLagThreshold]; thresholdRaw != "" {
+		threshold, err := strconv.ParseUint(thresholdRaw, 10, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected a number of bytes", ConfigKeyLogreplLagThreshold, thresholdRaw)
+		}
+		cfg.LogreplLagThreshold = threshold
+	}
+	if thresholdRaw := cfgRaw[ConfigKeyLogreplRetentionThreshold]; thresholdRaw != "" {
+		threshold, err := strconv.ParseUint(thresholdRaw, 10, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected a number of bytes", ConfigKeyLogreplRetentionThreshold, thresholdRaw)
+		}
+		cfg.LogreplRetentionThreshold = threshold
+	}
+	if durationRaw := cfgRaw[ConfigKeyLogreplLagDuration]; durationRaw != "" {
+		duration, err := time.ParseDuration(durationRaw)
+		if err != nil || duration < 0 {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected a duration", ConfigKeyLogreplLagDuration, durationRaw)
+		}
+		cfg.LogreplLagDuration = duration
+	}
+	if modeRaw := cfgRaw[ConfigKeyLogreplSchemaChanges]; modeRaw != "" {
+		if !isSchemaChangesModeSupported(modeRaw) {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected one of %v", ConfigKeyLogreplSchemaChanges, modeRaw, schemaChangesModeAll)
+		}
+		cfg.LogreplSchemaChanges = SchemaChangesMode(modeRaw)
+	}
+	if modeRaw := cfgRaw[ConfigKeyLogreplReplicaIdentity]; modeRaw != "" {
+		if !isReplicaIdentityModeSupported(modeRaw) {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected one of %v", ConfigKeyLogreplReplicaIdentity, modeRaw, replicaIdentityModeAll)
+		}
+		cfg.LogreplReplicaIdentity = ReplicaIdentityMode(modeRaw)
+	}
+	if cfg.LogreplReplicaIdentity == ReplicaIdentityModeIndex && cfg.LogreplReplicaIdentityIndex == "" {
+		return Config{}, fmt.Errorf("%q %q requires %q to be set", ConfigKeyLogreplReplicaIdentity, ReplicaIdentityModeIndex, ConfigKeyLogreplReplicaIdentityIndex)
+	}
+	if groupRaw := cfgRaw[ConfigKeyLogreplGroupTransactions]; groupRaw != "" {
+		group, err := strconv.ParseBool(groupRaw)
+		if err != nil {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected a boolean", ConfigKeyLogreplGroupTransactions, groupRaw)
+		}
+		cfg.LogreplGroupTransactions = group
+	}
+	if lsnRaw := cfgRaw[ConfigKeyLogreplStartLSN]; lsnRaw != "" {
+		lsn, err := pglogrepl.ParseLSN(lsnRaw)
+		if err != nil {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected an LSN (e.g. 16/B374D848)", ConfigKeyLogreplStartLSN, lsnRaw)
+		}
+		cfg.LogreplStartLSN = lsn
+	}
+	if lsnRaw := cfgRaw[ConfigKeyLogreplStopLSN]; lsnRaw != "" {
+		lsn, err := pglogrepl.ParseLSN(lsnRaw)
+		if err != nil {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected an LSN (e.g. 16/B374D848)", ConfigKeyLogreplStopLSN, lsnRaw)
+		}
+		cfg.LogreplStopLSN = lsn
+	}
+	if cfg.LogreplStartLSN > 0 && cfg.SnapshotMode != SnapshotModeNever {
+		// the snapshot contains the current rows, not the rows at the LSN
+		return Config{}, fmt.Errorf("%q requires %q %q", ConfigKeyLogreplStartLSN, ConfigKeySnapshotMode, SnapshotModeNever)
+	}
+	if cfg.LogreplStopLSN > 0 && cfg.LogreplStopLSN <= cfg.LogreplStartLSN {
+		return Config{}, fmt.Errorf("%q needs to be greater than %q", ConfigKeyLogreplStopLSN, ConfigKeyLogreplStartLSN)
+	}
+	if cfg.LogreplStartLSN > 0 && cfg.CDCMode == CDCModeLongPolling {
+		return Config{}, fmt.Errorf("%q can't be combined with %q %q", ConfigKeyLogreplStartLSN, ConfigKeyCDCMode, CDCModeLongPolling)
+	}
+	if cfg.LogreplStopLSN > 0 && cfg.CDCMode == CDCModeLongPolling {
+		return Config{}, fmt.Errorf("%q can't be combined with %q %q", ConfigKeyLogreplStopLSN, ConfigKeyCDCMode, CDCModeLongPolling)
+	}
+	if captureRaw := cfgRaw[ConfigKeyLogreplCaptureSequences]; captureRaw != "" {
+		capture, err := strconv.ParseBool(captureRaw)
+		if err != nil {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected a boolean", ConfigKeyLogreplCaptureSequences, captureRaw)
+		}
+		cfg.LogreplCaptureSequences = capture
+	}
+	if durationRaw := cfgRaw[ConfigKeyLogreplSequencesInterval]; durationRaw != "" {
+		duration, err := time.ParseDuration(durationRaw)
+		if err != nil || duration < 0 {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected a duration", ConfigKeyLogreplSequencesInterval, durationRaw)
+		}
+		cfg.LogreplSequencesInterval = duration
+	}
+	if cfg.LogreplSequencesInterval > 0 && !cfg.LogreplCaptureSequences {
+		return Config{}, fmt.Errorf("%q requires %q to be enabled", ConfigKeyLogreplSequencesInterval, ConfigKeyLogreplCaptureSequences)
+	}
+	if cfg.LogreplCaptureSequences && cfg.CDCMode == CDCModeLongPolling {
+		return Config{}, fmt.Errorf("%q can't be combined with %q %q", ConfigKeyLogreplCaptureSequences, ConfigKeyCDCMode, CDCModeLongPolling)
+	}
+	if durationRaw := cfgRaw[ConfigKeyLongPollingInterval]; durationRaw != "" {
+		duration, err := time.ParseDuration(durationRaw)
+		if err != nil || duration <= 0 {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected a positive duration", ConfigKeyLongPollingInterval, durationRaw)
+		}
+		cfg.LongPollingInterval = duration
+	}
+	if refreshRaw := cfgRaw[ConfigKeyLongPollingRefreshMaterializedView]; refreshRaw != "" {
+		refresh, err := strconv.ParseBool(refreshRaw)
+		if err != nil {
+			return Config{}, fmt.Errorf("%q contains unsupported value %q, expected a boolean", ConfigKeyLongPollingRefreshMaterializedView, refreshRaw)
+		}
+		cfg.LongPollingRefreshMaterializedView = refresh
+	}
+	tables, err := parseTablesConfig(cfgRaw)
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Tables = tables
+	for _, c := range cfg.Tables[cfg.Table].ExcludeColumns {
+		if cfg.Key != "" && c == cfg.Key {
+			return Config{}, fmt.Errorf("%q can't contain the key column %q", ConfigKeyTablesPrefix+cfg.Table+"."+ConfigTableKeyExcludeColumns, cfg.Key)
+		}
+	}
+	if cfg.SnapshotFetchSize > 0 && cfg.Tables[cfg.Table].OrderBy != "" {
+		// pages continue after the last key, so rows need to be ordered by it
+		return Config{}, fmt.Errorf("%q can't be combined with %q", ConfigKeySnapshotFetchSize, ConfigKeyTablesPrefix+cfg.Table+"."+ConfigTableKeyOrderBy)
+	}
+	if cfg.Retry, err = retry.ParseConfig(cfgRaw); err != nil {
+		return Config{}, err
+	}
+	if cfg.Session, err = session.ParseConfig(cfgRaw); err != nil {
+		return Config{}, err
+	}
+	if cfg.StatsInterval, err = stats.ParseInterval(cfgRaw); err != nil {
+		return Config{}, err
+	}
+	if cfg.Session.PoolerCompatibility && cfg.CDCMode != CDCModeLongPolling {
+		return Config{}, fmt.Errorf("%q requires %q %q, logical replication doesn't work through a connection pooler", session.ConfigKeyPoolerCompatibility, ConfigKeyCDCMode, CDCModeLongPolling)
+	}
 
 	return cfg, nil
 }
 
+// parseTablesConfig collects all config values with the prefix "tables." and
+// groups them by table. The table name can contain dots (e.g. schema.table),
+// the option is the part after the last dot.
+func parseTablesConfig(cfgRaw map[string]string) (map[string]TableConfig, error) {
+	var tables map[string]TableConfig
+	for k, v := range cfgRaw {
+		if !strings.HasPrefix(k, ConfigKeyTablesPrefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(k, ConfigKeyTablesPrefix)
+		i := strings.LastIndex(rest, ".")
+		if i <= 0 {
+			return nil, fmt.Errorf("%q is not a valid table config key, expected format \"tables.<table>.<option>\"", k)
+		}
+		table, option := rest[:i], rest[i+1:]
+
+		if tables == nil {
+			tables = make(map[string]TableConfig)
+		}
+		tc := tables[table]
+		switch option {
+		case ConfigTableKeyOrderBy:
+			tc.OrderBy = v
+		case ConfigTableKeyIncludeColumns:
+			tc.IncludeColumns = splitList(v)
+		case ConfigTableKeyExcludeColumns:
+			tc.ExcludeColumns = splitList(v)
+		case ConfigTableKeyHashColumns:
+			tc.HashColumns = splitList(v)
+		case ConfigTableKeyRedactColumns:
+			tc.RedactColumns = splitList(v)
+		case ConfigTableKeyFilter:
+			tc.Filter = strings.TrimSpace(v)
+		case ConfigTableKeyCollectionName:
+			if err := collection.Validate(v); err != nil {
+				return nil, fmt.Errorf("%q contains unsupported value %q: %v", k, v, err)
+			}
+			tc.CollectionName = v
+		default:
+			return nil, fmt.Errorf("%q contains unsupported table option %q", k, option)
+		}
+		tables[table] = tc
+	}
+	return tables, nil
+}
+
+// splitList splits a comma separated list and trims the values.
+func splitList(raw string) []string {
+	list := strings.Split(raw, ",")
+	for i, v := range list {
+		list[i] = strings.TrimSpace(v)
+	}
+	return list
+}
+
 func isSnapshotModeSupported(modeRaw string) bool {
 	for _, m := range snapshotModeAll {
 		if string(m) == modeRaw {
@@ -137,6 +564,24 @@ func isCDCModeSupported(modeRaw string) bool {
 	return false
 }
 
+func isSchemaChangesModeSupported(modeRaw string) bool {
+	for _, m := range schemaChangesModeAll {
+		if string(m) == modeRaw {
+			return true
+		}
+	}
+	return false
+}
+
+func isReplicaIdentityModeSupported(modeRaw string) bool {
+	for _, m := range replicaIdentityModeAll {
+		if string(m) == modeRaw {
+			return true
+		}
+	}
+	return false
+}
+
 func requiredConfigErr(name string) error {
 	return fmt.Errorf("%q config value must be set", name)
 }
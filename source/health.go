@@ -0,0 +1,43 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"context"
+
+	"github.com/conduitio/conduit-connector-postgres/health"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// checkHealth checks that the table exists and the current user can read it.
+// Unless long polling is used, it also checks that the server and the user
+// are set up for logical replication. Changes of views are always read with
+// long polling, so logical replication isn't checked for them.
+func (s *Source) checkHealth(ctx context.Context) error {
+	c := health.New(s.conn)
+	c.Table(ctx, s.config.Table, "SELECT")
+	if s.config.CDCMode != CDCModeLongPolling {
+		// a missing table was reported above
+		rel, err := s.lookupRelation(ctx)
+		if err != nil || (rel.kind != relKindView && rel.kind != relKindMaterializedView) {
+			c.LogicalReplication(ctx)
+		}
+	}
+	if err := c.Err(); err != nil {
+		return err
+	}
+	sdk.Logger(ctx).Info().Msg("health check passed")
+	return nil
+}
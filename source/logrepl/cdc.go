@@ -18,8 +18,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
 
+	"github.com/conduitio/conduit-connector-postgres/fieldname"
+	"github.com/conduitio/conduit-connector-postgres/source/columnfilter"
 	"github.com/conduitio/conduit-connector-postgres/source/logrepl/internal"
+	"github.com/conduitio/conduit-connector-postgres/source/longpoll"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 	"github.com/jackc/pglogrepl"
 	"github.com/jackc/pgx/v4"
@@ -33,6 +38,77 @@ type Config struct {
 	TableName       string
 	KeyColumnName   string
 	Columns         []string
+	// ExcludeColumns is the list of columns removed from the payload.
+	ExcludeColumns []string
+	// HashColumns is the list of columns whose values are hashed.
+	HashColumns []string
+	// RedactColumns is the list of columns whose values are replaced with nil.
+	RedactColumns []string
+	// FieldNames determines how column names are turned into the field names
+	// of keys and payloads.
+	FieldNames fieldname.Mode
+	// CollectionName is the template of the collection name stored in the
+	// "table" metadata field of records, see collection.Name. Records are
+	// named after their table if empty.
+	CollectionName string
+	// Filter is the WHERE expression of the table in the publication, only
+	// matching changes are replicated. It requires Postgres 15, on older
+	// servers all changes are replicated.
+	Filter string
+	// LagThreshold is the number of WAL bytes between the end of the WAL on
+	// the server and the last acked position above which the replication lag
+	// is reported. The lag is not monitored if set to 0.
+	LagThreshold uint64
+	// LagDuration is the time the lag needs to stay above LagThreshold before
+	// it is reported.
+	LagDuration time.Duration
+	// RetentionThreshold is the number of WAL bytes retained by the
+	// replication slot above which the retention is reported. The retention
+	// needs to stay above the threshold for LagDuration, it is not reported
+	// if set to 0.
+	RetentionThreshold uint64
+	// EmitSchemaChanges makes the iterator return a record with the action
+	// "schema_change" when the schema of the table changes.
+	EmitSchemaChanges bool
+	// GroupTransactions makes the iterator hold back the changes of a
+	// transaction until it's committed and return them together, tagged with
+	// their index in the transaction and the size of the transaction.
+	GroupTransactions bool
+	// CheckReplicaIdentity makes the iterator fail if the replica identity of
+	// the table doesn't include the key column, in which case updates and
+	// deletes would be returned without a key.
+	CheckReplicaIdentity bool
+	// ReplicaIdentityFull sets the replica identity of the table to FULL.
+	ReplicaIdentityFull bool
+	// ReplicaIdentityIndex sets the replica identity of the table to the
+	// index with this name if not empty.
+	ReplicaIdentityIndex string
+	// StartLSN is the LSN after which changes are read if Position is empty.
+	// Changes before the confirmed position of the replication slot can't be
+	// read anymore, they are skipped.
+	StartLSN pglogrepl.LSN
+	// StopLSN stops the iterator once all transactions committed at or before
+	// it were returned, it keeps running if StopLSN is 0.
+	StopLSN pglogrepl.LSN
+	// CaptureSequences makes the iterator return a record with the action
+	// "sequence" for each sequence owned by a column of the table, containing
+	// its current value. Values are captured once after the snapshot, or when
+	// replication starts if no snapshot is taken.
+	CaptureSequences bool
+	// SequencesInterval is the interval in which the values of sequences are
+	// captured again, only changed values are returned. Values are only
+	// captured once if set to 0.
+	SequencesInterval time.Duration
+	// Snapshot configures the snapshot taken before changes are returned, no
+	// snapshot is taken if nil. The snapshot is skipped if Position contains
+	// an LSN, since the snapshot was already read.
+	Snapshot *longpoll.SnapshotConfig
+	// ConnConfig returns the config of the connections opened by the
+	// iterator, i.e. the replication, snapshot and sequence connections. It's
+	// called for every connection, so credentials that expire, like IAM auth
+	// tokens, are renewed. The config of the connection passed to
+	// NewCDCIterator is used if nil.
+	ConnConfig func() (*pgx.ConnConfig, error)
 }
 
 // CDCIterator asynchronously listens for events from the logical replication
@@ -42,6 +118,30 @@ type CDCIterator struct {
 	records chan sdk.Record
 
 	sub *internal.Subscription
+	// stopSlotMonitor stops the slot monitor, slotMonitorDone is closed once
+	// it stopped. Both are nil if the monitor wasn't started.
+	stopSlotMonitor context.CancelFunc
+	slotMonitorDone chan struct{}
+	// slotStats contains the SlotStats of the last slot check.
+	slotStats atomic.Value
+
+	// connConfig returns the config of new connections, see
+	// Config.ConnConfig.
+	connConfig func() (*pgx.ConnConfig, error)
+	keyColumn  string
+	// snapshot returns the rows of the table before any changes, it is nil
+	// if no snapshot is taken or once the snapshot is done.
+	snapshot *initialSnapshot
+	// snapshotStarted receives the result of starting the snapshot.
+	snapshotStarted chan error
+	// sequences captures the values of sequences, it is nil if sequences
+	// aren't captured.
+	sequences *sequenceCapture
+	// position is the position of the last returned record.
+	position sdk.Position
+	// completeLogged is true once the iterator logged that it reached
+	// StopLSN.
+	completeLogged bool
 }
 
 // NewCDCIterator sets up the subscription to a logical replication slot and
@@ -49,8 +149,15 @@ type CDCIterator struct {
 // until either the context is canceled or Teardown is called.
 func NewCDCIterator(ctx context.Context, conn *pgx.Conn, config Config) (*CDCIterator, error) {
 	i := &CDCIterator{
-		config:  config,
-		records: make(chan sdk.Record),
+		config:     config,
+		records:    make(chan sdk.Record),
+		connConfig: config.ConnConfig,
+	}
+	if i.connConfig == nil {
+		connConfig := conn.Config()
+		i.connConfig = func() (*pgx.ConnConfig, error) {
+			return connConfig.Copy(), nil
+		}
 	}
 
 	err := i.attachSubscription(ctx, conn)
@@ -58,8 +165,27 @@ func NewCDCIterator(ctx context.Context, conn *pgx.Conn, config Config) (*CDCIte
 		return nil, fmt.Errorf("failed to setup subscription: %w", err)
 	}
 
+	if config.CaptureSequences {
+		i.sequences = newSequenceCapture(i.connConfig, config)
+	}
+
 	go i.listen(ctx)
 
+	if i.config.Snapshot != nil {
+		if err := i.waitForSnapshot(ctx); err != nil {
+			i.sub.Stop()
+			return nil, err
+		}
+	}
+
+	monitorCtx, stopSlotMonitor := context.WithCancel(ctx)
+	i.stopSlotMonitor = stopSlotMonitor
+	i.slotMonitorDone = make(chan struct{})
+	go func() {
+		defer close(i.slotMonitorDone)
+		i.monitorSlot(monitorCtx, conn)
+	}()
+
 	return i, nil
 }
 
@@ -82,9 +208,38 @@ func (i *CDCIterator) listen(ctx context.Context) {
 
 // Next returns the next record retrieved from the subscription. This call will
 // block until either a record is returned from the subscription, the
-// subscription stops because of an error or the context gets canceled.
+// subscription stops because of an error or the context gets canceled. If a
+// snapshot is taken, all snapshot records are returned first. If sequences
+// are captured, their values are returned after the snapshot and in between
+// changes once they are due.
 func (i *CDCIterator) Next(ctx context.Context) (sdk.Record, error) {
+	rec, err := i.next(ctx)
+	if err != nil {
+		return sdk.Record{}, err
+	}
+	i.position = rec.Position
+	return rec, nil
+}
+
+func (i *CDCIterator) next(ctx context.Context) (sdk.Record, error) {
+	if i.snapshot != nil {
+		rec, ok, err := i.snapshot.next(ctx)
+		if err != nil {
+			return sdk.Record{}, fmt.Errorf("snapshot error: %w", err)
+		}
+		if ok {
+			return rec, nil
+		}
+		i.snapshot = nil
+	}
 	for {
+		rec, ok, err := i.sequences.next(ctx, i.position)
+		if err != nil {
+			return sdk.Record{}, fmt.Errorf("sequence error: %w", err)
+		}
+		if ok {
+			return rec, nil
+		}
 		select {
 		case <-ctx.Done():
 			return sdk.Record{}, ctx.Err()
@@ -97,19 +252,47 @@ func (i *CDCIterator) Next(ctx context.Context) (sdk.Record, error) {
 				// into the wrong case by chance
 				return sdk.Record{}, err
 			}
+			if i.sub.StopLSNReached() {
+				// all changes were returned, there is nothing left to read
+				if !i.completeLogged {
+					sdk.Logger(ctx).Info().
+						Str("stopLSN", i.config.StopLSN.String()).
+						Msg("all changes up to the stop LSN were read, the pipeline can be stopped")
+					i.completeLogged = true
+				}
+				return sdk.Record{}, sdk.ErrBackoffRetry
+			}
 			// subscription stopped without an error and the context is still
 			// open, this is a strange case, shouldn't actually happen
 			return sdk.Record{}, fmt.Errorf("subscription stopped, no more data to fetch (this smells like a bug)")
 		case r := <-i.records:
 			return r, nil
+		case <-i.sequences.tick():
+			i.sequences.due = true
 		}
 	}
 }
 
-// Ack forwards the acknowledgment to the subscription.
+// Complete returns true once the iterator stopped at StopLSN, Next returns
+// sdk.ErrBackoffRetry from then on.
+func (i *CDCIterator) Complete() bool {
+	select {
+	case <-i.sub.Done():
+		return i.sub.StopLSNReached()
+	default:
+		return false
+	}
+}
+
+// Ack forwards the acknowledgment to the subscription. Snapshot records don't
+// need to be acked.
 func (i *CDCIterator) Ack(ctx context.Context, pos sdk.Position) error {
 	lsn, err := PositionToLSN(pos)
 	if err != nil {
+		if i.config.Snapshot != nil {
+			// snapshot records have integer positions
+			return nil
+		}
 		return fmt.Errorf("failed to parse position: %w", err)
 	}
 	i.sub.Ack(lsn)
@@ -121,6 +304,21 @@ func (i *CDCIterator) Ack(ctx context.Context, pos sdk.Position) error {
 // error, the error is returned.
 func (i *CDCIterator) Teardown(ctx context.Context) error {
 	i.sub.Stop()
+	if i.stopSlotMonitor != nil {
+		// the slot monitor uses the connection, wait for it to stop
+		i.stopSlotMonitor()
+		<-i.slotMonitorDone
+	}
+	if i.snapshot != nil {
+		if err := i.snapshot.teardown(ctx); err != nil {
+			// log it, the subscription still needs to be stopped
+			sdk.Logger(ctx).Warn().Err(err).Msg("failed to tear down snapshot")
+		}
+		i.snapshot = nil
+	}
+	if err := i.sequences.teardown(ctx); err != nil {
+		sdk.Logger(ctx).Warn().Err(err).Msg("failed to tear down sequence capture")
+	}
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -143,18 +341,52 @@ func (i *CDCIterator) attachSubscription(ctx context.Context, conn *pgx.Conn) er
 	if i.config.Position != nil && string(i.config.Position) != "" {
 		var err error
 		lsn, err = PositionToLSN(i.config.Position)
-		if err != nil {
+		switch {
+		case err != nil && i.config.Snapshot != nil:
+			// the position of an interrupted snapshot, start over
+			lsn = 0
+		case err != nil:
 			return err
+		default:
+			// the snapshot was already read
+			i.config.Snapshot = nil
 		}
+	} else if i.config.StartLSN > 0 {
+		lsn = i.config.StartLSN
 	}
+	i.position = LSNToPosition(lsn)
 
 	keyColumn, err := i.getKeyColumn(ctx, conn)
 	if err != nil {
 		return fmt.Errorf("failed to find key for table %s (try specifying it manually): %w", i.config.TableName, err)
 	}
+	i.keyColumn = keyColumn
+
+	if err := i.ensureReplicaIdentity(ctx, conn); err != nil {
+		return err
+	}
+	if err := i.attachPublication(ctx, conn); err != nil {
+		return err
+	}
+
+	filter := columnfilter.New(columnfilter.Config{
+		Include: i.config.Columns,
+		Exclude: i.config.ExcludeColumns,
+		Hash:    i.config.HashColumns,
+		Redact:  i.config.RedactColumns,
 
+		FieldNames: i.config.FieldNames,
+	})
+	if filter.Excludes(keyColumn) {
+		return fmt.Errorf("key column %q of %s can't be excluded", keyColumn, i.config.TableName)
+	}
+
+	connConfig, err := i.connConfig()
+	if err != nil {
+		return fmt.Errorf("failed to create replication connection config: %w", err)
+	}
 	sub := internal.NewSubscription(
-		conn.Config().Config,
+		connConfig.Config,
 		i.config.SlotName,
 		i.config.PublicationName,
 		[]string{i.config.TableName},
@@ -162,15 +394,64 @@ func (i *CDCIterator) attachSubscription(ctx context.Context, conn *pgx.Conn) er
 		NewCDCHandler(
 			internal.NewRelationSet(conn.ConnInfo()),
 			keyColumn,
-			i.config.Columns,
+			filter,
+			i.config.CollectionName,
+			i.config.EmitSchemaChanges,
+			i.config.GroupTransactions,
 			i.records,
 		).Handle,
 	)
 
+	sub.StopLSN = i.config.StopLSN
+
+	if i.config.Filter != "" {
+		rowFilters, err := i.rowFilters(ctx, conn)
+		if err != nil {
+			return err
+		}
+		sub.RowFilters = rowFilters
+	}
+
+	if i.config.Snapshot != nil {
+		i.snapshotStarted = make(chan error, 1)
+		sub.SnapshotHandler = i.handleSnapshot
+	}
+
 	i.sub = sub
 	return nil
 }
 
+// rowFilterMinServerVersion is the first server_version_num that supports row
+// filters and column lists in publications.
+const rowFilterMinServerVersion = 150000
+
+// rowFilters returns the row filters of the publication. If the server
+// doesn't support row filters, it logs a warning and returns nil, in which
+// case the filter is only applied to the snapshot. It returns an error if the
+// filter would make updates and deletes of the table fail, see
+// checkRowFilter.
+func (i *CDCIterator) rowFilters(ctx context.Context, conn *pgx.Conn) (map[string]string, error) {
+	version, err := serverVersion(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if version < rowFilterMinServerVersion {
+		sdk.Logger(ctx).Warn().
+			Int("serverVersion", version).
+			Str("table", i.config.TableName).
+			Msg("server doesn't support row filters in publications, the filter is only applied to the snapshot")
+		return nil, nil
+	}
+	ident, err := getReplicaIdentity(ctx, conn, pgx.Identifier{i.config.TableName}.Sanitize())
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRowFilter(ctx, conn, i.config.TableName, i.config.Filter, ident); err != nil {
+		return nil, err
+	}
+	return map[string]string{i.config.TableName: i.config.Filter}, nil
+}
+
 // getKeyColumn queries the db for the name of the primary key column for a
 // table if one exists and returns it.
 func (i *CDCIterator) getKeyColumn(ctx context.Context, conn *pgx.Conn) (string, error) {
@@ -56,6 +56,9 @@ func TestIterator_Next(t *testing.T) {
 				Metadata: map[string]string{
 					"table":  table,
 					"action": "insert",
+
+					MetadataPostgresTable:  table,
+					MetadataPostgresSchema: "public",
 				},
 				Payload: sdk.StructuredData{
 					"id":      int64(6),
@@ -77,6 +80,9 @@ func TestIterator_Next(t *testing.T) {
 				Metadata: map[string]string{
 					"table":  table,
 					"action": "update",
+
+					MetadataPostgresTable:  table,
+					MetadataPostgresSchema: "public",
 				},
 				Payload: sdk.StructuredData{
 					"id":      int64(1),
@@ -96,6 +102,9 @@ func TestIterator_Next(t *testing.T) {
 				Metadata: map[string]string{
 					"table":  table,
 					"action": "delete",
+
+					MetadataPostgresTable:  table,
+					MetadataPostgresSchema: "public",
 				},
 			},
 		},
@@ -120,6 +129,16 @@ func TestIterator_Next(t *testing.T) {
 			tt.want.CreatedAt = got.CreatedAt
 			tt.want.Position = got.Position
 
+			// transaction details are only known after the change is made
+			is.Equal(got.Metadata[MetadataPostgresLSN], string(got.Position))
+			is.True(got.Metadata[MetadataPostgresXID] != "")
+			commitTime, err := time.Parse(time.RFC3339Nano, got.Metadata[MetadataPostgresCommitTime])
+			is.NoErr(err)
+			is.True(commitTime.After(now.Add(-time.Minute)))
+			tt.want.Metadata[MetadataPostgresLSN] = got.Metadata[MetadataPostgresLSN]
+			tt.want.Metadata[MetadataPostgresXID] = got.Metadata[MetadataPostgresXID]
+			tt.want.Metadata[MetadataPostgresCommitTime] = got.Metadata[MetadataPostgresCommitTime]
+
 			is.Equal(got, tt.want)
 			is.NoErr(i.Ack(ctx, got.Position))
 		})
@@ -17,8 +17,10 @@ package logrepl
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/conduitio/conduit-connector-postgres/source/columnfilter"
 	"github.com/conduitio/conduit-connector-postgres/source/logrepl/internal"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 	"github.com/jackc/pglogrepl"
@@ -31,35 +33,51 @@ var (
 	actionInsert action = "insert"
 	actionUpdate action = "update"
 	actionDelete action = "delete"
+	// actionSchemaChange is the action of records describing a change of the
+	// table schema.
+	actionSchemaChange action = "schema_change"
 )
 
 // CDCHandler is responsible for handling logical replication messages,
 // converting them to a record and sending them to a channel.
 type CDCHandler struct {
 	keyColumn   string
-	columns     map[string]bool // columns can be used to filter only specific columns
+	filter      *columnfilter.Filter // filter removes and masks columns
 	relationSet *internal.RelationSet
-	out         chan<- sdk.Record
+	// collectionName is the template of the collection name stored in the
+	// "table" metadata field, see collection.Name.
+	collectionName string
+	// emitSchemaChanges controls if schema changes are sent as records.
+	emitSchemaChanges bool
+	// groupTransactions controls if the records of a transaction are held
+	// back until the transaction is committed.
+	groupTransactions bool
+	out               chan<- sdk.Record
+
+	// tx is the transaction whose changes are currently handled.
+	tx transaction
+	// pending are the records of the current transaction that are sent
+	// when it's committed, if groupTransactions is enabled.
+	pending []sdk.Record
 }
 
 func NewCDCHandler(
 	rs *internal.RelationSet,
 	keyColumn string,
-	columns []string,
+	filter *columnfilter.Filter,
+	collectionName string,
+	emitSchemaChanges bool,
+	groupTransactions bool,
 	out chan<- sdk.Record,
 ) *CDCHandler {
-	var columnSet map[string]bool
-	if len(columns) > 0 {
-		columnSet = make(map[string]bool)
-		for _, col := range columns {
-			columnSet[col] = true
-		}
-	}
 	return &CDCHandler{
-		keyColumn:   keyColumn,
-		columns:     columnSet,
-		relationSet: rs,
-		out:         out,
+		keyColumn:         keyColumn,
+		filter:            filter,
+		relationSet:       rs,
+		collectionName:    collectionName,
+		emitSchemaChanges: emitSchemaChanges,
+		groupTransactions: groupTransactions,
+		out:               out,
 	}
 }
 
@@ -71,10 +89,21 @@ func (h *CDCHandler) Handle(ctx context.Context, m pglogrepl.Message, lsn pglogr
 		Msg("handler received pglogrepl.Message")
 
 	switch m := m.(type) {
+	case *pglogrepl.BeginMessage:
+		h.tx = transaction{
+			xid:        m.Xid,
+			commitTime: m.CommitTime,
+		}
+	case *pglogrepl.CommitMessage:
+		err := h.handleCommit(ctx)
+		if err != nil {
+			return fmt.Errorf("logrepl handler commit: %w", err)
+		}
 	case *pglogrepl.RelationMessage:
-		// We have to add the Relations to our Set so that we can
-		// decode our own output
-		h.relationSet.Add(m)
+		err := h.handleRelation(ctx, m, lsn)
+		if err != nil {
+			return fmt.Errorf("logrepl handler relation: %w", err)
+		}
 	case *pglogrepl.InsertMessage:
 		err := h.handleInsert(ctx, m, lsn)
 		if err != nil {
@@ -95,6 +124,37 @@ func (h *CDCHandler) Handle(ctx context.Context, m pglogrepl.Message, lsn pglogr
 	return nil
 }
 
+// handleRelation stores the relation so we can decode our own output. If the
+// relation was seen before and its columns changed, the schema change is
+// logged and sent as a record if configured.
+func (h *CDCHandler) handleRelation(
+	ctx context.Context,
+	msg *pglogrepl.RelationMessage,
+	lsn pglogrepl.LSN,
+) error {
+	old := h.relationSet.Add(msg)
+	if old == nil {
+		// first time we see this relation
+		return nil
+	}
+
+	change := diffRelations(old, msg)
+	if change.empty() {
+		return nil
+	}
+	sdk.Logger(ctx).Info().
+		Str("table", msg.RelationName).
+		Strs("added", change.added).
+		Strs("dropped", change.dropped).
+		Strs("changed", change.changed).
+		Msg("detected schema change, records are now built using the new schema")
+
+	if !h.emitSchemaChanges {
+		return nil
+	}
+	return h.send(ctx, h.buildSchemaChangeRecord(msg, change, lsn))
+}
+
 // handleInsert formats a Record with INSERT event data from Postgres and sends
 // it to the output channel.
 func (h *CDCHandler) handleInsert(
@@ -112,12 +172,16 @@ func (h *CDCHandler) handleInsert(
 		return fmt.Errorf("failed to decode new values: %w", err)
 	}
 
-	rec := h.buildRecord(actionInsert, rel, newValues, lsn)
+	rec, err := h.buildRecord(actionInsert, rel, newValues, lsn)
+	if err != nil {
+		return err
+	}
 	return h.send(ctx, rec)
 }
 
 // handleUpdate formats a record with UPDATE event data from Postgres and sends
-// it to the output channel.
+// it to the output channel. If the table has REPLICA IDENTITY FULL, the row
+// before the update is added to the metadata.
 func (h *CDCHandler) handleUpdate(
 	ctx context.Context,
 	msg *pglogrepl.UpdateMessage,
@@ -133,7 +197,35 @@ func (h *CDCHandler) handleUpdate(
 		return fmt.Errorf("failed to decode new values: %w", err)
 	}
 
-	rec := h.buildRecord(actionUpdate, rel, newValues, lsn)
+	// the old tuple contains the whole row only with REPLICA IDENTITY FULL,
+	// otherwise it's either missing or contains only the replica identity
+	var oldValues map[string]pgtype.Value
+	if msg.OldTupleType == pglogrepl.UpdateMessageTupleTypeOld {
+		oldValues, err = h.relationSet.Values(pgtype.OID(msg.RelationID), msg.OldTuple)
+		if err != nil {
+			return fmt.Errorf("failed to decode old values: %w", err)
+		}
+		// unchanged TOASTed values are missing in the new tuple, take them
+		// from the old row, otherwise they are left out of the payload
+		for name, value := range oldValues {
+			if _, ok := newValues[name]; !ok {
+				newValues[name] = value
+			}
+		}
+	}
+
+	rec, err := h.buildRecord(actionUpdate, rel, newValues, lsn)
+	if err != nil {
+		return err
+	}
+
+	if oldValues != nil {
+		before, err := h.buildRecordPayload(oldValues)
+		if err != nil {
+			return err
+		}
+		rec.Metadata[MetadataPayloadBefore] = string(before.Bytes())
+	}
 	return h.send(ctx, rec)
 }
 
@@ -154,16 +246,47 @@ func (h *CDCHandler) handleDelete(
 		return fmt.Errorf("failed to decode old values: %w", err)
 	}
 
-	rec := h.buildRecord(actionDelete, rel, oldValues, lsn)
+	rec, err := h.buildRecord(actionDelete, rel, oldValues, lsn)
+	if err != nil {
+		return err
+	}
 	// NB: Deletes shouldn't have payloads. Key + delete action is sufficient.
 	rec.Payload = nil
 
 	return h.send(ctx, rec)
 }
 
-// send the record to the output channel or detect the cancellation of the
-// context and return the context error.
+// handleCommit sends the records held back for the committed transaction, if
+// groupTransactions is enabled. Each record is tagged with its index in the
+// transaction and the number of records of the transaction, so the first and
+// last record of the transaction can be recognized.
+func (h *CDCHandler) handleCommit(ctx context.Context) error {
+	pending := h.pending
+	h.pending = nil
+	size := strconv.Itoa(len(pending))
+	for i, rec := range pending {
+		rec.Metadata[MetadataPostgresTxIndex] = strconv.Itoa(i)
+		rec.Metadata[MetadataPostgresTxSize] = size
+		if err := h.sendNow(ctx, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send the record to the output channel or hold it back until the transaction
+// is committed if groupTransactions is enabled.
 func (h *CDCHandler) send(ctx context.Context, rec sdk.Record) error {
+	if h.groupTransactions {
+		h.pending = append(h.pending, rec)
+		return nil
+	}
+	return h.sendNow(ctx, rec)
+}
+
+// sendNow sends the record to the output channel or detects the cancellation
+// of the context and returns the context error.
+func (h *CDCHandler) sendNow(ctx context.Context, rec sdk.Record) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -178,41 +301,57 @@ func (h *CDCHandler) buildRecord(
 	relation *pglogrepl.RelationMessage,
 	values map[string]pgtype.Value,
 	lsn pglogrepl.LSN,
-) sdk.Record {
+) (sdk.Record, error) {
+	key, err := h.buildRecordKey(values)
+	if err != nil {
+		return sdk.Record{}, err
+	}
+	payload, err := h.buildRecordPayload(values)
+	if err != nil {
+		return sdk.Record{}, err
+	}
 	return sdk.Record{
-		Position: LSNToPosition(lsn),
-		Metadata: map[string]string{
-			"action": string(action),
-			"table":  relation.RelationName,
-		},
+		Position:  LSNToPosition(lsn),
+		Metadata:  h.buildMetadata(action, relation, lsn),
 		CreatedAt: time.Now(),
-		Key:       h.buildRecordKey(values),
-		Payload:   h.buildRecordPayload(values),
-	}
+		Key:       key,
+		Payload:   payload,
+	}, nil
 }
 
 // buildRecordKey takes the values from the message and extracts the key that
-// matches the configured keyColumnName.
-func (h *CDCHandler) buildRecordKey(values map[string]pgtype.Value) sdk.Data {
+// matches the configured keyColumnName. The key is masked like the payload.
+func (h *CDCHandler) buildRecordKey(values map[string]pgtype.Value) (sdk.Data, error) {
 	key := sdk.StructuredData{}
 	for k, v := range values {
 		if h.keyColumn == k {
-			key[k] = v.Get()
+			value, err := h.filter.Mask(k, v.Get())
+			if err != nil {
+				return nil, fmt.Errorf("failed to mask key column %q: %w", k, err)
+			}
+			key[h.filter.Field(k)] = value
 		}
 	}
-	return key
+	return key, nil
 }
 
 // buildRecordPayload takes the values from the message and extracts the payload
-// for the record.
-func (h *CDCHandler) buildRecordPayload(values map[string]pgtype.Value) sdk.Data {
+// for the record. Columns are filtered and masked as configured.
+func (h *CDCHandler) buildRecordPayload(values map[string]pgtype.Value) (sdk.Data, error) {
 	payload := sdk.StructuredData{}
 	for k, v := range values {
-		// filter columns if columns are specified
-		if h.columns == nil || h.columns[k] {
-			value := v.Get()
-			payload[k] = value
+		value, ok, err := h.filter.Apply(k, v.Get())
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		field := h.filter.Field(k)
+		if _, dup := payload[field]; dup {
+			return nil, fmt.Errorf("column %q has the same field name %q as another column", k, field)
 		}
+		payload[field] = value
 	}
-	return payload
+	return payload, nil
 }
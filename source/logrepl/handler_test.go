@@ -0,0 +1,341 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/conduitio/conduit-connector-postgres/fieldname"
+	"github.com/conduitio/conduit-connector-postgres/source/columnfilter"
+	"github.com/conduitio/conduit-connector-postgres/source/logrepl/internal"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgtype"
+	"github.com/matryer/is"
+)
+
+func TestCDCHandler_HandleUpdate_Before(t *testing.T) {
+	ctx := context.Background()
+
+	relation := &pglogrepl.RelationMessage{
+		RelationID:   1,
+		Namespace:    "public",
+		RelationName: "users",
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Name: "id", DataType: pgtype.Int8OID},
+			{Name: "name", DataType: pgtype.TextOID},
+		},
+	}
+	tuple := func(id, name string) *pglogrepl.TupleData {
+		return &pglogrepl.TupleData{Columns: []*pglogrepl.TupleDataColumn{
+			{DataType: pglogrepl.TupleDataTypeText, Data: []byte(id)},
+			{DataType: pglogrepl.TupleDataTypeText, Data: []byte(name)},
+		}}
+	}
+
+	testCases := []struct {
+		name       string
+		msg        *pglogrepl.UpdateMessage
+		wantBefore string
+	}{{
+		name: "replica identity full",
+		msg: &pglogrepl.UpdateMessage{
+			RelationID:   1,
+			OldTupleType: pglogrepl.UpdateMessageTupleTypeOld,
+			OldTuple:     tuple("1", "foo"),
+			NewTuple:     tuple("1", "bar"),
+		},
+		wantBefore: `{"id":1,"name":"foo"}`,
+	}, {
+		name: "replica identity default",
+		msg: &pglogrepl.UpdateMessage{
+			RelationID: 1,
+			NewTuple:   tuple("1", "bar"),
+		},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			out := make(chan sdk.Record, 1)
+			h := NewCDCHandler(
+				internal.NewRelationSet(pgtype.NewConnInfo()),
+				"id",
+				columnfilter.New(columnfilter.Config{}),
+				"",
+				false,
+				false,
+				out,
+			)
+			is.NoErr(h.Handle(ctx, relation, 0))
+			is.NoErr(h.Handle(ctx, tc.msg, 0))
+
+			rec := <-out
+			is.Equal(rec.Payload, sdk.StructuredData{"id": int64(1), "name": "bar"})
+			before, ok := rec.Metadata[MetadataPayloadBefore]
+			is.Equal(ok, tc.wantBefore != "")
+			is.Equal(before, tc.wantBefore)
+		})
+	}
+}
+
+func TestCDCHandler_HandleUpdate_UnchangedToast(t *testing.T) {
+	ctx := context.Background()
+
+	relation := &pglogrepl.RelationMessage{
+		RelationID:   1,
+		Namespace:    "public",
+		RelationName: "documents",
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Name: "id", DataType: pgtype.Int8OID},
+			{Name: "title", DataType: pgtype.TextOID},
+			{Name: "body", DataType: pgtype.TextOID},
+		},
+	}
+	newTuple := &pglogrepl.TupleData{Columns: []*pglogrepl.TupleDataColumn{
+		{DataType: pglogrepl.TupleDataTypeText, Data: []byte("1")},
+		{DataType: pglogrepl.TupleDataTypeText, Data: []byte("new")},
+		{DataType: pglogrepl.TupleDataTypeToast},
+	}}
+	oldTuple := &pglogrepl.TupleData{Columns: []*pglogrepl.TupleDataColumn{
+		{DataType: pglogrepl.TupleDataTypeText, Data: []byte("1")},
+		{DataType: pglogrepl.TupleDataTypeText, Data: []byte("old")},
+		{DataType: pglogrepl.TupleDataTypeText, Data: []byte("large body")},
+	}}
+
+	testCases := []struct {
+		name        string
+		msg         *pglogrepl.UpdateMessage
+		wantPayload sdk.StructuredData
+	}{{
+		name: "replica identity full",
+		msg: &pglogrepl.UpdateMessage{
+			RelationID:   1,
+			OldTupleType: pglogrepl.UpdateMessageTupleTypeOld,
+			OldTuple:     oldTuple,
+			NewTuple:     newTuple,
+		},
+		wantPayload: sdk.StructuredData{"id": int64(1), "title": "new", "body": "large body"},
+	}, {
+		name: "replica identity default",
+		msg: &pglogrepl.UpdateMessage{
+			RelationID: 1,
+			NewTuple:   newTuple,
+		},
+		wantPayload: sdk.StructuredData{"id": int64(1), "title": "new"},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			out := make(chan sdk.Record, 1)
+			h := NewCDCHandler(
+				internal.NewRelationSet(pgtype.NewConnInfo()),
+				"id",
+				columnfilter.New(columnfilter.Config{}),
+				"",
+				false,
+				false,
+				out,
+			)
+			is.NoErr(h.Handle(ctx, relation, 0))
+			is.NoErr(h.Handle(ctx, tc.msg, 0))
+
+			rec := <-out
+			is.Equal(rec.Payload, tc.wantPayload)
+		})
+	}
+}
+
+func TestCDCHandler_FieldNames(t *testing.T) {
+	ctx := context.Background()
+
+	relation := func(columns ...string) *pglogrepl.RelationMessage {
+		rel := &pglogrepl.RelationMessage{
+			RelationID:   1,
+			Namespace:    "public",
+			RelationName: "Users",
+		}
+		for _, c := range columns {
+			rel.Columns = append(rel.Columns, &pglogrepl.RelationMessageColumn{Name: c, DataType: pgtype.TextOID})
+		}
+		return rel
+	}
+	insert := &pglogrepl.InsertMessage{
+		RelationID: 1,
+		Tuple: &pglogrepl.TupleData{Columns: []*pglogrepl.TupleDataColumn{
+			{DataType: pglogrepl.TupleDataTypeText, Data: []byte("1")},
+			{DataType: pglogrepl.TupleDataTypeText, Data: []byte("foo")},
+		}},
+	}
+	newHandler := func(out chan sdk.Record) *CDCHandler {
+		return NewCDCHandler(
+			internal.NewRelationSet(pgtype.NewConnInfo()),
+			"UserID",
+			columnfilter.New(columnfilter.Config{FieldNames: fieldname.ModeSnakeCase}),
+			"",
+			true,
+			false,
+			out,
+		)
+	}
+
+	t.Run("normalized", func(t *testing.T) {
+		is := is.New(t)
+
+		out := make(chan sdk.Record, 1)
+		h := newHandler(out)
+		is.NoErr(h.Handle(ctx, relation("UserID", "FirstName"), 0))
+		is.NoErr(h.Handle(ctx, insert, 0))
+
+		rec := <-out
+		is.Equal(rec.Key, sdk.StructuredData{"user_id": "1"})
+		is.Equal(rec.Payload, sdk.StructuredData{"user_id": "1", "first_name": "foo"})
+	})
+
+	t.Run("same field name", func(t *testing.T) {
+		is := is.New(t)
+
+		h := newHandler(make(chan sdk.Record, 1))
+		is.NoErr(h.Handle(ctx, relation("UserID", "user_id"), 0))
+		err := h.Handle(ctx, insert, 0)
+		is.True(err != nil)
+		is.True(strings.Contains(err.Error(), `has the same field name "user_id" as another column`))
+	})
+
+	t.Run("schema change", func(t *testing.T) {
+		is := is.New(t)
+
+		out := make(chan sdk.Record, 1)
+		h := newHandler(out)
+		is.NoErr(h.Handle(ctx, relation("UserID"), 0))
+		is.NoErr(h.Handle(ctx, relation("UserID", "FirstName"), 0))
+
+		rec := <-out
+		is.Equal(rec.Metadata["schema.added"], "first_name")
+		is.Equal(rec.Payload, sdk.StructuredData{"user_id": "text", "first_name": "text"})
+	})
+}
+
+func TestCDCHandler_MaskKey(t *testing.T) {
+	ctx := context.Background()
+
+	relation := &pglogrepl.RelationMessage{
+		RelationID:   1,
+		Namespace:    "public",
+		RelationName: "users",
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Name: "email", DataType: pgtype.TextOID},
+			{Name: "name", DataType: pgtype.TextOID},
+		},
+	}
+	insert := &pglogrepl.InsertMessage{
+		RelationID: 1,
+		Tuple: &pglogrepl.TupleData{Columns: []*pglogrepl.TupleDataColumn{
+			{DataType: pglogrepl.TupleDataTypeText, Data: []byte("john@example.com")},
+			{DataType: pglogrepl.TupleDataTypeText, Data: []byte("john")},
+		}},
+	}
+
+	testCases := []struct {
+		name    string
+		config  columnfilter.Config
+		wantKey sdk.StructuredData
+	}{{
+		name:    "hashed",
+		config:  columnfilter.Config{Hash: []string{"email"}},
+		wantKey: sdk.StructuredData{"email": "855f96e983f1f8e8be944692b6f719fd54329826cb62e98015efee8e2e071dd4"},
+	}, {
+		name:    "redacted",
+		config:  columnfilter.Config{Redact: []string{"email"}},
+		wantKey: sdk.StructuredData{"email": nil},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			out := make(chan sdk.Record, 1)
+			h := NewCDCHandler(
+				internal.NewRelationSet(pgtype.NewConnInfo()),
+				"email",
+				columnfilter.New(tc.config),
+				"",
+				false,
+				false,
+				out,
+			)
+			is.NoErr(h.Handle(ctx, relation, 0))
+			is.NoErr(h.Handle(ctx, insert, 0))
+
+			rec := <-out
+			is.Equal(rec.Key, tc.wantKey)
+			is.Equal(rec.Payload.(sdk.StructuredData)["email"], tc.wantKey["email"])
+		})
+	}
+}
+
+func TestCDCHandler_GroupTransactions(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	relation := &pglogrepl.RelationMessage{
+		RelationID:   1,
+		Namespace:    "public",
+		RelationName: "users",
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Name: "id", DataType: pgtype.Int8OID},
+		},
+	}
+	insert := func(id string) *pglogrepl.InsertMessage {
+		return &pglogrepl.InsertMessage{
+			RelationID: 1,
+			Tuple: &pglogrepl.TupleData{Columns: []*pglogrepl.TupleDataColumn{
+				{DataType: pglogrepl.TupleDataTypeText, Data: []byte(id)},
+			}},
+		}
+	}
+
+	out := make(chan sdk.Record, 2)
+	h := NewCDCHandler(
+		internal.NewRelationSet(pgtype.NewConnInfo()),
+		"id",
+		columnfilter.New(columnfilter.Config{}),
+		"",
+		false,
+		true,
+		out,
+	)
+	is.NoErr(h.Handle(ctx, &pglogrepl.BeginMessage{Xid: 42}, 0))
+	is.NoErr(h.Handle(ctx, relation, 0))
+	is.NoErr(h.Handle(ctx, insert("1"), 1))
+	is.NoErr(h.Handle(ctx, insert("2"), 2))
+	is.Equal(len(out), 0) // held back until commit
+
+	is.NoErr(h.Handle(ctx, &pglogrepl.CommitMessage{}, 3))
+	is.Equal(len(out), 2)
+	for i := 0; i < 2; i++ {
+		rec := <-out
+		is.Equal(rec.Key, sdk.StructuredData{"id": int64(i + 1)})
+		is.Equal(rec.Metadata[MetadataPostgresXID], "42")
+		is.Equal(rec.Metadata[MetadataPostgresTxIndex], strconv.Itoa(i))
+		is.Equal(rec.Metadata[MetadataPostgresTxSize], "2")
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Values of pg_class.relreplident.
+const (
+	replicaIdentityDefault = "d"
+	replicaIdentityNothing = "n"
+	replicaIdentityFull    = "f"
+	replicaIdentityIndex   = "i"
+)
+
+// replicaIdentity describes which old values Postgres writes to the WAL for
+// updates and deletes of a table.
+type replicaIdentity struct {
+	// kind is the value of pg_class.relreplident.
+	kind string
+	// index is the name of the index used as the replica identity, it is
+	// only set if kind is replicaIdentityIndex.
+	index string
+	// columns are the columns contained in the old values of updates and
+	// deletes, i.e. the columns of the primary key with the default identity
+	// or the columns of the index. It is empty for a full identity.
+	columns []string
+}
+
+// ensureReplicaIdentity changes the replica identity of the table if
+// configured and checks that updates and deletes contain the key column.
+func (i *CDCIterator) ensureReplicaIdentity(ctx context.Context, conn *pgx.Conn) error {
+	table := pgx.Identifier{i.config.TableName}.Sanitize()
+	ident, err := getReplicaIdentity(ctx, conn, table)
+	if err != nil {
+		return err
+	}
+
+	var alter string
+	switch {
+	case i.config.ReplicaIdentityFull && ident.kind != replicaIdentityFull:
+		alter = "FULL"
+	case i.config.ReplicaIdentityIndex != "" &&
+		(ident.kind != replicaIdentityIndex || ident.index != i.config.ReplicaIdentityIndex):
+		alter = "USING INDEX " + pgx.Identifier{i.config.ReplicaIdentityIndex}.Sanitize()
+	}
+	if alter != "" {
+		sdk.Logger(ctx).Info().
+			Str("table", i.config.TableName).
+			Str("replicaIdentity", alter).
+			Msg("changing replica identity of table")
+		if _, err := conn.Exec(ctx, fmt.Sprintf("ALTER TABLE %s REPLICA IDENTITY %s", table, alter)); err != nil {
+			return fmt.Errorf("failed to change replica identity of table %s: %w", i.config.TableName, err)
+		}
+		if ident, err = getReplicaIdentity(ctx, conn, table); err != nil {
+			return err
+		}
+	}
+
+	if !i.config.CheckReplicaIdentity {
+		return nil
+	}
+	return checkReplicaIdentity(i.config.TableName, i.keyColumn, ident)
+}
+
+// getReplicaIdentity queries the replica identity of the table.
+func getReplicaIdentity(ctx context.Context, conn *pgx.Conn, table string) (replicaIdentity, error) {
+	query := `SELECT c.relreplident::text,
+			COALESCE((SELECT ic.relname
+				FROM pg_index ix JOIN pg_class ic ON ic.oid = ix.indexrelid
+				WHERE ix.indrelid = c.oid AND ix.indisreplident), ''),
+			COALESCE((SELECT array_agg(a.attname::text)
+				FROM pg_index ix JOIN pg_attribute a
+					ON a.attrelid = ix.indrelid AND a.attnum = ANY(ix.indkey)
+				WHERE ix.indrelid = c.oid AND
+					CASE c.relreplident WHEN 'i' THEN ix.indisreplident ELSE ix.indisprimary END),
+				'{}')
+		FROM pg_class c
+		WHERE c.oid = $1::regclass`
+
+	var ident replicaIdentity
+	err := conn.QueryRow(ctx, query, table).Scan(&ident.kind, &ident.index, &ident.columns)
+	if err != nil {
+		return replicaIdentity{}, fmt.Errorf("failed to query replica identity of table %s: %w", table, err)
+	}
+	if ident.kind == replicaIdentityFull {
+		ident.columns = nil
+	}
+	return ident, nil
+}
+
+// checkReplicaIdentity returns an error if updates and deletes of the table
+// don't contain the key column with the replica identity.
+func checkReplicaIdentity(table, keyColumn string, ident replicaIdentity) error {
+	const hint = `set "logrepl.replicaIdentity" to "full" or "index" or add a primary key`
+	switch ident.kind {
+	case replicaIdentityFull:
+		return nil
+	case replicaIdentityNothing:
+		return fmt.Errorf("table %s has replica identity NOTHING, updates and deletes don't contain the key column %q (%s)", table, keyColumn, hint)
+	case replicaIdentityDefault:
+		if len(ident.columns) == 0 {
+			return fmt.Errorf("table %s has replica identity DEFAULT but no primary key, updates and deletes don't contain the key column %q (%s)", table, keyColumn, hint)
+		}
+	case replicaIdentityIndex:
+		if len(ident.columns) == 0 {
+			return fmt.Errorf("table %s has replica identity USING INDEX but the index doesn't exist (%s)", table, hint)
+		}
+	default:
+		return fmt.Errorf("table %s has unknown replica identity %q", table, ident.kind)
+	}
+	for _, c := range ident.columns {
+		if c == keyColumn {
+			return nil
+		}
+	}
+	return fmt.Errorf("replica identity of table %s contains columns %v but not the key column %q, updates and deletes don't contain the key (%s)", table, ident.columns, keyColumn, hint)
+}
+
+// codeUndefinedColumn is the SQLSTATE of references to unknown columns.
+const codeUndefinedColumn = "42703"
+
+// checkRowFilter returns an error if the row filter of the table references
+// columns outside of its replica identity. Postgres only accepts such filters
+// in publications of updates and deletes with a full replica identity and
+// otherwise fails the updates and deletes of the table, not the creation of
+// the publication. The filter is checked by evaluating it against the
+// replica identity columns only.
+func checkRowFilter(ctx context.Context, conn *pgx.Conn, table, filter string, ident replicaIdentity) error {
+	const hint = `set "logrepl.replicaIdentity" to "full" or only reference columns of the replica identity`
+	if ident.kind == replicaIdentityFull {
+		return nil
+	}
+	if len(ident.columns) == 0 {
+		return fmt.Errorf("filter of table %s requires a replica identity, the table has none (%s)", table, hint)
+	}
+
+	_, err := conn.Exec(ctx, rowFilterCheckQuery(table, filter, ident.columns))
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == codeUndefinedColumn {
+		return fmt.Errorf("filter of table %s references columns outside of its replica identity %v, updates and deletes of the table would fail (%s): %w", table, ident.columns, hint, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check filter of table %s: %w", table, err)
+	}
+	return nil
+}
+
+// rowFilterCheckQuery returns a query that evaluates the filter against the
+// columns only, the columns are selected under the name of the table so
+// qualified column references resolve as well.
+func rowFilterCheckQuery(table, filter string, columns []string) string {
+	sanitized := make([]string, len(columns))
+	for i, c := range columns {
+		sanitized[i] = pgx.Identifier{c}.Sanitize()
+	}
+	ident := pgx.Identifier{table}.Sanitize()
+	return fmt.Sprintf("SELECT 1 FROM (SELECT %s FROM %s LIMIT 0) AS %s WHERE (%s)",
+		strings.Join(sanitized, ", "), ident, ident, filter)
+}
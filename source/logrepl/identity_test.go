@@ -0,0 +1,82 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestCheckReplicaIdentity(t *testing.T) {
+	testCases := []struct {
+		name    string
+		ident   replicaIdentity
+		wantErr bool
+	}{{
+		name:  "full",
+		ident: replicaIdentity{kind: replicaIdentityFull},
+	}, {
+		name:  "default with primary key",
+		ident: replicaIdentity{kind: replicaIdentityDefault, columns: []string{"id"}},
+	}, {
+		name:    "default without primary key",
+		ident:   replicaIdentity{kind: replicaIdentityDefault},
+		wantErr: true,
+	}, {
+		name:    "default with other primary key",
+		ident:   replicaIdentity{kind: replicaIdentityDefault, columns: []string{"other"}},
+		wantErr: true,
+	}, {
+		name:    "nothing",
+		ident:   replicaIdentity{kind: replicaIdentityNothing},
+		wantErr: true,
+	}, {
+		name:  "index",
+		ident: replicaIdentity{kind: replicaIdentityIndex, index: "idx", columns: []string{"tenant", "id"}},
+	}, {
+		name:    "dropped index",
+		ident:   replicaIdentity{kind: replicaIdentityIndex},
+		wantErr: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			err := checkReplicaIdentity("users", "id", tc.ident)
+			is.Equal(err != nil, tc.wantErr)
+		})
+	}
+}
+
+func TestCheckRowFilter_WithoutReplicaIdentity(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	// a full replica identity allows any filter
+	is.NoErr(checkRowFilter(ctx, nil, "orders", "status <> 'draft'", replicaIdentity{kind: replicaIdentityFull}))
+
+	err := checkRowFilter(ctx, nil, "orders", "status <> 'draft'", replicaIdentity{kind: replicaIdentityNothing})
+	is.True(err != nil)
+}
+
+func TestRowFilterCheckQuery(t *testing.T) {
+	is := is.New(t)
+	is.Equal(
+		rowFilterCheckQuery("orders", "status <> 'draft'", []string{"id", "tenant"}),
+		`SELECT 1 FROM (SELECT "id", "tenant" FROM "orders" LIMIT 0) AS "orders" WHERE (status <> 'draft')`,
+	)
+}
@@ -30,6 +30,9 @@ type CreatePublicationOptions struct {
 	AllTables         bool
 	Tables            []string
 	PublicationParams []string
+	// RowFilters maps tables to the WHERE expression rows need to match to be
+	// published, it requires Postgres 15 or newer.
+	RowFilters map[string]string
 }
 
 // CreatePublication creates a publication.
@@ -42,7 +45,14 @@ func CreatePublication(ctx context.Context, conn *pgconn.PgConn, publicationName
 	if options.AllTables {
 		forTableString = "FOR ALL TABLES"
 	} else if len(options.Tables) > 0 {
-		forTableString = fmt.Sprintf("FOR TABLE %s", strings.Join(options.Tables, ", "))
+		tables := make([]string, len(options.Tables))
+		for i, table := range options.Tables {
+			tables[i] = table
+			if filter := options.RowFilters[table]; filter != "" {
+				tables[i] += fmt.Sprintf(" WHERE (%s)", filter)
+			}
+		}
+		forTableString = fmt.Sprintf("FOR TABLE %s", strings.Join(tables, ", "))
 	}
 
 	var publicationParams string
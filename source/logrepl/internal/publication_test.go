@@ -94,6 +94,39 @@ func TestCreatePublicationForTables(t *testing.T) {
 	}
 }
 
+func TestCreatePublicationRowFilters(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+	pub := test.RandomIdentifier(t)
+	conn := test.ConnectSimple(ctx, t, test.RegularConnString)
+	table := test.SetupTestTable(ctx, t, conn)
+
+	var version int
+	is.NoErr(conn.QueryRow(ctx, "SELECT current_setting('server_version_num')::int").Scan(&version))
+	if version < 150000 {
+		t.Skip("row filters require Postgres 15")
+	}
+
+	err := CreatePublication(
+		ctx,
+		conn.PgConn(),
+		pub,
+		CreatePublicationOptions{
+			Tables:     []string{table},
+			RowFilters: map[string]string{table: "column2 > 200"},
+		},
+	)
+	is.NoErr(err)
+	defer func() {
+		is.NoErr(DropPublication(ctx, conn.PgConn(), pub, DropPublicationOptions{}))
+	}()
+
+	var rowFilter string
+	err = conn.QueryRow(ctx, "SELECT rowfilter FROM pg_publication_tables WHERE pubname = $1", pub).Scan(&rowFilter)
+	is.NoErr(err)
+	is.Equal(rowFilter, "(column2 > 200)")
+}
+
 func TestCreatePublicationForTablesAndAllTables(t *testing.T) {
 	ctx := context.Background()
 	is := is.New(t)
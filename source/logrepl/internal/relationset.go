@@ -16,6 +16,7 @@ package internal
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/conduitio/conduit-connector-postgres/pgutil"
 	"github.com/jackc/pglogrepl"
@@ -37,8 +38,12 @@ func NewRelationSet(ci *pgtype.ConnInfo) *RelationSet {
 	}
 }
 
-func (rs *RelationSet) Add(r *pglogrepl.RelationMessage) {
+// Add stores the relation and returns the relation it replaced, or nil if the
+// relation wasn't known yet.
+func (rs *RelationSet) Add(r *pglogrepl.RelationMessage) *pglogrepl.RelationMessage {
+	old := rs.relations[pgtype.OID(r.RelationID)]
 	rs.relations[pgtype.OID(r.RelationID)] = r
+	return old
 }
 
 func (rs *RelationSet) Get(id pgtype.OID) (*pglogrepl.RelationMessage, error) {
@@ -49,6 +54,17 @@ func (rs *RelationSet) Get(id pgtype.OID) (*pglogrepl.RelationMessage, error) {
 	return msg, nil
 }
 
+// TypeName returns the name of the type with the OID or the OID itself if the
+// type is unknown.
+func (rs *RelationSet) TypeName(id pgtype.OID) string {
+	if dt, ok := rs.connInfo.DataTypeForOID(uint32(id)); ok {
+		return dt.Name
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// Values decodes the values of the row. Unchanged TOASTed values are not sent
+// by Postgres, their columns are missing in the returned map.
 func (rs *RelationSet) Values(id pgtype.OID, row *pglogrepl.TupleData) (map[string]pgtype.Value, error) {
 	rel, err := rs.Get(id)
 	if err != nil {
@@ -60,6 +76,9 @@ func (rs *RelationSet) Values(id pgtype.OID, row *pglogrepl.TupleData) (map[stri
 	// assert same number of row and rel columns
 	for i, tuple := range row.Columns {
 		col := rel.Columns[i]
+		if tuple.DataType == pglogrepl.TupleDataTypeToast {
+			continue
+		}
 		decoder := rs.oidToDecoderValue(pgtype.OID(col.DataType))
 
 		if err := decoder.DecodeText(rs.connInfo, tuple.Data); err != nil {
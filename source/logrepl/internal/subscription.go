@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -34,18 +35,39 @@ const (
 
 // Subscription manages a subscription to a logical replication slot.
 type Subscription struct {
-	ConnConfig    pgconn.Config
-	SlotName      string
-	Publication   string
-	Tables        []string
-	StartLSN      pglogrepl.LSN
+	ConnConfig  pgconn.Config
+	SlotName    string
+	Publication string
+	Tables      []string
+	// RowFilters maps tables to the WHERE expression of the table in the
+	// publication. It's only used if the publication is created.
+	RowFilters map[string]string
+	StartLSN   pglogrepl.LSN
+	// StopLSN stops the subscription once all transactions committed at or
+	// before it were handled, it keeps running if StopLSN is 0.
+	StopLSN       pglogrepl.LSN
 	Handler       Handler
 	StatusTimeout time.Duration
+	// SnapshotHandler is called with the name of the snapshot exported when
+	// the replication slot is created, before replication is started. The
+	// snapshot can only be imported until the handler returns. It is not
+	// called if the replication slot already exists.
+	SnapshotHandler SnapshotHandler
 
 	stop    context.CancelFunc
 	ready   chan struct{}
 	done    chan struct{}
 	doneErr error
+	// stopLSNReached is true if the subscription stopped because it reached
+	// StopLSN.
+	stopLSNReached bool
+	// inTx is true while the messages of a transaction are handled.
+	inTx bool
+	// handling is true while the handler runs, status updates are sent by
+	// sendStatusWhileHandling in the meantime, see handle. It's guarded by
+	// statusMu, which is held while such a status update is sent.
+	handling bool
+	statusMu sync.Mutex
 
 	// cleanup is the function that gets called on teardown.
 	// Cleanup functions that get added here on initialization act as deferred
@@ -54,10 +76,22 @@ type Subscription struct {
 
 	walWritten pglogrepl.LSN
 	walFlushed pglogrepl.LSN
+	// serverWALEnd is the last known end of the WAL on the server, it's
+	// updated on every message received from the server.
+	serverWALEnd pglogrepl.LSN
+	// firstWALEnd is the end of the WAL on the server when the first message
+	// was received, used as the baseline for the lag until an LSN is acked.
+	firstWALEnd pglogrepl.LSN
 }
 
+// errStopLSNReached is returned internally to stop the subscription once it
+// reached StopLSN.
+var errStopLSNReached = errors.New("reached stop LSN")
+
 type Handler func(context.Context, pglogrepl.Message, pglogrepl.LSN) error
 
+type SnapshotHandler func(ctx context.Context, snapshotName string) error
+
 func NewSubscription(
 	config pgconn.Config,
 	slotName,
@@ -128,13 +162,34 @@ func (s *Subscription) Start(ctx context.Context) (err error) {
 	s.walWritten = s.StartLSN
 	s.walFlushed = s.StartLSN
 
-	return s.listen(lctx, conn)
+	err = s.listen(lctx, conn)
+	if errors.Is(err, errStopLSNReached) {
+		sdk.Logger(ctx).Info().
+			Str("stopLSN", s.StopLSN.String()).
+			Msg("reached stop LSN, stopping logical replication")
+		s.stopLSNReached = true
+		return nil
+	}
+	return err
 }
 
 // listen runs until context is cancelled or an error is encountered.
 func (s *Subscription) listen(ctx context.Context, conn *pgconn.PgConn) error {
 	// signal that the subscription is ready and is receiving messages
 	close(s.ready)
+
+	statusCtx, stopStatus := context.WithCancel(ctx)
+	statusDone := make(chan struct{})
+	go func() {
+		defer close(statusDone)
+		s.sendStatusWhileHandling(statusCtx, conn)
+	}()
+	defer func() {
+		// the connection is used by the cleanup once listen returns
+		stopStatus()
+		<-statusDone
+	}()
+
 	nextStatusUpdateAt := time.Now().Add(s.StatusTimeout)
 	for {
 		if time.Now().After(nextStatusUpdateAt) {
@@ -191,6 +246,12 @@ func (s *Subscription) handlePrimaryKeepaliveMessage(ctx context.Context, conn *
 	if err != nil {
 		return fmt.Errorf("failed to parse primary keepalive message: %w", err)
 	}
+	s.storeServerWALEnd(pkm.ServerWALEnd)
+	if s.StopLSN > 0 && !s.inTx && pkm.ServerWALEnd > s.StopLSN {
+		// the server already sent everything up to the end of the WAL, no
+		// transaction committed at or before StopLSN is left
+		return errStopLSNReached
+	}
 	if pkm.ReplyRequested {
 		if err = s.sendStandbyStatusUpdate(ctx, conn); err != nil {
 			return fmt.Errorf("failed to send status: %w", err)
@@ -207,6 +268,8 @@ func (s *Subscription) handleXLogData(ctx context.Context, copyDataMsg *pgproto3
 		return fmt.Errorf("failed to parse xlog data: %w", err)
 	}
 
+	s.storeServerWALEnd(xld.ServerWALEnd)
+
 	if xld.WALStart > 0 && xld.WALStart <= s.StartLSN {
 		// skip stuff that's in the past
 		return nil
@@ -216,8 +279,18 @@ func (s *Subscription) handleXLogData(ctx context.Context, copyDataMsg *pgproto3
 	if err != nil {
 		return fmt.Errorf("invalid message: %w", err)
 	}
+	switch m := logicalMsg.(type) {
+	case *pglogrepl.BeginMessage:
+		if s.StopLSN > 0 && m.FinalLSN > s.StopLSN {
+			// the transaction is committed after StopLSN
+			return errStopLSNReached
+		}
+		s.inTx = true
+	case *pglogrepl.CommitMessage:
+		s.inTx = false
+	}
 
-	if err = s.Handler(ctx, logicalMsg, xld.WALStart); err != nil {
+	if err = s.handle(ctx, logicalMsg, xld.WALStart); err != nil {
 		return fmt.Errorf("handler error: %w", err)
 	}
 
@@ -227,6 +300,47 @@ func (s *Subscription) handleXLogData(ctx context.Context, copyDataMsg *pgproto3
 	return nil
 }
 
+// handle calls the handler. The handler can block for a long time, e.g. while
+// the snapshot is read the records of changes aren't consumed. The loop in
+// listen is blocked as well, so status updates are sent by
+// sendStatusWhileHandling until the handler returns, otherwise the server
+// would close the connection once wal_sender_timeout is exceeded.
+func (s *Subscription) handle(ctx context.Context, msg pglogrepl.Message, lsn pglogrepl.LSN) error {
+	s.statusMu.Lock()
+	s.handling = true
+	s.statusMu.Unlock()
+	defer func() {
+		// waits for a status update that is being sent, listen uses the
+		// connection again once handle returns
+		s.statusMu.Lock()
+		s.handling = false
+		s.statusMu.Unlock()
+	}()
+	return s.Handler(ctx, msg, lsn)
+}
+
+// sendStatusWhileHandling sends a status update every StatusTimeout while the
+// handler runs, see handle. It runs until the context is canceled.
+func (s *Subscription) sendStatusWhileHandling(ctx context.Context, conn *pgconn.PgConn) {
+	ticker := time.NewTicker(s.StatusTimeout)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.statusMu.Lock()
+		if s.handling {
+			if err := s.sendStandbyStatusUpdate(ctx, conn); err != nil {
+				// listen returns the error of the broken connection
+				sdk.Logger(ctx).Warn().Err(err).Msg("failed to send status update while handling a message")
+			}
+		}
+		s.statusMu.Unlock()
+	}
+}
+
 // Ack stores the LSN as flushed. Next time WAL positions are flushed, Postgres
 // will know it can purge WAL logs up to this LSN.
 func (s *Subscription) Ack(lsn pglogrepl.LSN) {
@@ -234,6 +348,32 @@ func (s *Subscription) Ack(lsn pglogrepl.LSN) {
 	atomic.StoreUint64((*uint64)(&s.walFlushed), uint64(lsn))
 }
 
+// storeServerWALEnd stores the end of the WAL as reported by the server.
+func (s *Subscription) storeServerWALEnd(lsn pglogrepl.LSN) {
+	if lsn == 0 {
+		return
+	}
+	atomic.CompareAndSwapUint64((*uint64)(&s.firstWALEnd), 0, uint64(lsn))
+	// store with atomic to prevent race conditions with Lag
+	atomic.StoreUint64((*uint64)(&s.serverWALEnd), uint64(lsn))
+}
+
+// Lag returns the number of WAL bytes between the end of the WAL on the server
+// and the last acked LSN. Postgres needs to retain these bytes until they are
+// acked. If nothing was acked yet, the lag is measured from the end of the WAL
+// at the time the subscription received its first message.
+func (s *Subscription) Lag() uint64 {
+	serverWALEnd := atomic.LoadUint64((*uint64)(&s.serverWALEnd))
+	walFlushed := atomic.LoadUint64((*uint64)(&s.walFlushed))
+	if walFlushed == 0 {
+		walFlushed = atomic.LoadUint64((*uint64)(&s.firstWALEnd))
+	}
+	if serverWALEnd <= walFlushed {
+		return 0
+	}
+	return serverWALEnd - walFlushed
+}
+
 // Stop signals to the subscription it should stop. Call Wait to block until the
 // subscription actually stops running.
 func (s *Subscription) Stop() {
@@ -254,6 +394,12 @@ func (s *Subscription) Wait(ctx context.Context) error {
 	}
 }
 
+// StopLSNReached returns true if the subscription stopped because it reached
+// StopLSN. It should be called after the subscription is done.
+func (s *Subscription) StopLSNReached() bool {
+	return s.stopLSNReached
+}
+
 // Ready returns a channel that is closed when the subscription is ready and
 // receiving messages.
 func (s *Subscription) Ready() <-chan struct{} {
@@ -304,7 +450,7 @@ func (s *Subscription) createPublication(ctx context.Context, conn *pgconn.PgCon
 		ctx,
 		conn,
 		s.Publication,
-		CreatePublicationOptions{Tables: s.Tables},
+		CreatePublicationOptions{Tables: s.Tables, RowFilters: s.RowFilters},
 	); err != nil {
 		// If creating the publication fails with code 42710, this means
 		// the publication already exists.
@@ -327,7 +473,8 @@ func (s *Subscription) createPublication(ctx context.Context, conn *pgconn.PgCon
 
 // createReplicationSlot creates a temporary replication slot which will be
 // deleted once the connection is closed. If a replication slot with that name
-// already exists it returns no error.
+// already exists it returns no error. If the slot is created, the exported
+// snapshot is passed to the snapshot handler.
 func (s *Subscription) createReplicationSlot(ctx context.Context, conn *pgconn.PgConn) error {
 	result, err := pglogrepl.CreateReplicationSlot(
 		ctx,
@@ -347,8 +494,15 @@ func (s *Subscription) createReplicationSlot(ctx context.Context, conn *pgconn.P
 		if !errors.As(err, &pgerr) || pgerr.Code != pgDuplicateObjectErrorCode {
 			return err
 		}
+		return nil
+	}
+	if s.SnapshotHandler != nil {
+		// the snapshot is valid until the next command is executed on the
+		// replication connection
+		if err := s.SnapshotHandler(ctx, result.SnapshotName); err != nil {
+			return fmt.Errorf("snapshot handler error: %w", err)
+		}
 	}
-	_ = result // TODO use returned snapshot name to start snapshot iterator
 	return nil
 }
 
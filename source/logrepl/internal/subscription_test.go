@@ -15,15 +15,20 @@
 package internal
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"net"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/conduitio/conduit-connector-postgres/test"
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgproto3/v2"
 	"github.com/matryer/is"
 )
 
@@ -161,6 +166,142 @@ func TestSubscriptionClosedContext(t *testing.T) {
 	isNoMoreMessages(t, messages, time.Millisecond*500)
 }
 
+func TestSubscriptionStopLSN(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	var handled []pglogrepl.MessageType
+	sub := NewSubscription(pgconn.Config{}, "", "", nil, 0,
+		func(_ context.Context, m pglogrepl.Message, _ pglogrepl.LSN) error {
+			handled = append(handled, m.Type())
+			return nil
+		},
+	)
+	sub.StopLSN = 0x200
+
+	// transaction committed at the stop LSN
+	is.NoErr(sub.handleXLogData(ctx, xLogData(0x100, beginMessage(0x200))))
+	is.NoErr(sub.handleXLogData(ctx, xLogData(0x200, commitMessage(0x200))))
+	// keepalive while the server is still decoding the WAL before the stop LSN
+	is.NoErr(sub.handlePrimaryKeepaliveMessage(ctx, nil, keepaliveMessage(0x200)))
+
+	// transaction committed after the stop LSN
+	err := sub.handleXLogData(ctx, xLogData(0x300, beginMessage(0x400)))
+	is.True(errors.Is(err, errStopLSNReached))
+	is.Equal(handled, []pglogrepl.MessageType{pglogrepl.MessageTypeBegin, pglogrepl.MessageTypeCommit})
+
+	// the server decoded the WAL past the stop LSN
+	err = sub.handlePrimaryKeepaliveMessage(ctx, nil, keepaliveMessage(0x201))
+	is.True(errors.Is(err, errStopLSNReached))
+}
+
+func TestListen_StatusWhileHandling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	is := is.New(t)
+
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close()
+	conn, err := pgconn.Construct(&pgconn.HijackedConn{
+		Conn:     clientConn,
+		Frontend: pgproto3.NewFrontend(pgproto3.NewChunkReader(clientConn), clientConn),
+		Config:   &pgconn.Config{},
+	})
+	is.NoErr(err)
+
+	// the server counts the status updates sent by the subscription
+	var statusUpdates int32
+	go func() {
+		backend := pgproto3.NewBackend(pgproto3.NewChunkReader(serverConn), serverConn)
+		for {
+			msg, err := backend.Receive()
+			if err != nil {
+				return
+			}
+			if cd, ok := msg.(*pgproto3.CopyData); ok && cd.Data[0] == pglogrepl.StandbyStatusUpdateByteID {
+				atomic.AddInt32(&statusUpdates, 1)
+			}
+		}
+	}()
+
+	// the handler blocks like the handler of the CDC iterator while the
+	// snapshot is read, longer than the status timeout
+	handled := make(chan int32)
+	sub := NewSubscription(pgconn.Config{}, "", "", nil, 0,
+		func(ctx context.Context, _ pglogrepl.Message, _ pglogrepl.LSN) error {
+			time.Sleep(250 * time.Millisecond)
+			handled <- atomic.LoadInt32(&statusUpdates)
+			return nil
+		},
+	)
+	sub.StatusTimeout = 50 * time.Millisecond
+	go func() {
+		_ = sub.listen(ctx, conn)
+	}()
+
+	msg := xLogData(0x100, beginMessage(0x200))
+	_, err = serverConn.Write(msg.Encode(nil))
+	is.NoErr(err)
+
+	select {
+	case n := <-handled:
+		is.True(n >= 3) // status updates were sent while the handler blocked
+	case <-time.After(time.Second):
+		is.Fail() // timeout while waiting for the handler
+	}
+}
+
+// xLogData returns an XLogData copy data message containing the logical
+// replication message.
+func xLogData(walStart pglogrepl.LSN, msg []byte) *pgproto3.CopyData {
+	return &pgproto3.CopyData{Data: encode(
+		byte(pglogrepl.XLogDataByteID),
+		walStart,
+		walStart,  // server WAL end
+		uint64(0), // server time
+		msg,
+	)}
+}
+
+func beginMessage(finalLSN pglogrepl.LSN) []byte {
+	return encode(
+		byte(pglogrepl.MessageTypeBegin),
+		finalLSN,
+		uint64(0), // commit time
+		uint32(1), // xid
+	)
+}
+
+func commitMessage(commitLSN pglogrepl.LSN) []byte {
+	return encode(
+		byte(pglogrepl.MessageTypeCommit),
+		uint8(0), // flags
+		commitLSN,
+		commitLSN+1, // end LSN
+		uint64(0),   // commit time
+	)
+}
+
+func keepaliveMessage(serverWALEnd pglogrepl.LSN) *pgproto3.CopyData {
+	return &pgproto3.CopyData{Data: encode(
+		byte(pglogrepl.PrimaryKeepaliveMessageByteID),
+		serverWALEnd,
+		uint64(0), // server time
+		uint8(0),  // reply requested
+	)}
+}
+
+// encode returns the values encoded in network byte order.
+func encode(values ...interface{}) []byte {
+	var buf bytes.Buffer
+	for _, v := range values {
+		if err := binary.Write(&buf, binary.BigEndian, v); err != nil {
+			panic(err)
+		}
+	}
+	return buf.Bytes()
+}
+
 func setupSubscription(
 	ctx context.Context,
 	t *testing.T,
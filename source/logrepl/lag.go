@@ -0,0 +1,265 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgx/v4"
+)
+
+// lagCheckInterval is the interval in which the replication lag is checked.
+const lagCheckInterval = 10 * time.Second
+
+// lagMonitor detects a replication lag that stays above a threshold for a
+// sustained amount of time.
+type lagMonitor struct {
+	threshold uint64
+	duration  time.Duration
+
+	// exceededSince is the time when the lag first exceeded the threshold, it
+	// is zero if the lag is below the threshold.
+	exceededSince time.Time
+	// alerted is true if an alert was raised since the lag exceeded the
+	// threshold.
+	alerted bool
+}
+
+// observe records the lag at the given time and returns true if the lag has
+// been above the threshold for at least the configured duration. While the lag
+// stays above the threshold, it returns true once per duration.
+func (m *lagMonitor) observe(now time.Time, lag uint64) bool {
+	if lag < m.threshold {
+		m.exceededSince = time.Time{}
+		return false
+	}
+	if m.exceededSince.IsZero() {
+		m.exceededSince = now
+	}
+	if now.Sub(m.exceededSince) < m.duration {
+		return false
+	}
+	// restart the window so the alert is repeated while the lag persists
+	m.exceededSince = now
+	m.alerted = true
+	return true
+}
+
+// recovered returns true once after the lag dropped below the threshold
+// following an alert.
+func (m *lagMonitor) recovered() bool {
+	if !m.alerted || !m.exceededSince.IsZero() {
+		return false
+	}
+	m.alerted = false
+	return true
+}
+
+// SlotStats contains the health of the replication slot as observed by the
+// last check.
+type SlotStats struct {
+	// Lag is the number of WAL bytes between the end of the WAL on the server
+	// and the last acked position.
+	Lag uint64
+	// RetainedBytes is the number of WAL bytes the server retains for the
+	// slot, i.e. the distance between the end of the WAL and the restart LSN
+	// of the slot.
+	RetainedBytes int64
+	// Active is true if a connection is currently streaming from the slot.
+	Active bool
+	// CheckedAt is the time of the check, it is zero if the slot wasn't
+	// checked yet.
+	CheckedAt time.Time
+}
+
+// Fields returns the stats as fields of the stats log line, see stats.Logger.
+// It returns no fields if the slot wasn't checked yet.
+func (s SlotStats) Fields() map[string]interface{} {
+	if s.CheckedAt.IsZero() {
+		return nil
+	}
+	return map[string]interface{}{
+		"slotLag":           s.Lag,
+		"slotRetainedBytes": s.RetainedBytes,
+		"slotActive":        s.Active,
+		"slotCheckedAt":     s.CheckedAt,
+	}
+}
+
+// SlotStats returns the health of the replication slot as observed by the
+// last check. The slot is checked every 10 seconds.
+func (i *CDCIterator) SlotStats() SlotStats {
+	stats, _ := i.slotStats.Load().(SlotStats)
+	return stats
+}
+
+// monitorSlot periodically checks the replication lag of the subscription and
+// the WAL retained by the replication slot and stores them so they can be
+// retrieved with SlotStats. If the lag or retained WAL exceed the configured
+// threshold for the configured duration, a warning including a snapshot of
+// the replication stats is logged. It should be called in a goroutine and
+// returns when the subscription is done or the context is canceled.
+func (i *CDCIterator) monitorSlot(ctx context.Context, conn *pgx.Conn) {
+	m := &lagMonitor{
+		threshold: i.config.LagThreshold,
+		duration:  i.config.LagDuration,
+	}
+	rm := &lagMonitor{
+		threshold: i.config.RetentionThreshold,
+		duration:  i.config.LagDuration,
+	}
+
+	ticker := time.NewTicker(lagCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-i.sub.Done():
+			return
+		case now := <-ticker.C:
+			lag := i.sub.Lag()
+			stats := SlotStats{Lag: lag, CheckedAt: now}
+			var err error
+			stats.RetainedBytes, stats.Active, err = slotRetention(ctx, conn, i.config.SlotName)
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				sdk.Logger(ctx).Warn().Err(err).
+					Str("slot", i.config.SlotName).
+					Msg("failed to check replication slot")
+			} else {
+				i.slotStats.Store(stats)
+				i.checkRetention(ctx, conn, rm, now, stats)
+			}
+
+			if m.threshold == 0 {
+				continue
+			}
+			if m.observe(now, lag) {
+				e := sdk.Logger(ctx).Warn().
+					Str("slot", i.config.SlotName).
+					Uint64("lag", lag).
+					Uint64("threshold", m.threshold).
+					Dur("duration", m.duration)
+				stats, err := replicationStats(ctx, conn, i.config.SlotName)
+				if err != nil {
+					e = e.AnErr("statsError", err)
+				} else {
+					e = e.Fields(stats)
+				}
+				e.Msg("replication lag exceeded threshold, WAL is retained on the server until the lag is caught up")
+			} else if m.recovered() {
+				sdk.Logger(ctx).Info().
+					Str("slot", i.config.SlotName).
+					Uint64("lag", lag).
+					Msg("replication lag dropped below threshold")
+			}
+		}
+	}
+}
+
+// checkRetention logs a warning if the WAL retained for the slot exceeds the
+// configured threshold for the configured duration.
+func (i *CDCIterator) checkRetention(ctx context.Context, conn *pgx.Conn, m *lagMonitor, now time.Time, stats SlotStats) {
+	if m.threshold == 0 || stats.RetainedBytes < 0 {
+		return
+	}
+	retained := uint64(stats.RetainedBytes)
+	if m.observe(now, retained) {
+		e := sdk.Logger(ctx).Warn().
+			Str("slot", i.config.SlotName).
+			Uint64("retainedBytes", retained).
+			Uint64("threshold", m.threshold).
+			Dur("duration", m.duration).
+			Bool("active", stats.Active)
+		details, err := replicationStats(ctx, conn, i.config.SlotName)
+		if err != nil {
+			e = e.AnErr("statsError", err)
+		} else {
+			e = e.Fields(details)
+		}
+		e.Msg("replication slot retains more WAL than the threshold, the disk of the server can fill up if the slot is not consumed")
+	} else if m.recovered() {
+		sdk.Logger(ctx).Info().
+			Str("slot", i.config.SlotName).
+			Uint64("retainedBytes", retained).
+			Msg("WAL retained by replication slot dropped below threshold")
+	}
+}
+
+// slotRetention returns the number of WAL bytes retained for the replication
+// slot and whether the slot is active.
+func slotRetention(ctx context.Context, conn *pgx.Conn, slotName string) (int64, bool, error) {
+	query := `SELECT
+			COALESCE(pg_wal_lsn_diff(pg_current_wal_lsn(), restart_lsn)::bigint, 0),
+			active
+		FROM pg_replication_slots
+		WHERE slot_name = $1`
+
+	var retained int64
+	var active bool
+	if err := conn.QueryRow(ctx, query, slotName).Scan(&retained, &active); err != nil {
+		return 0, false, err
+	}
+	return retained, active, nil
+}
+
+// replicationStats returns a snapshot of pg_stat_replication and
+// pg_replication_slots for the replication slot.
+func replicationStats(ctx context.Context, conn *pgx.Conn, slotName string) (map[string]interface{}, error) {
+	query := `SELECT
+			COALESCE(r.state, ''),
+			COALESCE(r.sent_lsn::text, ''),
+			COALESCE(r.write_lsn::text, ''),
+			COALESCE(r.flush_lsn::text, ''),
+			COALESCE(r.replay_lsn::text, ''),
+			COALESCE(r.write_lag::text, ''),
+			COALESCE(r.flush_lag::text, ''),
+			COALESCE(r.replay_lag::text, ''),
+			COALESCE(s.confirmed_flush_lsn::text, ''),
+			COALESCE(pg_wal_lsn_diff(pg_current_wal_lsn(), s.restart_lsn)::bigint, 0)
+		FROM pg_replication_slots s
+		LEFT JOIN pg_stat_replication r ON r.pid = s.active_pid
+		WHERE s.slot_name = $1`
+
+	var (
+		state, sentLSN, writeLSN, flushLSN, replayLSN string
+		writeLag, flushLag, replayLag, confirmedLSN   string
+		retainedBytes                                 int64
+	)
+	err := conn.QueryRow(ctx, query, slotName).Scan(
+		&state, &sentLSN, &writeLSN, &flushLSN, &replayLSN,
+		&writeLag, &flushLag, &replayLag, &confirmedLSN, &retainedBytes,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"state":             state,
+		"sentLSN":           sentLSN,
+		"writeLSN":          writeLSN,
+		"flushLSN":          flushLSN,
+		"replayLSN":         replayLSN,
+		"writeLag":          writeLag,
+		"flushLag":          flushLag,
+		"replayLag":         replayLag,
+		"confirmedFlushLSN": confirmedLSN,
+		"retainedBytes":     retainedBytes,
+	}, nil
+}
@@ -0,0 +1,90 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/conduitio/conduit-connector-postgres/source/logrepl/internal"
+	"github.com/jackc/pgconn"
+	"github.com/matryer/is"
+)
+
+func TestLagMonitor(t *testing.T) {
+	is := is.New(t)
+
+	m := &lagMonitor{threshold: 100, duration: time.Minute}
+	start := time.Now()
+
+	// lag below threshold
+	is.True(!m.observe(start, 50))
+	is.True(!m.recovered())
+
+	// lag above threshold, but not for long enough
+	is.True(!m.observe(start.Add(10*time.Second), 150))
+	is.True(!m.observe(start.Add(30*time.Second), 200))
+
+	// lag above threshold for the whole duration
+	is.True(m.observe(start.Add(70*time.Second), 200))
+	is.True(!m.recovered())
+
+	// alert is repeated only after another duration
+	is.True(!m.observe(start.Add(80*time.Second), 200))
+	is.True(m.observe(start.Add(130*time.Second), 200))
+
+	// lag drops below threshold
+	is.True(!m.observe(start.Add(140*time.Second), 10))
+	is.True(m.recovered())
+	is.True(!m.recovered())
+}
+
+func TestCDCIterator_SlotStats(t *testing.T) {
+	is := is.New(t)
+
+	i := &CDCIterator{}
+	is.Equal(i.SlotStats(), SlotStats{}) // not checked yet
+
+	want := SlotStats{Lag: 10, RetainedBytes: 1024, Active: true, CheckedAt: time.Now()}
+	i.slotStats.Store(want)
+	is.Equal(i.SlotStats(), want)
+	is.Equal(i.SlotStats().Fields()["slotRetainedBytes"], int64(1024))
+	is.Equal(len(SlotStats{}.Fields()), 0)
+}
+
+func TestCDCIterator_TeardownStopsSlotMonitor(t *testing.T) {
+	is := is.New(t)
+
+	// the subscription never stops, e.g. because the server doesn't respond
+	i := &CDCIterator{
+		sub:             internal.NewSubscription(pgconn.Config{}, "slot", "pub", nil, 0, nil),
+		slotMonitorDone: make(chan struct{}),
+	}
+	monitorCtx, stop := context.WithCancel(context.Background())
+	i.stopSlotMonitor = stop
+	stopped := false
+	go func() {
+		defer close(i.slotMonitorDone)
+		<-monitorCtx.Done()
+		time.Sleep(10 * time.Millisecond)
+		stopped = true
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	is.Equal(i.Teardown(ctx), context.Canceled)
+	is.True(stopped) // the monitor stopped before Teardown returned
+}
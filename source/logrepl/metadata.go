@@ -0,0 +1,76 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/conduitio/conduit-connector-postgres/source/collection"
+	"github.com/jackc/pglogrepl"
+)
+
+// Metadata keys added to every record produced by logical replication.
+const (
+	// MetadataPostgresLSN is the LSN of the change, same as the position.
+	MetadataPostgresLSN = "postgres.lsn"
+	// MetadataPostgresXID is the ID of the transaction containing the change.
+	MetadataPostgresXID = "postgres.xid"
+	// MetadataPostgresCommitTime is the commit time of the transaction
+	// containing the change, formatted as RFC 3339 with nanoseconds in UTC.
+	MetadataPostgresCommitTime = "postgres.commitTime"
+	// MetadataPostgresTable is the name of the changed table.
+	MetadataPostgresTable = "postgres.table"
+	// MetadataPostgresSchema is the schema of the changed table.
+	MetadataPostgresSchema = "postgres.schema"
+	// MetadataPostgresTxIndex is the index of the change in its transaction,
+	// starting at 0. It is only set if transactions are grouped.
+	MetadataPostgresTxIndex = "postgres.txIndex"
+	// MetadataPostgresTxSize is the number of changes in the transaction of
+	// the change. It is only set if transactions are grouped.
+	MetadataPostgresTxSize = "postgres.txSize"
+	// MetadataPayloadBefore contains the row before an update encoded as
+	// JSON, it is only set for tables with REPLICA IDENTITY FULL.
+	MetadataPayloadBefore = "payload.before"
+)
+
+// transaction contains the details of the transaction that is currently
+// replicated. Postgres sends a begin message before the changes of each
+// transaction.
+type transaction struct {
+	xid        uint32
+	commitTime time.Time
+}
+
+// buildMetadata returns the metadata of a record with the action, describing
+// a change of the relation at the LSN.
+func (h *CDCHandler) buildMetadata(
+	action action,
+	relation *pglogrepl.RelationMessage,
+	lsn pglogrepl.LSN,
+) map[string]string {
+	m := map[string]string{
+		"action":               string(action),
+		"table":                collection.Name(h.collectionName, relation.Namespace, relation.RelationName),
+		MetadataPostgresLSN:    lsn.String(),
+		MetadataPostgresTable:  relation.RelationName,
+		MetadataPostgresSchema: relation.Namespace,
+	}
+	if h.tx.xid != 0 {
+		m[MetadataPostgresXID] = strconv.FormatUint(uint64(h.tx.xid), 10)
+		m[MetadataPostgresCommitTime] = h.tx.commitTime.UTC().Format(time.RFC3339Nano)
+	}
+	return m
+}
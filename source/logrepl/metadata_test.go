@@ -0,0 +1,54 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pglogrepl"
+	"github.com/matryer/is"
+)
+
+func TestCDCHandler_BuildMetadata(t *testing.T) {
+	is := is.New(t)
+
+	relation := &pglogrepl.RelationMessage{Namespace: "app", RelationName: "users"}
+	h := &CDCHandler{}
+
+	// no begin message received yet
+	got := h.buildMetadata(actionInsert, relation, pglogrepl.LSN(0x16B3748))
+	is.Equal(got, map[string]string{
+		"action":               "insert",
+		"table":                "users",
+		MetadataPostgresLSN:    "0/16B3748",
+		MetadataPostgresTable:  "users",
+		MetadataPostgresSchema: "app",
+	})
+
+	commitTime := time.Date(2022, 4, 1, 12, 30, 0, 123000, time.FixedZone("CEST", 2*60*60))
+	err := h.Handle(context.Background(), &pglogrepl.BeginMessage{Xid: 742, CommitTime: commitTime}, 0)
+	is.NoErr(err)
+
+	got = h.buildMetadata(actionUpdate, relation, pglogrepl.LSN(0x16B3748))
+	is.Equal(got[MetadataPostgresXID], "742")
+	is.Equal(got[MetadataPostgresCommitTime], "2022-04-01T10:30:00.000123Z")
+
+	// collections are named after the template
+	h.collectionName = "{schema}.{table}"
+	got = h.buildMetadata(actionInsert, relation, pglogrepl.LSN(0x16B3748))
+	is.Equal(got["table"], "app.users")
+}
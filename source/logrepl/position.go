@@ -15,6 +15,8 @@
 package logrepl
 
 import (
+	"strings"
+
 	sdk "github.com/conduitio/conduit-connector-sdk"
 	"github.com/jackc/pglogrepl"
 )
@@ -24,7 +26,17 @@ func LSNToPosition(lsn pglogrepl.LSN) sdk.Position {
 	return sdk.Position(lsn.String())
 }
 
-// PositionToLSN converts a Conduit position to a Postgres LSN.
+// positionSuffixSeparator separates the position of a record from the suffix
+// added to positions of records that don't describe a change, e.g. sequence
+// records.
+const positionSuffixSeparator = "#"
+
+// PositionToLSN converts a Conduit position to a Postgres LSN. A suffix of
+// the position is ignored.
 func PositionToLSN(pos sdk.Position) (pglogrepl.LSN, error) {
-	return pglogrepl.ParseLSN(string(pos))
+	raw := string(pos)
+	if i := strings.Index(raw, positionSuffixSeparator); i >= 0 {
+		raw = raw[:i]
+	}
+	return pglogrepl.ParseLSN(raw)
 }
@@ -0,0 +1,203 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"fmt"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgx/v4"
+)
+
+// publishedTable describes a table of an existing publication, as listed in
+// pg_publication_tables.
+type publishedTable struct {
+	// name is the qualified name of the table.
+	name string
+	// captured is true if the table is the table captured by the iterator.
+	captured bool
+	// columns is the column list of the table in the publication, only these
+	// columns are replicated. It is nil if all columns are published.
+	columns []string
+	// rowFilter is the row filter of the table in the publication, only rows
+	// matching it are replicated. It is empty if all rows are published.
+	rowFilter string
+}
+
+// attachPublication checks the publication if it already exists, in which
+// case the iterator doesn't create it and the publication determines what is
+// replicated. The captured columns are limited to the column list of the
+// table in the publication and the row filter of the publication is applied
+// to the snapshot, so snapshot records match the replicated changes.
+func (i *CDCIterator) attachPublication(ctx context.Context, conn *pgx.Conn) error {
+	tables, ok, err := getPublishedTables(ctx, conn, i.config.PublicationName, pgx.Identifier{i.config.TableName}.Sanitize())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// the publication is created with the configured table and filter
+		return nil
+	}
+	table, err := checkPublication(i.config.PublicationName, i.config.TableName, i.keyColumn, i.config.Columns, tables)
+	if err != nil {
+		return err
+	}
+
+	if table.columns != nil && len(i.config.Columns) == 0 {
+		sdk.Logger(ctx).Info().
+			Str("publication", i.config.PublicationName).
+			Strs("columns", table.columns).
+			Msg("capturing the columns published by the existing publication")
+		i.config.Columns = table.columns
+		if i.config.Snapshot != nil {
+			i.config.Snapshot.Columns = table.columns
+		}
+	}
+
+	switch {
+	case table.rowFilter == "" && i.config.Filter != "":
+		sdk.Logger(ctx).Warn().
+			Str("publication", i.config.PublicationName).
+			Str("filter", i.config.Filter).
+			Msg("existing publication has no row filter, the filter is only applied to the snapshot")
+	case table.rowFilter != "" && i.config.Filter == "":
+		sdk.Logger(ctx).Info().
+			Str("publication", i.config.PublicationName).
+			Str("rowFilter", table.rowFilter).
+			Msg("applying the row filter of the existing publication to the snapshot")
+		if i.config.Snapshot != nil {
+			i.config.Snapshot.Filter = table.rowFilter
+		}
+	case table.rowFilter != i.config.Filter:
+		// Postgres normalizes the stored expression, so equal filters can
+		// differ in their text
+		sdk.Logger(ctx).Warn().
+			Str("publication", i.config.PublicationName).
+			Str("filter", i.config.Filter).
+			Str("rowFilter", table.rowFilter).
+			Msg("changes are filtered with the row filter of the existing publication, the filter is only applied to the snapshot")
+	}
+	return nil
+}
+
+// getPublishedTables returns the tables of the publication, the second return
+// value is false if the publication doesn't exist. Column lists and row
+// filters are only returned by Postgres 15 and later.
+func getPublishedTables(ctx context.Context, conn *pgx.Conn, publication, table string) ([]publishedTable, bool, error) {
+	var exists bool
+	err := conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1)", publication).Scan(&exists)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query publication %q: %w", publication, err)
+	}
+	if !exists {
+		return nil, false, nil
+	}
+
+	version, err := serverVersion(ctx, conn)
+	if err != nil {
+		return nil, false, err
+	}
+	// attnames lists all published columns, it only contains a column list
+	// if columns of the table are left out; generated columns are never
+	// published
+	columns, rowFilter := "NULL::text[]", "''"
+	if version >= rowFilterMinServerVersion {
+		columns = `CASE WHEN cardinality(attnames) < (SELECT count(*) FROM pg_attribute a
+				WHERE a.attrelid = format('%I.%I', schemaname, tablename)::regclass
+					AND a.attnum > 0 AND NOT a.attisdropped AND a.attgenerated = '')
+				THEN attnames::text[] END`
+		rowFilter = "COALESCE(rowfilter, '')"
+	}
+	query := `SELECT format('%I.%I', schemaname, tablename),
+			format('%I.%I', schemaname, tablename)::regclass = $2::regclass,
+			` + columns + `,
+			` + rowFilter + `
+		FROM pg_publication_tables
+		WHERE pubname = $1
+		ORDER BY 1`
+	rows, err := conn.Query(ctx, query, publication, table)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to query tables of publication %q: %w", publication, err)
+	}
+	defer rows.Close()
+
+	var tables []publishedTable
+	for rows.Next() {
+		var t publishedTable
+		if err := rows.Scan(&t.name, &t.captured, &t.columns, &t.rowFilter); err != nil {
+			return nil, false, fmt.Errorf("failed to query tables of publication %q: %w", publication, err)
+		}
+		tables = append(tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to query tables of publication %q: %w", publication, err)
+	}
+	return tables, true, nil
+}
+
+// checkPublication returns the captured table of the existing publication.
+// It returns an error if the publication doesn't contain the table, or if the
+// column list of the table leaves out the key column or configured columns.
+func checkPublication(publication, table, keyColumn string, columns []string, tables []publishedTable) (publishedTable, error) {
+	const hint = `or set "logrepl.publicationName" to a publication that doesn't exist yet`
+	var names []string
+	for _, t := range tables {
+		if !t.captured {
+			names = append(names, t.name)
+			continue
+		}
+		if t.columns == nil {
+			return t, nil
+		}
+
+		if !contains(t.columns, keyColumn) {
+			return publishedTable{}, fmt.Errorf("column list of table %s in publication %q doesn't contain the key column %q (add it to the column list %s)", table, publication, keyColumn, hint)
+		}
+		var missing []string
+		for _, c := range columns {
+			if !contains(t.columns, c) {
+				missing = append(missing, c)
+			}
+		}
+		if len(missing) > 0 {
+			return publishedTable{}, fmt.Errorf("column list of table %s in publication %q doesn't contain the columns %v, only %v are published (add them to the column list %s)", table, publication, missing, t.columns, hint)
+		}
+		return t, nil
+	}
+	if len(names) == 0 {
+		return publishedTable{}, fmt.Errorf("publication %q already exists but contains no tables, table %s is not replicated (add the table to the publication %s)", publication, table, hint)
+	}
+	return publishedTable{}, fmt.Errorf("publication %q already exists but doesn't contain table %s, only %v (add the table to the publication %s)", publication, table, names, hint)
+}
+
+// serverVersion returns the server_version_num of the server.
+func serverVersion(ctx context.Context, conn *pgx.Conn) (int, error) {
+	var version int
+	err := conn.QueryRow(ctx, "SELECT current_setting('server_version_num')::int").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to detect server version: %w", err)
+	}
+	return version, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+func TestCheckPublication(t *testing.T) {
+	others := publishedTable{name: "public.orders"}
+	testCases := []struct {
+		name    string
+		columns []string
+		tables  []publishedTable
+		want    publishedTable
+		wantErr error
+	}{{
+		name:   "all columns",
+		tables: []publishedTable{others, {name: "public.users", captured: true, rowFilter: "(active IS TRUE)"}},
+		want:   publishedTable{name: "public.users", captured: true, rowFilter: "(active IS TRUE)"},
+	}, {
+		name:    "column list",
+		columns: []string{"name"},
+		tables:  []publishedTable{{name: "public.users", captured: true, columns: []string{"id", "name"}}},
+		want:    publishedTable{name: "public.users", captured: true, columns: []string{"id", "name"}},
+	}, {
+		name:    "column list without key",
+		tables:  []publishedTable{{name: "public.users", captured: true, columns: []string{"name"}}},
+		wantErr: errors.New(`column list of table users in publication "pub" doesn't contain the key column "id" (add it to the column list or set "logrepl.publicationName" to a publication that doesn't exist yet)`),
+	}, {
+		name:    "column list without configured columns",
+		columns: []string{"name", "email"},
+		tables:  []publishedTable{{name: "public.users", captured: true, columns: []string{"id", "name"}}},
+		wantErr: errors.New(`column list of table users in publication "pub" doesn't contain the columns [email], only [id name] are published (add them to the column list or set "logrepl.publicationName" to a publication that doesn't exist yet)`),
+	}, {
+		name:    "table missing",
+		tables:  []publishedTable{others},
+		wantErr: errors.New(`publication "pub" already exists but doesn't contain table users, only [public.orders] (add the table to the publication or set "logrepl.publicationName" to a publication that doesn't exist yet)`),
+	}, {
+		name:    "no tables",
+		wantErr: errors.New(`publication "pub" already exists but contains no tables, table users is not replicated (add the table to the publication or set "logrepl.publicationName" to a publication that doesn't exist yet)`),
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			got, err := checkPublication("pub", "users", "id", tc.columns, tc.tables)
+			is.Equal(err, tc.wantErr)
+			is.Equal(got, tc.want)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"strings"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgtype"
+)
+
+// schemaChange describes the difference between two versions of a relation.
+type schemaChange struct {
+	added   []string
+	dropped []string
+	// changed contains columns whose type changed.
+	changed []string
+}
+
+func (c schemaChange) empty() bool {
+	return len(c.added) == 0 && len(c.dropped) == 0 && len(c.changed) == 0
+}
+
+// diffRelations compares the columns of two versions of a relation. Postgres
+// sends a relation message before the first change of a relation in a session
+// and every time the relation changes, so comparing it with the previous
+// message reveals schema changes.
+func diffRelations(old, new *pglogrepl.RelationMessage) schemaChange {
+	oldColumns := make(map[string]*pglogrepl.RelationMessageColumn, len(old.Columns))
+	for _, col := range old.Columns {
+		oldColumns[col.Name] = col
+	}
+
+	var change schemaChange
+	for _, col := range new.Columns {
+		oldCol, ok := oldColumns[col.Name]
+		switch {
+		case !ok:
+			change.added = append(change.added, col.Name)
+		case oldCol.DataType != col.DataType || oldCol.TypeModifier != col.TypeModifier:
+			change.changed = append(change.changed, col.Name)
+		}
+		delete(oldColumns, col.Name)
+	}
+	// keep the order of the old relation for dropped columns
+	for _, col := range old.Columns {
+		if _, ok := oldColumns[col.Name]; ok {
+			change.dropped = append(change.dropped, col.Name)
+		}
+	}
+	return change
+}
+
+// buildSchemaChangeRecord returns a record describing the schema change. The
+// payload contains the new columns of the relation and their types. Columns
+// are named like the fields of change records.
+func (h *CDCHandler) buildSchemaChangeRecord(
+	relation *pglogrepl.RelationMessage,
+	change schemaChange,
+	lsn pglogrepl.LSN,
+) sdk.Record {
+	columns := sdk.StructuredData{}
+	for _, col := range relation.Columns {
+		columns[h.filter.Field(col.Name)] = h.relationSet.TypeName(pgtype.OID(col.DataType))
+	}
+	metadata := h.buildMetadata(actionSchemaChange, relation, lsn)
+	metadata["schema.added"] = h.joinFields(change.added)
+	metadata["schema.dropped"] = h.joinFields(change.dropped)
+	metadata["schema.changed"] = h.joinFields(change.changed)
+	return sdk.Record{
+		Position:  schemaChangePosition(lsn, relation),
+		Metadata:  metadata,
+		CreatedAt: time.Now(),
+		Key:       sdk.StructuredData{},
+		Payload:   columns,
+	}
+}
+
+// joinFields returns the comma separated field names of the columns.
+func (h *CDCHandler) joinFields(columns []string) string {
+	fields := make([]string, len(columns))
+	for i, col := range columns {
+		fields[i] = h.filter.Field(col)
+	}
+	return strings.Join(fields, ",")
+}
+
+// schemaChangePosition returns the position of a schema change record. The
+// relation message has the same WAL position as the change following it, so
+// the position is based on the LSN before it, with the relation appended to
+// make it unique. Acknowledging it, or resuming from it, never skips the
+// change, see PositionToLSN.
+func schemaChangePosition(lsn pglogrepl.LSN, relation *pglogrepl.RelationMessage) sdk.Position {
+	if lsn > 0 {
+		lsn--
+	}
+	return sdk.Position(string(LSNToPosition(lsn)) + positionSuffixSeparator + "schema:" + relation.Namespace + "." + relation.RelationName)
+}
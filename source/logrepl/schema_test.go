@@ -0,0 +1,67 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"testing"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgtype"
+	"github.com/matryer/is"
+)
+
+func TestDiffRelations(t *testing.T) {
+	is := is.New(t)
+
+	old := &pglogrepl.RelationMessage{
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Name: "id", DataType: pgtype.Int8OID, TypeModifier: -1},
+			{Name: "name", DataType: pgtype.VarcharOID, TypeModifier: 104},
+			{Name: "legacy", DataType: pgtype.TextOID, TypeModifier: -1},
+		},
+	}
+	new := &pglogrepl.RelationMessage{
+		Columns: []*pglogrepl.RelationMessageColumn{
+			{Name: "id", DataType: pgtype.Int8OID, TypeModifier: -1},
+			{Name: "name", DataType: pgtype.VarcharOID, TypeModifier: 259},
+			{Name: "email", DataType: pgtype.TextOID, TypeModifier: -1},
+		},
+	}
+
+	is.True(diffRelations(old, old).empty())
+	is.Equal(diffRelations(old, new), schemaChange{
+		added:   []string{"email"},
+		dropped: []string{"legacy"},
+		changed: []string{"name"},
+	})
+}
+
+func TestSchemaChangePosition(t *testing.T) {
+	is := is.New(t)
+
+	relation := &pglogrepl.RelationMessage{Namespace: "public", RelationName: "users"}
+	lsn := pglogrepl.LSN(0x16B3748)
+
+	pos := schemaChangePosition(lsn, relation)
+	is.Equal(pos, sdk.Position("0/16B3747#schema:public.users"))
+	is.True(string(pos) != string(LSNToPosition(lsn))) // distinct from the change
+
+	// acknowledging or resuming from the position never skips the change
+	// at the LSN of the relation message
+	got, err := PositionToLSN(pos)
+	is.NoErr(err)
+	is.True(got < lsn)
+}
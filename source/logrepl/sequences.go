@@ -0,0 +1,229 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/conduitio/conduit-connector-postgres/source/collection"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgx/v4"
+)
+
+// actionSequence is the action of records containing the current value of a
+// sequence owned by a column of the table.
+var actionSequence action = "sequence"
+
+// MetadataPostgresSequence is the qualified name of the sequence whose value
+// is contained in a sequence record.
+const MetadataPostgresSequence = "postgres.sequence"
+
+// sequenceValue is the current value of a sequence owned by a column of the
+// table, e.g. by a serial or identity column.
+type sequenceValue struct {
+	tableSchema string
+	table       string
+	column      string
+	schema      string
+	name        string
+	lastValue   int64
+}
+
+// qualifiedName returns the name of the sequence qualified with its schema.
+func (v sequenceValue) qualifiedName() string {
+	return v.schema + "." + v.name
+}
+
+// sequenceCapture reads the values of the sequences owned by the table on a
+// separate connection, so replication isn't blocked. Values are captured
+// once after the snapshot and then every interval, if it's set.
+type sequenceCapture struct {
+	// connConfig returns the config of the sequence connection, it's only
+	// called when the connection is opened.
+	connConfig func() (*pgx.ConnConfig, error)
+	table      string
+	// collectionName is the template of the collection name, see
+	// collection.Name.
+	collectionName string
+	interval       time.Duration
+
+	conn   *pgx.Conn
+	ticker *time.Ticker
+	// due is true if the values need to be captured before the next change
+	// is returned.
+	due bool
+	// captured contains the last captured value of each sequence, values are
+	// only returned if they changed.
+	captured map[string]int64
+	// pending contains the records of the last capture that weren't returned
+	// yet.
+	pending []sdk.Record
+}
+
+func newSequenceCapture(connConfig func() (*pgx.ConnConfig, error), config Config) *sequenceCapture {
+	c := &sequenceCapture{
+		connConfig:     connConfig,
+		table:          config.TableName,
+		collectionName: config.CollectionName,
+		interval:       config.SequencesInterval,
+		due:            true,
+		captured:       make(map[string]int64),
+	}
+	if c.interval > 0 {
+		c.ticker = time.NewTicker(c.interval)
+	}
+	return c
+}
+
+// tick returns a channel receiving a value every interval, it blocks forever
+// if the values are only captured once.
+func (c *sequenceCapture) tick() <-chan time.Time {
+	if c == nil || c.ticker == nil {
+		return nil
+	}
+	return c.ticker.C
+}
+
+// next returns the next record of the last capture, the values are captured
+// first if they are due. The position of the records is derived from pos, the
+// position of the last record returned by the iterator.
+func (c *sequenceCapture) next(ctx context.Context, pos sdk.Position) (sdk.Record, bool, error) {
+	if c == nil {
+		return sdk.Record{}, false, nil
+	}
+	if c.due {
+		values, err := c.query(ctx)
+		if err != nil {
+			return sdk.Record{}, false, err
+		}
+		c.due = false
+		c.pending = c.buildRecords(values, pos)
+	}
+	if len(c.pending) == 0 {
+		return sdk.Record{}, false, nil
+	}
+	rec := c.pending[0]
+	c.pending = c.pending[1:]
+	return rec, true, nil
+}
+
+// query returns the current values of the sequences owned by the columns of
+// the table. Sequences that were never used have no value and are skipped.
+func (c *sequenceCapture) query(ctx context.Context) ([]sequenceValue, error) {
+	if c.conn == nil {
+		connConfig, err := c.connConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create sequence connection config: %w", err)
+		}
+		conn, err := pgx.ConnectConfig(ctx, connConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open sequence connection: %w", err)
+		}
+		c.conn = conn
+	}
+
+	query := `SELECT tn.nspname, t.relname, a.attname, sn.nspname, s.relname, ps.last_value
+		FROM pg_depend d
+		JOIN pg_class s ON s.oid = d.objid AND s.relkind = 'S'
+		JOIN pg_namespace sn ON sn.oid = s.relnamespace
+		JOIN pg_sequences ps ON ps.schemaname = sn.nspname AND ps.sequencename = s.relname
+		JOIN pg_class t ON t.oid = d.refobjid
+		JOIN pg_namespace tn ON tn.oid = t.relnamespace
+		JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+		WHERE d.classid = 'pg_class'::regclass AND d.refclassid = 'pg_class'::regclass
+			AND d.refobjid = $1::regclass AND d.deptype IN ('a', 'i')
+		ORDER BY a.attname`
+	rows, err := c.conn.Query(ctx, query, c.table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sequences of table %s: %w", c.table, err)
+	}
+	defer rows.Close()
+
+	var values []sequenceValue
+	for rows.Next() {
+		var v sequenceValue
+		var lastValue *int64
+		if err := rows.Scan(&v.tableSchema, &v.table, &v.column, &v.schema, &v.name, &lastValue); err != nil {
+			return nil, fmt.Errorf("failed to scan sequence: %w", err)
+		}
+		if lastValue == nil {
+			continue
+		}
+		v.lastValue = *lastValue
+		values = append(values, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query sequences of table %s: %w", c.table, err)
+	}
+	return values, nil
+}
+
+// buildRecords returns a record for each value that changed since the last
+// capture. The key contains the sequence, the payload the column owning it
+// and its last value.
+func (c *sequenceCapture) buildRecords(values []sequenceValue, pos sdk.Position) []sdk.Record {
+	var records []sdk.Record
+	for _, v := range values {
+		name := v.qualifiedName()
+		if last, ok := c.captured[name]; ok && last == v.lastValue {
+			continue
+		}
+		c.captured[name] = v.lastValue
+		records = append(records, sdk.Record{
+			Position: sequencePosition(pos, name, v.lastValue),
+			Metadata: map[string]string{
+				"action":                 string(actionSequence),
+				"table":                  collection.Name(c.collectionName, v.tableSchema, v.table),
+				MetadataPostgresTable:    v.table,
+				MetadataPostgresSchema:   v.tableSchema,
+				MetadataPostgresSequence: name,
+			},
+			CreatedAt: time.Now(),
+			Key:       sdk.StructuredData{"sequence": name},
+			Payload: sdk.StructuredData{
+				"column":    v.column,
+				"lastValue": v.lastValue,
+			},
+		})
+	}
+	return records
+}
+
+// teardown stops the ticker and closes the connection.
+func (c *sequenceCapture) teardown(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+	if c.ticker != nil {
+		c.ticker.Stop()
+	}
+	if c.conn != nil {
+		if err := c.conn.Close(ctx); err != nil {
+			return fmt.Errorf("failed to close sequence connection: %w", err)
+		}
+	}
+	return nil
+}
+
+// sequencePosition returns the position of a sequence record. It's the
+// position of the preceding record with the sequence and its value appended,
+// so it's unique and acknowledging it acknowledges the preceding record, see
+// PositionToLSN.
+func sequencePosition(pos sdk.Position, name string, value int64) sdk.Position {
+	return sdk.Position(string(pos) + positionSuffixSeparator + name + ":" + strconv.FormatInt(value, 10))
+}
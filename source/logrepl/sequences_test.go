@@ -0,0 +1,90 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/conduitio/conduit-connector-postgres/source/collection"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pglogrepl"
+	"github.com/jackc/pgx/v4"
+	"github.com/matryer/is"
+)
+
+func TestSequenceCapture_BuildRecords(t *testing.T) {
+	is := is.New(t)
+	c := newSequenceCapture(nil, Config{TableName: "users", CollectionName: collection.DefaultTemplate})
+
+	values := []sequenceValue{{
+		tableSchema: "public",
+		table:       "users",
+		column:      "id",
+		schema:      "public",
+		name:        "users_id_seq",
+		lastValue:   42,
+	}}
+	records := c.buildRecords(values, sdk.Position("0/16B3748"))
+	is.Equal(len(records), 1)
+	rec := records[0]
+	is.Equal(rec.Position, sdk.Position("0/16B3748#public.users_id_seq:42"))
+	is.Equal(rec.Metadata["action"], "sequence")
+	is.Equal(rec.Metadata["table"], "users")
+	is.Equal(rec.Metadata[MetadataPostgresSequence], "public.users_id_seq")
+	is.Equal(rec.Key, sdk.StructuredData{"sequence": "public.users_id_seq"})
+	is.Equal(rec.Payload, sdk.StructuredData{"column": "id", "lastValue": int64(42)})
+
+	// unchanged values are not returned again
+	is.Equal(len(c.buildRecords(values, sdk.Position("0/16B3800"))), 0)
+	values[0].lastValue = 43
+	is.Equal(len(c.buildRecords(values, sdk.Position("0/16B3800"))), 1)
+}
+
+func TestSequenceCapture_DelayedConnect(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	var calls int
+	errExpired := errors.New("token expired")
+	connConfig := func() (*pgx.ConnConfig, error) {
+		calls++
+		return nil, errExpired
+	}
+	c := newSequenceCapture(connConfig, Config{TableName: "users", CollectionName: collection.DefaultTemplate})
+
+	// the config of the sequence connection is only created when the
+	// connection is opened, e.g. after a long snapshot, and again on the next
+	// attempt, so credentials like IAM auth tokens are current
+	is.Equal(calls, 0)
+	_, err := c.query(ctx)
+	is.True(errors.Is(err, errExpired))
+	is.Equal(calls, 1)
+	_, err = c.query(ctx)
+	is.True(errors.Is(err, errExpired))
+	is.Equal(calls, 2)
+}
+
+func TestPositionToLSN_Suffix(t *testing.T) {
+	is := is.New(t)
+	want, err := pglogrepl.ParseLSN("0/16B3748")
+	is.NoErr(err)
+
+	// acknowledging a sequence record acknowledges the preceding change
+	got, err := PositionToLSN(sequencePosition(LSNToPosition(want), "public.users_id_seq", 42))
+	is.NoErr(err)
+	is.Equal(got, want)
+}
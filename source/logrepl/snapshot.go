@@ -0,0 +1,144 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logrepl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/conduitio/conduit-connector-postgres/source/longpoll"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgx/v4"
+)
+
+// initialSnapshot reads the table in a transaction that uses the snapshot
+// exported when the replication slot was created. The snapshot sees exactly
+// the changes committed before the slot's consistent point and replication
+// streams all changes after it, so there is no gap or overlap between
+// snapshot records and change records.
+type initialSnapshot struct {
+	conn     *pgx.Conn
+	tx       pgx.Tx
+	iterator *longpoll.SnapshotIterator
+}
+
+// handleSnapshot is the snapshot handler of the subscription. It starts the
+// snapshot and reports the result to waitForSnapshot.
+func (i *CDCIterator) handleSnapshot(ctx context.Context, snapshotName string) error {
+	err := i.startSnapshot(ctx, snapshotName)
+	i.snapshotStarted <- err
+	return err
+}
+
+// startSnapshot opens a separate connection, imports the exported snapshot and
+// starts reading the table. Once the rows are queried the snapshot is
+// imported and replication can start.
+func (i *CDCIterator) startSnapshot(ctx context.Context, snapshotName string) error {
+	connConfig, err := i.connConfig()
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot connection config: %w", err)
+	}
+	conn, err := pgx.ConnectConfig(ctx, connConfig)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot connection: %w", err)
+	}
+	s := &initialSnapshot{conn: conn}
+
+	s.tx, err = conn.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		_ = conn.Close(ctx)
+		return fmt.Errorf("failed to begin snapshot transaction: %w", err)
+	}
+	query := "SET TRANSACTION SNAPSHOT '" + strings.ReplaceAll(snapshotName, "'", "''") + "'"
+	if _, err := s.tx.Exec(ctx, query); err != nil {
+		_ = conn.Close(ctx)
+		return fmt.Errorf("failed to import snapshot %s: %w", snapshotName, err)
+	}
+
+	config := *i.config.Snapshot
+	if config.Key == "" {
+		config.Key = i.keyColumn
+	}
+	// the iterator queries the rows in the open transaction
+	s.iterator, err = longpoll.NewSnapshotIterator(ctx, conn, config)
+	if err != nil {
+		_ = conn.Close(ctx)
+		return err
+	}
+
+	sdk.Logger(ctx).Info().
+		Str("snapshot", snapshotName).
+		Str("table", config.Table).
+		Msg("taking snapshot using the snapshot exported by the replication slot")
+	i.snapshot = s
+	return nil
+}
+
+// waitForSnapshot blocks until the snapshot is started or the subscription
+// is ready without calling the snapshot handler, because the replication slot
+// already existed.
+func (i *CDCIterator) waitForSnapshot(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-i.snapshotStarted:
+		return err
+	case <-i.sub.Ready():
+	}
+
+	// the handler reports its result before the subscription is ready
+	select {
+	case err := <-i.snapshotStarted:
+		return err
+	default:
+	}
+	sdk.Logger(ctx).Warn().
+		Str("slot", i.config.SlotName).
+		Msg("no snapshot was exported, the replication slot probably already exists, skipping snapshot")
+	return nil
+}
+
+// next returns the next snapshot record. Once all rows are read, the snapshot
+// is closed and ok is false.
+func (s *initialSnapshot) next(ctx context.Context) (rec sdk.Record, ok bool, err error) {
+	rec, err = s.iterator.Next(ctx)
+	if errors.Is(err, longpoll.ErrNoRows) {
+		sdk.Logger(ctx).Info().Msg("snapshot done, continuing with changes")
+		return sdk.Record{}, false, s.teardown(ctx)
+	}
+	if err != nil {
+		return sdk.Record{}, false, err
+	}
+	return rec, true, nil
+}
+
+// teardown closes the snapshot rows, transaction and connection. If the
+// snapshot isn't complete, longpoll.ErrSnapshotInterrupt is returned.
+func (s *initialSnapshot) teardown(ctx context.Context) error {
+	iterErr := s.iterator.Teardown(ctx)
+	// the transaction is read only, nothing to commit
+	if err := s.tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+		return fmt.Errorf("failed to close snapshot transaction: %w", err)
+	}
+	if err := s.conn.Close(ctx); err != nil {
+		return fmt.Errorf("failed to close snapshot connection: %w", err)
+	}
+	return iterErr
+}
@@ -0,0 +1,134 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package longpoll
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/conduitio/conduit-connector-postgres/source/columnfilter"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// MetadataPostgresColumnDefaults contains the default expressions of the
+	// columns of the snapshot, encoded as a JSON object mapping field names
+	// to expressions.
+	MetadataPostgresColumnDefaults = "postgres.columnDefaults"
+	// MetadataPostgresGeneratedColumns contains the generation expressions of
+	// the generated columns of the snapshot, encoded as a JSON object mapping
+	// field names to expressions.
+	MetadataPostgresGeneratedColumns = "postgres.generatedColumns"
+)
+
+// columnExpression is the default or generation expression of a column.
+type columnExpression struct {
+	column     string
+	expression string
+	generated  bool
+}
+
+// loadColumnDefaults returns the metadata describing the default and
+// generated columns of the table. Columns that are not part of the payload
+// are left out.
+func loadColumnDefaults(ctx context.Context, conn *pgx.Conn, table string, columns []string, filter *columnfilter.Filter) (map[string]string, error) {
+	expressions, err := queryColumnExpressions(ctx, conn, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load column defaults of %s: %w", table, err)
+	}
+	return columnDefaultsMetadata(expressions, columns, filter)
+}
+
+func queryColumnExpressions(ctx context.Context, conn *pgx.Conn, table string) ([]columnExpression, error) {
+	var version int
+	if err := conn.QueryRow(ctx, "SELECT current_setting('server_version_num')::int").Scan(&version); err != nil {
+		return nil, err
+	}
+	// generated columns were added in Postgres 12
+	generated := "false"
+	if version >= 120000 {
+		generated = "a.attgenerated = 's'"
+	}
+	query := `SELECT a.attname, pg_get_expr(d.adbin, d.adrelid), ` + generated + `
+		FROM pg_attribute a
+		JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum`
+	rows, err := conn.Query(ctx, query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expressions []columnExpression
+	for rows.Next() {
+		var e columnExpression
+		if err := rows.Scan(&e.column, &e.expression, &e.generated); err != nil {
+			return nil, err
+		}
+		expressions = append(expressions, e)
+	}
+	return expressions, rows.Err()
+}
+
+// columnDefaultsMetadata encodes the expressions of the columns in the
+// payload as metadata, see MetadataPostgresColumnDefaults and
+// MetadataPostgresGeneratedColumns. The columns are named like the payload
+// fields. Metadata fields without any column are left out.
+func columnDefaultsMetadata(expressions []columnExpression, columns []string, filter *columnfilter.Filter) (map[string]string, error) {
+	included := func(column string) bool {
+		if !filter.Include(column) {
+			return false
+		}
+		if len(columns) == 0 {
+			return true
+		}
+		for _, c := range columns {
+			if c == column {
+				return true
+			}
+		}
+		return false
+	}
+
+	defaults := make(map[string]string)
+	generated := make(map[string]string)
+	for _, e := range expressions {
+		switch {
+		case !included(e.column):
+		case e.generated:
+			generated[filter.Field(e.column)] = e.expression
+		default:
+			defaults[filter.Field(e.column)] = e.expression
+		}
+	}
+
+	metadata := make(map[string]string)
+	for key, m := range map[string]map[string]string{
+		MetadataPostgresColumnDefaults:   defaults,
+		MetadataPostgresGeneratedColumns: generated,
+	} {
+		if len(m) == 0 {
+			continue
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(b)
+	}
+	return metadata, nil
+}
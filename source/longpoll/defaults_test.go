@@ -0,0 +1,78 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package longpoll
+
+import (
+	"testing"
+
+	"github.com/conduitio/conduit-connector-postgres/fieldname"
+	"github.com/conduitio/conduit-connector-postgres/source/columnfilter"
+	"github.com/matryer/is"
+)
+
+func TestColumnDefaultsMetadata(t *testing.T) {
+	expressions := []columnExpression{
+		{column: "id", expression: "nextval('users_id_seq'::regclass)"},
+		{column: "created_at", expression: "now()"},
+		{column: "full_name", expression: "((first_name || ' '::text) || last_name)", generated: true},
+	}
+
+	testCases := []struct {
+		name    string
+		columns []string
+		filter  columnfilter.Config
+		want    map[string]string
+	}{{
+		name: "all columns",
+		want: map[string]string{
+			MetadataPostgresColumnDefaults:   `{"created_at":"now()","id":"nextval('users_id_seq'::regclass)"}`,
+			MetadataPostgresGeneratedColumns: `{"full_name":"((first_name || ' '::text) || last_name)"}`,
+		},
+	}, {
+		name:    "selected columns",
+		columns: []string{"id", "first_name"},
+		want: map[string]string{
+			MetadataPostgresColumnDefaults: `{"id":"nextval('users_id_seq'::regclass)"}`,
+		},
+	}, {
+		name:   "excluded columns",
+		filter: columnfilter.Config{Exclude: []string{"id", "created_at", "full_name"}},
+		want:   map[string]string{},
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			got, err := columnDefaultsMetadata(expressions, tc.columns, columnfilter.New(tc.filter))
+			is.NoErr(err)
+			is.Equal(got, tc.want)
+		})
+	}
+}
+
+func TestColumnDefaultsMetadata_FieldNames(t *testing.T) {
+	is := is.New(t)
+	expressions := []columnExpression{
+		{column: "UserID", expression: "nextval('users_id_seq'::regclass)"},
+		{column: "Created At", expression: "now()"},
+	}
+	filter := columnfilter.New(columnfilter.Config{FieldNames: fieldname.ModeSnakeCase})
+
+	got, err := columnDefaultsMetadata(expressions, nil, filter)
+	is.NoErr(err)
+	is.Equal(got, map[string]string{
+		MetadataPostgresColumnDefaults: `{"created_at":"now()","user_id":"nextval('users_id_seq'::regclass)"}`,
+	})
+}
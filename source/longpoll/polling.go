@@ -0,0 +1,421 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package longpoll
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	actionInsert = "insert"
+	actionUpdate = "update"
+	actionDelete = "delete"
+)
+
+// PollingConfig holds configuration values for PollingIterator.
+type PollingConfig struct {
+	// Snapshot configures the query executed on each poll, Key needs to be
+	// set.
+	Snapshot SnapshotConfig
+	// Interval is the time between the start of two polls.
+	Interval time.Duration
+	// RefreshMaterializedView refreshes the materialized view before each
+	// poll.
+	RefreshMaterializedView bool
+	// EmitSnapshot makes the iterator return the rows of the first poll as
+	// snapshot records. Otherwise the first poll only establishes the state
+	// later polls are compared with.
+	EmitSnapshot bool
+	// Position is the position of the last record read before a restart,
+	// positions continue after it. It contains the progress of the snapshot
+	// of the table, see snapshotPosition. If the restart interrupted the
+	// snapshot and it's read in pages, the snapshot resumes after the key
+	// stored in the position. If the snapshot was completed, it's skipped.
+	Position sdk.Position
+}
+
+// PollingIterator captures changes of tables, views and materialized views by
+// reading all rows periodically and comparing them with the rows of the
+// previous poll. Rows are identified by their key, new rows are returned as
+// inserts, changed rows as updates and rows that disappeared as deletes.
+//
+// The iterator keeps the key and a hash of each row in memory, the state is
+// not persisted, so the first poll after a restart starts over. Only the
+// progress of the snapshot is stored in positions, a snapshot read in pages is
+// resumed after the last key read and a completed snapshot is skipped.
+type PollingIterator struct {
+	conn   *pgx.Conn
+	config PollingConfig
+
+	// rows contains the rows of the last completed poll, indexed by the key
+	// encoded as JSON.
+	rows map[string]polledRow
+	// seen contains the rows of the poll in progress.
+	seen map[string]polledRow
+	// snap reads the rows of the poll in progress, it is nil between polls.
+	snap *SnapshotIterator
+	// deletes are the delete records of the last completed poll that were
+	// not returned yet.
+	deletes []sdk.Record
+	// polls is the number of started polls.
+	polls int
+	// lastPoll is the time the last poll started.
+	lastPoll time.Time
+	// internalPos is the position of the last returned record.
+	internalPos int64
+	// resumeKey is the key of the last snapshot row returned before a
+	// restart, the first poll reads the rows up to it without returning
+	// them and then resumes the snapshot after it. It is nil if the snapshot
+	// isn't resumed or once the rows up to the key were read.
+	resumeKey *string
+	// snapshotComplete is true if the snapshot of the table was completed
+	// before the restart, the first poll only establishes the state.
+	snapshotComplete bool
+}
+
+// polledRow is a row read by a poll.
+type polledRow struct {
+	key  sdk.Data
+	hash [sha256.Size]byte
+}
+
+// NewPollingIterator returns a PollingIterator, the first poll is executed
+// by the first call to Next.
+func NewPollingIterator(ctx context.Context, conn *pgx.Conn, config PollingConfig) (*PollingIterator, error) {
+	if config.Snapshot.Key == "" {
+		return nil, fmt.Errorf("polling %s requires a key column to detect changes", config.Snapshot.Table)
+	}
+	for _, c := range config.Snapshot.RedactColumns {
+		if c == config.Snapshot.Key {
+			return nil, fmt.Errorf("polling %s can't redact the key column %q, rows are identified by it", config.Snapshot.Table, c)
+		}
+	}
+	i := &PollingIterator{
+		conn:   conn,
+		config: config,
+	}
+	if len(config.Position) > 0 {
+		row, progress, err := parseSnapshotPosition(config.Position)
+		if err != nil {
+			return nil, err
+		}
+		i.internalPos = row
+		// the progress of a snapshot of another table is ignored, e.g. if
+		// the table was changed in the config
+		if config.EmitSnapshot && progress.table == config.Snapshot.Table {
+			switch {
+			case progress.key == nil:
+				i.snapshotComplete = true
+				sdk.Logger(ctx).Info().
+					Str("table", config.Snapshot.Table).
+					Msg("skipping snapshot, it was completed before the restart")
+			case i.resumable():
+				i.resumeKey = progress.key
+			}
+		}
+	}
+	return i, nil
+}
+
+// resumable returns true if the snapshot is read in pages and its positions
+// contain the last key read. Hashed keys are not stored in positions, since
+// they would leave the connector unmasked.
+func (i *PollingIterator) resumable() bool {
+	if !i.config.EmitSnapshot || i.config.Snapshot.FetchSize == 0 {
+		return false
+	}
+	for _, c := range i.config.Snapshot.HashColumns {
+		if c == i.config.Snapshot.Key {
+			return false
+		}
+	}
+	return true
+}
+
+// Next returns the next change. It blocks until a change was detected or the
+// context is canceled.
+func (i *PollingIterator) Next(ctx context.Context) (sdk.Record, error) {
+	for {
+		if len(i.deletes) > 0 {
+			rec := i.deletes[0]
+			i.deletes = i.deletes[1:]
+			return i.withPosition(rec), nil
+		}
+		if i.snap == nil {
+			if err := i.startPoll(ctx); err != nil {
+				return sdk.Record{}, err
+			}
+		}
+
+		rec, err := i.snap.Next(ctx)
+		if errors.Is(err, ErrNoRows) && i.resumeKey != nil {
+			if err := i.resumeSnapshot(ctx); err != nil {
+				return sdk.Record{}, err
+			}
+			continue
+		}
+		if errors.Is(err, ErrNoRows) {
+			if err := i.finishPoll(ctx); err != nil {
+				return sdk.Record{}, err
+			}
+			continue
+		}
+		if err != nil {
+			return sdk.Record{}, fmt.Errorf("failed to read row: %w", err)
+		}
+		rec, ok, err := i.compare(rec)
+		if err != nil {
+			return sdk.Record{}, err
+		}
+		if ok {
+			return i.withPosition(rec), nil
+		}
+	}
+}
+
+// Ack is here to implement the Iterator interface, it does nothing.
+func (i *PollingIterator) Ack(context.Context, sdk.Position) error {
+	return nil // acks not needed
+}
+
+// Teardown stops the poll in progress.
+func (i *PollingIterator) Teardown(ctx context.Context) error {
+	if i.snap == nil {
+		return nil
+	}
+	err := i.snap.Teardown(ctx)
+	if errors.Is(err, ErrSnapshotInterrupt) {
+		// the next run starts with a new poll anyway
+		return nil
+	}
+	return err
+}
+
+// startPoll waits until the next poll is due and starts reading the rows.
+func (i *PollingIterator) startPoll(ctx context.Context) error {
+	if i.polls > 0 {
+		timer := time.NewTimer(time.Until(i.lastPoll.Add(i.config.Interval)))
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	i.lastPoll = time.Now()
+
+	if i.config.RefreshMaterializedView {
+		query := "REFRESH MATERIALIZED VIEW " + i.config.Snapshot.Table
+		if _, err := i.conn.Exec(ctx, query); err != nil {
+			return fmt.Errorf("failed to refresh materialized view %s: %w", i.config.Snapshot.Table, err)
+		}
+	}
+	config := i.config.Snapshot
+	// column defaults are only added to the snapshot records of the first poll
+	config.ColumnDefaults = config.ColumnDefaults && i.polls == 0 && i.emitSnapshot()
+	if i.resumeKey != nil {
+		// the rows up to the key were returned before the restart
+		config.ColumnDefaults = false
+		config.EndKey = i.resumeKey
+	}
+	snap, err := NewSnapshotIterator(ctx, i.conn, config)
+	if err != nil {
+		return fmt.Errorf("failed to poll %s: %w", i.config.Snapshot.Table, err)
+	}
+	i.snap = snap
+	i.seen = make(map[string]polledRow, len(i.rows))
+	i.polls++
+	return nil
+}
+
+// resumeSnapshot continues the first poll after the rows up to resumeKey were
+// read, the rows after it are returned as snapshot records.
+func (i *PollingIterator) resumeSnapshot(ctx context.Context) error {
+	if err := i.snap.Teardown(ctx); err != nil {
+		return fmt.Errorf("failed to read rows up to the resumed key: %w", err)
+	}
+	config := i.config.Snapshot
+	config.StartKey = i.resumeKey
+	snap, err := NewSnapshotIterator(ctx, i.conn, config)
+	if err != nil {
+		return fmt.Errorf("failed to resume snapshot of %s: %w", i.config.Snapshot.Table, err)
+	}
+	sdk.Logger(ctx).Info().
+		Str("table", i.config.Snapshot.Table).
+		Str("key", *i.resumeKey).
+		Msg("resuming snapshot after the last key read before the restart")
+	i.snap = snap
+	i.resumeKey = nil
+	return nil
+}
+
+// finishPoll stops reading rows and creates delete records for the rows of
+// the previous poll that were not seen in this poll.
+func (i *PollingIterator) finishPoll(ctx context.Context) error {
+	if err := i.snap.Teardown(ctx); err != nil {
+		return fmt.Errorf("failed to finish poll: %w", err)
+	}
+	i.snap = nil
+
+	var deleted []string
+	for id := range i.rows {
+		if _, ok := i.seen[id]; !ok {
+			deleted = append(deleted, id)
+		}
+	}
+	sort.Strings(deleted)
+	for _, id := range deleted {
+		rec := sdk.Record{Key: i.rows[id].key}
+		rec = withMetadata(rec, i.config.Snapshot.collection(), i.config.Snapshot.Key)
+		rec.Metadata["action"] = actionDelete
+		rec = withTimestampNow(rec)
+		i.deletes = append(i.deletes, rec)
+	}
+	i.rows, i.seen = i.seen, nil
+	return nil
+}
+
+// compare records the row read by the poll and returns the record that should
+// be returned for it, or false if the row didn't change.
+func (i *PollingIterator) compare(rec sdk.Record) (sdk.Record, bool, error) {
+	if rec.Key == nil {
+		return sdk.Record{}, false, fmt.Errorf("row of %s has no value in key column %q", i.config.Snapshot.Table, i.config.Snapshot.Key)
+	}
+	id, err := json.Marshal(rec.Key)
+	if err != nil {
+		return sdk.Record{}, false, fmt.Errorf("failed to encode key: %w", err)
+	}
+	payload, err := json.Marshal(rec.Payload)
+	if err != nil {
+		return sdk.Record{}, false, fmt.Errorf("failed to encode payload: %w", err)
+	}
+	row := polledRow{key: rec.Key, hash: sha256.Sum256(payload)}
+	i.seen[string(id)] = row
+
+	if i.polls == 1 {
+		// the first poll establishes the state, rows that were returned
+		// before the restart are not returned again
+		return rec, i.emitSnapshot() && i.resumeKey == nil, nil
+	}
+
+	prev, ok := i.rows[string(id)]
+	switch {
+	case !ok:
+		return withChangeMetadata(rec, actionInsert), true, nil
+	case prev.hash != row.hash:
+		return withChangeMetadata(rec, actionUpdate), true, nil
+	default:
+		return sdk.Record{}, false, nil
+	}
+}
+
+// emitSnapshot returns true if the rows of the first poll are returned as
+// snapshot records.
+func (i *PollingIterator) emitSnapshot() bool {
+	return i.config.EmitSnapshot && !i.snapshotComplete
+}
+
+// withPosition sets the position of the record, positions keep increasing
+// across polls and restarts. If a snapshot is emitted, positions contain its
+// progress, see snapshotPosition.
+func (i *PollingIterator) withPosition(rec sdk.Record) sdk.Record {
+	i.internalPos++
+	table := i.config.Snapshot.Table
+	switch {
+	case !i.config.EmitSnapshot:
+		return withPosition(rec, i.internalPos)
+	case i.polls == 1 && i.snap != nil:
+		// snapshot records read in pages contain the last key read, others
+		// don't contain any progress, the snapshot starts over
+		if key, ok := i.snap.LastKey(); ok && i.resumable() {
+			rec.Position = snapshotPosition(i.internalPos, table, &key)
+			return rec
+		}
+		return withPosition(rec, i.internalPos)
+	default:
+		rec.Position = snapshotPosition(i.internalPos, table, nil)
+		return rec
+	}
+}
+
+// snapshotPositionSeparator separates the number of a record from the
+// progress of the snapshot in its position.
+const snapshotPositionSeparator = "#"
+
+// snapshotProgress is the progress of the snapshot of a table stored in a
+// position.
+type snapshotProgress struct {
+	// table is the table of the snapshot, it's empty if the position
+	// doesn't contain any progress.
+	table string
+	// key is the text representation of the key of the last row read, it's
+	// nil if the snapshot is complete.
+	key *string
+}
+
+// snapshotPosition returns a position containing the progress of the snapshot
+// of the table: the number of the record followed by the table and the key of
+// the last row read, e.g. "42#public.users#1042", or only by the table if the
+// key is nil and the snapshot is complete, e.g. "43#public.users". The table
+// is escaped, so it doesn't contain the separator.
+func snapshotPosition(n int64, table string, key *string) sdk.Position {
+	pos := strconv.FormatInt(n, 10) + snapshotPositionSeparator + url.PathEscape(table)
+	if key != nil {
+		pos += snapshotPositionSeparator + *key
+	}
+	return sdk.Position(pos)
+}
+
+// parseSnapshotPosition returns the number of the record and the progress of
+// the snapshot stored in the position, see snapshotPosition.
+func parseSnapshotPosition(pos sdk.Position) (int64, snapshotProgress, error) {
+	parts := strings.SplitN(string(pos), snapshotPositionSeparator, 3)
+	n, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, snapshotProgress{}, fmt.Errorf("invalid position %q: %w", pos, err)
+	}
+	var progress snapshotProgress
+	if len(parts) > 1 {
+		if progress.table, err = url.PathUnescape(parts[1]); err != nil {
+			return 0, snapshotProgress{}, fmt.Errorf("invalid position %q: %w", pos, err)
+		}
+	}
+	if len(parts) > 2 {
+		progress.key = &parts[2]
+	}
+	return n, progress, nil
+}
+
+// withChangeMetadata replaces the snapshot metadata of a polled row with the
+// action of the change.
+func withChangeMetadata(rec sdk.Record, action string) sdk.Record {
+	delete(rec.Metadata, "snapshot.id")
+	delete(rec.Metadata, "snapshot.row")
+	delete(rec.Metadata, "snapshot.chunk")
+	rec.Metadata["action"] = action
+	return rec
+}
@@ -0,0 +1,246 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package longpoll
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/conduitio/conduit-connector-postgres/test"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+func TestPollingIterator(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	conn := test.ConnectSimple(ctx, t, test.RegularConnString)
+	table := test.SetupTestTable(ctx, t, conn)
+	view := table + "_view"
+	_, err := conn.Exec(ctx, fmt.Sprintf("CREATE VIEW %s AS SELECT * FROM %s", view, table))
+	is.NoErr(err)
+	t.Cleanup(func() {
+		_, err := conn.Exec(context.Background(), "DROP VIEW "+view)
+		is.NoErr(err)
+	})
+
+	i, err := NewPollingIterator(ctx, conn, PollingConfig{
+		Snapshot: SnapshotConfig{
+			Table:   view,
+			Columns: []string{"id", "column1", "key"},
+			Key:     "key",
+		},
+		Interval:     10 * time.Millisecond,
+		EmitSnapshot: true,
+	})
+	is.NoErr(err)
+	defer func() {
+		is.NoErr(i.Teardown(ctx))
+	}()
+
+	for n := 1; n <= 4; n++ {
+		rec, err := i.Next(ctx)
+		is.NoErr(err)
+		is.Equal(rec.Metadata["action"], actionSnapshot)
+		is.Equal(string(rec.Position), fmt.Sprint(n))
+	}
+
+	// the rows of the poll are still read, change the table using another
+	// connection
+	other := test.ConnectSimple(ctx, t, test.RegularConnString)
+	for _, query := range []string{
+		"UPDATE %s SET column1 = 'changed' WHERE key = '1'",
+		"DELETE FROM %s WHERE key = '2'",
+		"INSERT INTO %s (key, column1) VALUES ('5', 'new')",
+	} {
+		_, err := other.Exec(ctx, fmt.Sprintf(query, table))
+		is.NoErr(err)
+	}
+
+	want := []struct {
+		action  string
+		key     string
+		column1 interface{}
+	}{
+		{action: actionUpdate, key: "1", column1: "changed"},
+		{action: actionInsert, key: "5", column1: "new"},
+		{action: actionDelete, key: "2"},
+	}
+	for n, w := range want {
+		rec, err := i.Next(ctx)
+		is.NoErr(err)
+		is.Equal(rec.Metadata["action"], w.action)
+		is.Equal(rec.Metadata["snapshot.id"], "")
+		// the snapshot is complete
+		is.Equal(string(rec.Position), fmt.Sprintf("%d#%s", n+5, view))
+		is.Equal(rec.Key, sdk.StructuredData{"key": []byte(w.key)})
+		if w.action != actionDelete {
+			is.Equal(rec.Payload.(sdk.StructuredData)["column1"], w.column1)
+		}
+	}
+}
+
+func TestPollingIterator_ResumeSnapshot(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	conn := test.ConnectSimple(ctx, t, test.RegularConnString)
+	table := test.SetupTestTable(ctx, t, conn)
+
+	config := PollingConfig{
+		Snapshot: SnapshotConfig{
+			Table:     table,
+			Columns:   []string{"id", "column1", "key"},
+			Key:       "id",
+			FetchSize: 2,
+		},
+		Interval:     10 * time.Millisecond,
+		EmitSnapshot: true,
+	}
+	i, err := NewPollingIterator(ctx, conn, config)
+	is.NoErr(err)
+	var pos sdk.Position
+	for n := 1; n <= 3; n++ {
+		rec, err := i.Next(ctx)
+		is.NoErr(err)
+		is.Equal(string(rec.Position), fmt.Sprintf("%d#%s#%d", n, table, n))
+		pos = rec.Position
+	}
+	is.NoErr(i.Teardown(ctx))
+
+	// the restarted iterator continues after the last key
+	config.Position = pos
+	i, err = NewPollingIterator(ctx, conn, config)
+	is.NoErr(err)
+	defer func() {
+		is.NoErr(i.Teardown(ctx))
+	}()
+	rec, err := i.Next(ctx)
+	is.NoErr(err)
+	is.Equal(rec.Metadata["action"], actionSnapshot)
+	is.Equal(string(rec.Position), fmt.Sprintf("4#%s#4", table))
+	is.Equal(rec.Key, sdk.StructuredData{"id": int64(4)})
+
+	// the rows read before the restart are part of the state
+	_, err = conn.Exec(ctx, fmt.Sprintf("UPDATE %s SET column1 = 'changed' WHERE id = 1", table))
+	is.NoErr(err)
+	rec, err = i.Next(ctx)
+	is.NoErr(err)
+	is.Equal(rec.Metadata["action"], actionUpdate)
+	is.Equal(string(rec.Position), fmt.Sprintf("5#%s", table))
+	is.Equal(rec.Key, sdk.StructuredData{"id": int64(1)})
+	is.NoErr(i.Teardown(ctx))
+
+	// the completed snapshot is skipped after a restart, the first poll
+	// only establishes the state
+	config.Position = rec.Position
+	i, err = NewPollingIterator(ctx, conn, config)
+	is.NoErr(err)
+	type result struct {
+		rec sdk.Record
+		err error
+	}
+	next := make(chan result)
+	go func() {
+		rec, err := i.Next(ctx)
+		next <- result{rec: rec, err: err}
+	}()
+	// change the row once the first poll is done
+	time.Sleep(100 * time.Millisecond)
+	other := test.ConnectSimple(ctx, t, test.RegularConnString)
+	_, err = other.Exec(ctx, fmt.Sprintf("UPDATE %s SET column1 = 'changed again' WHERE id = 2", table))
+	is.NoErr(err)
+	res := <-next
+	is.NoErr(res.err)
+	rec = res.rec
+	is.Equal(rec.Metadata["action"], actionUpdate)
+	is.Equal(string(rec.Position), fmt.Sprintf("6#%s", table))
+	is.Equal(rec.Key, sdk.StructuredData{"id": int64(2)})
+}
+
+func TestNewPollingIterator_Position(t *testing.T) {
+	ctx := context.Background()
+	config := PollingConfig{
+		Snapshot: SnapshotConfig{
+			Table:     "users",
+			Key:       "id",
+			FetchSize: 2,
+		},
+		EmitSnapshot: true,
+	}
+
+	t.Run("snapshot in progress", func(t *testing.T) {
+		is := is.New(t)
+		config := config
+		config.Position = sdk.Position("4#users#4")
+		i, err := NewPollingIterator(ctx, nil, config)
+		is.NoErr(err)
+		is.Equal(i.internalPos, int64(4))
+		is.Equal(*i.resumeKey, "4")
+		is.True(i.emitSnapshot())
+	})
+
+	t.Run("snapshot complete", func(t *testing.T) {
+		is := is.New(t)
+		config := config
+		config.Position = sdk.Position("5#users")
+		i, err := NewPollingIterator(ctx, nil, config)
+		is.NoErr(err)
+		is.Equal(i.internalPos, int64(5))
+		is.True(i.resumeKey == nil)
+		is.True(!i.emitSnapshot())
+	})
+
+	t.Run("snapshot of another table", func(t *testing.T) {
+		is := is.New(t)
+		config := config
+		config.Position = sdk.Position("5#admins")
+		i, err := NewPollingIterator(ctx, nil, config)
+		is.NoErr(err)
+		is.Equal(i.internalPos, int64(5))
+		is.True(i.resumeKey == nil)
+		is.True(i.emitSnapshot())
+	})
+}
+
+func TestSnapshotPosition(t *testing.T) {
+	is := is.New(t)
+
+	key := "a#b"
+	pos := snapshotPosition(42, "public.my#table", &key)
+	is.Equal(string(pos), "42#public.my%23table#a#b")
+	n, progress, err := parseSnapshotPosition(pos)
+	is.NoErr(err)
+	is.Equal(n, int64(42))
+	is.Equal(progress.table, "public.my#table")
+	is.Equal(*progress.key, "a#b")
+
+	// the snapshot is complete
+	n, progress, err = parseSnapshotPosition(snapshotPosition(43, "users", nil))
+	is.NoErr(err)
+	is.Equal(n, int64(43))
+	is.Equal(progress, snapshotProgress{table: "users"})
+
+	n, progress, err = parseSnapshotPosition(sdk.Position("7"))
+	is.NoErr(err)
+	is.Equal(n, int64(7))
+	is.Equal(progress, snapshotProgress{})
+
+	_, _, err = parseSnapshotPosition(sdk.Position("0/16B3748"))
+	is.True(err != nil)
+}
@@ -16,13 +16,19 @@ package longpoll
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/conduitio/conduit-connector-postgres/fieldname"
 	"github.com/conduitio/conduit-connector-postgres/pgutil"
+	"github.com/conduitio/conduit-connector-postgres/source/columnfilter"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 	"github.com/jackc/pgtype"
 	"github.com/jackc/pgx/v4"
@@ -41,15 +47,98 @@ var (
 	ErrSnapshotInterrupt = fmt.Errorf("interrupted snapshot")
 )
 
+const (
+	// actionSnapshot is the action of records produced by a snapshot, it
+	// distinguishes them from records produced by live changes.
+	actionSnapshot = "snapshot"
+	// snapshotChunkSize is the number of rows in a snapshot chunk.
+	snapshotChunkSize = 10000
+)
+
+// SnapshotConfig holds configuration values for SnapshotIterator.
+type SnapshotConfig struct {
+	// Table is the table to snapshot.
+	Table string
+	// Collection is the collection name stored in the "table" metadata field
+	// of records, defaults to Table.
+	Collection string
+	// Columns is the list of columns that the iterator should record.
+	Columns []string
+	// Key is the name of the key column for the table snapshot.
+	Key string
+	// OrderBy is the expression used to order the rows of the snapshot. If
+	// empty, rows are ordered by Key.
+	OrderBy string
+	// ExcludeColumns is the list of columns removed from the payload.
+	ExcludeColumns []string
+	// HashColumns is the list of columns whose values are hashed.
+	HashColumns []string
+	// RedactColumns is the list of columns whose values are replaced with nil.
+	RedactColumns []string
+	// Filter is the expression used in the WHERE clause of the snapshot
+	// query. If empty, all rows are read.
+	Filter string
+	// FetchSize is the number of rows read per query. If set, rows are read
+	// in pages ordered by Key, each page continues after the last key of the
+	// previous page, so no query stays open for the whole snapshot. The key
+	// needs to be unique and OrderBy must be empty. If 0, all rows are read
+	// with a single query.
+	FetchSize int
+	// StartKey is the key after which the snapshot starts, in the text
+	// representation returned by SnapshotIterator.LastKey. It requires
+	// FetchSize, the snapshot starts with the first row if nil.
+	StartKey *string
+	// EndKey is the key of the last row read by the snapshot, see StartKey.
+	// It requires FetchSize, all rows after StartKey are read if nil.
+	EndKey *string
+	// ColumnDefaults adds the default and generation expressions of the
+	// columns to the metadata of each record, see
+	// MetadataPostgresColumnDefaults and MetadataPostgresGeneratedColumns.
+	ColumnDefaults bool
+	// FieldNames determines how column names are turned into the field names
+	// of keys and payloads.
+	FieldNames fieldname.Mode
+}
+
+// collection returns the collection name of the records.
+func (c SnapshotConfig) collection() string {
+	if c.Collection != "" {
+		return c.Collection
+	}
+	return c.Table
+}
+
 // SnapshotIterator implements the Iterator interface for capturing an initial table
 // snapshot.
 type SnapshotIterator struct {
 	// table is the table to snapshot
 	table string
+	// collection is the collection name stored in the metadata of records
+	collection string
 	// key is the name of the key column for the table snapshot
 	key string
 	// list of columns that the iterator should record
 	columns []string
+	// orderBy is the expression used to order the snapshot rows
+	orderBy string
+	// where is the expression rows need to match to be part of the snapshot
+	where string
+	// fetchSize is the number of rows read per page, 0 reads all rows with a
+	// single query
+	fetchSize int
+	// pageRows is the number of rows read from the current page
+	pageRows int
+	// lastKey is the text representation of the key of the last row read,
+	// the next page starts after it. Postgres parses it back into the type
+	// of the key column.
+	lastKey *string
+	// endKey is the key of the last row read, all rows are read if nil
+	endKey *string
+	// filter removes and masks columns before they are added to the payload
+	filter *columnfilter.Filter
+	// columnDefaults is the metadata describing the default and generated
+	// columns, it's added to each record
+	columnDefaults map[string]string
 	// conn handle to postgres
 	conn *pgx.Conn
 	// rows holds a reference to the postgres connection. this can be nil so
@@ -61,6 +150,9 @@ type SnapshotIterator struct {
 	// snapshotComplete keeps an internal record of whether the snapshot is
 	// complete yet
 	snapshotComplete bool
+	// snapshotID identifies the snapshot run, each iterator produces a new
+	// ID.
+	snapshotID string
 }
 
 // NewSnapshotIterator returns a SnapshotIterator that is an Iterator.
@@ -69,17 +161,54 @@ type SnapshotIterator struct {
 // * It acquires a read only transaction lock before reading the table.
 // * If Teardown is called while a snpashot is in progress, it will return an
 // ErrSnapshotInterrupt error.
-func NewSnapshotIterator(ctx context.Context, conn *pgx.Conn, table string, columns []string, key string) (*SnapshotIterator, error) {
+func NewSnapshotIterator(ctx context.Context, conn *pgx.Conn, config SnapshotConfig) (*SnapshotIterator, error) {
+	orderBy := config.OrderBy
+	if orderBy == "" {
+		orderBy = config.Key
+	}
 	s := &SnapshotIterator{
-		conn:             conn,
-		table:            table,
-		columns:          columns,
-		key:              key,
+		conn:       conn,
+		table:      config.Table,
+		collection: config.collection(),
+		columns:    config.Columns,
+		key:        config.Key,
+		orderBy:    orderBy,
+		where:      config.Filter,
+
+		fetchSize: config.FetchSize,
+		lastKey:   config.StartKey,
+		endKey:    config.EndKey,
+		filter: columnfilter.New(columnfilter.Config{
+			Exclude: config.ExcludeColumns,
+			Hash:    config.HashColumns,
+			Redact:  config.RedactColumns,
+
+			FieldNames: config.FieldNames,
+		}),
 		internalPos:      0,
 		snapshotComplete: false,
 	}
+	if (s.lastKey != nil || s.endKey != nil) && s.fetchSize == 0 {
+		return nil, fmt.Errorf("reading %s from or up to a key requires a fetch size", config.Table)
+	}
+	if s.filter.Excludes(s.key) {
+		return nil, fmt.Errorf("key column %q of %s can't be excluded", s.key, config.Table)
+	}
+	var err error
+	s.snapshotID, err = newSnapshotID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate snapshot ID: %w", err)
+	}
+	if config.ColumnDefaults {
+		// the expressions are loaded before the rows, the connection is busy
+		// while rows are read
+		s.columnDefaults, err = loadColumnDefaults(ctx, conn, config.Table, config.Columns, s.filter)
+		if err != nil {
+			return nil, err
+		}
+	}
 	// load our initial set of rows into the iterator after we've set the db
-	err := s.loadRows(ctx)
+	err = s.loadRows(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get rows for snapshot: %w", err)
 	}
@@ -93,24 +222,57 @@ func (s *SnapshotIterator) Next(ctx context.Context) (sdk.Record, error) {
 	if s.rows == nil {
 		return sdk.Record{}, ErrNoRows
 	}
-	if !s.rows.Next() {
-		s.snapshotComplete = true
-		return sdk.Record{}, ErrNoRows
+	for !s.rows.Next() {
+		if s.fetchSize == 0 || s.pageRows < s.fetchSize {
+			s.snapshotComplete = true
+			return sdk.Record{}, ErrNoRows
+		}
+		// the page was full, there can be more rows
+		if err := s.rows.Err(); err != nil {
+			return sdk.Record{}, fmt.Errorf("failed to read page: %w", err)
+		}
+		if err := s.loadRows(ctx); err != nil {
+			return sdk.Record{}, fmt.Errorf("failed to get next page: %w", err)
+		}
 	}
 	s.internalPos++
+	s.pageRows++
 
 	rec := sdk.Record{}
-	rec, err := withPayload(rec, s.rows, s.columns, s.key)
+	rec, keyValue, err := withPayload(rec, s.rows, s.key, s.filter)
 	if err != nil {
 		return sdk.Record{}, fmt.Errorf("failed to assign payload: %w",
 			err)
 	}
-	rec = withMetadata(rec, s.table, s.key)
+	if s.fetchSize > 0 {
+		if rec.Key == nil {
+			return sdk.Record{}, fmt.Errorf("key column %q is missing in the snapshot rows, it's required to read pages", s.key)
+		}
+		lastKey, err := keyText(keyValue)
+		if err != nil {
+			return sdk.Record{}, fmt.Errorf("failed to read pages after key column %q: %w", s.key, err)
+		}
+		s.lastKey = &lastKey
+	}
+	rec = withMetadata(rec, s.collection, s.key)
+	rec = withSnapshotMetadata(rec, s.snapshotID, s.internalPos)
+	for k, v := range s.columnDefaults {
+		rec.Metadata[k] = v
+	}
 	rec = withTimestampNow(rec)
 	rec = withPosition(rec, s.internalPos)
 	return rec, nil
 }
 
+// LastKey returns the text representation of the key of the last row read, it
+// is only known if the snapshot is read in pages.
+func (s *SnapshotIterator) LastKey() (string, bool) {
+	if s.lastKey == nil {
+		return "", false
+	}
+	return *s.lastKey, true
+}
+
 // Ack is here to implement the Iterator interface, it does nothing.
 func (s *SnapshotIterator) Ack(context.Context, sdk.Position) error {
 	return nil // acks not needed
@@ -141,8 +303,33 @@ func (s *SnapshotIterator) Teardown(ctx context.Context) error {
 // or returns an error.
 // * It returns nil if no error was detected.
 // * rows.Close and rows.Err are called at Teardown.
+// * If fetchSize is set, it loads the next page of rows after lastKey.
 func (s *SnapshotIterator) loadRows(ctx context.Context) error {
-	query, args, err := psql.Select(s.columns...).From(s.table).ToSql()
+	columns := s.columns
+	if len(columns) == 0 {
+		columns = []string{"*"}
+	}
+	builder := psql.Select(columns...).From(s.table)
+	if s.where != "" {
+		// escape question marks so jsonb operators like ? aren't taken for
+		// placeholders
+		builder = builder.Where("(" + strings.ReplaceAll(s.where, "?", "??") + ")")
+	}
+	if s.fetchSize > 0 {
+		// keys are passed as text, Postgres parses them into the type of
+		// the key column
+		if s.lastKey != nil {
+			builder = builder.Where(sq.Gt{s.key: *s.lastKey})
+		}
+		if s.endKey != nil {
+			builder = builder.Where(sq.LtOrEq{s.key: *s.endKey})
+		}
+		builder = builder.Limit(uint64(s.fetchSize))
+	}
+	if s.orderBy != "" {
+		builder = builder.OrderBy(s.orderBy)
+	}
+	query, args, err := builder.ToSql()
 	if err != nil {
 		return fmt.Errorf("failed to create read query: %w", err)
 	}
@@ -151,6 +338,7 @@ func (s *SnapshotIterator) loadRows(ctx context.Context) error {
 		return fmt.Errorf("failed to query context: %w", err)
 	}
 	s.rows = rows
+	s.pageRows = 0
 	return nil
 }
 
@@ -161,16 +349,41 @@ func withPosition(rec sdk.Record, i int64) sdk.Record {
 }
 
 // withMetadata sets the Metadata field on a Record.
-// Currently it adds the table name and key column of the Record.
-func withMetadata(rec sdk.Record, table string, key string) sdk.Record {
+// Currently it adds the collection name and key column of the Record.
+func withMetadata(rec sdk.Record, collection string, key string) sdk.Record {
 	if rec.Metadata == nil {
 		rec.Metadata = make(map[string]string)
 	}
-	rec.Metadata["table"] = table
+	rec.Metadata["table"] = collection
 	rec.Metadata["key"] = key
 	return rec
 }
 
+// withSnapshotMetadata marks the record as a snapshot record and adds the ID
+// of the snapshot run, the number of the row in the snapshot and the number of
+// the chunk the row belongs to. Rows are numbered starting at 1 and each chunk
+// contains snapshotChunkSize rows, so a consumer can verify that all rows of a
+// chunk were received.
+func withSnapshotMetadata(rec sdk.Record, snapshotID string, row int64) sdk.Record {
+	if rec.Metadata == nil {
+		rec.Metadata = make(map[string]string)
+	}
+	rec.Metadata["action"] = actionSnapshot
+	rec.Metadata["snapshot.id"] = snapshotID
+	rec.Metadata["snapshot.row"] = strconv.FormatInt(row, 10)
+	rec.Metadata["snapshot.chunk"] = strconv.FormatInt((row-1)/snapshotChunkSize+1, 10)
+	return rec
+}
+
+// newSnapshotID returns a random ID for a snapshot run.
+func newSnapshotID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
 // withTimestampNow is used when no column name for records' timestamp
 // field is set.
 func withTimestampNow(rec sdk.Record) sdk.Record {
@@ -178,39 +391,80 @@ func withTimestampNow(rec sdk.Record) sdk.Record {
 	return rec
 }
 
-// withPayload builds a record's payload from *sql.Rows.
-func withPayload(rec sdk.Record, rows pgx.Rows, columns []string, key string) (sdk.Record, error) {
+// withPayload builds a record's payload from *sql.Rows. The key is masked
+// like the payload, the unmasked value of the key column is returned as well,
+// since pages continue after it.
+func withPayload(rec sdk.Record, rows pgx.Rows, key string, filter *columnfilter.Filter) (sdk.Record, pgtype.Value, error) {
 	// get the column types for those rows and record them as well
 	colTypes := rows.FieldDescriptions()
 
 	// make a new slice of correct pgtypes to scan into
-	vals := make([]interface{}, len(columns))
-	for i := range columns {
+	vals := make([]interface{}, len(colTypes))
+	for i := range colTypes {
 		vals[i] = oidToScannerValue(pgtype.OID(colTypes[i].DataTypeOID))
 	}
 
 	// build the payload from the row
 	err := rows.Scan(vals...)
 	if err != nil {
-		return sdk.Record{}, fmt.Errorf("failed to scan: %w", err)
+		return sdk.Record{}, nil, fmt.Errorf("failed to scan: %w", err)
 	}
 
+	var keyValue pgtype.Value
 	payload := make(sdk.StructuredData)
-	for i, col := range columns {
+	for i, fd := range colTypes {
+		col := string(fd.Name)
 		val := vals[i].(pgtype.Value)
 
+		field := filter.Field(col)
+
 		// handle and assign the record a Key
 		if key == col {
 			// TODO: Handle composite keys
+			keyValue = val
+			masked, err := filter.Mask(col, val.Get())
+			if err != nil {
+				return sdk.Record{}, nil, fmt.Errorf("failed to mask key column %q: %w", col, err)
+			}
 			rec.Key = sdk.StructuredData{
-				col: val.Get(),
+				field: masked,
 			}
 		}
-		payload[col] = val.Get()
+
+		v, ok, err := filter.Apply(col, val.Get())
+		if err != nil {
+			return sdk.Record{}, nil, err
+		}
+		if !ok {
+			continue
+		}
+		if _, dup := payload[field]; dup {
+			return sdk.Record{}, nil, fmt.Errorf("column %q has the same field name %q as another column", col, field)
+		}
+		payload[field] = v
 	}
 
 	rec.Payload = payload
-	return rec, nil
+	return rec, keyValue, nil
+}
+
+// keyText returns the text representation of the key value.
+func keyText(val pgtype.Value) (string, error) {
+	if enc, ok := val.(pgtype.TextEncoder); ok {
+		buf, err := enc.EncodeText(nil, []byte{})
+		if err != nil {
+			return "", err
+		}
+		if buf == nil {
+			return "", errors.New("key is NULL")
+		}
+		return string(buf), nil
+	}
+	// types without a pgtype implementation are scanned as text
+	if text, ok := val.Get().(string); ok {
+		return text, nil
+	}
+	return "", fmt.Errorf("keys of type %T can't be converted to text", val)
 }
 
 type scannerValue interface {
@@ -17,6 +17,8 @@ package longpoll
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strconv"
 	"testing"
 
 	"github.com/conduitio/conduit-connector-postgres/test"
@@ -31,23 +33,133 @@ func TestSnapshotterReads(t *testing.T) {
 	conn := test.ConnectSimple(ctx, t, test.RegularConnString)
 	table := test.SetupTestTable(ctx, t, conn)
 
-	s, err := NewSnapshotIterator(ctx, conn, table,
-		[]string{"id", "column1", "key"}, "key")
+	s, err := NewSnapshotIterator(ctx, conn, SnapshotConfig{
+		Table:   table,
+		Columns: []string{"id", "column1", "key"},
+		Key:     "key",
+	})
 	is.NoErr(err)
 	i := 0
 	for {
-		_, err := s.Next(ctx)
+		rec, err := s.Next(ctx)
 		if err == ErrNoRows {
 			break
 		}
 		is.NoErr(err)
 		i++
+		is.Equal(rec.Metadata["action"], actionSnapshot)
+		is.Equal(rec.Metadata["snapshot.id"], s.snapshotID)
+		is.Equal(rec.Metadata["snapshot.row"], strconv.Itoa(i))
 	}
 	is.Equal(4, i)
 	is.NoErr(s.Teardown(ctx))
 	is.True(s.snapshotComplete == true) // failed to mark snapshot complete
 }
 
+func TestSnapshotterOrderBy(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	conn := test.ConnectSimple(ctx, t, test.RegularConnString)
+	table := test.SetupTestTable(ctx, t, conn)
+
+	s, err := NewSnapshotIterator(ctx, conn, SnapshotConfig{
+		Table:   table,
+		Columns: []string{"id", "column1", "key"},
+		Key:     "key",
+		OrderBy: "column2 DESC NULLS LAST",
+	})
+	is.NoErr(err)
+	rec, err := s.Next(ctx)
+	is.NoErr(err)
+	is.Equal(rec.Payload.(sdk.StructuredData)["column1"], "baz")
+	is.True(errors.Is(s.Teardown(ctx), ErrSnapshotInterrupt))
+}
+
+func TestSnapshotterFilter(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	conn := test.ConnectSimple(ctx, t, test.RegularConnString)
+	table := test.SetupTestTable(ctx, t, conn)
+
+	s, err := NewSnapshotIterator(ctx, conn, SnapshotConfig{
+		Table:   table,
+		Columns: []string{"id", "column1", "key"},
+		Key:     "key",
+		Filter:  "column2 > 200 OR column3",
+	})
+	is.NoErr(err)
+	var got []interface{}
+	for {
+		rec, err := s.Next(ctx)
+		if errors.Is(err, ErrNoRows) {
+			break
+		}
+		is.NoErr(err)
+		got = append(got, rec.Payload.(sdk.StructuredData)["column1"])
+	}
+	is.Equal(got, []interface{}{"bar", "baz"})
+	is.NoErr(s.Teardown(ctx))
+}
+
+func TestSnapshotterMaskKey(t *testing.T) {
+	ctx := context.Background()
+	is := is.New(t)
+
+	conn := test.ConnectSimple(ctx, t, test.RegularConnString)
+	table := test.SetupTestTable(ctx, t, conn)
+
+	s, err := NewSnapshotIterator(ctx, conn, SnapshotConfig{
+		Table:         table,
+		Columns:       []string{"id", "column1"},
+		Key:           "id",
+		HashColumns:   []string{"id"},
+		FetchSize:     2,
+		RedactColumns: []string{"column1"},
+	})
+	is.NoErr(err)
+	var got []interface{}
+	for {
+		rec, err := s.Next(ctx)
+		if errors.Is(err, ErrNoRows) {
+			break
+		}
+		is.NoErr(err)
+		key := rec.Key.(sdk.StructuredData)["id"]
+		is.Equal(key, rec.Payload.(sdk.StructuredData)["id"]) // key and payload are hashed the same way
+		got = append(got, key)
+	}
+	// pages continue after the unmasked key, so all rows are read once
+	is.Equal(len(got), 4)
+	is.Equal(got[0], "6b86b273ff34fce19d6b804eff5a3f5747ada4eaa22f1d49c01e52ddb7875b4b") // sha256("1")
+	is.NoErr(s.Teardown(ctx))
+
+	_, err = NewSnapshotIterator(ctx, conn, SnapshotConfig{
+		Table:          table,
+		Key:            "id",
+		ExcludeColumns: []string{"id"},
+	})
+	is.Equal(err.Error(), fmt.Sprintf("key column \"id\" of %s can't be excluded", table))
+}
+
+func TestWithSnapshotMetadata(t *testing.T) {
+	is := is.New(t)
+
+	rec := withSnapshotMetadata(sdk.Record{}, "abc", 1)
+	is.Equal(rec.Metadata, map[string]string{
+		"action":         actionSnapshot,
+		"snapshot.id":    "abc",
+		"snapshot.row":   "1",
+		"snapshot.chunk": "1",
+	})
+
+	rec = withSnapshotMetadata(sdk.Record{}, "abc", snapshotChunkSize)
+	is.Equal(rec.Metadata["snapshot.chunk"], "1")
+	rec = withSnapshotMetadata(sdk.Record{}, "abc", snapshotChunkSize+1)
+	is.Equal(rec.Metadata["snapshot.chunk"], "2")
+}
+
 func TestSnapshotterTeardown(t *testing.T) {
 	ctx := context.Background()
 	is := is.New(t)
@@ -55,8 +167,11 @@ func TestSnapshotterTeardown(t *testing.T) {
 	conn := test.ConnectSimple(ctx, t, test.RegularConnString)
 	table := test.SetupTestTable(ctx, t, conn)
 
-	s, err := NewSnapshotIterator(ctx, conn, table,
-		[]string{"id", "column1", "key"}, "key")
+	s, err := NewSnapshotIterator(ctx, conn, SnapshotConfig{
+		Table:   table,
+		Columns: []string{"id", "column1", "key"},
+		Key:     "key",
+	})
 	is.NoErr(err)
 	_, err = s.Next(ctx)
 	is.NoErr(err)
@@ -72,8 +187,11 @@ func TestPrematureDBClose(t *testing.T) {
 	conn := test.ConnectSimple(ctx, t, test.RegularConnString)
 	table := test.SetupTestTable(ctx, t, conn)
 
-	s, err := NewSnapshotIterator(ctx, conn, table,
-		[]string{"id", "column1", "key"}, "key")
+	s, err := NewSnapshotIterator(ctx, conn, SnapshotConfig{
+		Table:   table,
+		Columns: []string{"id", "column1", "key"},
+		Key:     "key",
+	})
 	is.NoErr(err)
 	teardownErr := s.Teardown(ctx)
 	is.True(errors.Is(teardownErr, ErrSnapshotInterrupt)) // failed to get snapshot interrupt error
@@ -16,10 +16,14 @@ package source
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/conduitio/conduit-connector-postgres/retry"
+	"github.com/conduitio/conduit-connector-postgres/source/collection"
 	"github.com/conduitio/conduit-connector-postgres/source/logrepl"
 	"github.com/conduitio/conduit-connector-postgres/source/longpoll"
+	"github.com/conduitio/conduit-connector-postgres/stats"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 	"github.com/jackc/pgx/v4"
 )
@@ -27,6 +31,7 @@ import (
 var (
 	_ Iterator = (*logrepl.CDCIterator)(nil)
 	_ Iterator = (*longpoll.SnapshotIterator)(nil)
+	_ Iterator = (*longpoll.PollingIterator)(nil)
 )
 
 // Source is a Postgres source plugin.
@@ -36,6 +41,10 @@ type Source struct {
 	iterator Iterator
 	config   Config
 	conn     *pgx.Conn
+	retry    *retry.Budget
+	// stats logs the counters of the source periodically, it is nil until
+	// the source is opened.
+	stats *stats.Logger
 }
 
 func NewSource() sdk.Source {
@@ -48,25 +57,73 @@ func (s *Source) Configure(ctx context.Context, cfgRaw map[string]string) error
 		return err
 	}
 	s.config = cfg
+	s.retry = retry.New(cfg.Retry)
 	return nil
 }
 func (s *Source) Open(ctx context.Context, pos sdk.Position) error {
-	conn, err := pgx.Connect(ctx, s.config.URL)
+	err := s.retry.Do(ctx, "connect", func(ctx context.Context) error {
+		conn, err := s.config.Session.Connect(ctx, s.config.URL)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
-	s.conn = conn
 
-	switch s.config.CDCMode {
+	if s.config.HealthCheck {
+		if err := s.checkHealth(ctx); err != nil {
+			return err
+		}
+	}
+
+	tableConfig := s.config.TableConfig(s.config.Table)
+	rel, err := s.lookupRelation(ctx)
+	if err != nil {
+		return err
+	}
+	if s.config.LongPollingRefreshMaterializedView && rel.kind != relKindMaterializedView {
+		return fmt.Errorf("%q requires %s to be a materialized view", ConfigKeyLongPollingRefreshMaterializedView, s.config.Table)
+	}
+	cdcMode := s.config.CDCMode
+	if cdcMode != CDCModeLongPolling && (rel.kind == relKindView || rel.kind == relKindMaterializedView) {
+		if cdcMode == CDCModeLogrepl || s.config.LogreplStartLSN > 0 || s.config.LogreplStopLSN > 0 {
+			return fmt.Errorf("logical replication can't capture changes of view %s, use %q %q", s.config.Table, ConfigKeyCDCMode, CDCModeLongPolling)
+		}
+		sdk.Logger(ctx).Info().
+			Str("table", s.config.Table).
+			Msg("table is a view, logical replication can't capture its changes, using long polling")
+		cdcMode = CDCModeLongPolling
+	}
+	switch cdcMode {
 	case CDCModeAuto:
 		// TODO add logic that checks if the DB supports logical replication and
 		//  switches to long polling if it's not. For now use logical replication
 		fallthrough
 	case CDCModeLogrepl:
+		var snapshot *longpoll.SnapshotConfig
 		if s.config.SnapshotMode == SnapshotModeInitial {
-			// TODO create snapshot iterator for logical replication and pass
-			//  the snapshot mode in the config
-			sdk.Logger(ctx).Warn().Msg("snapshot not supported in logical replication mode")
+			snapshot = &longpoll.SnapshotConfig{
+				Table:          s.config.Table,
+				Collection:     rel.collectionName(s.config.TableCollectionName(s.config.Table)),
+				Columns:        s.config.TableColumns(s.config.Table),
+				Key:            s.config.Key,
+				OrderBy:        tableConfig.OrderBy,
+				ExcludeColumns: tableConfig.ExcludeColumns,
+				HashColumns:    tableConfig.HashColumns,
+				RedactColumns:  tableConfig.RedactColumns,
+				Filter:         tableConfig.Filter,
+				FetchSize:      s.config.SnapshotFetchSize,
+				ColumnDefaults: s.config.SnapshotColumnDefaults,
+				FieldNames:     s.config.FieldNames,
+			}
+		}
+
+		var replicaIdentityIndex string
+		if s.config.LogreplReplicaIdentity == ReplicaIdentityModeIndex {
+			replicaIdentityIndex = s.config.LogreplReplicaIdentityIndex
 		}
 
 		i, err := logrepl.NewCDCIterator(ctx, s.conn, logrepl.Config{
@@ -74,38 +131,131 @@ func (s *Source) Open(ctx context.Context, pos sdk.Position) error {
 			SlotName:        s.config.LogreplSlotName,
 			PublicationName: s.config.LogreplPublicationName,
 			TableName:       s.config.Table,
+			CollectionName:  s.config.TableCollectionName(s.config.Table),
 			KeyColumnName:   s.config.Key,
-			Columns:         s.config.Columns,
+			Columns:         s.config.TableColumns(s.config.Table),
+			ExcludeColumns:  tableConfig.ExcludeColumns,
+			HashColumns:     tableConfig.HashColumns,
+			RedactColumns:   tableConfig.RedactColumns,
+			FieldNames:      s.config.FieldNames,
+			Filter:          tableConfig.Filter,
+			LagThreshold:    s.config.LogreplLagThreshold,
+			LagDuration:     s.config.LogreplLagDuration,
+
+			RetentionThreshold: s.config.LogreplRetentionThreshold,
+
+			CheckReplicaIdentity: s.config.LogreplReplicaIdentity != ReplicaIdentityModeIgnore,
+			ReplicaIdentityFull:  s.config.LogreplReplicaIdentity == ReplicaIdentityModeFull,
+			ReplicaIdentityIndex: replicaIdentityIndex,
+
+			EmitSchemaChanges: s.config.LogreplSchemaChanges == SchemaChangesModeRecord,
+			GroupTransactions: s.config.LogreplGroupTransactions,
+			StartLSN:          s.config.LogreplStartLSN,
+			StopLSN:           s.config.LogreplStopLSN,
+			CaptureSequences:  s.config.LogreplCaptureSequences,
+			SequencesInterval: s.config.LogreplSequencesInterval,
+			Snapshot:          snapshot,
+			ConnConfig: func() (*pgx.ConnConfig, error) {
+				return s.config.Session.ConnConfig(s.config.URL)
+			},
 		})
 		if err != nil {
 			return fmt.Errorf("failed to create logical replication iterator: %w", err)
 		}
 		s.iterator = i
 	case CDCModeLongPolling:
-		sdk.Logger(ctx).Warn().Msg("long polling not supported yet, only snapshot is supported")
-		if s.config.SnapshotMode != SnapshotModeInitial {
-			// TODO create long polling iterator and pass snapshot mode in the config
-			sdk.Logger(ctx).Warn().Msg("snapshot disabled, can't do anything right now")
-			return sdk.ErrUnimplemented
+		key, err := s.keyColumn(ctx)
+		if err != nil {
+			return err
 		}
-
-		snap, err := longpoll.NewSnapshotIterator(
-			ctx,
-			s.conn,
-			s.config.Table,
-			s.config.Columns,
-			s.config.Key)
+		i, err := longpoll.NewPollingIterator(ctx, s.conn, longpoll.PollingConfig{
+			Snapshot: longpoll.SnapshotConfig{
+				Table:          s.config.Table,
+				Collection:     rel.collectionName(s.config.TableCollectionName(s.config.Table)),
+				Columns:        s.config.TableColumns(s.config.Table),
+				Key:            key,
+				OrderBy:        tableConfig.OrderBy,
+				ExcludeColumns: tableConfig.ExcludeColumns,
+				HashColumns:    tableConfig.HashColumns,
+				RedactColumns:  tableConfig.RedactColumns,
+				Filter:         tableConfig.Filter,
+				FetchSize:      s.config.SnapshotFetchSize,
+				ColumnDefaults: s.config.SnapshotColumnDefaults,
+				FieldNames:     s.config.FieldNames,
+			},
+			Interval:                s.config.LongPollingInterval,
+			RefreshMaterializedView: s.config.LongPollingRefreshMaterializedView,
+			EmitSnapshot:            s.config.SnapshotMode == SnapshotModeInitial,
+			Position:                pos,
+		})
 		if err != nil {
 			return fmt.Errorf("failed to create long polling iterator: %w", err)
 		}
-		s.iterator = snap
+		s.iterator = i
 	default:
 		// shouldn't happen, config was validated
 		return fmt.Errorf("%q contains unsupported value %q, expected one of %v", ConfigKeyCDCMode, s.config.CDCMode, cdcModeAll)
 	}
+	s.stats = stats.New(s.config.StatsInterval, s.statsFields)
+	s.stats.Start(ctx)
 	return nil
 }
 
+const (
+	relKindView             = "v"
+	relKindMaterializedView = "m"
+)
+
+// relation describes the relation the connector reads.
+type relation struct {
+	// kind is the kind of the relation, as stored in pg_class.relkind.
+	kind   string
+	schema string
+	name   string
+}
+
+// collectionName returns the collection name of the relation, see
+// collection.Name.
+func (r relation) collectionName(template string) string {
+	return collection.Name(template, r.schema, r.name)
+}
+
+// lookupRelation returns the relation the connector reads.
+func (s *Source) lookupRelation(ctx context.Context) (relation, error) {
+	query := `SELECT c.relkind::text, n.nspname, c.relname
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.oid = $1::regclass`
+	var rel relation
+	err := s.conn.QueryRow(ctx, query, s.config.Table).Scan(&rel.kind, &rel.schema, &rel.name)
+	if err != nil {
+		return relation{}, fmt.Errorf("failed to look up table %s: %w", s.config.Table, err)
+	}
+	return rel, nil
+}
+
+// keyColumn returns the configured key column or the primary key column of
+// the table. Views have no primary key, so the key needs to be configured.
+func (s *Source) keyColumn(ctx context.Context) (string, error) {
+	if s.config.Key != "" {
+		return s.config.Key, nil
+	}
+	query := `SELECT a.attname
+		FROM pg_index i
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = i.indkey[0]
+		WHERE i.indrelid = $1::regclass AND i.indisprimary
+		LIMIT 1`
+	var key string
+	err := s.conn.QueryRow(ctx, query, s.config.Table).Scan(&key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("%s has no primary key, %q needs to be set", s.config.Table, ConfigKeyKey)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find key for table %s: %w", s.config.Table, err)
+	}
+	return key, nil
+}
+
 func (s *Source) Read(ctx context.Context) (sdk.Record, error) {
 	return s.iterator.Next(ctx)
 }
@@ -114,7 +264,42 @@ func (s *Source) Ack(ctx context.Context, pos sdk.Position) error {
 	return s.iterator.Ack(ctx, pos)
 }
 
+// SlotStats returns the health of the replication slot as observed by the
+// last check. It returns false if the source doesn't use logical replication.
+func (s *Source) SlotStats() (logrepl.SlotStats, bool) {
+	i, ok := s.iterator.(*logrepl.CDCIterator)
+	if !ok {
+		return logrepl.SlotStats{}, false
+	}
+	return i.SlotStats(), true
+}
+
+// Complete returns true once the source read all changes up to
+// "logrepl.stopLSN", Read returns sdk.ErrBackoffRetry from then on and the
+// pipeline can be stopped.
+func (s *Source) Complete() bool {
+	i, ok := s.iterator.(*logrepl.CDCIterator)
+	return ok && i.Complete()
+}
+
+// statsFields returns the counters logged periodically, see stats.Logger: the
+// retries, the health of the replication slot and whether "logrepl.stopLSN"
+// was reached.
+func (s *Source) statsFields() map[string]interface{} {
+	fields := s.retry.Stats().Fields()
+	if slot, ok := s.SlotStats(); ok {
+		for k, v := range slot.Fields() {
+			fields[k] = v
+		}
+	}
+	if s.config.LogreplStopLSN > 0 {
+		fields["complete"] = s.Complete()
+	}
+	return fields
+}
+
 func (s *Source) Teardown(ctx context.Context) error {
+	s.stats.Stop(ctx)
 	if s.iterator != nil {
 		if err := s.iterator.Teardown(ctx); err != nil {
 			return fmt.Errorf("failed to tear down iterator: %w", err)
@@ -26,16 +26,431 @@ func Specification() sdk.Specification {
 		Author:  "Meroxa, Inc.",
 		DestinationParams: map[string]sdk.Parameter{
 			"url": {
-				Default:     "true",
-				Required:    true,
-				Description: "connection url to the postgres destination.",
+				Default:     "",
+				Required:    false,
+				Description: "connection url to the postgres destination, can reference environment variables, e.g. ${PG_URL}. Required unless host is set.",
+			},
+			"host": {
+				Default:     "",
+				Required:    false,
+				Description: "Host of the database, overrides the host in url.",
+			},
+			"port": {
+				Default:     "",
+				Required:    false,
+				Description: "Port of the database, overrides the port in url.",
+			},
+			"user": {
+				Default:     "",
+				Required:    false,
+				Description: "User name, overrides the user in url.",
+			},
+			"password": {
+				Default:     "",
+				Required:    false,
+				Description: "Password, overrides the password in url. Can reference an environment variable, e.g. ${PG_PASSWORD}.",
+			},
+			"dbname": {
+				Default:     "",
+				Required:    false,
+				Description: "Name of the database, overrides the database in url.",
+			},
+			"schema": {
+				Default:     "",
+				Required:    false,
+				Description: "Schema of tables whose name is not schema qualified. If empty, the table is looked up using the search_path of the session.",
+			},
+			"dedupColumn": {
+				Default:     "",
+				Required:    false,
+				Description: "Column that stores a hash of each record inserted into a keyless table. Records with an already stored hash are skipped. The column needs a unique index.",
+			},
+			"routeToPartitions": {
+				Default:     "false",
+				Required:    false,
+				Description: "Write records directly into the matching child partition when the target table is partitioned.",
+			},
+			"shardCount": {
+				Default:     "0",
+				Required:    false,
+				Description: "Number of tables rows are spread across by the hash of their key, rows are written into the table with the shard number appended to its name (e.g. orders_3). 0 disables sharding.",
+			},
+			"overridingSystemValue": {
+				Default:     "false",
+				Required:    false,
+				Description: "Write payload values into identity columns declared as GENERATED ALWAYS using OVERRIDING SYSTEM VALUE instead of skipping them.",
+			},
+			"jsonMergeColumns": {
+				Default:     "",
+				Required:    false,
+				Description: "Comma-separated list of jsonb columns that are merged with the existing document on upsert instead of being replaced.",
+			},
+			"dialect": {
+				Default:     "postgres",
+				Required:    false,
+				Description: "SQL dialect of the target database, one of postgres, cockroachdb, timescaledb or redshift.",
+			},
+			"createKeyIndex": {
+				Default:     "false",
+				Required:    false,
+				Description: "Create a unique index on the key column of the configured table when the destination is opened, if none exists.",
+			},
+			"trackPositions": {
+				Default:     "false",
+				Required:    false,
+				Description: "Store the position of the last written record in the table _conduit_positions in the same transaction as the record and skip already written records after a restart.",
+			},
+			"positionId": {
+				Default:     "",
+				Required:    false,
+				Description: "Identifies the destination in the tables _conduit_positions and _conduit_written_positions, required if trackPositions or dedupWindow is set.",
+			},
+			"dedupWindow": {
+				Default:     "0",
+				Required:    false,
+				Description: "Number of recently written record positions stored in the table _conduit_written_positions in the same transaction as the records. Records whose position is among them are skipped. If 0, no positions are stored.",
+			},
+			"writeHistory": {
+				Default:     "false",
+				Required:    false,
+				Description: "Mirror each applied change into the table <table>_history, in the same transaction as the change. The table is created if it doesn't exist.",
+			},
+			"maxRecordsPerSecond": {
+				Default:     "0",
+				Required:    false,
+				Description: "Maximum number of records written per second, writes block when the limit is reached. 0 disables the limit.",
+			},
+			"maxConcurrentWrites": {
+				Default:     "0",
+				Required:    false,
+				Description: "Maximum number of workers writing at the same time, requires writeConcurrency to be greater than 1. Writes block when the limit is reached. 0 disables the limit.",
+			},
+			"flattenObjects": {
+				Default:     "false",
+				Required:    false,
+				Description: "Write nested objects into columns prefixed with the field name instead of a single column. Objects written into json or jsonb columns are never flattened.",
+			},
+			"flattenSeparator": {
+				Default:     "_",
+				Required:    false,
+				Description: "Separator between the field name and the key of a flattened object.",
+			},
+			"includeFields": {
+				Default:     "",
+				Required:    false,
+				Description: "Comma-separated list of payload fields that are written, all other fields are dropped. Empty means all fields are written.",
+			},
+			"excludeFields": {
+				Default:     "",
+				Required:    false,
+				Description: "Comma-separated list of payload fields that are dropped before the record is written.",
+			},
+			"columnMapping.*": {
+				Default:     "",
+				Required:    false,
+				Description: "Column the value at a path in the payload is written into, * is replaced with the path, e.g. address.city or meta.tags[0].",
+			},
+			"columnExpression.*": {
+				Default:     "",
+				Required:    false,
+				Description: "SQL expression the value of the column * is written with, $value is replaced with the parameter of the value, e.g. lower($value).",
+			},
+			"conditionalUpdates": {
+				Default:     "false",
+				Required:    false,
+				Description: "Update a row only if it matches the row before the update contained in the payload.before metadata field, updates of changed rows are skipped.",
+			},
+			"validateWrites": {
+				Default:     "false",
+				Required:    false,
+				Description: "Read each written row back and log fields whose stored value doesn't match the record. Meant for debugging, doubles the number of queries.",
+			},
+			"generateKey": {
+				Default:     "",
+				Required:    false,
+				Description: "Generate the key of inserted records without a key, default leaves the key column to its DEFAULT, uuid writes a random UUID into keyColumnName and the record metadata.",
+			},
+			"timestampLayouts": {
+				Default:     "",
+				Required:    false,
+				Description: "Comma separated list of Go time layouts, or names like RFC3339, strings written into timestamp and timestamptz columns are parsed with.",
+			},
+			"assumeTimezone": {
+				Default:     "UTC",
+				Required:    false,
+				Description: "IANA timezone of parsed timestamps without an offset, values written into timestamp columns are converted into it.",
+			},
+			"strictTimestamps": {
+				Default:     "false",
+				Required:    false,
+				Description: "Fail writes of timestamps that match none of the timestamp layouts instead of leaving the cast to Postgres.",
+			},
+			"healthCheck": {
+				Default:     "false",
+				Required:    false,
+				Description: "Check that the table exists and the user can insert, update and delete its rows when the destination is opened, all problems are reported at once.",
+			},
+			"countRows": {
+				Default:     "false",
+				Required:    false,
+				Description: "Count the rows inserted, updated, deleted and skipped by writes, upserts tell inserts and updates apart with RETURNING. The counts are logged on teardown.",
+			},
+			"updateColumns": {
+				Default:     "",
+				Required:    false,
+				Description: "Comma separated list of the only columns overwritten when an upsert updates an existing row, all other columns are only written on insert.",
+			},
+			"excludeFromUpdate": {
+				Default:     "",
+				Required:    false,
+				Description: "Comma separated list of columns that are only written when an upsert inserts a row and never updated.",
+			},
+			"conflictTarget": {
+				Default:     "",
+				Required:    false,
+				Description: "Conflict target used in upserts instead of the key column, e.g. (lower(email)) WHERE deleted_at IS NULL or ON CONSTRAINT users_email_key. Needed for tables whose uniqueness is enforced by a partial or expression index.",
+			},
+			"bufferPath": {
+				Default:     "",
+				Required:    false,
+				Description: "File that buffers records until they are written into the database. If set, records are acknowledged once they are committed, while the database is unreachable records are buffered up to bufferMaxRecords.",
+			},
+			"bufferMaxRecords": {
+				Default:     "10000",
+				Required:    false,
+				Description: "Maximum number of records in the buffer, writes block while the buffer is full.",
+			},
+			"batchSize": {
+				Default:     "1",
+				Required:    false,
+				Description: "Maximum number of buffered records written in a single transaction. Only the last upsert or delete of each key is written and upserts with the same columns are combined into one statement. Requires bufferPath.",
+			},
+			"writeConcurrency": {
+				Default:     "1",
+				Required:    false,
+				Description: "Number of workers writing buffered records in parallel, each with its own connection. Records with the same key are written by the same worker in the order they were received. Requires bufferPath.",
+			},
+			"loadMode": {
+				Default:     "upsert",
+				Required:    false,
+				Description: "How snapshot records are written, upsert, truncateAndLoad or staged. In truncateAndLoad mode a table is truncated when a new snapshot run starts and snapshot records are written with COPY. In staged mode snapshot records are written with COPY into a staging table, whose rows replace the rows of the table in a single transaction once the snapshot is complete.",
+			},
+			"maxIdleTime": {
+				Default:     "0",
+				Required:    false,
+				Description: "Connections idle for longer than this duration are checked with a ping before the next write and reopened if the ping fails. 0 disables the check.",
+			},
+			"writeTimeout": {
+				Default:     "0",
+				Required:    false,
+				Description: "Maximum time of a single write attempt, including all statements of a batch. A timed out write is canceled on the server and retried on a new connection. 0 means no limit.",
+			},
+			"deferConstraints": {
+				Default:     "false",
+				Required:    false,
+				Description: "Defer deferrable constraints, e.g. foreign keys, until a batch is committed, so rows of related tables can arrive in any order within a batch. Requires batchSize to be greater than 1.",
+			},
+			"txIsolationLevel": {
+				Default:     "",
+				Required:    false,
+				Description: "Isolation level of batch transactions, one of readCommitted, repeatableRead or serializable. Batches failing with a serialization failure are repeated automatically. Requires batchSize to be greater than 1, the default isolation level of the session is used if empty.",
+			},
+			"sessionReplicationRole": {
+				Default:     "",
+				Required:    false,
+				Description: "The session_replication_role of the connections, one of origin, replica or local. With replica, writes don't fire triggers and foreign keys aren't checked. Requires a superuser or the SET privilege on the parameter.",
+			},
+			"initSQL": {
+				Default:     "",
+				Required:    false,
+				Description: "SQL statements separated by semicolons, executed once when the destination is opened, before it creates its own tables.",
+			},
+			"teardownSQL": {
+				Default:     "",
+				Required:    false,
+				Description: "SQL statements separated by semicolons, executed once when the destination is torn down.",
+			},
+			"dryRun": {
+				Default:     "false",
+				Required:    false,
+				Description: "Preview the SQL statements and their parameters instead of executing them. Catalog queries are still executed, so the destination needs to be able to connect to the database.",
+			},
+			"dryRunPath": {
+				Default:     "",
+				Required:    false,
+				Description: "File the statements previewed in dry run mode are appended to as JSON lines, they are logged if empty.",
+			},
+			"maxRecordSize": {
+				Default:     "0",
+				Required:    false,
+				Description: "Maximum size of the payload of a record in bytes, 0 means no limit. Records exceeding the limit are handled according to oversizedRecords.",
+			},
+			"oversizedRecords": {
+				Default:     "reject",
+				Required:    false,
+				Description: "Determines how records exceeding maxRecordSize are handled, either reject (fail the write), overflow (remove the largest fields and list them in overflowColumn) or deadLetter (write the record, with its payload compressed, into deadLetterTable).",
+			},
+			"overflowColumn": {
+				Default:     "",
+				Required:    false,
+				Description: "jsonb column listing the fields removed from oversized records and their size, required if oversizedRecords is overflow.",
+			},
+			"deadLetterTable": {
+				Default:     "",
+				Required:    false,
+				Description: "Table oversized records are written into, it is created if it doesn't exist. Required if oversizedRecords is deadLetter.",
+			},
+			"heavyFields": {
+				Default:     "",
+				Required:    false,
+				Description: "Comma separated list of payload fields kept out of the table, their values are compressed or written into a side table depending on heavyFieldsMode.",
+			},
+			"heavyFieldsMode": {
+				Default:     "compress",
+				Required:    false,
+				Description: "How heavy fields are written, either compress, which writes gzip compressed JSON into bytea columns, or sideTable, which writes them into the table with the suffix _heavy_fields.",
+			},
+			"outOfOrderRecords": {
+				Default:     "ignore",
+				Required:    false,
+				Description: "Handling of records older than the last record written for the same key, one of ignore, warn, skip or reject.",
+			},
+			"setCreatedAtColumn": {
+				Default:     "",
+				Required:    false,
+				Description: "Column set to now() when a row is inserted, it is not changed when the row is updated.",
+			},
+			"setUpdatedAtColumn": {
+				Default:     "",
+				Required:    false,
+				Description: "Column set to now() when a row is inserted or updated.",
+			},
+			"treatMissingAsNull": {
+				Default:     "false",
+				Required:    false,
+				Description: "Set columns missing in the payload to NULL when an existing row is updated, by default they keep their value. Fields explicitly set to null are always written as NULL.",
+			},
+			"fieldNameConversion": {
+				Default:     "none",
+				Required:    false,
+				Description: "Conversion applied to field names of the key and payload before they are used as column names, either none, snake_case (userId becomes user_id) or lowercase.",
+			},
+			"upsertMethod": {
+				Default:     "onConflict",
+				Required:    false,
+				Description: "Statement used to upsert records, either onConflict (INSERT ... ON CONFLICT) or merge (MERGE, Postgres 15+, falls back to onConflict on older servers).",
+			},
+			"logrepl.replicaIdentity": {
+				Default:     "check",
+				Required:    false,
+				Description: "Determines how the replica identity of the table is handled, either check (fail if updates and deletes don't contain the key), full (set it to FULL), index (set it to logrepl.replicaIdentityIndex) or ignore.",
+			},
+			"logrepl.replicaIdentityIndex": {
+				Default:     "",
+				Required:    false,
+				Description: "Name of the unique index used as replica identity if logrepl.replicaIdentity is index.",
+			},
+			"retry.maxAttempts": {
+				Default:     "1",
+				Required:    false,
+				Description: "Maximum number of times an operation is executed, 1 disables retries.",
+			},
+			"retry.maxElapsedTime": {
+				Default:     "0",
+				Required:    false,
+				Description: "Maximum time spent retrying an operation, 0 means no limit.",
+			},
+			"retry.codes": {
+				Default:     "^08,^25006$,^40001$,^40P01$,^53300$,^57P0[123]$",
+				Required:    false,
+				Description: "Comma-separated list of regular expressions matched against SQLSTATE codes of errors, matching errors are retried.",
+			},
+			"stats.interval": {
+				Default:     "1m",
+				Required:    false,
+				Description: "Interval in which the counters of the connector are logged, 0 only logs them on teardown.",
+			},
+			"session.searchPath": {
+				Default:     "",
+				Required:    false,
+				Description: "Schema search path of the session, used to resolve unqualified table names.",
+			},
+			"session.statementTimeout": {
+				Default:     "0",
+				Required:    false,
+				Description: "Statements running longer than the timeout are aborted, 0 means the server default is used.",
+			},
+			"session.lockTimeout": {
+				Default:     "0",
+				Required:    false,
+				Description: "Statements waiting longer than the timeout for a lock are aborted, 0 means the server default is used.",
+			},
+			"session.applicationName": {
+				Default:     "conduit-connector-postgres",
+				Required:    false,
+				Description: "Application name of the session shown in pg_stat_activity, overrides application_name in the URL.",
+			},
+			"session.hosts": {
+				Default:     "",
+				Required:    false,
+				Description: "Comma-separated list of host:port replacing the hosts in the URL, multiple hosts enable failover to the server accepting writes.",
+			},
+			"session.poolerCompatibility": {
+				Default:     "false",
+				Required:    false,
+				Description: "Make connections work through a connection pooler in transaction pooling mode (e.g. pgbouncer) by using the simple protocol instead of prepared statements. Can't be combined with session.searchPath, session.statementTimeout and session.lockTimeout.",
+			},
+			"session.keepalive": {
+				Default:     "0",
+				Required:    false,
+				Description: "Interval of TCP keepalive probes, so connections dropped by a firewall or the server are detected while they are idle. 0 uses the default of 5 minutes.",
+			},
+			"session.tlsServerName": {
+				Default:     "",
+				Required:    false,
+				Description: "Host name the server certificate is verified against and sent with SNI, overrides the host of the URL, e.g. when connecting through a tunnel.",
+			},
+			"session.awsIAMAuth": {
+				Default:     "false",
+				Required:    false,
+				Description: "Authenticate with an Amazon RDS IAM auth token signed with the AWS credentials from the environment instead of a password. Requires TLS.",
+			},
+			"session.awsRegion": {
+				Default:     "",
+				Required:    false,
+				Description: "Region of the RDS instance used to sign IAM auth tokens, defaults to the AWS_REGION environment variable.",
 			},
 		},
 		SourceParams: map[string]sdk.Parameter{
 			"url": {
 				Default:     "",
-				Required:    true,
-				Description: "Connection url to the postgres source.",
+				Required:    false,
+				Description: "Connection url to the postgres source, can reference environment variables, e.g. ${PG_URL}. Required unless host is set.",
+			},
+			"host": {
+				Default:     "",
+				Required:    false,
+				Description: "Host of the database, overrides the host in url.",
+			},
+			"port": {
+				Default:     "",
+				Required:    false,
+				Description: "Port of the database, overrides the port in url.",
+			},
+			"user": {
+				Default:     "",
+				Required:    false,
+				Description: "User name, overrides the user in url.",
+			},
+			"password": {
+				Default:     "",
+				Required:    false,
+				Description: "Password, overrides the password in url. Can reference an environment variable, e.g. ${PG_PASSWORD}.",
+			},
+			"dbname": {
+				Default:     "",
+				Required:    false,
+				Description: "Name of the database, overrides the database in url.",
 			},
 			"mode": {
 				Default:     "cdc",
@@ -57,16 +472,201 @@ func Specification() sdk.Specification {
 				Required:    false,
 				Description: "The column name used to populate record Keys. If no key is specified, the connector will attempt to lookup the table's primary key column. If no primary key column is found, then the source will return an error.",
 			},
+			"snapshotFetchSize": {
+				Default:     "0",
+				Required:    false,
+				Description: "Number of rows read per query when taking a snapshot. The snapshot is read in pages ordered by the key column. If 0, all rows are read with a single query.",
+			},
+			"snapshotColumnDefaults": {
+				Default:     "false",
+				Required:    false,
+				Description: "Add the default and generation expressions of the columns to the metadata of snapshot records, in postgres.columnDefaults and postgres.generatedColumns.",
+			},
+			"collectionName": {
+				Default:     "{table}",
+				Required:    false,
+				Description: "Template of the collection name stored in the table metadata field of records. {schema} is replaced with the schema and {table} with the name of the table.",
+			},
+			"fieldNames": {
+				Default:     "preserve",
+				Required:    false,
+				Description: "Determines how column names are turned into the field names of keys and payloads (allowed values: preserve, lowercase or snake_case).",
+			},
 			"logrepl.publicationName": {
 				Default:     "conduitpub",
 				Required:    false,
 				Description: "Determines which publication the CDC iterator consumes.",
 			},
+			"healthCheck": {
+				Default:     "false",
+				Required:    false,
+				Description: "Check that the table exists and can be read, and that wal_level and the user are set up for logical replication when the source is opened, all problems are reported at once.",
+			},
 			"logrepl.slotName": {
 				Default:     "conduitslot",
 				Required:    false,
 				Description: "Determines which replication slot the CDC iterator uses.",
 			},
+			"logrepl.lagThreshold": {
+				Default:     "0",
+				Required:    false,
+				Description: "Number of bytes the replication slot can lag behind the end of the WAL before a warning is logged, 0 disables the check.",
+			},
+			"logrepl.lagDuration": {
+				Default:     "5m",
+				Required:    false,
+				Description: "Time the replication lag or retained WAL needs to stay above logrepl.lagThreshold or logrepl.retentionThreshold before a warning is logged.",
+			},
+			"logrepl.retentionThreshold": {
+				Default:     "0",
+				Required:    false,
+				Description: "Number of WAL bytes the replication slot can retain on the server before a warning is logged, 0 disables the check.",
+			},
+			"logrepl.schemaChanges": {
+				Default:     "log",
+				Required:    false,
+				Description: "Determines how schema changes are handled, either log (log the change) or record (additionally emit a schema_change record).",
+			},
+			"logrepl.groupTransactions": {
+				Default:     "false",
+				Required:    false,
+				Description: "Hold back the changes of a transaction until it's committed and tag each record with its index in the transaction (postgres.txIndex) and the number of changes in the transaction (postgres.txSize).",
+			},
+			"logrepl.startLSN": {
+				Default:     "",
+				Required:    false,
+				Description: "LSN (e.g. 16/B374D848) after which changes are read in the first run of the pipeline. Requires snapshotMode never.",
+			},
+			"logrepl.stopLSN": {
+				Default:     "",
+				Required:    false,
+				Description: "LSN (e.g. 16/B374D848) at which logical replication stops, all transactions committed at or before it are read.",
+			},
+			"logrepl.captureSequences": {
+				Default:     "false",
+				Required:    false,
+				Description: "Emit a record with the action sequence containing the value of each sequence owned by a column of the table, once after the snapshot.",
+			},
+			"logrepl.sequencesInterval": {
+				Default:     "",
+				Required:    false,
+				Description: "Interval in which the values of sequences are captured again, changed values are emitted. Requires logrepl.captureSequences.",
+			},
+			"longPolling.interval": {
+				Default:     "10s",
+				Required:    false,
+				Description: "Time between two polls in the long_polling CDC mode, changes are detected by comparing the rows with the previous poll.",
+			},
+			"longPolling.refreshMaterializedView": {
+				Default:     "false",
+				Required:    false,
+				Description: "Refresh the materialized view before each poll in the long_polling CDC mode.",
+			},
+			"retry.maxAttempts": {
+				Default:     "1",
+				Required:    false,
+				Description: "Maximum number of times an operation is executed, 1 disables retries.",
+			},
+			"retry.maxElapsedTime": {
+				Default:     "0",
+				Required:    false,
+				Description: "Maximum time spent retrying an operation, 0 means no limit.",
+			},
+			"retry.codes": {
+				Default:     "^08,^25006$,^40001$,^40P01$,^53300$,^57P0[123]$",
+				Required:    false,
+				Description: "Comma-separated list of regular expressions matched against SQLSTATE codes of errors, matching errors are retried.",
+			},
+			"stats.interval": {
+				Default:     "1m",
+				Required:    false,
+				Description: "Interval in which the counters of the connector are logged, 0 only logs them on teardown.",
+			},
+			"session.searchPath": {
+				Default:     "",
+				Required:    false,
+				Description: "Schema search path of the session, used to resolve unqualified table names.",
+			},
+			"session.statementTimeout": {
+				Default:     "0",
+				Required:    false,
+				Description: "Statements running longer than the timeout are aborted, 0 means the server default is used.",
+			},
+			"session.lockTimeout": {
+				Default:     "0",
+				Required:    false,
+				Description: "Statements waiting longer than the timeout for a lock are aborted, 0 means the server default is used.",
+			},
+			"session.applicationName": {
+				Default:     "conduit-connector-postgres",
+				Required:    false,
+				Description: "Application name of the session shown in pg_stat_activity, overrides application_name in the URL.",
+			},
+			"session.hosts": {
+				Default:     "",
+				Required:    false,
+				Description: "Comma-separated list of host:port replacing the hosts in the URL, multiple hosts enable failover to the server accepting writes.",
+			},
+			"session.poolerCompatibility": {
+				Default:     "false",
+				Required:    false,
+				Description: "Make connections work through a connection pooler in transaction pooling mode (e.g. pgbouncer) by using the simple protocol instead of prepared statements. Can't be combined with session.searchPath, session.statementTimeout and session.lockTimeout.",
+			},
+			"session.keepalive": {
+				Default:     "0",
+				Required:    false,
+				Description: "Interval of TCP keepalive probes, so connections dropped by a firewall or the server are detected while they are idle. 0 uses the default of 5 minutes.",
+			},
+			"session.tlsServerName": {
+				Default:     "",
+				Required:    false,
+				Description: "Host name the server certificate is verified against and sent with SNI, overrides the host of the URL, e.g. when connecting through a tunnel.",
+			},
+			"session.awsIAMAuth": {
+				Default:     "false",
+				Required:    false,
+				Description: "Authenticate with an Amazon RDS IAM auth token signed with the AWS credentials from the environment instead of a password. Requires TLS.",
+			},
+			"session.awsRegion": {
+				Default:     "",
+				Required:    false,
+				Description: "Region of the RDS instance used to sign IAM auth tokens, defaults to the AWS_REGION environment variable.",
+			},
+			"tables.*.orderBy": {
+				Default:     "key column",
+				Required:    false,
+				Description: "Expression used to order the rows of a table when taking a snapshot, * is replaced with the table name.",
+			},
+			"tables.*.includeColumns": {
+				Default:     "",
+				Required:    false,
+				Description: "Comma-separated list of columns included in payloads of the table, takes precedence over columns.",
+			},
+			"tables.*.excludeColumns": {
+				Default:     "",
+				Required:    false,
+				Description: "Comma-separated list of columns removed from payloads of the table.",
+			},
+			"tables.*.hashColumns": {
+				Default:     "",
+				Required:    false,
+				Description: "Comma-separated list of columns whose values are replaced with their SHA-256 hash.",
+			},
+			"tables.*.redactColumns": {
+				Default:     "",
+				Required:    false,
+				Description: "Comma-separated list of columns whose values are replaced with null.",
+			},
+			"tables.*.filter": {
+				Default:     "",
+				Required:    false,
+				Description: "SQL expression rows of a table need to match to be read. Used in snapshot queries and, on Postgres 15+, in the publication.",
+			},
+			"tables.*.collectionName": {
+				Default:     "",
+				Required:    false,
+				Description: "Template of the collection name of a table, overrides collectionName.",
+			},
 		},
 	}
 }
@@ -0,0 +1,132 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stats periodically logs the counters of a connector, e.g. its
+// retries, the health of the replication slot and the rows written. The SDK
+// has no API to export metrics, so the log line is the only way to observe
+// them in Conduit, the counters can only be read directly when the connector
+// is embedded. It is shared by the source and destination.
+package stats
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+const (
+	ConfigKeyInterval = "stats.interval"
+
+	// DefaultInterval is the default interval in which the stats are logged.
+	DefaultInterval = time.Minute
+)
+
+// ParseInterval parses the interval in which stats are logged, 0 disables the
+// periodic log line.
+func ParseInterval(cfgRaw map[string]string) (time.Duration, error) {
+	raw := cfgRaw[ConfigKeyInterval]
+	if raw == "" {
+		return DefaultInterval, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("%q contains unsupported value %q, expected a duration", ConfigKeyInterval, raw)
+	}
+	return d, nil
+}
+
+// Func returns the current values of counters, they are added to the fields
+// of the log line.
+type Func func() map[string]interface{}
+
+// Logger logs the counters returned by its functions in a single line every
+// interval.
+type Logger struct {
+	interval time.Duration
+	funcs    []Func
+
+	stop chan struct{}
+	done chan struct{}
+
+	// log is replaced in tests
+	log func(context.Context, map[string]interface{})
+}
+
+// New returns a Logger logging the counters returned by funcs.
+func New(interval time.Duration, funcs ...Func) *Logger {
+	return &Logger{
+		interval: interval,
+		funcs:    funcs,
+		log:      log,
+	}
+}
+
+// Start logs the stats every interval in a goroutine until Stop is called or
+// the context is canceled. It does nothing if the interval is 0.
+func (l *Logger) Start(ctx context.Context) {
+	if l == nil || l.interval == 0 || len(l.funcs) == 0 {
+		return
+	}
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	go func() {
+		defer close(l.done)
+		ticker := time.NewTicker(l.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-l.stop:
+				return
+			case <-ticker.C:
+				l.Log(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops the goroutine started by Start and logs the stats a last time,
+// so the totals are logged when the connector is torn down.
+func (l *Logger) Stop(ctx context.Context) {
+	if l == nil {
+		return
+	}
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+		l.stop = nil
+	}
+	l.Log(ctx)
+}
+
+// Log logs the current stats.
+func (l *Logger) Log(ctx context.Context) {
+	if len(l.funcs) == 0 {
+		return
+	}
+	fields := make(map[string]interface{})
+	for _, f := range l.funcs {
+		for k, v := range f() {
+			fields[k] = v
+		}
+	}
+	l.log(ctx, fields)
+}
+
+func log(ctx context.Context, fields map[string]interface{}) {
+	sdk.Logger(ctx).Info().Fields(fields).Msg("connector stats")
+}
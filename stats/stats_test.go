@@ -0,0 +1,101 @@
+// Copyright © 2022 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestParseInterval(t *testing.T) {
+	is := is.New(t)
+
+	d, err := ParseInterval(map[string]string{})
+	is.NoErr(err)
+	is.Equal(d, DefaultInterval)
+
+	d, err = ParseInterval(map[string]string{ConfigKeyInterval: "0"})
+	is.NoErr(err)
+	is.Equal(d, time.Duration(0))
+
+	_, err = ParseInterval(map[string]string{ConfigKeyInterval: "-1s"})
+	is.Equal(err, errors.New(`"stats.interval" contains unsupported value "-1s", expected a duration`))
+}
+
+func TestLogger(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	var retries uint64
+	l := New(time.Millisecond,
+		func() map[string]interface{} {
+			return map[string]interface{}{"retries": atomic.LoadUint64(&retries)}
+		},
+		func() map[string]interface{} {
+			return map[string]interface{}{"complete": false}
+		},
+	)
+	logged := make(chan map[string]interface{}, 100)
+	l.log = func(_ context.Context, fields map[string]interface{}) {
+		logged <- fields
+	}
+
+	l.Start(ctx)
+	atomic.StoreUint64(&retries, 3)
+	// the fields of all functions are logged in one line, until the counter
+	// change shows up
+	for {
+		fields := <-logged
+		is.Equal(len(fields), 2)
+		is.Equal(fields["complete"], false)
+		if fields["retries"] == uint64(3) {
+			break
+		}
+	}
+
+	// the stats are logged a last time when the logger stops
+	l.Stop(ctx)
+	for len(logged) > 1 {
+		<-logged
+	}
+	is.Equal((<-logged)["retries"], uint64(3))
+	is.Equal(len(logged), 0)
+}
+
+func TestLogger_Disabled(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	var calls int
+	l := New(0, func() map[string]interface{} {
+		calls++
+		return nil
+	})
+	l.log = func(context.Context, map[string]interface{}) {}
+
+	// no goroutine is started, only Stop logs the stats
+	l.Start(ctx)
+	l.Stop(ctx)
+	is.Equal(calls, 1)
+
+	var nilLogger *Logger
+	nilLogger.Start(ctx)
+	nilLogger.Stop(ctx)
+}